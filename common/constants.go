@@ -122,6 +122,12 @@ var BatchUpdateInterval int
 
 var RelayTimeout int // unit is second
 
+// MetricsToken 访问 /metrics 的 Bearer Token，为空时需要管理员权限
+var MetricsToken string
+
+// MetricsListenAddr 不为空时 /metrics 在该地址单独监听，不需要鉴权
+var MetricsListenAddr string
+
 var GeminiSafetySetting string
 
 // https://docs.cohere.com/docs/safety-modes Type; NONE/CONTEXTUAL/STRICT
@@ -129,6 +135,8 @@ var CohereSafetySetting string
 
 const (
 	RequestIdKey = "X-Oneapi-Request-Id"
+	// 实际提供服务的模型，触发模型回退时与请求的模型不同
+	ServedModelHeaderKey = "X-Oneapi-Served-Model"
 )
 
 const (
@@ -0,0 +1,186 @@
+package event
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/QuantumNous/new-api/common"
+
+	"github.com/bytedance/gopkg/util/gopool"
+)
+
+type Type string
+
+const (
+	ChannelDisabled     Type = "channel.disabled"
+	ChannelEnabled      Type = "channel.enabled"
+	ChannelKeyExhausted Type = "channel.key_exhausted"
+	TopUpCompleted      Type = "topup.completed"
+	RedemptionUsed      Type = "redemption.used"
+	UserRegistered      Type = "user.registered"
+	TaskFinished        Type = "task.finished"
+	TaskFailed          Type = "task.failed"
+	BudgetReached       Type = "budget.reached"
+)
+
+// All 所有可订阅的事件类型
+var All = []Type{
+	ChannelDisabled,
+	ChannelEnabled,
+	ChannelKeyExhausted,
+	TopUpCompleted,
+	RedemptionUsed,
+	UserRegistered,
+	TaskFinished,
+	TaskFailed,
+	BudgetReached,
+}
+
+// userScoped 归属于某个用户的事件，普通用户只能订阅这些事件，且只会收到自己的事件
+var userScoped = map[Type]bool{
+	TopUpCompleted: true,
+	RedemptionUsed: true,
+	TaskFinished:   true,
+	TaskFailed:     true,
+	BudgetReached:  true,
+}
+
+func IsValid(t Type) bool {
+	for _, item := range All {
+		if item == t {
+			return true
+		}
+	}
+	return false
+}
+
+func IsUserScoped(t Type) bool {
+	return userScoped[t]
+}
+
+// UserScopedTypes 普通用户可订阅的事件类型
+func UserScopedTypes() []Type {
+	types := make([]Type, 0, len(userScoped))
+	for _, t := range All {
+		if userScoped[t] {
+			types = append(types, t)
+		}
+	}
+	return types
+}
+
+// Event 事件，UserId 为事件所属用户，系统事件为 0
+type Event struct {
+	Id        string `json:"id"`
+	Type      Type   `json:"type"`
+	UserId    int    `json:"user_id"`
+	CreatedAt int64  `json:"created_at"`
+	Data      any    `json:"data"`
+}
+
+type ChannelData struct {
+	ChannelId   int    `json:"channel_id"`
+	ChannelName string `json:"channel_name"`
+	Reason      string `json:"reason,omitempty"`
+}
+
+type TopUpData struct {
+	TradeNo       string  `json:"trade_no"`
+	PaymentMethod string  `json:"payment_method"`
+	Amount        int64   `json:"amount"`
+	Money         float64 `json:"money"`
+	Quota         int     `json:"quota"`
+}
+
+type RedemptionData struct {
+	RedemptionId int    `json:"redemption_id"`
+	Name         string `json:"name"`
+	Quota        int    `json:"quota"`
+}
+
+type UserData struct {
+	Username  string `json:"username"`
+	Email     string `json:"email,omitempty"`
+	InviterId int    `json:"inviter_id,omitempty"`
+}
+
+type TaskData struct {
+	TaskId     string `json:"task_id"`
+	Platform   string `json:"platform"`
+	Action     string `json:"action"`
+	Status     string `json:"status"`
+	FailReason string `json:"fail_reason,omitempty"`
+	Quota      int    `json:"quota"`
+}
+
+type BudgetData struct {
+	BudgetId    int    `json:"budget_id"`
+	SubjectType string `json:"subject_type"`
+	SubjectId   int    `json:"subject_id"`
+	Period      string `json:"period"`
+	Quota       int    `json:"quota"`
+	UsedQuota   int    `json:"used_quota"`
+	ResetTime   int64  `json:"reset_time"`
+}
+
+type Handler func(e *Event)
+
+var (
+	handlersLock sync.RWMutex
+	handlers     []Handler
+	syncHandlers []Handler
+)
+
+// Subscribe 注册事件处理函数，处理函数在独立的协程中执行
+func Subscribe(handler Handler) {
+	handlersLock.Lock()
+	defer handlersLock.Unlock()
+	handlers = append(handlers, handler)
+}
+
+// SubscribeSync 注册同步事件处理函数，处理函数在发布方的协程中执行，Publish 返回前已处理完成。
+// 用于需要可靠落库的订阅方（如写入 webhook 投递记录），处理函数应尽快返回
+func SubscribeSync(handler Handler) {
+	handlersLock.Lock()
+	defer handlersLock.Unlock()
+	syncHandlers = append(syncHandlers, handler)
+}
+
+// Publish 发布事件，同步处理函数执行完成后返回，其余处理函数异步执行
+func Publish(t Type, userId int, data any) {
+	handlersLock.RLock()
+	subscribers := handlers
+	syncSubscribers := syncHandlers
+	handlersLock.RUnlock()
+	if len(subscribers) == 0 && len(syncSubscribers) == 0 {
+		return
+	}
+	e := &Event{
+		Id:        "evt_" + common.GetRandomString(24),
+		Type:      t,
+		UserId:    userId,
+		CreatedAt: time.Now().Unix(),
+		Data:      data,
+	}
+	for _, handler := range syncSubscribers {
+		dispatch(handler, e)
+	}
+	if len(subscribers) == 0 {
+		return
+	}
+	gopool.Go(func() {
+		for _, handler := range subscribers {
+			dispatch(handler, e)
+		}
+	})
+}
+
+func dispatch(handler Handler, e *Event) {
+	defer func() {
+		if r := recover(); r != nil {
+			common.SysError(fmt.Sprintf("panic in event handler: type=%s, error=%v", e.Type, r))
+		}
+	}()
+	handler(e)
+}
@@ -5,6 +5,7 @@ import (
 	_ "embed"
 	"fmt"
 	"sync"
+	"time"
 
 	"github.com/QuantumNous/new-api/common"
 	"github.com/go-redis/redis/v8"
@@ -13,9 +14,25 @@ import (
 //go:embed lua/rate_limit.lua
 var rateLimitScript string
 
+//go:embed lua/token_bucket.lua
+var tokenBucketScript string
+
+//go:embed lua/concurrency.lua
+var concurrencyScript string
+
 type RedisLimiter struct {
 	client         *redis.Client
 	limitScriptSHA string
+	// TPM 与并发脚本使用 redis.Script 执行，Redis 重启或执行 SCRIPT FLUSH 后遇到 NOSCRIPT 时自动回退到 EVAL
+	tokenBucketScript *redis.Script
+	concurrencyScript *redis.Script
+}
+
+// TokenLimiter TPM 与并发限制，Redis 与内存实现共用
+type TokenLimiter interface {
+	ConsumeTokens(ctx context.Context, key string, requested int64, tpm int64, force bool) (bool, error)
+	AcquireConcurrency(ctx context.Context, key string, member string, limit int64, lease time.Duration) (bool, error)
+	ReleaseConcurrency(ctx context.Context, key string, member string) error
 }
 
 var (
@@ -30,9 +47,19 @@ func New(ctx context.Context, r *redis.Client) *RedisLimiter {
 		if err != nil {
 			common.SysLog(fmt.Sprintf("Failed to load rate limit script: %v", err))
 		}
+		tokenBucket := redis.NewScript(tokenBucketScript)
+		if err = tokenBucket.Load(ctx, r).Err(); err != nil {
+			common.SysLog(fmt.Sprintf("Failed to load token bucket script: %v", err))
+		}
+		concurrency := redis.NewScript(concurrencyScript)
+		if err = concurrency.Load(ctx, r).Err(); err != nil {
+			common.SysLog(fmt.Sprintf("Failed to load concurrency script: %v", err))
+		}
 		instance = &RedisLimiter{
-			client:         r,
-			limitScriptSHA: limitSHA,
+			client:            r,
+			limitScriptSHA:    limitSHA,
+			tokenBucketScript: tokenBucket,
+			concurrencyScript: concurrency,
 		}
 	})
 
@@ -68,6 +95,47 @@ func (rl *RedisLimiter) Allow(ctx context.Context, key string, opts ...Option) (
 	return result == 1, nil
 }
 
+// ConsumeTokens 按 token 数扣减 TPM 令牌桶，force 为 true 时不检查余量直接扣减（requested 可为负数表示退还）
+func (rl *RedisLimiter) ConsumeTokens(ctx context.Context, key string, requested int64, tpm int64, force bool) (bool, error) {
+	forceArg := 0
+	if force {
+		forceArg = 1
+	}
+	result, err := rl.tokenBucketScript.Run(
+		ctx,
+		rl.client,
+		[]string{key},
+		requested,
+		tpm,
+		forceArg,
+	).Int()
+	if err != nil {
+		return false, fmt.Errorf("token rate limit failed: %w", err)
+	}
+	return result == 1, nil
+}
+
+// AcquireConcurrency 占用一个并发名额，lease 为名额的最长持有时间
+func (rl *RedisLimiter) AcquireConcurrency(ctx context.Context, key string, member string, limit int64, lease time.Duration) (bool, error) {
+	result, err := rl.concurrencyScript.Run(
+		ctx,
+		rl.client,
+		[]string{key},
+		member,
+		limit,
+		lease.Milliseconds(),
+	).Int()
+	if err != nil {
+		return false, fmt.Errorf("concurrency limit failed: %w", err)
+	}
+	return result == 1, nil
+}
+
+// ReleaseConcurrency 释放并发名额
+func (rl *RedisLimiter) ReleaseConcurrency(ctx context.Context, key string, member string) error {
+	return rl.client.ZRem(ctx, key, member).Err()
+}
+
 // Config 配置选项模式
 type Config struct {
 	Capacity  int64
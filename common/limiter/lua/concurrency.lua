@@ -0,0 +1,22 @@
+-- 并发数限制，使用有序集合记录在途请求，score 为获取时间
+-- KEYS[1]: 限流器唯一标识
+-- ARGV[1]: 请求唯一标识
+-- ARGV[2]: 最大并发数
+-- ARGV[3]: 租约时长（毫秒），超时未释放的请求视为已结束，防止进程崩溃导致计数泄漏
+
+local key = KEYS[1]
+local member = ARGV[1]
+local limit = tonumber(ARGV[2])
+local lease = tonumber(ARGV[3])
+
+local now = redis.call('TIME')
+local nowInMillis = tonumber(now[1]) * 1000 + math.floor(tonumber(now[2]) / 1000)
+
+redis.call('ZREMRANGEBYSCORE', key, '-inf', nowInMillis - lease)
+if redis.call('ZCARD', key) >= limit then
+    return 0
+end
+
+redis.call('ZADD', key, nowInMillis, member)
+redis.call('PEXPIRE', key, lease)
+return 1
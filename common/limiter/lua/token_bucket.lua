@@ -0,0 +1,42 @@
+-- 按 token 数计量的令牌桶，用于 TPM 限流
+-- KEYS[1]: 限流器唯一标识
+-- ARGV[1]: 本次消耗的 token 数，可为负数（按实际用量校正时退还）
+-- ARGV[2]: 每分钟 token 数（同时作为桶容量）
+-- ARGV[3]: 是否强制扣除 (1 表示不检查余量，用于按实际用量校正)
+
+local key = KEYS[1]
+local requested = tonumber(ARGV[1])
+local capacity = tonumber(ARGV[2])
+local force = tonumber(ARGV[3]) == 1
+local rate = capacity / 60000
+
+-- 获取当前时间（Redis服务器时间，毫秒）
+local now = redis.call('TIME')
+local nowInMillis = tonumber(now[1]) * 1000 + math.floor(tonumber(now[2]) / 1000)
+
+-- 获取桶状态
+local bucket = redis.call('HMGET', key, 'tokens', 'last_time')
+local tokens = tonumber(bucket[1])
+local last_time = tonumber(bucket[2])
+
+-- 初始化桶（首次请求或过期）
+if not tokens or not last_time then
+    tokens = capacity
+else
+    local elapsed = nowInMillis - last_time
+    tokens = math.min(capacity, tokens + elapsed * rate)
+end
+last_time = nowInMillis
+
+-- 桶满时允许超过容量的单个请求，否则大请求永远无法通过；欠下的 token 由后续补充抵消
+local allowed = false
+if force or tokens >= requested or tokens >= capacity then
+    tokens = math.min(capacity, tokens - requested)
+    allowed = true
+end
+
+redis.call('HMSET', key, 'tokens', tokens, 'last_time', last_time)
+-- 桶在一分钟内即可补满，过期后重新初始化与补满等价
+redis.call('PEXPIRE', key, 120000)
+
+return allowed and 1 or 0
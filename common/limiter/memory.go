@@ -0,0 +1,101 @@
+package limiter
+
+import (
+	"context"
+	"math"
+	"sync"
+	"time"
+)
+
+type memoryBucket struct {
+	tokens   float64
+	lastTime int64 // unix milli
+}
+
+// MemoryLimiter 未启用 Redis 时的单机实现，语义与 Lua 脚本一致
+type MemoryLimiter struct {
+	mutex       sync.Mutex
+	buckets     map[string]*memoryBucket
+	inflight    map[string]map[string]int64 // key -> member -> 获取时间 (unix milli)
+	lastCleanup int64
+}
+
+var memoryInstance = &MemoryLimiter{
+	buckets:  make(map[string]*memoryBucket),
+	inflight: make(map[string]map[string]int64),
+}
+
+func NewMemory() *MemoryLimiter {
+	return memoryInstance
+}
+
+func (ml *MemoryLimiter) ConsumeTokens(_ context.Context, key string, requested int64, tpm int64, force bool) (bool, error) {
+	ml.mutex.Lock()
+	defer ml.mutex.Unlock()
+	now := time.Now().UnixMilli()
+	ml.cleanup(now)
+
+	capacity := float64(tpm)
+	bucket, ok := ml.buckets[key]
+	if !ok {
+		bucket = &memoryBucket{tokens: capacity}
+		ml.buckets[key] = bucket
+	} else {
+		bucket.tokens = math.Min(capacity, bucket.tokens+float64(now-bucket.lastTime)*capacity/60000)
+	}
+	bucket.lastTime = now
+
+	if force || bucket.tokens >= float64(requested) || bucket.tokens >= capacity {
+		bucket.tokens = math.Min(capacity, bucket.tokens-float64(requested))
+		return true, nil
+	}
+	return false, nil
+}
+
+func (ml *MemoryLimiter) AcquireConcurrency(_ context.Context, key string, member string, limit int64, lease time.Duration) (bool, error) {
+	ml.mutex.Lock()
+	defer ml.mutex.Unlock()
+	now := time.Now().UnixMilli()
+	ml.cleanup(now)
+
+	members, ok := ml.inflight[key]
+	if !ok {
+		members = make(map[string]int64)
+		ml.inflight[key] = members
+	}
+	for m, acquiredAt := range members {
+		if now-acquiredAt > lease.Milliseconds() {
+			delete(members, m)
+		}
+	}
+	if int64(len(members)) >= limit {
+		return false, nil
+	}
+	members[member] = now
+	return true, nil
+}
+
+func (ml *MemoryLimiter) ReleaseConcurrency(_ context.Context, key string, member string) error {
+	ml.mutex.Lock()
+	defer ml.mutex.Unlock()
+	if members, ok := ml.inflight[key]; ok {
+		delete(members, member)
+		if len(members) == 0 {
+			delete(ml.inflight, key)
+		}
+	}
+	return nil
+}
+
+// cleanup 每分钟清理一次已补满的令牌桶，需持有 mutex
+func (ml *MemoryLimiter) cleanup(now int64) {
+	if now-ml.lastCleanup < 60000 {
+		return
+	}
+	ml.lastCleanup = now
+	for key, bucket := range ml.buckets {
+		if now-bucket.lastTime > 120000 {
+			delete(ml.buckets, key)
+		}
+	}
+}
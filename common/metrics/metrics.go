@@ -0,0 +1,270 @@
+// Package metrics 以 Prometheus 文本格式导出指标，仅实现本项目用到的 counter、gauge 与 histogram
+package metrics
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+const (
+	typeCounter   = "counter"
+	typeGauge     = "gauge"
+	typeHistogram = "histogram"
+)
+
+// DefaultBuckets 请求耗时的默认分桶（秒）
+var DefaultBuckets = []float64{0.1, 0.25, 0.5, 1, 2, 5, 10, 20, 30, 60, 120, 300}
+
+// Sample 采集时生成的单个指标值
+type Sample struct {
+	Labels []string
+	Value  float64
+}
+
+type collector interface {
+	name() string
+	write(w *bufio.Writer)
+}
+
+var (
+	registry     []collector
+	registryLock sync.RWMutex
+)
+
+func register(c collector) {
+	registryLock.Lock()
+	defer registryLock.Unlock()
+	registry = append(registry, c)
+}
+
+// WriteText 按注册顺序输出所有指标
+func WriteText(w io.Writer) error {
+	registryLock.RLock()
+	collectors := append([]collector(nil), registry...)
+	registryLock.RUnlock()
+	buf := bufio.NewWriter(w)
+	for _, c := range collectors {
+		c.write(buf)
+	}
+	return buf.Flush()
+}
+
+type desc struct {
+	metricName string
+	help       string
+	metricType string
+	labelNames []string
+}
+
+func (d *desc) name() string {
+	return d.metricName
+}
+
+func (d *desc) writeHeader(w *bufio.Writer) {
+	fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s %s\n", d.metricName, escapeHelp(d.help), d.metricName, d.metricType)
+}
+
+func (d *desc) formatLabels(values []string, extraName string, extraValue string) string {
+	if len(d.labelNames) == 0 && extraName == "" {
+		return ""
+	}
+	var b strings.Builder
+	b.WriteByte('{')
+	for i, labelName := range d.labelNames {
+		if i > 0 {
+			b.WriteByte(',')
+		}
+		value := ""
+		if i < len(values) {
+			value = values[i]
+		}
+		b.WriteString(labelName)
+		b.WriteString(`="`)
+		b.WriteString(escapeLabel(value))
+		b.WriteByte('"')
+	}
+	if extraName != "" {
+		if len(d.labelNames) > 0 {
+			b.WriteByte(',')
+		}
+		b.WriteString(extraName)
+		b.WriteString(`="`)
+		b.WriteString(extraValue)
+		b.WriteByte('"')
+	}
+	b.WriteByte('}')
+	return b.String()
+}
+
+func escapeHelp(s string) string {
+	return strings.NewReplacer(`\`, `\\`, "\n", `\n`).Replace(s)
+}
+
+func escapeLabel(s string) string {
+	return strings.NewReplacer(`\`, `\\`, "\n", `\n`, `"`, `\"`).Replace(s)
+}
+
+func formatFloat(v float64) string {
+	switch {
+	case math.IsInf(v, 1):
+		return "+Inf"
+	case math.IsInf(v, -1):
+		return "-Inf"
+	case math.IsNaN(v):
+		return "NaN"
+	}
+	return strconv.FormatFloat(v, 'g', -1, 64)
+}
+
+// 标签值以 \xff 拼接作为 map 的 key
+func labelKey(values []string) string {
+	return strings.Join(values, "\xff")
+}
+
+type series struct {
+	labels []string
+	value  float64
+}
+
+// CounterVec 带标签的累加计数器
+type CounterVec struct {
+	desc
+	mu     sync.Mutex
+	series map[string]*series
+}
+
+func NewCounterVec(name string, help string, labelNames ...string) *CounterVec {
+	c := &CounterVec{
+		desc:   desc{metricName: name, help: help, metricType: typeCounter, labelNames: labelNames},
+		series: make(map[string]*series),
+	}
+	register(c)
+	return c
+}
+
+// Add 增加计数，delta 小于 0 时忽略
+func (c *CounterVec) Add(delta float64, labelValues ...string) {
+	if delta < 0 {
+		return
+	}
+	key := labelKey(labelValues)
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	s, ok := c.series[key]
+	if !ok {
+		s = &series{labels: append([]string(nil), labelValues...)}
+		c.series[key] = s
+	}
+	s.value += delta
+}
+
+func (c *CounterVec) Inc(labelValues ...string) {
+	c.Add(1, labelValues...)
+}
+
+func (c *CounterVec) write(w *bufio.Writer) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.writeHeader(w)
+	for _, key := range sortedKeys(c.series) {
+		s := c.series[key]
+		fmt.Fprintf(w, "%s%s %s\n", c.metricName, c.formatLabels(s.labels, "", ""), formatFloat(s.value))
+	}
+}
+
+// GaugeFunc 在采集时调用 collect 生成当前值，适用于从数据库或缓存读取的状态
+type GaugeFunc struct {
+	desc
+	collect func() []Sample
+}
+
+func NewGaugeFunc(name string, help string, collect func() []Sample, labelNames ...string) *GaugeFunc {
+	g := &GaugeFunc{
+		desc:    desc{metricName: name, help: help, metricType: typeGauge, labelNames: labelNames},
+		collect: collect,
+	}
+	register(g)
+	return g
+}
+
+func (g *GaugeFunc) write(w *bufio.Writer) {
+	g.writeHeader(w)
+	for _, sample := range g.collect() {
+		fmt.Fprintf(w, "%s%s %s\n", g.metricName, g.formatLabels(sample.Labels, "", ""), formatFloat(sample.Value))
+	}
+}
+
+type histogramSeries struct {
+	labels []string
+	counts []uint64
+	count  uint64
+	sum    float64
+}
+
+// HistogramVec 带标签的直方图
+type HistogramVec struct {
+	desc
+	buckets []float64
+	mu      sync.Mutex
+	series  map[string]*histogramSeries
+}
+
+func NewHistogramVec(name string, help string, buckets []float64, labelNames ...string) *HistogramVec {
+	buckets = append([]float64(nil), buckets...)
+	sort.Float64s(buckets)
+	h := &HistogramVec{
+		desc:    desc{metricName: name, help: help, metricType: typeHistogram, labelNames: labelNames},
+		buckets: buckets,
+		series:  make(map[string]*histogramSeries),
+	}
+	register(h)
+	return h
+}
+
+func (h *HistogramVec) Observe(value float64, labelValues ...string) {
+	key := labelKey(labelValues)
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	s, ok := h.series[key]
+	if !ok {
+		s = &histogramSeries{labels: append([]string(nil), labelValues...), counts: make([]uint64, len(h.buckets))}
+		h.series[key] = s
+	}
+	for i, bound := range h.buckets {
+		if value <= bound {
+			s.counts[i]++
+		}
+	}
+	s.count++
+	s.sum += value
+}
+
+func (h *HistogramVec) write(w *bufio.Writer) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.writeHeader(w)
+	for _, key := range sortedKeys(h.series) {
+		s := h.series[key]
+		for i, bound := range h.buckets {
+			fmt.Fprintf(w, "%s_bucket%s %d\n", h.metricName, h.formatLabels(s.labels, "le", formatFloat(bound)), s.counts[i])
+		}
+		fmt.Fprintf(w, "%s_bucket%s %d\n", h.metricName, h.formatLabels(s.labels, "le", "+Inf"), s.count)
+		fmt.Fprintf(w, "%s_sum%s %s\n", h.metricName, h.formatLabels(s.labels, "", ""), formatFloat(s.sum))
+		fmt.Fprintf(w, "%s_count%s %d\n", h.metricName, h.formatLabels(s.labels, "", ""), s.count)
+	}
+}
+
+func sortedKeys[T any](m map[string]T) []string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
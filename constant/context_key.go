@@ -8,6 +8,8 @@ const (
 
 	ContextKeyOriginalModel    ContextKey = "original_model"
 	ContextKeyRequestStartTime ContextKey = "request_start_time"
+	// 触发模型回退时记录客户端请求的模型
+	ContextKeyModelFallbackFrom ContextKey = "model_fallback_from"
 
 	/* token related keys */
 	ContextKeyTokenUnlimited         ContextKey = "token_unlimited_quota"
@@ -17,6 +19,12 @@ const (
 	ContextKeyTokenSpecificChannelId ContextKey = "specific_channel_id"
 	ContextKeyTokenModelLimitEnabled ContextKey = "token_model_limit_enabled"
 	ContextKeyTokenModelLimit        ContextKey = "token_model_limit"
+	ContextKeyTokenTpmLimit          ContextKey = "token_tpm_limit"
+	ContextKeyTokenConcurrencyLimit  ContextKey = "token_concurrency_limit"
+	ContextKeyTokenRateLimitLease    ContextKey = "token_rate_limit_lease"
+	ContextKeyTokenModelFallback     ContextKey = "token_model_fallback"
+	ContextKeyTokenCallbackUrl       ContextKey = "token_callback_url"
+	ContextKeyTokenCallbackSecret    ContextKey = "token_callback_secret"
 
 	/* channel related keys */
 	ContextKeyChannelId                ContextKey = "channel_id"
@@ -49,4 +57,15 @@ const (
 	ContextKeyLocalCountTokens ContextKey = "local_count_tokens"
 
 	ContextKeySystemPromptOverride ContextKey = "system_prompt_override"
+
+	/* relay hedging related keys */
+	ContextKeyRelayHedgeContext ContextKey = "relay_hedge_context" // 对冲请求的上游请求上下文，落败时取消
+	ContextKeyRelayHedgeLost    ContextKey = "relay_hedge_lost"    // 对冲请求已落败，不计费
+
+	/* payload capture related keys */
+	ContextKeyPayloadCapture  ContextKey = "payload_capture"  // 当前请求的内容记录器
+	ContextKeyPayloadCaptured ContextKey = "payload_captured" // 当前请求的内容会被记录，日志中需关联 request_id
+
+	/* task related keys */
+	ContextKeySubmittedTask ContextKey = "submitted_task" // 本次请求提交成功的异步任务
 )
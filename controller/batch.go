@@ -0,0 +1,130 @@
+package controller
+
+import (
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/dto"
+	"github.com/QuantumNous/new-api/model"
+	"github.com/QuantumNous/new-api/service"
+
+	"github.com/gin-gonic/gin"
+)
+
+// 目前只支持 24 小时的完成时间窗口，与 OpenAI 一致
+const batchCompletionWindow = "24h"
+
+func CreateBatch(c *gin.Context) {
+	userId := c.GetInt("id")
+	var req dto.BatchCreateRequest
+	if err := common.UnmarshalBodyReusable(c, &req); err != nil {
+		openAIErrorResponse(c, http.StatusBadRequest, "invalid_request", "invalid request body")
+		return
+	}
+	if !service.SupportedBatchEndpoints[req.Endpoint] {
+		openAIErrorResponse(c, http.StatusBadRequest, "invalid_endpoint", fmt.Sprintf("endpoint %s is not supported", req.Endpoint))
+		return
+	}
+	if req.CompletionWindow != batchCompletionWindow {
+		openAIErrorResponse(c, http.StatusBadRequest, "invalid_completion_window", "completion_window must be 24h")
+		return
+	}
+	file, err := model.GetFileById(req.InputFileId, userId)
+	if err != nil {
+		openAIDataError(c, err, "file", req.InputFileId)
+		return
+	}
+	if file.Purpose != model.FilePurposeBatch {
+		openAIErrorResponse(c, http.StatusBadRequest, "invalid_input_file", "input file must be uploaded with purpose 'batch'")
+		return
+	}
+
+	now := time.Now()
+	batch := &model.Batch{
+		Id:               model.NewBatchId(),
+		UserId:           userId,
+		TokenId:          c.GetInt("token_id"),
+		ClientIp:         c.ClientIP(),
+		Endpoint:         req.Endpoint,
+		InputFileId:      req.InputFileId,
+		CompletionWindow: req.CompletionWindow,
+		Status:           model.BatchStatusValidating,
+		CreatedAt:        now.Unix(),
+		ExpiresAt:        now.Add(24 * time.Hour).Unix(),
+	}
+	if len(req.Metadata) > 0 {
+		data, _ := common.Marshal(req.Metadata)
+		batch.Metadata = string(data)
+	}
+	if err := batch.Insert(); err != nil {
+		common.SysError("failed to insert batch: " + err.Error())
+		openAIErrorResponse(c, http.StatusInternalServerError, "create_batch_failed", "failed to create batch")
+		return
+	}
+	c.JSON(http.StatusOK, batch.ToOpenAIBatch())
+}
+
+func GetBatch(c *gin.Context) {
+	id := c.Param("id")
+	batch, err := model.GetBatchById(id, c.GetInt("id"))
+	if err != nil {
+		openAIDataError(c, err, "batch", id)
+		return
+	}
+	c.JSON(http.StatusOK, batch.ToOpenAIBatch())
+}
+
+func ListBatches(c *gin.Context) {
+	limit := getListLimit(c)
+	batches, err := model.GetUserBatches(c.GetInt("id"), c.Query("after"), limit+1)
+	if err != nil {
+		openAIDataError(c, err, "batch", "")
+		return
+	}
+	hasMore := len(batches) > limit
+	if hasMore {
+		batches = batches[:limit]
+	}
+	resp := dto.OpenAIBatchList{
+		Object:  "list",
+		Data:    make([]dto.OpenAIBatch, 0, len(batches)),
+		HasMore: hasMore,
+	}
+	for _, batch := range batches {
+		resp.Data = append(resp.Data, batch.ToOpenAIBatch())
+	}
+	if len(resp.Data) > 0 {
+		resp.FirstId = resp.Data[0].Id
+		resp.LastId = resp.Data[len(resp.Data)-1].Id
+	}
+	c.JSON(http.StatusOK, resp)
+}
+
+func CancelBatch(c *gin.Context) {
+	id := c.Param("id")
+	userId := c.GetInt("id")
+	batch, err := model.GetBatchById(id, userId)
+	if err != nil {
+		openAIDataError(c, err, "batch", id)
+		return
+	}
+	if batch.Status != model.BatchStatusCancelling {
+		ok, err := model.CancelBatch(id, userId)
+		if err != nil {
+			openAIDataError(c, err, "batch", id)
+			return
+		}
+		if !ok {
+			openAIErrorResponse(c, http.StatusConflict, "batch_not_cancellable", fmt.Sprintf("cannot cancel a batch with status %s", batch.Status))
+			return
+		}
+	}
+	batch, err = model.GetBatchById(id, userId)
+	if err != nil {
+		openAIDataError(c, err, "batch", id)
+		return
+	}
+	c.JSON(http.StatusOK, batch.ToOpenAIBatch())
+}
@@ -63,6 +63,11 @@ func clearChannelInfo(channel *model.Channel) {
 	}
 }
 
+// fillChannelBreakerInfo 填充渠道的熔断状态，仅用于接口展示
+func fillChannelBreakerInfo(channel *model.Channel) {
+	channel.Breaker = model.GetChannelBreakerInfos(channel.Id)
+}
+
 func GetAllChannels(c *gin.Context) {
 	pageInfo := common.GetPageQuery(c)
 	channelData := make([]*model.Channel, 0)
@@ -139,6 +144,7 @@ func GetAllChannels(c *gin.Context) {
 
 	for _, datum := range channelData {
 		clearChannelInfo(datum)
+		fillChannelBreakerInfo(datum)
 	}
 
 	countQuery := model.DB.Model(&model.Channel{})
@@ -367,6 +373,7 @@ func SearchChannels(c *gin.Context) {
 
 	for _, datum := range pagedData {
 		clearChannelInfo(datum)
+		fillChannelBreakerInfo(datum)
 	}
 
 	c.JSON(http.StatusOK, gin.H{
@@ -394,6 +401,7 @@ func GetChannel(c *gin.Context) {
 	}
 	if channel != nil {
 		clearChannelInfo(channel)
+		fillChannelBreakerInfo(channel)
 	}
 	c.JSON(http.StatusOK, gin.H{
 		"success": true,
@@ -403,6 +411,30 @@ func GetChannel(c *gin.Context) {
 	return
 }
 
+// GetChannelHealth 获取渠道健康统计，可通过 id 参数过滤单个渠道
+func GetChannelHealth(c *gin.Context) {
+	stats := model.GetAllChannelHealthStats()
+	if idStr := c.Query("id"); idStr != "" {
+		id, err := strconv.Atoi(idStr)
+		if err != nil {
+			common.ApiError(c, err)
+			return
+		}
+		filtered := make([]model.ChannelHealthStats, 0)
+		for _, stat := range stats {
+			if stat.ChannelId == id {
+				filtered = append(filtered, stat)
+			}
+		}
+		stats = filtered
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "",
+		"data":    stats,
+	})
+}
+
 // GetChannelKey 获取渠道密钥（需要通过安全验证中间件）
 // 此函数依赖 SecureVerificationRequired 中间件，确保用户已通过安全验证
 func GetChannelKey(c *gin.Context) {
@@ -912,6 +944,8 @@ func UpdateChannel(c *gin.Context) {
 		return
 	}
 	model.InitChannelCache()
+	model.ResetChannelHealth(channel.Id)
+	model.ResetChannelBreaker(channel.Id)
 	service.ResetProxyClientCache()
 	channel.Key = ""
 	clearChannelInfo(&channel.Channel)
@@ -0,0 +1,53 @@
+package controller
+
+import (
+	"fmt"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/logger"
+	"github.com/QuantumNous/new-api/relay"
+	relaycommon "github.com/QuantumNous/new-api/relay/common"
+	"github.com/QuantumNous/new-api/relay/helper"
+	"github.com/QuantumNous/new-api/types"
+
+	"github.com/gin-gonic/gin"
+)
+
+// RelayCountTokens 处理 Claude /v1/messages/count_tokens 与 Gemini models/{model}:countTokens，
+// 仅计数不扣费，因此不经过预扣费与重试流程
+func RelayCountTokens(c *gin.Context, relayFormat types.RelayFormat) {
+	requestId := c.GetString(common.RequestIdKey)
+
+	var newAPIError *types.NewAPIError
+	defer func() {
+		if newAPIError != nil {
+			logger.LogError(c, fmt.Sprintf("count tokens error: %s", newAPIError.Error()))
+			newAPIError.SetMessage(common.MessageWithRequestId(newAPIError.Error(), requestId))
+			switch relayFormat {
+			case types.RelayFormatClaude:
+				c.JSON(newAPIError.StatusCode, gin.H{
+					"type":  "error",
+					"error": newAPIError.ToClaudeError(),
+				})
+			default:
+				c.JSON(newAPIError.StatusCode, gin.H{
+					"error": newAPIError.ToOpenAIError(),
+				})
+			}
+		}
+	}()
+
+	request, err := helper.GetAndValidateCountTokensRequest(c, relayFormat)
+	if err != nil {
+		newAPIError = types.NewError(err, types.ErrorCodeInvalidRequest)
+		return
+	}
+
+	relayInfo, err := relaycommon.GenRelayInfo(c, relayFormat, request, nil)
+	if err != nil {
+		newAPIError = types.NewError(err, types.ErrorCodeGenRelayInfoFailed)
+		return
+	}
+
+	newAPIError = relay.CountTokensHelper(c, relayInfo)
+}
@@ -0,0 +1,175 @@
+package controller
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/dto"
+	"github.com/QuantumNous/new-api/model"
+	"github.com/QuantumNous/new-api/service"
+	"github.com/QuantumNous/new-api/service/storage"
+	"github.com/QuantumNous/new-api/setting/system_setting"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+func openAIErrorResponse(c *gin.Context, statusCode int, code string, message string) {
+	c.JSON(statusCode, gin.H{
+		"error": dto.OpenAIError{
+			Message: common.MessageWithRequestId(message, c.GetString(common.RequestIdKey)),
+			Type:    "invalid_request_error",
+			Code:    code,
+		},
+	})
+}
+
+func openAIDataError(c *gin.Context, err error, name string, id string) {
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		openAIErrorResponse(c, http.StatusNotFound, "not_found", fmt.Sprintf("No such %s: %s", name, id))
+		return
+	}
+	common.SysError(fmt.Sprintf("failed to query %s %s: %s", name, id, err.Error()))
+	openAIErrorResponse(c, http.StatusInternalServerError, "query_data_error", "failed to query data")
+}
+
+func getListLimit(c *gin.Context) int {
+	limit, _ := strconv.Atoi(c.Query("limit"))
+	if limit <= 0 || limit > 100 {
+		limit = 20
+	}
+	return limit
+}
+
+func UploadFile(c *gin.Context) {
+	userId := c.GetInt("id")
+	purpose := c.PostForm("purpose")
+	if purpose != model.FilePurposeBatch {
+		openAIErrorResponse(c, http.StatusBadRequest, "invalid_purpose", "only purpose 'batch' is supported")
+		return
+	}
+	header, err := c.FormFile("file")
+	if err != nil {
+		openAIErrorResponse(c, http.StatusBadRequest, "missing_file", "file is required")
+		return
+	}
+	maxBytes := int64(system_setting.GetFileStorageSettings().MaxFileSizeMB) << 20
+	if maxBytes > 0 && header.Size > maxBytes {
+		openAIErrorResponse(c, http.StatusBadRequest, "file_too_large", fmt.Sprintf("file size exceeds the limit of %d MB", system_setting.GetFileStorageSettings().MaxFileSizeMB))
+		return
+	}
+	reader, err := header.Open()
+	if err != nil {
+		openAIErrorResponse(c, http.StatusBadRequest, "invalid_file", err.Error())
+		return
+	}
+	defer reader.Close()
+
+	file := &model.File{
+		Id:       model.NewFileId(),
+		UserId:   userId,
+		Purpose:  purpose,
+		Filename: header.Filename,
+		Status:   model.FileStatusProcessed,
+	}
+	file.StorageKey = service.FileStorageKey(userId, file.Id)
+	n, err := service.SaveFile(file.StorageKey, reader)
+	if err != nil {
+		common.SysError("failed to save file: " + err.Error())
+		openAIErrorResponse(c, http.StatusInternalServerError, "save_file_failed", "failed to save file")
+		return
+	}
+	file.Bytes = n
+	if err := file.Insert(); err != nil {
+		common.SysError("failed to insert file: " + err.Error())
+		openAIErrorResponse(c, http.StatusInternalServerError, "save_file_failed", "failed to save file")
+		return
+	}
+	c.JSON(http.StatusOK, file.ToOpenAIFile())
+}
+
+func ListFiles(c *gin.Context) {
+	userId := c.GetInt("id")
+	limit := getListLimit(c)
+	files, err := model.GetUserFiles(userId, c.Query("purpose"), c.Query("after"), limit+1)
+	if err != nil {
+		openAIDataError(c, err, "file", "")
+		return
+	}
+	hasMore := len(files) > limit
+	if hasMore {
+		files = files[:limit]
+	}
+	data := make([]dto.OpenAIFile, 0, len(files))
+	for _, file := range files {
+		data = append(data, file.ToOpenAIFile())
+	}
+	c.JSON(http.StatusOK, dto.OpenAIFileList{
+		Object:  "list",
+		Data:    data,
+		HasMore: hasMore,
+	})
+}
+
+func GetFile(c *gin.Context) {
+	id := c.Param("id")
+	file, err := model.GetFileById(id, c.GetInt("id"))
+	if err != nil {
+		openAIDataError(c, err, "file", id)
+		return
+	}
+	c.JSON(http.StatusOK, file.ToOpenAIFile())
+}
+
+func DeleteFile(c *gin.Context) {
+	id := c.Param("id")
+	userId := c.GetInt("id")
+	file, err := model.GetFileById(id, userId)
+	if err != nil {
+		openAIDataError(c, err, "file", id)
+		return
+	}
+	if err := model.DeleteFileById(id, userId); err != nil {
+		openAIDataError(c, err, "file", id)
+		return
+	}
+	if store, err := storage.Get(); err == nil {
+		if err := store.Delete(file.StorageKey); err != nil {
+			common.SysError(fmt.Sprintf("failed to delete file %s from storage: %s", id, err.Error()))
+		}
+	}
+	c.JSON(http.StatusOK, dto.OpenAIFileDeleteResponse{
+		Id:      id,
+		Object:  "file",
+		Deleted: true,
+	})
+}
+
+func GetFileContent(c *gin.Context) {
+	id := c.Param("id")
+	file, err := model.GetFileById(id, c.GetInt("id"))
+	if err != nil {
+		openAIDataError(c, err, "file", id)
+		return
+	}
+	store, err := storage.Get()
+	if err != nil {
+		openAIErrorResponse(c, http.StatusInternalServerError, "storage_error", err.Error())
+		return
+	}
+	reader, err := store.Open(file.StorageKey)
+	if err != nil {
+		common.SysError(fmt.Sprintf("failed to open file %s: %s", id, err.Error()))
+		openAIErrorResponse(c, http.StatusNotFound, "not_found", "file content is not available")
+		return
+	}
+	defer reader.Close()
+	c.Header("Content-Type", "application/octet-stream")
+	c.Header("Content-Disposition", fmt.Sprintf("attachment; filename=%q", file.Filename))
+	c.Status(http.StatusOK)
+	_, _ = io.Copy(c.Writer, reader)
+}
@@ -6,6 +6,7 @@ import (
 
 	"github.com/QuantumNous/new-api/common"
 	"github.com/QuantumNous/new-api/model"
+	"github.com/QuantumNous/new-api/service"
 
 	"github.com/gin-gonic/gin"
 )
@@ -167,3 +168,13 @@ func DeleteHistoryLogs(c *gin.Context) {
 	})
 	return
 }
+
+// GetPayloadCapture 按 request_id 获取请求内容记录
+func GetPayloadCapture(c *gin.Context) {
+	capture, err := service.GetPayloadCapture(c.Param("request_id"))
+	if err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	common.ApiSuccess(c, capture)
+}
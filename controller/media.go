@@ -0,0 +1,189 @@
+package controller
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/common/event"
+	"github.com/QuantumNous/new-api/constant"
+	"github.com/QuantumNous/new-api/dto"
+	"github.com/QuantumNous/new-api/model"
+	"github.com/QuantumNous/new-api/service"
+	"github.com/QuantumNous/new-api/setting/operation_setting"
+
+	"github.com/gin-gonic/gin"
+	"github.com/samber/lo"
+)
+
+// SubscribeTaskMediaStorage 订阅任务完成事件，将任务结果保存到文件存储
+func SubscribeTaskMediaStorage() {
+	event.Subscribe(func(e *event.Event) {
+		if e.Type != event.TaskFinished || !service.MediaStorageEnabled(model.MediaSourceTask) {
+			return
+		}
+		data, ok := e.Data.(event.TaskData)
+		if !ok {
+			return
+		}
+		task, exists, err := model.GetByTaskId(e.UserId, data.TaskId)
+		if err != nil || !exists {
+			return
+		}
+		persistTaskMedia(task)
+	})
+}
+
+// persistTaskMedia 下载任务结果，Suno 任务保存每首歌曲的音频，其余任务保存结果地址指向的文件
+func persistTaskMedia(task *model.Task) {
+	params := service.MediaSaveParams{
+		UserId:    task.UserId,
+		Group:     task.Group,
+		Source:    model.MediaSourceTask,
+		SourceId:  task.TaskID,
+		ModelName: task.Properties.OriginModelName,
+	}
+	if task.Platform == constant.TaskPlatformSuno {
+		var songs []dto.SunoSong
+		if err := json.Unmarshal(task.Data, &songs); err != nil {
+			return
+		}
+		for i, song := range songs {
+			if song.AudioURL == "" {
+				continue
+			}
+			params.Seq = i
+			params.Kind = model.MediaKindAudio
+			if _, err := service.SaveMediaAssetFromUrl(params, song.AudioURL); err != nil {
+				common.SysError(fmt.Sprintf("failed to save media of task %s: %v", task.TaskID, err))
+			}
+		}
+		return
+	}
+
+	if lo.Contains(model.MidjourneyTaskPlatforms, task.Platform) {
+		persistMidjourneyMedia(task, params)
+		return
+	}
+
+	channel, err := model.CacheGetChannel(task.ChannelId)
+	if err != nil {
+		return
+	}
+	// OpenAI 与 Gemini 的视频需要通过接口下载，其余平台的结果地址保存在 FailReason
+	if task.FailReason == "" && channel.Type != constant.ChannelTypeOpenAI && channel.Type != constant.ChannelTypeSora && channel.Type != constant.ChannelTypeGemini {
+		return
+	}
+	req, err := newTaskVideoRequest(context.Background(), task, channel)
+	if err != nil {
+		common.SysError(fmt.Sprintf("failed to create media request of task %s: %v", task.TaskID, err))
+		return
+	}
+	resp, err := service.GetMediaDownloadClient().Do(req)
+	if err == nil {
+		_, err = service.SaveMediaAssetFromResponse(params, resp)
+	}
+	if err != nil {
+		common.SysError(fmt.Sprintf("failed to save media of task %s: %v", task.TaskID, err))
+	}
+}
+
+// persistMidjourneyMedia 保存 Midjourney 任务生成的图片与视频
+func persistMidjourneyMedia(task *model.Task, params service.MediaSaveParams) {
+	var data dto.MidjourneyDto
+	if err := common.Unmarshal(task.Data, &data); err != nil {
+		return
+	}
+	for i, url := range []string{data.ImageUrl, data.VideoUrl} {
+		if url == "" {
+			continue
+		}
+		params.Seq = i
+		params.Kind = lo.Ternary(i == 0, model.MediaKindImage, model.MediaKindVideo)
+		if _, err := service.SaveMediaAssetFromUrl(params, url); err != nil {
+			common.SysError(fmt.Sprintf("failed to save media of midjourney task %s: %v", task.TaskID, err))
+		}
+	}
+}
+
+// GetMedia 通过签名地址访问保存的文件，无需令牌
+func GetMedia(c *gin.Context) {
+	id, _ := strconv.Atoi(c.Param("id"))
+	if id == 0 || !service.VerifyMediaSign(id, c.Query("expires"), c.Query("sign")) {
+		c.JSON(http.StatusForbidden, gin.H{
+			"error": gin.H{
+				"message": "Invalid or expired signature",
+				"type":    "invalid_request_error",
+			},
+		})
+		return
+	}
+	asset, err := model.GetMediaAssetById(id)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{
+			"error": gin.H{
+				"message": "Media not found",
+				"type":    "invalid_request_error",
+			},
+		})
+		return
+	}
+	service.ServeMediaAsset(c, asset)
+}
+
+type mediaAssetItem struct {
+	*model.MediaAsset
+	Url string `json:"url"`
+}
+
+// GetUserMediaAssets 分页查询当前用户保存的文件，返回的地址带签名
+func GetUserMediaAssets(c *gin.Context) {
+	pageInfo := common.GetPageQuery(c)
+	userId := c.GetInt("id")
+	assets, total, err := model.GetUserMediaAssets(userId, c.Query("kind"), pageInfo.GetStartIdx(), pageInfo.GetPageSize())
+	if err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	items := make([]*mediaAssetItem, 0, len(assets))
+	for _, asset := range assets {
+		items = append(items, &mediaAssetItem{MediaAsset: asset, Url: service.SignMediaUrl(asset)})
+	}
+	pageInfo.SetTotal(int(total))
+	pageInfo.SetItems(items)
+	common.ApiSuccess(c, pageInfo)
+}
+
+// GetUserMediaUsage 返回当前用户已使用与可用的存储空间（字节），上限为 0 表示不限制
+func GetUserMediaUsage(c *gin.Context) {
+	userId := c.GetInt("id")
+	usage, err := model.GetUserMediaUsage(userId)
+	if err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	group, _ := model.GetUserGroup(userId, false)
+	setting := operation_setting.GetMediaStorageSetting()
+	common.ApiSuccess(c, gin.H{
+		"used":           usage,
+		"limit":          setting.GetUserQuotaBytes(group),
+		"retention_days": setting.RetentionDays,
+	})
+}
+
+func DeleteUserMediaAsset(c *gin.Context) {
+	id, _ := strconv.Atoi(c.Param("id"))
+	asset, err := model.GetUserMediaAsset(c.GetInt("id"), id)
+	if err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	if err := service.DeleteMediaAsset(asset); err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	common.ApiSuccess(c, nil)
+}
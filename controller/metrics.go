@@ -0,0 +1,19 @@
+package controller
+
+import (
+	"net/http"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/common/metrics"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Metrics 以 Prometheus 文本格式输出指标
+func Metrics(c *gin.Context) {
+	c.Status(http.StatusOK)
+	c.Header("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	if err := metrics.WriteText(c.Writer); err != nil {
+		common.SysError("failed to write metrics: " + err.Error())
+	}
+}
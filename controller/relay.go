@@ -6,7 +6,9 @@ import (
 	"io"
 	"log"
 	"net/http"
+	"slices"
 	"strings"
+	"time"
 
 	"github.com/QuantumNous/new-api/common"
 	"github.com/QuantumNous/new-api/constant"
@@ -20,12 +22,15 @@ import (
 	"github.com/QuantumNous/new-api/relay/helper"
 	"github.com/QuantumNous/new-api/service"
 	"github.com/QuantumNous/new-api/setting"
+	"github.com/QuantumNous/new-api/setting/operation_setting"
 	"github.com/QuantumNous/new-api/types"
 
 	"github.com/bytedance/gopkg/util/gopool"
 
 	"github.com/gin-gonic/gin"
 	"github.com/gorilla/websocket"
+	"github.com/tidwall/gjson"
+	"github.com/tidwall/sjson"
 )
 
 func relayHandler(c *gin.Context, info *relaycommon.RelayInfo) *types.NewAPIError {
@@ -61,6 +66,19 @@ func geminiRelayHandler(c *gin.Context, info *relaycommon.RelayInfo) *types.NewA
 	return err
 }
 
+func relayAttempt(c *gin.Context, relayFormat types.RelayFormat, relayInfo *relaycommon.RelayInfo) *types.NewAPIError {
+	switch relayFormat {
+	case types.RelayFormatOpenAIRealtime:
+		return relay.WssHelper(c, relayInfo)
+	case types.RelayFormatClaude:
+		return relay.ClaudeHelper(c, relayInfo)
+	case types.RelayFormatGemini:
+		return geminiRelayHandler(c, relayInfo)
+	default:
+		return relayHandler(c, relayInfo)
+	}
+}
+
 func Relay(c *gin.Context, relayFormat types.RelayFormat) {
 
 	requestId := c.GetString(common.RequestIdKey)
@@ -70,8 +88,14 @@ func Relay(c *gin.Context, relayFormat types.RelayFormat) {
 	var (
 		newAPIError *types.NewAPIError
 		ws          *websocket.Conn
+		relayInfo   *relaycommon.RelayInfo
 	)
 
+	startTime := time.Now()
+	defer func() {
+		service.RecordRelayMetrics(c, relayInfo, startTime)
+	}()
+
 	if relayFormat == types.RelayFormatOpenAIRealtime {
 		var err error
 		ws, err = upgrader.Upgrade(c.Writer, c.Request, nil)
@@ -80,6 +104,9 @@ func Relay(c *gin.Context, relayFormat types.RelayFormat) {
 			return
 		}
 		defer ws.Close()
+	} else if capture := service.StartPayloadCapture(c); capture != nil {
+		// 在返回错误信息之后保存，错误响应也会被记录
+		defer capture.Finish()
 	}
 
 	defer func() {
@@ -108,7 +135,7 @@ func Relay(c *gin.Context, relayFormat types.RelayFormat) {
 		return
 	}
 
-	relayInfo, err := relaycommon.GenRelayInfo(c, relayFormat, request, ws)
+	relayInfo, err = relaycommon.GenRelayInfo(c, relayFormat, request, ws)
 	if err != nil {
 		newAPIError = types.NewError(err, types.ErrorCodeGenRelayInfoFailed)
 		return
@@ -116,11 +143,37 @@ func Relay(c *gin.Context, relayFormat types.RelayFormat) {
 
 	meta := request.GetTokenCountMeta()
 
-	if setting.ShouldCheckPromptSensitive() {
+	if relayFormat != types.RelayFormatOpenAIRealtime {
+		changed, policyErr := service.CheckRequestContentPolicy(c, meta.CombineText)
+		if policyErr != nil {
+			newAPIError = policyErr
+			return
+		}
+		if changed {
+			// 请求内容已被脱敏，重新解析请求体
+			request, err = helper.GetAndValidateRequest(c, relayFormat)
+			if err != nil {
+				newAPIError = types.NewError(err, types.ErrorCodeInvalidRequest)
+				return
+			}
+			relayInfo, err = relaycommon.GenRelayInfo(c, relayFormat, request, ws)
+			if err != nil {
+				newAPIError = types.NewError(err, types.ErrorCodeGenRelayInfoFailed)
+				return
+			}
+			meta = request.GetTokenCountMeta()
+		}
+
+		if policyWriter := service.NewContentPolicyWriter(c, relayFormat); policyWriter != nil {
+			c.Writer = policyWriter
+			defer policyWriter.Finish()
+		}
+	} else if setting.ShouldCheckPromptSensitive() {
+		// Realtime 请求无法改写或拦截流式内容，仅保留敏感词检查
 		contains, words := service.CheckSensitiveText(meta.CombineText)
 		if contains {
 			logger.LogWarn(c, fmt.Sprintf("user sensitive words detected: %s", strings.Join(words, ", ")))
-			newAPIError = types.NewError(err, types.ErrorCodeSensitiveWordsDetected)
+			newAPIError = types.NewError(fmt.Errorf("sensitive words detected"), types.ErrorCodeSensitiveWordsDetected)
 			return
 		}
 	}
@@ -133,20 +186,73 @@ func Relay(c *gin.Context, relayFormat types.RelayFormat) {
 
 	relayInfo.SetPromptTokens(tokens)
 
+	newAPIError = service.AcquireTokenRateLimit(c, relayInfo, tokens)
+	if newAPIError != nil {
+		return
+	}
+	defer service.ReleaseTokenRateLimit(c)
+
+	if common.GetContextKeyString(c, constant.ContextKeyModelFallbackFrom) != "" {
+		// 分发阶段主模型无可用渠道，已切换到回退模型
+		setRequestBodyModel(c, originalModel)
+	}
+	newAPIError = relayModel(c, relayFormat, relayInfo, group, tokens, meta)
+
+	// 主模型的所有渠道均失败或限流时，按回退链切换到下一个模型重新请求，跨格式转换由渠道适配器完成
+	requestedModel := originalModel
+	if fallbackFrom := common.GetContextKeyString(c, constant.ContextKeyModelFallbackFrom); fallbackFrom != "" {
+		requestedModel = fallbackFrom
+	}
+	fallbackModels := service.GetModelFallbackChain(c, group, requestedModel)
+	if index := slices.Index(fallbackModels, originalModel); index >= 0 {
+		fallbackModels = fallbackModels[index+1:]
+	}
+	for relayFormat != types.RelayFormatOpenAIRealtime && len(fallbackModels) > 0 && shouldFallbackModel(c, newAPIError) {
+		channel, fallbackModel := service.CacheGetFallbackChannel(c, group, fallbackModels)
+		if channel == nil {
+			break
+		}
+		fallbackModels = fallbackModels[slices.Index(fallbackModels, fallbackModel)+1:]
+		logger.LogWarn(c, fmt.Sprintf("模型 %s 请求失败，回退到模型 %s: %s", relayInfo.OriginModelName, fallbackModel, newAPIError.Error()))
+
+		if setupErr := middleware.SetupContextForSelectedChannel(c, channel, fallbackModel); setupErr != nil {
+			newAPIError = setupErr
+			break
+		}
+		common.SetContextKey(c, constant.ContextKeyModelFallbackFrom, requestedModel)
+		setRequestBodyModel(c, fallbackModel)
+		request.SetModelName(fallbackModel)
+		relayInfo, err = relaycommon.GenRelayInfo(c, relayFormat, request, ws)
+		if err != nil {
+			newAPIError = types.NewError(err, types.ErrorCodeGenRelayInfoFailed)
+			return
+		}
+		relayInfo.SetPromptTokens(tokens)
+		newAPIError = relayModel(c, relayFormat, relayInfo, group, tokens, meta)
+	}
+}
+
+// relayModel 按当前模型计价、预扣费并在该模型的渠道间重试，失败时退还预扣额度
+func relayModel(c *gin.Context, relayFormat types.RelayFormat, relayInfo *relaycommon.RelayInfo, group string, tokens int, meta *types.TokenCountMeta) (newAPIError *types.NewAPIError) {
+	originalModel := relayInfo.OriginModelName
+	c.Writer.Header().Set(common.ServedModelHeaderKey, originalModel)
+
 	priceData, err := helper.ModelPriceHelper(c, relayInfo, tokens, meta)
 	if err != nil {
-		newAPIError = types.NewError(err, types.ErrorCodeModelPriceError)
-		return
+		return types.NewError(err, types.ErrorCodeModelPriceError)
 	}
 
-	// common.SetContextKey(c, constant.ContextKeyTokenCountMeta, meta)
+	// 命中响应缓存时不请求渠道，也无需预扣费
+	if relay.ReplayResponseCache(c, relayInfo) {
+		return nil
+	}
 
 	if priceData.FreeModel {
 		logger.LogInfo(c, fmt.Sprintf("模型 %s 免费，跳过预扣费", relayInfo.OriginModelName))
 	} else {
 		newAPIError = service.PreConsumeQuota(c, priceData.QuotaToPreConsume, relayInfo)
 		if newAPIError != nil {
-			return
+			return newAPIError
 		}
 	}
 
@@ -157,6 +263,12 @@ func Relay(c *gin.Context, relayFormat types.RelayFormat) {
 		}
 	}()
 
+	// 指定渠道的请求与 Realtime 请求不进行对冲
+	hedgingDelay := operation_setting.GetRelayHedgingDelay(group)
+	if _, ok := c.Get("specific_channel_id"); ok || relayFormat == types.RelayFormatOpenAIRealtime {
+		hedgingDelay = 0
+	}
+
 	for i := 0; i <= common.RetryTimes; i++ {
 		channel, err := getChannel(c, group, originalModel, i)
 		if err != nil {
@@ -169,23 +281,22 @@ func Relay(c *gin.Context, relayFormat types.RelayFormat) {
 		requestBody, _ := common.GetRequestBody(c)
 		c.Request.Body = io.NopCloser(bytes.NewBuffer(requestBody))
 
-		switch relayFormat {
-		case types.RelayFormatOpenAIRealtime:
-			newAPIError = relay.WssHelper(c, relayInfo)
-		case types.RelayFormatClaude:
-			newAPIError = relay.ClaudeHelper(c, relayInfo)
-		case types.RelayFormatGemini:
-			newAPIError = geminiRelayHandler(c, relayInfo)
-		default:
-			newAPIError = relayHandler(c, relayInfo)
-		}
-
-		if newAPIError == nil {
-			return
+		if hedgingDelay > 0 {
+			// 对冲请求内部已记录各渠道的成功与失败
+			newAPIError = relayWithHedging(c, relayFormat, relayInfo, channel, group, originalModel, hedgingDelay)
+			if newAPIError == nil {
+				return nil
+			}
+		} else {
+			attemptStartTime := time.Now()
+			newAPIError = relayAttempt(c, relayFormat, relayInfo)
+			if newAPIError == nil {
+				recordChannelSuccess(c, channel.Id, relayInfo, attemptStartTime)
+				return nil
+			}
+			processChannelError(c, *types.NewChannelError(channel.Id, channel.Type, channel.Name, channel.ChannelInfo.IsMultiKey, common.GetContextKeyString(c, constant.ContextKeyChannelKey), channel.GetAutoBan()), newAPIError)
 		}
 
-		processChannelError(c, *types.NewChannelError(channel.Id, channel.Type, channel.Name, channel.ChannelInfo.IsMultiKey, common.GetContextKeyString(c, constant.ContextKeyChannelKey), channel.GetAutoBan()), newAPIError)
-
 		if !shouldRetry(c, newAPIError, common.RetryTimes-i) {
 			break
 		}
@@ -196,6 +307,35 @@ func Relay(c *gin.Context, relayFormat types.RelayFormat) {
 		retryLogStr := fmt.Sprintf("重试：%s", strings.Trim(strings.Join(strings.Fields(fmt.Sprint(useChannel)), "->"), "[]"))
 		logger.LogInfo(c, retryLogStr)
 	}
+	return newAPIError
+}
+
+// shouldFallbackModel 仅在渠道侧失败（渠道错误、限流、上游 5xx 或无可用渠道）时回退模型，
+// 请求本身的错误、指定渠道的请求以及已开始向客户端输出的请求不回退
+func shouldFallbackModel(c *gin.Context, err *types.NewAPIError) bool {
+	if err == nil || c.Writer.Written() {
+		return false
+	}
+	if _, ok := c.Get("specific_channel_id"); ok {
+		return false
+	}
+	if types.IsChannelError(err) || err.GetErrorCode() == types.ErrorCodeGetChannelFailed {
+		return true
+	}
+	return err.StatusCode == http.StatusTooManyRequests || err.StatusCode/100 == 5
+}
+
+// setRequestBodyModel 同步修改缓存的请求体中的模型名，保证透传请求体时使用回退模型
+func setRequestBodyModel(c *gin.Context, modelName string) {
+	requestBody, err := common.GetRequestBody(c)
+	if err != nil || !gjson.GetBytes(requestBody, "model").Exists() {
+		return
+	}
+	requestBody, err = sjson.SetBytes(requestBody, "model", modelName)
+	if err != nil {
+		return
+	}
+	c.Set(common.KeyRequestBody, requestBody)
 }
 
 var upgrader = websocket.Upgrader{
@@ -281,8 +421,31 @@ func shouldRetry(c *gin.Context, openaiErr *types.NewAPIError, retryTimes int) b
 	return true
 }
 
+// getUsingKeyIndex 返回当前使用的多 Key 索引，非多 Key 渠道返回 -1
+func getUsingKeyIndex(c *gin.Context) int {
+	if !common.GetContextKeyBool(c, constant.ContextKeyChannelIsMultiKey) {
+		return -1
+	}
+	return common.GetContextKeyInt(c, constant.ContextKeyChannelMultiKeyIndex)
+}
+
+func recordChannelSuccess(c *gin.Context, channelId int, relayInfo *relaycommon.RelayInfo, attemptStartTime time.Time) {
+	// 命中响应缓存时未请求渠道，不计入渠道健康统计
+	if relayInfo.ResponseCacheHit {
+		return
+	}
+	// 流式请求使用首字时间，非流式请求使用整个请求耗时
+	latency := time.Since(attemptStartTime)
+	if relayInfo.FirstResponseTime.After(attemptStartTime) {
+		latency = relayInfo.FirstResponseTime.Sub(attemptStartTime)
+	}
+	service.RecordChannelSuccess(channelId, getUsingKeyIndex(c), latency)
+}
+
 func processChannelError(c *gin.Context, channelError types.ChannelError, err *types.NewAPIError) {
 	logger.LogError(c, fmt.Sprintf("channel error (channel #%d, status code: %d): %s", channelError.ChannelId, err.StatusCode, err.Error()))
+	service.RecordChannelFailure(channelError.ChannelId, getUsingKeyIndex(c), err)
+	service.RecordUpstreamErrorMetric(channelError.ChannelId, err)
 	// 不要使用context获取渠道信息，异步处理时可能会出现渠道信息不一致的情况
 	// do not use context to get channel info, there may be inconsistent channel info when processing asynchronously
 	if service.ShouldDisableChannel(channelError.ChannelId, err) && channelError.AutoBan {
@@ -337,15 +500,15 @@ func RelayMidjourney(c *gin.Context) {
 	var mjErr *dto.MidjourneyResponse
 	switch relayInfo.RelayMode {
 	case relayconstant.RelayModeMidjourneyNotify:
-		mjErr = relay.RelayMidjourneyNotify(c)
+		mjErr = relayMidjourneyNotify(c)
 	case relayconstant.RelayModeMidjourneyTaskFetch, relayconstant.RelayModeMidjourneyTaskFetchByCondition:
 		mjErr = relay.RelayMidjourneyTask(c, relayInfo.RelayMode)
 	case relayconstant.RelayModeMidjourneyTaskImageSeed:
 		mjErr = relay.RelayMidjourneyTaskImageSeed(c)
-	case relayconstant.RelayModeSwapFace:
-		mjErr = relay.RelaySwapFace(c, relayInfo)
+	case relayconstant.RelayModeMidjourneyUpload:
+		mjErr = relay.RelayMidjourneyUpload(c, relayInfo)
 	default:
-		mjErr = relay.RelayMidjourneySubmit(c, relayInfo)
+		mjErr = relayMidjourneyTask(c, relayInfo)
 	}
 	//err = relayMidjourneySubmit(c, relayMode)
 	log.Println(mjErr)
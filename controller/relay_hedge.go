@@ -0,0 +1,315 @@
+package controller
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"runtime/debug"
+	"sync"
+	"time"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/constant"
+	"github.com/QuantumNous/new-api/logger"
+	"github.com/QuantumNous/new-api/middleware"
+	"github.com/QuantumNous/new-api/model"
+	relaycommon "github.com/QuantumNous/new-api/relay/common"
+	"github.com/QuantumNous/new-api/types"
+
+	"github.com/bytedance/gopkg/util/gopool"
+	"github.com/gin-gonic/gin"
+)
+
+var errRelayHedgeLost = errors.New("another hedged request has responded")
+
+// hedgeGate 决定并发的多个尝试中由谁向客户端输出，第一个写出数据的尝试胜出
+type hedgeGate struct {
+	mu       sync.Mutex
+	attempts []*hedgeAttempt
+	winner   *hedgeAttempt
+	decided  chan struct{}
+}
+
+type hedgeAttempt struct {
+	ctx       *gin.Context
+	info      *relaycommon.RelayInfo
+	channel   *model.Channel
+	startTime time.Time
+	cancel    context.CancelFunc
+	done      chan struct{}
+	err       *types.NewAPIError
+	lost      bool // 已被其他尝试抢先，由 hedgeGate.mu 保护
+}
+
+// register 登记新的尝试，已决出胜者时返回 false
+func (g *hedgeGate) register(attempt *hedgeAttempt) bool {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	if g.winner != nil {
+		return false
+	}
+	g.attempts = append(g.attempts, attempt)
+	return true
+}
+
+func (g *hedgeGate) getAttempts() []*hedgeAttempt {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	return append([]*hedgeAttempt(nil), g.attempts...)
+}
+
+func (g *hedgeGate) isWinner(attempt *hedgeAttempt) bool {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	return g.winner == attempt
+}
+
+// claim 尝试首次向客户端写出时调用，胜出时提交暂存的响应头，并取消其余仍在进行的尝试
+func (g *hedgeGate) claim(w *hedgeWriter) bool {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	if g.winner == nil {
+		g.winner = w.attempt
+		header := w.ResponseWriter.Header()
+		for key, values := range w.header {
+			header[key] = values
+		}
+		if w.status != 0 {
+			w.ResponseWriter.WriteHeader(w.status)
+		}
+		for _, attempt := range g.attempts {
+			if attempt == w.attempt || attempt.finished() {
+				continue
+			}
+			// 先标记落败再取消，保证落败的尝试在结算时不会计费
+			attempt.lost = true
+			common.SetContextKey(attempt.ctx, constant.ContextKeyRelayHedgeLost, true)
+			attempt.cancel()
+		}
+		close(g.decided)
+	}
+	return g.winner == w.attempt
+}
+
+// hedgeWriter 胜出前暂存响应头与状态码，落败后丢弃所有写入
+type hedgeWriter struct {
+	gin.ResponseWriter
+	gate    *hedgeGate
+	attempt *hedgeAttempt
+	header  http.Header
+	status  int
+}
+
+func (w *hedgeWriter) Header() http.Header {
+	if w.gate.isWinner(w.attempt) {
+		return w.ResponseWriter.Header()
+	}
+	return w.header
+}
+
+func (w *hedgeWriter) WriteHeader(code int) {
+	if w.gate.isWinner(w.attempt) {
+		w.ResponseWriter.WriteHeader(code)
+		return
+	}
+	w.status = code
+}
+
+func (w *hedgeWriter) WriteHeaderNow() {
+	if w.gate.claim(w) {
+		w.ResponseWriter.WriteHeaderNow()
+	}
+}
+
+func (w *hedgeWriter) Write(data []byte) (int, error) {
+	if !w.gate.claim(w) {
+		return 0, errRelayHedgeLost
+	}
+	return w.ResponseWriter.Write(data)
+}
+
+func (w *hedgeWriter) WriteString(s string) (int, error) {
+	if !w.gate.claim(w) {
+		return 0, errRelayHedgeLost
+	}
+	return w.ResponseWriter.WriteString(s)
+}
+
+func (w *hedgeWriter) Status() int {
+	if w.gate.isWinner(w.attempt) {
+		return w.ResponseWriter.Status()
+	}
+	if w.status != 0 {
+		return w.status
+	}
+	return http.StatusOK
+}
+
+func (w *hedgeWriter) Size() int {
+	if w.gate.isWinner(w.attempt) {
+		return w.ResponseWriter.Size()
+	}
+	return -1
+}
+
+func (w *hedgeWriter) Written() bool {
+	return w.gate.isWinner(w.attempt) && w.ResponseWriter.Written()
+}
+
+func (w *hedgeWriter) Flush() {
+	if w.gate.isWinner(w.attempt) {
+		w.ResponseWriter.Flush()
+	}
+}
+
+func newHedgeAttempt(c *gin.Context, info *relaycommon.RelayInfo, channel *model.Channel, writer gin.ResponseWriter, gate *hedgeGate) *hedgeAttempt {
+	// 上游请求随客户端断开一同取消，落败时单独取消
+	upstreamCtx, cancel := context.WithCancel(c.Request.Context())
+	attempt := &hedgeAttempt{
+		ctx:       c,
+		info:      info,
+		channel:   channel,
+		startTime: time.Now(),
+		cancel:    cancel,
+		done:      make(chan struct{}),
+	}
+	common.SetContextKey(c, constant.ContextKeyRelayHedgeContext, upstreamCtx)
+	c.Writer = &hedgeWriter{
+		ResponseWriter: writer,
+		gate:           gate,
+		attempt:        attempt,
+		header:         writer.Header().Clone(),
+	}
+	return attempt
+}
+
+func (attempt *hedgeAttempt) finished() bool {
+	select {
+	case <-attempt.done:
+		return true
+	default:
+		return false
+	}
+}
+
+func (attempt *hedgeAttempt) run(relayFormat types.RelayFormat) {
+	gopool.Go(func() {
+		defer close(attempt.done)
+		defer attempt.cancel()
+		defer func() {
+			if err := recover(); err != nil {
+				common.SysLog(fmt.Sprintf("panic detected: %v", err))
+				common.SysLog(fmt.Sprintf("stacktrace from panic: %s", string(debug.Stack())))
+				attempt.err = types.NewError(fmt.Errorf("panic detected: %v", err), types.ErrorCodeDoRequestFailed, types.ErrOptionWithSkipRetry())
+			}
+		}()
+		attempt.err = relayAttempt(attempt.ctx, relayFormat, attempt.info)
+	})
+}
+
+// relayWithHedging 在 delay 内未向客户端返回首字时，向另一个渠道发起相同的请求，
+// 先返回首字的请求胜出，另一个请求被取消且不计费，两个渠道都会记录到 use_channel 中。
+// 各尝试在各自的上下文副本上执行，全部结束后再将最终结果所在尝试的上下文写回 c
+func relayWithHedging(c *gin.Context, relayFormat types.RelayFormat, relayInfo *relaycommon.RelayInfo, channel *model.Channel, group, originalModel string, delay time.Duration) *types.NewAPIError {
+	originWriter := c.Writer
+	defer func() {
+		c.Writer = originWriter
+	}()
+	// Ping 会被当作首字，启用对冲时不发送
+	relayInfo.DisablePing = true
+
+	// 在主请求开始前准备对冲请求的上下文，避免继承主请求执行过程中写入的状态
+	hedgeCtx := c.Copy()
+	hedgeRequest := c.Request.Clone(c.Request.Context())
+	requestBody, _ := common.GetRequestBody(c)
+	hedgeRequest.Body = io.NopCloser(bytes.NewBuffer(requestBody))
+	hedgeCtx.Request = hedgeRequest
+	hedgeInfo := relayInfo.Clone()
+
+	gate := &hedgeGate{decided: make(chan struct{})}
+	primary := newHedgeAttempt(c.Copy(), relayInfo, channel, originWriter, gate)
+	gate.register(primary)
+	primary.run(relayFormat)
+
+	timer := time.NewTimer(delay)
+	select {
+	case <-gate.decided:
+	case <-primary.done:
+	case <-timer.C:
+		startHedgeAttempt(c, hedgeCtx, hedgeInfo, relayFormat, channel, group, originalModel, delay, originWriter, gate)
+	}
+	timer.Stop()
+
+	attempts := gate.getAttempts()
+	for _, attempt := range attempts {
+		<-attempt.done
+	}
+	result := finishHedging(gate, attempts)
+	useChannel := c.GetStringSlice("use_channel")
+	for key, value := range result.ctx.Keys {
+		c.Set(key, value)
+	}
+	c.Set("use_channel", useChannel)
+	return result.err
+}
+
+func startHedgeAttempt(c *gin.Context, hedgeCtx *gin.Context, hedgeInfo *relaycommon.RelayInfo, relayFormat types.RelayFormat, primaryChannel *model.Channel, group, originalModel string, delay time.Duration, writer gin.ResponseWriter, gate *hedgeGate) {
+	// 对冲请求发往与主请求同一优先级的其他渠道
+	selectGroup := group
+	if autoGroup := c.GetString("auto_group"); group == "auto" && autoGroup != "" {
+		selectGroup = autoGroup
+	}
+	channel, err := model.GetRandomSatisfiedChannelExcept(selectGroup, originalModel, primaryChannel.Id)
+	if err != nil {
+		logger.LogWarn(c, "skip relay hedging: "+err.Error())
+		return
+	}
+	if channel == nil {
+		logger.LogWarn(c, fmt.Sprintf("skip relay hedging: no channel other than #%d is available in the same priority", primaryChannel.Id))
+		return
+	}
+	if newAPIError := middleware.SetupContextForSelectedChannel(hedgeCtx, channel, originalModel); newAPIError != nil {
+		logger.LogWarn(c, "skip relay hedging: "+newAPIError.Error())
+		return
+	}
+
+	attempt := newHedgeAttempt(hedgeCtx, hedgeInfo, channel, writer, gate)
+	if !gate.register(attempt) {
+		return
+	}
+	addUsedChannel(c, channel.Id)
+	hedgeCtx.Set("use_channel", c.GetStringSlice("use_channel"))
+	logger.LogInfo(c, fmt.Sprintf("渠道 #%d 在 %s 内未返回首字，向渠道 #%d 发起对冲请求", primaryChannel.Id, delay, channel.Id))
+	attempt.run(relayFormat)
+}
+
+// finishHedging 记录各渠道的结果并返回作为最终结果的尝试，落败被取消的尝试不计入渠道健康统计
+func finishHedging(gate *hedgeGate, attempts []*hedgeAttempt) *hedgeAttempt {
+	winner := gate.winner
+	if winner == nil {
+		for _, attempt := range attempts {
+			if attempt.err == nil {
+				winner = attempt
+				break
+			}
+		}
+	}
+	for _, attempt := range attempts {
+		if attempt.lost {
+			continue
+		}
+		if attempt.err == nil {
+			recordChannelSuccess(attempt.ctx, attempt.channel.Id, attempt.info, attempt.startTime)
+			continue
+		}
+		channel := attempt.channel
+		processChannelError(attempt.ctx, *types.NewChannelError(channel.Id, channel.Type, channel.Name, channel.ChannelInfo.IsMultiKey, common.GetContextKeyString(attempt.ctx, constant.ContextKeyChannelKey), channel.GetAutoBan()), attempt.err)
+	}
+	if winner != nil {
+		return winner
+	}
+	return attempts[0]
+}
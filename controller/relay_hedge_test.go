@@ -0,0 +1,107 @@
+package controller
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/QuantumNous/new-api/constant"
+	"github.com/QuantumNous/new-api/model"
+	relaycommon "github.com/QuantumNous/new-api/relay/common"
+	"github.com/QuantumNous/new-api/service"
+
+	"github.com/gin-gonic/gin"
+)
+
+func newHedgeTestContext() (*gin.Context, *httptest.ResponseRecorder, context.CancelFunc) {
+	gin.SetMode(gin.TestMode)
+	recorder := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(recorder)
+	ctx, cancel := context.WithCancel(context.Background())
+	c.Request = httptest.NewRequest(http.MethodPost, "/v1/chat/completions", nil).WithContext(ctx)
+	return c, recorder, cancel
+}
+
+func upstreamContext(t *testing.T, attempt *hedgeAttempt) context.Context {
+	t.Helper()
+	value, ok := attempt.ctx.Get(string(constant.ContextKeyRelayHedgeContext))
+	if !ok {
+		t.Fatal("upstream context is not set")
+	}
+	return value.(context.Context)
+}
+
+func TestHedgeGateBilling(t *testing.T) {
+	tests := []struct {
+		name        string
+		firstWriter int
+	}{
+		{name: "primary wins", firstWriter: 0},
+		{name: "hedge wins", firstWriter: 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c, recorder, cancel := newHedgeTestContext()
+			defer cancel()
+			gate := &hedgeGate{decided: make(chan struct{})}
+			attempts := []*hedgeAttempt{
+				newHedgeAttempt(c.Copy(), &relaycommon.RelayInfo{}, &model.Channel{Id: 1}, c.Writer, gate),
+				newHedgeAttempt(c.Copy(), &relaycommon.RelayInfo{}, &model.Channel{Id: 2}, c.Writer, gate),
+			}
+			for _, attempt := range attempts {
+				if !gate.register(attempt) {
+					t.Fatal("register failed before a winner is decided")
+				}
+			}
+
+			winner := attempts[tt.firstWriter]
+			loser := attempts[1-tt.firstWriter]
+			winner.ctx.Writer.Header().Set("X-Attempt", "winner")
+			loser.ctx.Writer.Header().Set("X-Attempt", "loser")
+			if _, err := winner.ctx.Writer.WriteString("winner"); err != nil {
+				t.Fatalf("winner write: %v", err)
+			}
+			if _, err := loser.ctx.Writer.WriteString("loser"); !errors.Is(err, errRelayHedgeLost) {
+				t.Fatalf("loser write error = %v, want errRelayHedgeLost", err)
+			}
+
+			if service.IsRelayHedgeLost(winner.ctx) {
+				t.Error("winner must be billed")
+			}
+			if !service.IsRelayHedgeLost(loser.ctx) || !loser.lost {
+				t.Error("loser must not be billed")
+			}
+			if upstreamContext(t, winner).Err() != nil {
+				t.Error("winner upstream request must not be cancelled")
+			}
+			if upstreamContext(t, loser).Err() == nil {
+				t.Error("loser upstream request must be cancelled")
+			}
+			if got := recorder.Body.String(); got != "winner" {
+				t.Errorf("body = %q, want winner", got)
+			}
+			if got := recorder.Header().Get("X-Attempt"); got != "winner" {
+				t.Errorf("header = %q, want winner", got)
+			}
+			if gate.register(newHedgeAttempt(c.Copy(), &relaycommon.RelayInfo{}, &model.Channel{Id: 3}, c.Writer, gate)) {
+				t.Error("register must fail after a winner is decided")
+			}
+		})
+	}
+}
+
+func TestHedgeAttemptCancelledWithClient(t *testing.T) {
+	c, _, cancel := newHedgeTestContext()
+	gate := &hedgeGate{decided: make(chan struct{})}
+	attempt := newHedgeAttempt(c.Copy(), &relaycommon.RelayInfo{}, &model.Channel{Id: 1}, c.Writer, gate)
+	upstreamCtx := upstreamContext(t, attempt)
+	if upstreamCtx.Err() != nil {
+		t.Fatal("upstream request cancelled before the client disconnects")
+	}
+	cancel()
+	if upstreamCtx.Err() == nil {
+		t.Error("upstream request must be cancelled when the client disconnects")
+	}
+}
@@ -0,0 +1,44 @@
+package controller
+
+import (
+	"net/http"
+
+	"github.com/QuantumNous/new-api/dto"
+	"github.com/QuantumNous/new-api/service"
+	"github.com/QuantumNous/new-api/setting/operation_setting"
+
+	"github.com/gin-gonic/gin"
+)
+
+// GetResponse 返回网关保存的 Responses API 响应
+func GetResponse(c *gin.Context) {
+	id := c.Param("id")
+	if !operation_setting.GetResponsesStoreSetting().Enabled {
+		openAIErrorResponse(c, http.StatusNotFound, "not_found", "No such response: "+id)
+		return
+	}
+	response, err := service.GetStoredResponse(id, c.GetInt("id"))
+	if err != nil {
+		openAIDataError(c, err, "response", id)
+		return
+	}
+	c.Data(http.StatusOK, "application/json", response)
+}
+
+// DeleteResponse 删除网关保存的 Responses API 响应
+func DeleteResponse(c *gin.Context) {
+	id := c.Param("id")
+	if !operation_setting.GetResponsesStoreSetting().Enabled {
+		openAIErrorResponse(c, http.StatusNotFound, "not_found", "No such response: "+id)
+		return
+	}
+	if err := service.DeleteStoredResponse(id, c.GetInt("id")); err != nil {
+		openAIDataError(c, err, "response", id)
+		return
+	}
+	c.JSON(http.StatusOK, dto.OpenAIResponsesDeleteResponse{
+		Id:      id,
+		Object:  "response",
+		Deleted: true,
+	})
+}
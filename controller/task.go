@@ -17,60 +17,14 @@ import (
 	"github.com/QuantumNous/new-api/logger"
 	"github.com/QuantumNous/new-api/model"
 	"github.com/QuantumNous/new-api/relay"
+	"github.com/QuantumNous/new-api/service"
+	"github.com/QuantumNous/new-api/setting/operation_setting"
 
+	"github.com/bytedance/gopkg/util/gopool"
 	"github.com/gin-gonic/gin"
 	"github.com/samber/lo"
 )
 
-func UpdateTaskBulk() {
-	//revocer
-	//imageModel := "midjourney"
-	for {
-		time.Sleep(time.Duration(15) * time.Second)
-		common.SysLog("任务进度轮询开始")
-		ctx := context.TODO()
-		allTasks := model.GetAllUnFinishSyncTasks(500)
-		platformTask := make(map[constant.TaskPlatform][]*model.Task)
-		for _, t := range allTasks {
-			platformTask[t.Platform] = append(platformTask[t.Platform], t)
-		}
-		for platform, tasks := range platformTask {
-			if len(tasks) == 0 {
-				continue
-			}
-			taskChannelM := make(map[int][]string)
-			taskM := make(map[string]*model.Task)
-			nullTaskIds := make([]int64, 0)
-			for _, task := range tasks {
-				if task.TaskID == "" {
-					// 统计失败的未完成任务
-					nullTaskIds = append(nullTaskIds, task.ID)
-					continue
-				}
-				taskM[task.TaskID] = task
-				taskChannelM[task.ChannelId] = append(taskChannelM[task.ChannelId], task.TaskID)
-			}
-			if len(nullTaskIds) > 0 {
-				err := model.TaskBulkUpdateByID(nullTaskIds, map[string]any{
-					"status":   "FAILURE",
-					"progress": "100%",
-				})
-				if err != nil {
-					logger.LogError(ctx, fmt.Sprintf("Fix null task_id task error: %v", err))
-				} else {
-					logger.LogInfo(ctx, fmt.Sprintf("Fix null task_id task success: %v", nullTaskIds))
-				}
-			}
-			if len(taskChannelM) == 0 {
-				continue
-			}
-
-			UpdateTaskByPlatform(platform, taskChannelM, taskM)
-		}
-		common.SysLog("任务进度轮询完成")
-	}
-}
-
 func UpdateTaskByPlatform(platform constant.TaskPlatform, taskChannelM map[int][]string, taskM map[string]*model.Task) {
 	switch platform {
 	case constant.TaskPlatformMidjourney:
@@ -102,13 +56,16 @@ func updateSunoTaskAll(ctx context.Context, channelId int, taskIds []string, tas
 	channel, err := model.CacheGetChannel(channelId)
 	if err != nil {
 		common.SysLog(fmt.Sprintf("CacheGetChannel: %v", err))
+		failReason := fmt.Sprintf("获取渠道信息失败，请联系管理员，渠道ID：%d", channelId)
 		err = model.TaskBulkUpdate(taskIds, map[string]any{
-			"fail_reason": fmt.Sprintf("获取渠道信息失败，请联系管理员，渠道ID：%d", channelId),
+			"fail_reason": failReason,
 			"status":      "FAILURE",
 			"progress":    "100%",
 		})
 		if err != nil {
 			common.SysLog(fmt.Sprintf("UpdateMidjourneyTask error2: %v", err))
+		} else {
+			settleFailedTasks(ctx, lo.Values(lo.PickByKeys(taskM, taskIds)), failReason)
 		}
 		return err
 	}
@@ -150,6 +107,7 @@ func updateSunoTaskAll(ctx context.Context, channelId int, taskIds []string, tas
 			continue
 		}
 
+		preStatus := task.Status
 		task.Status = lo.If(model.TaskStatus(responseItem.Status) != "", model.TaskStatus(responseItem.Status)).Else(task.Status)
 		task.FailReason = lo.If(responseItem.FailReason != "", responseItem.FailReason).Else(task.FailReason)
 		task.SubmitTime = lo.If(responseItem.SubmitTime != 0, responseItem.SubmitTime).Else(task.SubmitTime)
@@ -157,21 +115,8 @@ func updateSunoTaskAll(ctx context.Context, channelId int, taskIds []string, tas
 		task.FinishTime = lo.If(responseItem.FinishTime != 0, responseItem.FinishTime).Else(task.FinishTime)
 		if responseItem.FailReason != "" || task.Status == model.TaskStatusFailure {
 			logger.LogInfo(ctx, task.TaskID+" 构建失败，"+task.FailReason)
+			task.Status = model.TaskStatusFailure
 			task.Progress = "100%"
-			//err = model.CacheUpdateUserQuota(task.UserId) ?
-			if err != nil {
-				logger.LogError(ctx, "error update user quota cache: "+err.Error())
-			} else {
-				quota := task.Quota
-				if quota != 0 {
-					err = model.IncreaseUserQuota(task.UserId, quota, false)
-					if err != nil {
-						logger.LogError(ctx, "fail to increase user quota: "+err.Error())
-					}
-					logContent := fmt.Sprintf("异步任务执行失败 %s，补偿 %s", task.TaskID, logger.LogQuota(quota))
-					model.RecordLog(task.UserId, model.LogTypeSystem, logContent)
-				}
-			}
 		}
 		if responseItem.Status == model.TaskStatusSuccess {
 			task.Progress = "100%"
@@ -181,6 +126,10 @@ func updateSunoTaskAll(ctx context.Context, channelId int, taskIds []string, tas
 		err = task.Update()
 		if err != nil {
 			common.SysLog("UpdateMidjourneyTask task error: " + err.Error())
+		} else {
+			model.PublishTaskStatusEvent(task, preStatus)
+			relay.NotifyTaskCallback(task, preStatus)
+			service.SettleTask(ctx, task, preStatus, nil)
 		}
 	}
 	return nil
@@ -273,3 +222,58 @@ func GetUserTask(c *gin.Context) {
 	pageInfo.SetItems(items)
 	common.ApiSuccess(c, pageInfo)
 }
+
+// TaskUpstreamCallback 接收上游的任务状态回调。回调只作为触发信号，
+// 任务状态仍通过 FetchTask 从上游查询，避免伪造的回调修改任务
+func TaskUpstreamCallback(c *gin.Context) {
+	channelId, _ := strconv.Atoi(c.Param("channel_id"))
+	if channelId == 0 || !service.VerifyTaskUpstreamCallbackSign(channelId, c.Param("sign")) {
+		c.JSON(http.StatusForbidden, gin.H{"success": false, "message": "invalid sign"})
+		return
+	}
+	body, err := io.ReadAll(io.LimitReader(c.Request.Body, 1<<20))
+	if err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	var payload map[string]any
+	if err := common.Unmarshal(body, &payload); err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	// 海螺在设置回调地址后会先发送 challenge，需原样返回
+	if challenge, ok := payload["challenge"]; ok {
+		c.JSON(http.StatusOK, gin.H{"challenge": challenge})
+		return
+	}
+	taskId := getUpstreamCallbackTaskId(payload)
+	task, exist, err := model.GetUnfinishedTaskByChannel(channelId, taskId)
+	if err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	if exist {
+		leaseUntil := time.Now().Unix() + int64(operation_setting.GetTaskPollSetting().LeaseSeconds)
+		// 正被其他节点轮询的任务无需重复查询
+		if ok, err := model.ClaimTaskPoll(task.ID, task.NextPollAt, leaseUntil); err == nil && ok {
+			task.NextPollAt = leaseUntil
+			gopool.Go(func() {
+				pollTasks(task.Platform, channelId, []*model.Task{task}, leaseUntil)
+			})
+		}
+	}
+	c.JSON(http.StatusOK, gin.H{"success": true})
+}
+
+// getUpstreamCallbackTaskId 从回调内容中取上游任务 id，兼容 task_id / id 及包裹在 data 中的格式
+func getUpstreamCallbackTaskId(payload map[string]any) string {
+	for _, key := range []string{"task_id", "id"} {
+		if v, ok := payload[key].(string); ok && v != "" {
+			return v
+		}
+	}
+	if data, ok := payload["data"].(map[string]any); ok {
+		return getUpstreamCallbackTaskId(data)
+	}
+	return ""
+}
@@ -0,0 +1,201 @@
+package controller
+
+import (
+	"bytes"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/constant"
+	"github.com/QuantumNous/new-api/dto"
+	"github.com/QuantumNous/new-api/logger"
+	"github.com/QuantumNous/new-api/model"
+	"github.com/QuantumNous/new-api/relay"
+	"github.com/QuantumNous/new-api/relay/channel"
+	relayconstant "github.com/QuantumNous/new-api/relay/constant"
+	"github.com/QuantumNous/new-api/service"
+
+	"github.com/gin-gonic/gin"
+)
+
+// taskSubmitWriter 暂存提交任务时各平台原样返回的响应，成功时改为返回统一格式的任务
+type taskSubmitWriter struct {
+	gin.ResponseWriter
+	status int
+	body   bytes.Buffer
+}
+
+func (w *taskSubmitWriter) WriteHeader(code int) {
+	w.status = code
+}
+
+func (w *taskSubmitWriter) WriteHeaderNow() {}
+
+func (w *taskSubmitWriter) Write(data []byte) (int, error) {
+	return w.body.Write(data)
+}
+
+func (w *taskSubmitWriter) WriteString(s string) (int, error) {
+	return w.body.WriteString(s)
+}
+
+func (w *taskSubmitWriter) Status() int {
+	return w.status
+}
+
+func (w *taskSubmitWriter) Size() int {
+	return w.body.Len()
+}
+
+func (w *taskSubmitWriter) Written() bool {
+	return w.status != 0 || w.body.Len() > 0
+}
+
+func taskApiError(c *gin.Context, statusCode int, errType string, message string) {
+	c.JSON(statusCode, gin.H{
+		"error": gin.H{
+			"message": message,
+			"type":    errType,
+		},
+	})
+}
+
+// SubmitTask 统一任务提交接口，按模型所在渠道转发到 Suno、Midjourney 或视频平台
+func SubmitTask(c *gin.Context) {
+	modelName := c.GetString("original_model")
+	if common.GetContextKeyInt(c, constant.ContextKeyChannelType) == constant.ChannelTypeSunoAPI {
+		// Suno 适配器从路由参数读取动作，模型名为 suno_<action>
+		c.Set("platform", string(constant.TaskPlatformSuno))
+		c.Set("relay_mode", relayconstant.RelayModeSunoSubmit)
+		c.Params = append(c.Params, gin.Param{Key: "action", Value: strings.TrimPrefix(modelName, "suno_")})
+	} else {
+		c.Set("relay_mode", relayconstant.RelayModeVideoSubmit)
+	}
+
+	origin := c.Writer
+	writer := &taskSubmitWriter{ResponseWriter: origin}
+	c.Writer = writer
+	RelayTask(c)
+	c.Writer = origin
+
+	if task, ok := common.GetContextKeyType[*model.Task](c, constant.ContextKeySubmittedTask); ok && task != nil {
+		c.JSON(http.StatusOK, relay.BuildTaskObject(task))
+		return
+	}
+	status := writer.status
+	if status == 0 {
+		status = http.StatusOK
+	}
+	c.Status(status)
+	_, _ = origin.Write(writer.body.Bytes())
+}
+
+// GetTask 查询当前用户的任务
+func GetTask(c *gin.Context) {
+	task, exists, err := model.GetByTaskId(c.GetInt("id"), c.Param("task_id"))
+	if err != nil {
+		logger.LogError(c, fmt.Sprintf("Failed to query task %s: %s", c.Param("task_id"), err.Error()))
+		taskApiError(c, http.StatusInternalServerError, "server_error", "Failed to query task")
+		return
+	}
+	if !exists {
+		taskApiError(c, http.StatusNotFound, "invalid_request_error", "Task not found")
+		return
+	}
+	c.JSON(http.StatusOK, relay.BuildTaskObject(task))
+}
+
+// ListTasks 分页查询当前用户的任务，支持按平台、统一状态、动作与提交时间筛选
+func ListTasks(c *gin.Context) {
+	pageInfo := common.GetPageQuery(c)
+	startTimestamp, _ := strconv.ParseInt(c.Query("start_timestamp"), 10, 64)
+	endTimestamp, _ := strconv.ParseInt(c.Query("end_timestamp"), 10, 64)
+	queryParams := model.SyncTaskQueryParams{
+		Action:         c.Query("action"),
+		StartTimestamp: startTimestamp,
+		EndTimestamp:   endTimestamp,
+	}
+	if platform := c.Query("platform"); platform != "" {
+		queryParams.Platforms = relay.GetTaskPlatformsByName(platform)
+		if len(queryParams.Platforms) == 0 {
+			taskApiError(c, http.StatusBadRequest, "invalid_request_error", "unknown platform: "+platform)
+			return
+		}
+	}
+	if status := c.Query("status"); status != "" {
+		queryParams.Statuses = relay.TaskObjectStatuses(status)
+		if len(queryParams.Statuses) == 0 {
+			taskApiError(c, http.StatusBadRequest, "invalid_request_error", "unknown status: "+status)
+			return
+		}
+	}
+
+	userId := c.GetInt("id")
+	tasks := model.TaskGetAllUserTask(userId, pageInfo.GetStartIdx(), pageInfo.GetPageSize(), queryParams)
+	total := model.TaskCountAllUserTask(userId, queryParams)
+	items := make([]*dto.TaskObject, 0, len(tasks))
+	for _, task := range tasks {
+		items = append(items, relay.BuildTaskObject(task))
+	}
+	c.JSON(http.StatusOK, dto.TaskObjectList{
+		Object: "list",
+		Data:   items,
+		Total:  total,
+	})
+}
+
+// CancelTask 取消未完成的任务，上游取消成功后标记失败并退还额度
+func CancelTask(c *gin.Context) {
+	task, exists, err := model.GetByTaskId(c.GetInt("id"), c.Param("task_id"))
+	if err != nil {
+		logger.LogError(c, fmt.Sprintf("Failed to query task %s: %s", c.Param("task_id"), err.Error()))
+		taskApiError(c, http.StatusInternalServerError, "server_error", "Failed to query task")
+		return
+	}
+	if !exists {
+		taskApiError(c, http.StatusNotFound, "invalid_request_error", "Task not found")
+		return
+	}
+	if task.Status == model.TaskStatusSuccess || task.Status == model.TaskStatusFailure {
+		taskApiError(c, http.StatusBadRequest, "invalid_request_error", "Task is already finished")
+		return
+	}
+	canceler, ok := relay.GetTaskAdaptor(task.Platform).(channel.TaskCanceler)
+	if !ok {
+		taskApiError(c, http.StatusBadRequest, "invalid_request_error", "Task cancellation is not supported by this platform")
+		return
+	}
+	ch, err := model.CacheGetChannel(task.ChannelId)
+	if err != nil {
+		taskApiError(c, http.StatusInternalServerError, "server_error", "Failed to retrieve channel information")
+		return
+	}
+	baseURL := constant.ChannelBaseURLs[ch.Type]
+	if ch.GetBaseURL() != "" {
+		baseURL = ch.GetBaseURL()
+	}
+	if err := canceler.CancelTask(baseURL, ch.Key, task.TaskID); err != nil {
+		logger.LogError(c, fmt.Sprintf("Failed to cancel task %s: %s", task.TaskID, err.Error()))
+		taskApiError(c, http.StatusBadGateway, "upstream_error", "Failed to cancel task upstream")
+		return
+	}
+
+	preStatus := task.Status
+	ok, err = model.CancelTask(task, "任务已取消", common.GetTimestamp())
+	if err != nil {
+		taskApiError(c, http.StatusInternalServerError, "server_error", "Failed to update task")
+		return
+	}
+	if !ok {
+		// 上游已取消，任务状态稍后由轮询同步
+		taskApiError(c, http.StatusConflict, "invalid_request_error", "Task is being updated, please retry later")
+		return
+	}
+	logger.LogInfo(c, fmt.Sprintf("Task %s cancelled by user", task.TaskID))
+	model.PublishTaskStatusEvent(task, preStatus)
+	relay.NotifyTaskCallback(task, preStatus)
+	service.SettleTask(c, task, preStatus, nil)
+	c.JSON(http.StatusOK, relay.BuildTaskObject(task))
+}
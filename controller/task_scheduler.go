@@ -0,0 +1,200 @@
+package controller
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/constant"
+	"github.com/QuantumNous/new-api/logger"
+	"github.com/QuantumNous/new-api/model"
+	"github.com/QuantumNous/new-api/relay"
+	"github.com/QuantumNous/new-api/service"
+	"github.com/QuantumNous/new-api/setting/operation_setting"
+
+	"github.com/bytedance/gopkg/util/gopool"
+	"github.com/samber/lo"
+)
+
+// taskPollLimiter 限制单个节点上每个平台、每个渠道同时运行的轮询协程数
+type taskPollLimiter struct {
+	mu      sync.Mutex
+	running map[string]int
+}
+
+var taskPollRunning = &taskPollLimiter{running: make(map[string]int)}
+
+// acquire 平台与渠道的并发均未达到上限时占用一个名额
+func (l *taskPollLimiter) acquire(platformKey string, channelKey string) bool {
+	setting := operation_setting.GetTaskPollSetting()
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.running[platformKey] >= setting.PlatformConcurrency || l.running[channelKey] >= setting.ChannelConcurrency {
+		return false
+	}
+	l.running[platformKey]++
+	l.running[channelKey]++
+	return true
+}
+
+func (l *taskPollLimiter) release(platformKey string, channelKey string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.running[platformKey]--
+	l.running[channelKey]--
+}
+
+type taskPollGroup struct {
+	platform  constant.TaskPlatform
+	channelId int
+}
+
+// StartTaskPollScheduler 异步任务轮询调度，所有节点都会运行。
+// 每个任务记录下次轮询时间，节点通过条件更新领取到期任务，领取期间其他节点不会重复处理
+func StartTaskPollScheduler() {
+	for {
+		time.Sleep(5 * time.Second)
+		scheduleTaskPolls()
+	}
+}
+
+// taskPollInterval 按任务存在时间计算轮询间隔，存在时间每翻一倍间隔也翻倍
+func taskPollInterval(submitTime int64, now int64) int64 {
+	setting := operation_setting.GetTaskPollSetting()
+	interval := int64(setting.BaseIntervalSeconds)
+	if interval <= 0 {
+		interval = 15
+	}
+	maxInterval := int64(setting.MaxIntervalSeconds)
+	age := now - submitTime
+	for interval*4 < age && interval < maxInterval {
+		interval *= 2
+	}
+	if maxInterval > 0 && interval > maxInterval {
+		interval = maxInterval
+	}
+	return interval
+}
+
+func scheduleTaskPolls() {
+	setting := operation_setting.GetTaskPollSetting()
+	ctx := context.Background()
+	now := time.Now().Unix()
+	if setting.MaxAgeSeconds > 0 {
+		failTimedOutTasks(ctx, now-int64(setting.MaxAgeSeconds), now)
+	}
+
+	tasks := model.GetDueTasks(now, setting.BatchSize)
+	groups := make(map[taskPollGroup][]*model.Task)
+	nullTasks := make([]*model.Task, 0)
+	nullTaskIds := make([]int64, 0)
+	for _, task := range tasks {
+		if task.TaskID == "" {
+			// 统计失败的未完成任务
+			nullTasks = append(nullTasks, task)
+			nullTaskIds = append(nullTaskIds, task.ID)
+			continue
+		}
+		key := taskPollGroup{platform: task.Platform, channelId: task.ChannelId}
+		groups[key] = append(groups[key], task)
+	}
+	if len(nullTaskIds) > 0 {
+		err := model.TaskBulkUpdateByID(nullTaskIds, map[string]any{
+			"status":   "FAILURE",
+			"progress": "100%",
+		})
+		if err != nil {
+			logger.LogError(ctx, fmt.Sprintf("Fix null task_id task error: %v", err))
+		} else {
+			logger.LogInfo(ctx, fmt.Sprintf("Fix null task_id task success: %v", nullTaskIds))
+			settleFailedTasks(ctx, nullTasks, "")
+		}
+	}
+
+	leaseUntil := now + int64(setting.LeaseSeconds)
+	for key, group := range groups {
+		platformKey := "task:" + string(key.platform)
+		channelKey := fmt.Sprintf("channel:%d", key.channelId)
+		for _, chunk := range lo.Chunk(group, max(setting.TasksPerWorker, 1)) {
+			// 并发已满时剩余任务保持到期状态，下一轮再领取
+			if !taskPollRunning.acquire(platformKey, channelKey) {
+				break
+			}
+			claimed := make([]*model.Task, 0, len(chunk))
+			for _, task := range chunk {
+				ok, err := model.ClaimTaskPoll(task.ID, task.NextPollAt, leaseUntil)
+				if err != nil || !ok {
+					continue
+				}
+				task.NextPollAt = leaseUntil
+				claimed = append(claimed, task)
+			}
+			if len(claimed) == 0 {
+				taskPollRunning.release(platformKey, channelKey)
+				continue
+			}
+			gopool.Go(func() {
+				defer taskPollRunning.release(platformKey, channelKey)
+				pollTasks(key.platform, key.channelId, claimed, leaseUntil)
+			})
+		}
+	}
+}
+
+// pollTasks 查询已领取任务的上游状态，结束后按任务存在时间设置下次轮询时间
+func pollTasks(platform constant.TaskPlatform, channelId int, tasks []*model.Task, leaseUntil int64) {
+	taskIds := make([]string, 0, len(tasks))
+	taskM := make(map[string]*model.Task, len(tasks))
+	for _, task := range tasks {
+		taskIds = append(taskIds, task.TaskID)
+		taskM[task.TaskID] = task
+	}
+	UpdateTaskByPlatform(platform, map[int][]string{channelId: taskIds}, taskM)
+
+	now := time.Now().Unix()
+	fallbackSeconds := int64(operation_setting.GetTaskCallbackSetting().UpstreamFallbackPollSeconds)
+	for _, task := range tasks {
+		interval := taskPollInterval(task.SubmitTime, now)
+		// 等待上游回调的任务只做兜底轮询
+		if task.PrivateData.UpstreamCallback && interval < fallbackSeconds {
+			interval = fallbackSeconds
+		}
+		if err := model.ReleaseTaskPoll(task.ID, leaseUntil, now+interval); err != nil {
+			common.SysLog(fmt.Sprintf("failed to release task %s: %v", task.TaskID, err))
+		}
+	}
+}
+
+// failTimedOutTasks 将提交时间早于 deadline 仍未完成的任务标记为失败并退还额度
+func failTimedOutTasks(ctx context.Context, deadline int64, now int64) {
+	for _, task := range model.GetTimedOutTasks(deadline, now, 100) {
+		preStatus := task.Status
+		ok, err := model.FailTimedOutTask(task, "任务超时", now)
+		if err != nil {
+			logger.LogError(ctx, fmt.Sprintf("Failed to mark task %s timed out: %v", task.TaskID, err))
+			continue
+		}
+		if !ok {
+			continue
+		}
+		logger.LogInfo(ctx, fmt.Sprintf("Task %s timed out", task.TaskID))
+		model.PublishTaskStatusEvent(task, preStatus)
+		relay.NotifyTaskCallback(task, preStatus)
+		service.SettleTask(ctx, task, preStatus, nil)
+	}
+}
+
+// settleFailedTasks 对批量标记为失败的任务逐个结算退款
+func settleFailedTasks(ctx context.Context, tasks []*model.Task, reason string) {
+	for _, task := range tasks {
+		preStatus := task.Status
+		task.Status = model.TaskStatusFailure
+		task.Progress = "100%"
+		if reason != "" {
+			task.FailReason = reason
+		}
+		service.SettleTask(ctx, task, preStatus, nil)
+	}
+}
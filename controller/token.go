@@ -1,12 +1,14 @@
 package controller
 
 import (
+	"errors"
 	"net/http"
 	"strconv"
 	"strings"
 
 	"github.com/QuantumNous/new-api/common"
 	"github.com/QuantumNous/new-api/model"
+	"github.com/QuantumNous/new-api/service"
 	"github.com/QuantumNous/new-api/setting/operation_setting"
 
 	"github.com/gin-gonic/gin"
@@ -20,6 +22,10 @@ func GetAllTokens(c *gin.Context) {
 		common.ApiError(c, err)
 		return
 	}
+	if err := model.FillTokenQuotaBudgets(tokens); err != nil {
+		common.ApiError(c, err)
+		return
+	}
 	total, _ := model.CountUserTokens(userId)
 	pageInfo.SetTotal(int(total))
 	pageInfo.SetItems(tokens)
@@ -36,6 +42,10 @@ func SearchTokens(c *gin.Context) {
 		common.ApiError(c, err)
 		return
 	}
+	if err := model.FillTokenQuotaBudgets(tokens); err != nil {
+		common.ApiError(c, err)
+		return
+	}
 	c.JSON(http.StatusOK, gin.H{
 		"success": true,
 		"message": "",
@@ -56,6 +66,11 @@ func GetToken(c *gin.Context) {
 		common.ApiError(c, err)
 		return
 	}
+	token.Budgets, err = model.GetQuotaBudgets(model.QuotaBudgetSubjectToken, token.Id)
+	if err != nil {
+		common.ApiError(c, err)
+		return
+	}
 	c.JSON(http.StatusOK, gin.H{
 		"success": true,
 		"message": "",
@@ -136,6 +151,18 @@ func GetTokenUsage(c *gin.Context) {
 	})
 }
 
+// validateTokenModelFallback 校验模型回退链格式：{"模型":["回退模型1","回退模型2"]}
+func validateTokenModelFallback(modelFallback string) error {
+	if strings.TrimSpace(modelFallback) == "" {
+		return nil
+	}
+	var fallbackMap map[string][]string
+	if err := common.UnmarshalJsonStr(modelFallback, &fallbackMap); err != nil {
+		return errors.New("模型回退链格式错误，应为 {\"模型\":[\"回退模型\"]} 格式")
+	}
+	return nil
+}
+
 func AddToken(c *gin.Context) {
 	token := model.Token{}
 	err := c.ShouldBindJSON(&token)
@@ -150,6 +177,27 @@ func AddToken(c *gin.Context) {
 		})
 		return
 	}
+	if err := validateTokenModelFallback(token.ModelFallback); err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return
+	}
+	if err := service.ValidateTaskCallbackUrl(token.CallbackUrl); err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return
+	}
+	if len(token.CallbackSecret) > 128 {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": "回调密钥长度不能超过 128",
+		})
+		return
+	}
 	// 检查是否强制要求选择分组
 	if operation_setting.IsGroupSelectionRequired() && strings.TrimSpace(token.Group) == "" {
 		c.JSON(http.StatusOK, gin.H{
@@ -180,12 +228,27 @@ func AddToken(c *gin.Context) {
 		ModelLimits:        token.ModelLimits,
 		AllowIps:           token.AllowIps,
 		Group:              token.Group,
+		TpmLimit:           token.TpmLimit,
+		ConcurrencyLimit:   token.ConcurrencyLimit,
+		ModelFallback:      token.ModelFallback,
+		CallbackUrl:        token.CallbackUrl,
+		CallbackSecret:     token.CallbackSecret,
+	}
+	if cleanToken.CallbackSecret == "" {
+		cleanToken.CallbackSecret = common.GetRandomString(32)
 	}
 	err = cleanToken.Insert()
 	if err != nil {
 		common.ApiError(c, err)
 		return
 	}
+	if len(token.Budgets) > 0 {
+		err = model.UpdateQuotaBudgets(model.QuotaBudgetSubjectToken, cleanToken.Id, token.Budgets)
+		if err != nil {
+			common.ApiError(c, err)
+			return
+		}
+	}
 	c.JSON(http.StatusOK, gin.H{
 		"success": true,
 		"message": "",
@@ -201,6 +264,7 @@ func DeleteToken(c *gin.Context) {
 		common.ApiError(c, err)
 		return
 	}
+	_ = model.DeleteQuotaBudgets(model.QuotaBudgetSubjectToken, id)
 	c.JSON(http.StatusOK, gin.H{
 		"success": true,
 		"message": "",
@@ -224,6 +288,27 @@ func UpdateToken(c *gin.Context) {
 		})
 		return
 	}
+	if err := validateTokenModelFallback(token.ModelFallback); err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return
+	}
+	if err := service.ValidateTaskCallbackUrl(token.CallbackUrl); err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return
+	}
+	if len(token.CallbackSecret) > 128 {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"message": "回调密钥长度不能超过 128",
+		})
+		return
+	}
 	cleanToken, err := model.GetTokenByIds(token.Id, userId)
 	if err != nil {
 		common.ApiError(c, err)
@@ -257,12 +342,31 @@ func UpdateToken(c *gin.Context) {
 		cleanToken.ModelLimits = token.ModelLimits
 		cleanToken.AllowIps = token.AllowIps
 		cleanToken.Group = token.Group
+		cleanToken.TpmLimit = token.TpmLimit
+		cleanToken.ConcurrencyLimit = token.ConcurrencyLimit
+		cleanToken.ModelFallback = token.ModelFallback
+		cleanToken.CallbackUrl = token.CallbackUrl
+		// 未填写回调密钥时保留原密钥
+		if token.CallbackSecret != "" {
+			cleanToken.CallbackSecret = token.CallbackSecret
+		} else if cleanToken.CallbackSecret == "" {
+			cleanToken.CallbackSecret = common.GetRandomString(32)
+		}
 	}
 	err = cleanToken.Update()
 	if err != nil {
 		common.ApiError(c, err)
 		return
 	}
+	// 未传 budgets 字段时保持原有预算不变
+	if statusOnly == "" && token.Budgets != nil {
+		err = model.UpdateQuotaBudgets(model.QuotaBudgetSubjectToken, cleanToken.Id, token.Budgets)
+		if err != nil {
+			common.ApiError(c, err)
+			return
+		}
+	}
+	cleanToken.Budgets, _ = model.GetQuotaBudgets(model.QuotaBudgetSubjectToken, cleanToken.Id)
 	c.JSON(http.StatusOK, gin.H{
 		"success": true,
 		"message": "",
@@ -290,6 +394,7 @@ func DeleteTokenBatch(c *gin.Context) {
 		common.ApiError(c, err)
 		return
 	}
+	_ = model.DeleteQuotaBudgets(model.QuotaBudgetSubjectToken, tokenBatch.Ids...)
 	c.JSON(http.StatusOK, gin.H{
 		"success": true,
 		"message": "",
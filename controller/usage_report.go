@@ -0,0 +1,30 @@
+package controller
+
+import (
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/model"
+
+	"github.com/gin-gonic/gin"
+)
+
+func getUsageReports(c *gin.Context, userId int) {
+	pageInfo := common.GetPageQuery(c)
+	reports, total, err := model.GetUsageReports(userId, c.Query("period"), pageInfo.GetStartIdx(), pageInfo.GetPageSize())
+	if err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	pageInfo.SetTotal(int(total))
+	pageInfo.SetItems(reports)
+	common.ApiSuccess(c, pageInfo)
+}
+
+// GetSelfUsageReports 获取当前用户的历史用量报告
+func GetSelfUsageReports(c *gin.Context) {
+	getUsageReports(c, c.GetInt("id"))
+}
+
+// GetSiteUsageReports 管理员获取全站历史用量报告
+func GetSiteUsageReports(c *gin.Context) {
+	getUsageReports(c, 0)
+}
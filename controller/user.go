@@ -15,6 +15,7 @@ import (
 	"github.com/QuantumNous/new-api/model"
 	"github.com/QuantumNous/new-api/service"
 	"github.com/QuantumNous/new-api/setting"
+	"github.com/QuantumNous/new-api/setting/operation_setting"
 
 	"github.com/QuantumNous/new-api/constant"
 
@@ -283,6 +284,10 @@ func GetAllUsers(c *gin.Context) {
 		common.ApiError(c, err)
 		return
 	}
+	if err := model.FillUserQuotaBudgets(users); err != nil {
+		common.ApiError(c, err)
+		return
+	}
 
 	pageInfo.SetTotal(int(total))
 	pageInfo.SetItems(users)
@@ -328,6 +333,10 @@ func SearchUsers(c *gin.Context) {
 		common.ApiError(c, err)
 		return
 	}
+	if err := model.FillUserQuotaBudgets(users); err != nil {
+		common.ApiError(c, err)
+		return
+	}
 
 	pageInfo.SetTotal(int(total))
 	pageInfo.SetItems(users)
@@ -412,6 +421,11 @@ func GetUser(c *gin.Context) {
 		})
 		return
 	}
+	user.Budgets, err = model.GetQuotaBudgets(model.QuotaBudgetSubjectUser, user.Id)
+	if err != nil {
+		common.ApiError(c, err)
+		return
+	}
 	c.JSON(http.StatusOK, gin.H{
 		"success": true,
 		"message": "",
@@ -738,6 +752,13 @@ func UpdateUser(c *gin.Context) {
 	if originUser.Quota != updatedUser.Quota {
 		model.RecordLog(originUser.Id, model.LogTypeManage, fmt.Sprintf("管理员将用户额度从 %s修改为 %s", logger.LogQuota(originUser.Quota), logger.LogQuota(updatedUser.Quota)))
 	}
+	// 未传 budgets 字段时保持原有预算不变
+	if updatedUser.Budgets != nil {
+		if err := model.UpdateQuotaBudgets(model.QuotaBudgetSubjectUser, updatedUser.Id, updatedUser.Budgets); err != nil {
+			common.ApiError(c, err)
+			return
+		}
+	}
 	c.JSON(http.StatusOK, gin.H{
 		"success": true,
 		"message": "",
@@ -1197,6 +1218,14 @@ type UpdateUserSettingRequest struct {
 	GotifyUrl                  string  `json:"gotify_url,omitempty"`
 	GotifyToken                string  `json:"gotify_token,omitempty"`
 	GotifyPriority             int     `json:"gotify_priority,omitempty"`
+	SlackWebhookUrl            string  `json:"slack_webhook_url,omitempty"`
+	TelegramChatId             string  `json:"telegram_chat_id,omitempty"`
+	DingtalkWebhookUrl         string  `json:"dingtalk_webhook_url,omitempty"`
+	DingtalkSecret             string  `json:"dingtalk_secret,omitempty"`
+	FeishuWebhookUrl           string  `json:"feishu_webhook_url,omitempty"`
+	FeishuSecret               string  `json:"feishu_secret,omitempty"`
+	WecomWebhookUrl            string  `json:"wecom_webhook_url,omitempty"`
+	UsageReportPeriod          string  `json:"usage_report_period,omitempty"`
 	AcceptUnsetModelRatioModel bool    `json:"accept_unset_model_ratio_model"`
 	RecordIpLog                bool    `json:"record_ip_log"`
 }
@@ -1212,7 +1241,10 @@ func UpdateUserSetting(c *gin.Context) {
 	}
 
 	// 验证预警类型
-	if req.QuotaWarningType != dto.NotifyTypeEmail && req.QuotaWarningType != dto.NotifyTypeWebhook && req.QuotaWarningType != dto.NotifyTypeBark && req.QuotaWarningType != dto.NotifyTypeGotify {
+	switch req.QuotaWarningType {
+	case dto.NotifyTypeEmail, dto.NotifyTypeWebhook, dto.NotifyTypeBark, dto.NotifyTypeGotify,
+		dto.NotifyTypeSlack, dto.NotifyTypeTelegram, dto.NotifyTypeDingtalk, dto.NotifyTypeFeishu, dto.NotifyTypeWecom:
+	default:
 		c.JSON(http.StatusOK, gin.H{
 			"success": false,
 			"message": "无效的预警类型",
@@ -1321,6 +1353,51 @@ func UpdateUserSetting(c *gin.Context) {
 		}
 	}
 
+	// 如果是聊天机器人类型，验证机器人地址
+	robotUrls := map[string]struct {
+		url  string
+		name string
+	}{
+		dto.NotifyTypeSlack:    {req.SlackWebhookUrl, "Slack Webhook地址"},
+		dto.NotifyTypeDingtalk: {req.DingtalkWebhookUrl, "钉钉机器人地址"},
+		dto.NotifyTypeFeishu:   {req.FeishuWebhookUrl, "飞书机器人地址"},
+		dto.NotifyTypeWecom:    {req.WecomWebhookUrl, "企业微信机器人地址"},
+	}
+	if robot, ok := robotUrls[req.QuotaWarningType]; ok {
+		if robot.url == "" {
+			c.JSON(http.StatusOK, gin.H{
+				"success": false,
+				"message": robot.name + "不能为空",
+			})
+			return
+		}
+		if _, err := url.ParseRequestURI(robot.url); err != nil || !strings.HasPrefix(robot.url, "https://") {
+			c.JSON(http.StatusOK, gin.H{
+				"success": false,
+				"message": "无效的" + robot.name + "，必须以https://开头",
+			})
+			return
+		}
+	}
+
+	// 验证用量报告周期
+	if req.UsageReportPeriod != "" {
+		if !model.IsValidUsageReportPeriod(req.UsageReportPeriod) {
+			c.JSON(http.StatusOK, gin.H{
+				"success": false,
+				"message": "无效的用量报告周期",
+			})
+			return
+		}
+		if !operation_setting.GetUsageReportSetting().Enabled {
+			c.JSON(http.StatusOK, gin.H{
+				"success": false,
+				"message": "管理员未开启用量报告",
+			})
+			return
+		}
+	}
+
 	userId := c.GetInt("id")
 	user, err := model.GetUserById(userId, true)
 	if err != nil {
@@ -1328,12 +1405,31 @@ func UpdateUserSetting(c *gin.Context) {
 		return
 	}
 
+	// 如果是Telegram类型，需要指定会话ID或已绑定Telegram账号
+	if req.QuotaWarningType == dto.NotifyTypeTelegram {
+		if common.TelegramBotToken == "" {
+			c.JSON(http.StatusOK, gin.H{
+				"success": false,
+				"message": "管理员未配置Telegram机器人",
+			})
+			return
+		}
+		if req.TelegramChatId == "" && user.TelegramId == "" {
+			c.JSON(http.StatusOK, gin.H{
+				"success": false,
+				"message": "请填写Telegram会话ID或先绑定Telegram账号",
+			})
+			return
+		}
+	}
+
 	// 构建设置
 	settings := dto.UserSetting{
 		NotifyType:            req.QuotaWarningType,
 		QuotaWarningThreshold: req.QuotaWarningThreshold,
 		AcceptUnsetRatioModel: req.AcceptUnsetModelRatioModel,
 		RecordIpLog:           req.RecordIpLog,
+		UsageReportPeriod:     req.UsageReportPeriod,
 	}
 
 	// 如果是webhook类型,添加webhook相关设置
@@ -1366,6 +1462,22 @@ func UpdateUserSetting(c *gin.Context) {
 		}
 	}
 
+	// 如果是聊天机器人类型，添加对应配置到设置中
+	switch req.QuotaWarningType {
+	case dto.NotifyTypeSlack:
+		settings.SlackWebhookUrl = req.SlackWebhookUrl
+	case dto.NotifyTypeTelegram:
+		settings.TelegramChatId = req.TelegramChatId
+	case dto.NotifyTypeDingtalk:
+		settings.DingtalkWebhookUrl = req.DingtalkWebhookUrl
+		settings.DingtalkSecret = req.DingtalkSecret
+	case dto.NotifyTypeFeishu:
+		settings.FeishuWebhookUrl = req.FeishuWebhookUrl
+		settings.FeishuSecret = req.FeishuSecret
+	case dto.NotifyTypeWecom:
+		settings.WecomWebhookUrl = req.WecomWebhookUrl
+	}
+
 	// 更新用户设置
 	user.SetSetting(settings)
 	if err := user.Update(false); err != nil {
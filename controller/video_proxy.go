@@ -1,6 +1,8 @@
 package controller
 
 import (
+	"context"
+	"errors"
 	"fmt"
 	"io"
 	"net/http"
@@ -10,6 +12,7 @@ import (
 	"github.com/QuantumNous/new-api/constant"
 	"github.com/QuantumNous/new-api/logger"
 	"github.com/QuantumNous/new-api/model"
+	"github.com/QuantumNous/new-api/service"
 
 	"github.com/gin-gonic/gin"
 )
@@ -58,6 +61,12 @@ func VideoProxy(c *gin.Context) {
 		return
 	}
 
+	// 已保存到文件存储时直接返回保存的文件，上游地址可能已经过期
+	if assets := service.GetMediaAssets(task.UserId, model.MediaSourceTask, task.TaskID); len(assets) > 0 {
+		service.ServeMediaAsset(c, assets[0])
+		return
+	}
+
 	channel, err := model.CacheGetChannel(task.ChannelId)
 	if err != nil {
 		logger.LogError(c.Request.Context(), fmt.Sprintf("Failed to get task %s: not found", taskID))
@@ -69,66 +78,15 @@ func VideoProxy(c *gin.Context) {
 		})
 		return
 	}
-	baseURL := channel.GetBaseURL()
-	if baseURL == "" {
-		baseURL = "https://api.openai.com"
-	}
 
-	var videoURL string
 	client := &http.Client{
 		Timeout: 60 * time.Second,
 	}
 
-	req, err := http.NewRequestWithContext(c.Request.Context(), http.MethodGet, "", nil)
-	if err != nil {
-		logger.LogError(c.Request.Context(), fmt.Sprintf("Failed to create request: %s", err.Error()))
-		c.JSON(http.StatusInternalServerError, gin.H{
-			"error": gin.H{
-				"message": "Failed to create proxy request",
-				"type":    "server_error",
-			},
-		})
-		return
-	}
-
-	switch channel.Type {
-	case constant.ChannelTypeGemini:
-		apiKey := task.PrivateData.Key
-		if apiKey == "" {
-			logger.LogError(c.Request.Context(), fmt.Sprintf("Missing stored API key for Gemini task %s", taskID))
-			c.JSON(http.StatusInternalServerError, gin.H{
-				"error": gin.H{
-					"message": "API key not stored for task",
-					"type":    "server_error",
-				},
-			})
-			return
-		}
-
-		videoURL, err = getGeminiVideoURL(channel, task, apiKey)
-		if err != nil {
-			logger.LogError(c.Request.Context(), fmt.Sprintf("Failed to resolve Gemini video URL for task %s: %s", taskID, err.Error()))
-			c.JSON(http.StatusBadGateway, gin.H{
-				"error": gin.H{
-					"message": "Failed to resolve Gemini video URL",
-					"type":    "server_error",
-				},
-			})
-			return
-		}
-		req.Header.Set("x-goog-api-key", apiKey)
-	case constant.ChannelTypeOpenAI, constant.ChannelTypeSora:
-		videoURL = fmt.Sprintf("%s/v1/videos/%s/content", baseURL, task.TaskID)
-		req.Header.Set("Authorization", "Bearer "+channel.Key)
-	default:
-		// Video URL is directly in task.FailReason
-		videoURL = task.FailReason
-	}
-
-	req.URL, err = url.Parse(videoURL)
+	req, err := newTaskVideoRequest(c.Request.Context(), task, channel)
 	if err != nil {
-		logger.LogError(c.Request.Context(), fmt.Sprintf("Failed to parse URL %s: %s", videoURL, err.Error()))
-		c.JSON(http.StatusInternalServerError, gin.H{
+		logger.LogError(c.Request.Context(), fmt.Sprintf("Failed to create video request for task %s: %s", taskID, err.Error()))
+		c.JSON(http.StatusBadGateway, gin.H{
 			"error": gin.H{
 				"message": "Failed to create proxy request",
 				"type":    "server_error",
@@ -136,6 +94,7 @@ func VideoProxy(c *gin.Context) {
 		})
 		return
 	}
+	videoURL := req.URL.String()
 
 	resp, err := client.Do(req)
 	if err != nil {
@@ -174,3 +133,43 @@ func VideoProxy(c *gin.Context) {
 		logger.LogError(c.Request.Context(), fmt.Sprintf("Failed to stream video content: %s", err.Error()))
 	}
 }
+
+// newTaskVideoRequest 构建获取任务视频内容的上游请求，OpenAI 与 Gemini 需要携带渠道密钥
+func newTaskVideoRequest(ctx context.Context, task *model.Task, channel *model.Channel) (*http.Request, error) {
+	baseURL := channel.GetBaseURL()
+	if baseURL == "" {
+		baseURL = "https://api.openai.com"
+	}
+
+	var videoURL string
+	header := http.Header{}
+	switch channel.Type {
+	case constant.ChannelTypeGemini:
+		apiKey := task.PrivateData.Key
+		if apiKey == "" {
+			return nil, errors.New("API key not stored for task")
+		}
+		var err error
+		videoURL, err = getGeminiVideoURL(channel, task, apiKey)
+		if err != nil {
+			return nil, fmt.Errorf("failed to resolve Gemini video URL: %w", err)
+		}
+		header.Set("x-goog-api-key", apiKey)
+	case constant.ChannelTypeOpenAI, constant.ChannelTypeSora:
+		videoURL = fmt.Sprintf("%s/v1/videos/%s/content", baseURL, task.TaskID)
+		header.Set("Authorization", "Bearer "+channel.Key)
+	default:
+		// Video URL is directly in task.FailReason
+		videoURL = task.FailReason
+	}
+
+	if _, err := url.Parse(videoURL); err != nil {
+		return nil, err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, videoURL, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header = header
+	return req, nil
+}
@@ -0,0 +1,257 @@
+package controller
+
+import (
+	"errors"
+	"net/url"
+	"strconv"
+	"unicode/utf8"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/common/event"
+	"github.com/QuantumNous/new-api/model"
+	"github.com/QuantumNous/new-api/service"
+	"github.com/QuantumNous/new-api/setting/operation_setting"
+
+	"github.com/gin-gonic/gin"
+)
+
+// 系统订阅的所属用户 id
+const systemWebhookOwner = 0
+
+type webhookSubscriptionRequest struct {
+	Id     int      `json:"id"`
+	Name   string   `json:"name"`
+	Url    string   `json:"url"`
+	Secret string   `json:"secret"`
+	Events []string `json:"events"`
+	Status int      `json:"status"`
+}
+
+func validateWebhookSubscription(req *webhookSubscriptionRequest, userScopedOnly bool) error {
+	if utf8.RuneCountInString(req.Name) == 0 || utf8.RuneCountInString(req.Name) > 64 {
+		return errors.New("名称长度必须在1-64之间")
+	}
+	if len(req.Url) > 512 {
+		return errors.New("URL 长度不能超过 512")
+	}
+	u, err := url.Parse(req.Url)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return errors.New("URL 必须是有效的 http 或 https 地址")
+	}
+	if len(req.Secret) > 128 {
+		return errors.New("密钥长度不能超过 128")
+	}
+	if len(req.Events) == 0 {
+		return errors.New("至少需要订阅一个事件")
+	}
+	for _, e := range req.Events {
+		t := event.Type(e)
+		if !event.IsValid(t) {
+			return errors.New("未知的事件类型：" + e)
+		}
+		if userScopedOnly && !event.IsUserScoped(t) {
+			return errors.New("无权订阅该事件：" + e)
+		}
+	}
+	if req.Status != model.WebhookStatusEnabled && req.Status != model.WebhookStatusDisabled {
+		req.Status = model.WebhookStatusEnabled
+	}
+	return nil
+}
+
+func checkUserWebhookEnabled(c *gin.Context) bool {
+	if !operation_setting.GetWebhookSetting().UserSubscriptionEnabled {
+		common.ApiErrorMsg(c, "管理员未开启用户事件订阅")
+		return false
+	}
+	return true
+}
+
+// GetWebhookEventTypes 返回当前用户可订阅的事件类型
+func GetWebhookEventTypes(c *gin.Context) {
+	if c.GetInt("role") >= common.RoleAdminUser {
+		common.ApiSuccess(c, event.All)
+		return
+	}
+	common.ApiSuccess(c, event.UserScopedTypes())
+}
+
+func getWebhookSubscriptions(c *gin.Context, ownerId int) {
+	pageInfo := common.GetPageQuery(c)
+	subscriptions, total, err := model.GetWebhookSubscriptions(ownerId, pageInfo.GetStartIdx(), pageInfo.GetPageSize())
+	if err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	pageInfo.SetTotal(int(total))
+	pageInfo.SetItems(subscriptions)
+	common.ApiSuccess(c, pageInfo)
+}
+
+func addWebhookSubscription(c *gin.Context, ownerId int) {
+	var req webhookSubscriptionRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	if err := validateWebhookSubscription(&req, ownerId != systemWebhookOwner); err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	if ownerId != systemWebhookOwner {
+		count, err := model.CountWebhookSubscriptions(ownerId)
+		if err != nil {
+			common.ApiError(c, err)
+			return
+		}
+		if count >= int64(operation_setting.GetWebhookSetting().MaxSubscriptionsPerUser) {
+			common.ApiErrorMsg(c, "订阅数量已达上限")
+			return
+		}
+	}
+	subscription := model.WebhookSubscription{
+		UserId: ownerId,
+		Name:   req.Name,
+		Url:    req.Url,
+		Secret: req.Secret,
+		Status: req.Status,
+	}
+	if subscription.Secret == "" {
+		subscription.Secret = common.GetRandomString(32)
+	}
+	subscription.SetEvents(req.Events)
+	if err := subscription.Insert(); err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	common.ApiSuccess(c, subscription)
+}
+
+func updateWebhookSubscription(c *gin.Context, ownerId int) {
+	var req webhookSubscriptionRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	subscription, err := model.GetWebhookSubscriptionById(req.Id, ownerId)
+	if err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	if err := validateWebhookSubscription(&req, ownerId != systemWebhookOwner); err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	subscription.Name = req.Name
+	subscription.Url = req.Url
+	subscription.Status = req.Status
+	// 未填写密钥时保留原密钥
+	if req.Secret != "" {
+		subscription.Secret = req.Secret
+	}
+	subscription.SetEvents(req.Events)
+	if err := subscription.Update(); err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	common.ApiSuccess(c, subscription)
+}
+
+func deleteWebhookSubscription(c *gin.Context, ownerId int) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	if err := model.DeleteWebhookSubscription(id, ownerId); err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	common.ApiSuccess(c, nil)
+}
+
+// getWebhookDeliveries ownerId 为 -1 时查询所有投递记录
+func getWebhookDeliveries(c *gin.Context, ownerId int) {
+	pageInfo := common.GetPageQuery(c)
+	subscriptionId, _ := strconv.Atoi(c.Query("subscription_id"))
+	deliveries, total, err := model.GetWebhookDeliveries(ownerId, subscriptionId, c.Query("event_id"), c.Query("status"), pageInfo.GetStartIdx(), pageInfo.GetPageSize())
+	if err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	pageInfo.SetTotal(int(total))
+	pageInfo.SetItems(deliveries)
+	common.ApiSuccess(c, pageInfo)
+}
+
+// redeliverWebhook ownerId 为 -1 时可重新投递任意记录
+func redeliverWebhook(c *gin.Context, ownerId int) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	if err := model.RedeliverWebhook(id, ownerId); err != nil {
+		common.ApiError(c, err)
+		return
+	}
+	service.TriggerWebhookDelivery()
+	common.ApiSuccess(c, nil)
+}
+
+func GetSelfWebhooks(c *gin.Context) {
+	getWebhookSubscriptions(c, c.GetInt("id"))
+}
+
+func AddSelfWebhook(c *gin.Context) {
+	if !checkUserWebhookEnabled(c) {
+		return
+	}
+	addWebhookSubscription(c, c.GetInt("id"))
+}
+
+func UpdateSelfWebhook(c *gin.Context) {
+	if !checkUserWebhookEnabled(c) {
+		return
+	}
+	updateWebhookSubscription(c, c.GetInt("id"))
+}
+
+func DeleteSelfWebhook(c *gin.Context) {
+	deleteWebhookSubscription(c, c.GetInt("id"))
+}
+
+func GetSelfWebhookDeliveries(c *gin.Context) {
+	getWebhookDeliveries(c, c.GetInt("id"))
+}
+
+func RedeliverSelfWebhook(c *gin.Context) {
+	if !checkUserWebhookEnabled(c) {
+		return
+	}
+	redeliverWebhook(c, c.GetInt("id"))
+}
+
+func GetSystemWebhooks(c *gin.Context) {
+	getWebhookSubscriptions(c, systemWebhookOwner)
+}
+
+func AddSystemWebhook(c *gin.Context) {
+	addWebhookSubscription(c, systemWebhookOwner)
+}
+
+func UpdateSystemWebhook(c *gin.Context) {
+	updateWebhookSubscription(c, systemWebhookOwner)
+}
+
+func DeleteSystemWebhook(c *gin.Context) {
+	deleteWebhookSubscription(c, systemWebhookOwner)
+}
+
+func GetAllWebhookDeliveries(c *gin.Context) {
+	getWebhookDeliveries(c, -1)
+}
+
+func RedeliverAnyWebhook(c *gin.Context) {
+	redeliverWebhook(c, -1)
+}
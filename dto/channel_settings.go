@@ -31,6 +31,10 @@ type ChannelOtherSettings struct {
 	DisableStore          bool          `json:"disable_store,omitempty"`           // 是否禁用 store 透传（默认允许透传，禁用后可能导致 Codex 无法使用）
 	AllowSafetyIdentifier bool          `json:"allow_safety_identifier,omitempty"` // 是否允许 safety_identifier 透传（默认过滤以保护用户隐私）
 	AwsKeyType            AwsKeyType    `json:"aws_key_type,omitempty"`
+	// 将 Responses 请求转换为 Chat Completions 请求发送，用于不支持 Responses API 的 OpenAI 兼容渠道
+	ResponsesToChatCompletions bool `json:"responses_to_chat_completions,omitempty"`
+	// Bedrock Claude 模型使用 Converse 接口，默认使用原生 InvokeModel 接口
+	AwsClaudeUseConverse bool `json:"aws_claude_use_converse,omitempty"`
 }
 
 func (s *ChannelOtherSettings) IsOpenRouterEnterprise() bool {
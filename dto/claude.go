@@ -22,12 +22,15 @@ type ClaudeMediaMessage struct {
 	Source       *ClaudeMessageSource `json:"source,omitempty"`
 	Usage        *ClaudeUsage         `json:"usage,omitempty"`
 	StopReason   *string              `json:"stop_reason,omitempty"`
+	StopSequence *string              `json:"stop_sequence,omitempty"`
 	PartialJson  *string              `json:"partial_json,omitempty"`
 	Role         string               `json:"role,omitempty"`
 	Thinking     *string              `json:"thinking,omitempty"`
 	Signature    string               `json:"signature,omitempty"`
-	Delta        string               `json:"delta,omitempty"`
-	CacheControl json.RawMessage      `json:"cache_control,omitempty"`
+	// redacted_thinking 的加密内容
+	Data         string          `json:"data,omitempty"`
+	Delta        string          `json:"delta,omitempty"`
+	CacheControl json.RawMessage `json:"cache_control,omitempty"`
 	// tool_calls
 	Id        string `json:"id,omitempty"`
 	Name      string `json:"name,omitempty"`
@@ -438,6 +441,21 @@ func (c *ClaudeRequest) ParseSystem() []ClaudeMediaMessage {
 	return mediaContent
 }
 
+// ClaudeCountTokensRequest /v1/messages/count_tokens 请求体，上游不接受 max_tokens 等生成参数
+type ClaudeCountTokensRequest struct {
+	Model      string          `json:"model"`
+	System     any             `json:"system,omitempty"`
+	Messages   []ClaudeMessage `json:"messages"`
+	Tools      any             `json:"tools,omitempty"`
+	ToolChoice any             `json:"tool_choice,omitempty"`
+	Thinking   *Thinking       `json:"thinking,omitempty"`
+	McpServers json.RawMessage `json:"mcp_servers,omitempty"`
+}
+
+type ClaudeCountTokensResponse struct {
+	InputTokens int `json:"input_tokens"`
+}
+
 type ClaudeErrorWithStatusCode struct {
 	Error      types.ClaudeError `json:"error"`
 	StatusCode int               `json:"status_code"`
@@ -451,6 +469,7 @@ type ClaudeResponse struct {
 	Content      []ClaudeMediaMessage `json:"content,omitempty"`
 	Completion   string               `json:"completion,omitempty"`
 	StopReason   string               `json:"stop_reason,omitempty"`
+	StopSequence *string              `json:"stop_sequence,omitempty"`
 	Model        string               `json:"model,omitempty"`
 	Error        any                  `json:"error,omitempty"`
 	Usage        *ClaudeUsage         `json:"usage,omitempty"`
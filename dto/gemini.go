@@ -450,6 +450,24 @@ func (r *GeminiBatchEmbeddingRequest) SetModelName(modelName string) {
 	}
 }
 
+// GeminiCountTokensRequest models/{model}:countTokens 请求体，contents 与 generateContentRequest 二选一
+type GeminiCountTokensRequest struct {
+	Contents               []GeminiChatContent `json:"contents,omitempty"`
+	GenerateContentRequest *GeminiChatRequest  `json:"generateContentRequest,omitempty"`
+}
+
+// ToChatRequest 统一转换为 GeminiChatRequest，便于模型映射与本地计数
+func (r *GeminiCountTokensRequest) ToChatRequest() *GeminiChatRequest {
+	if r.GenerateContentRequest != nil {
+		return r.GenerateContentRequest
+	}
+	return &GeminiChatRequest{Contents: r.Contents}
+}
+
+type GeminiCountTokensResponse struct {
+	TotalTokens int `json:"totalTokens"`
+}
+
 type GeminiEmbeddingResponse struct {
 	Embedding ContentEmbedding `json:"embedding"`
 }
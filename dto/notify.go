@@ -5,6 +5,7 @@ type Notify struct {
 	Title   string        `json:"title"`
 	Content string        `json:"content"`
 	Values  []interface{} `json:"values"`
+	Data    any           `json:"data,omitempty"` // 结构化数据，仅随 webhook 发送
 }
 
 const ContentValueParam = "{{value}}"
@@ -13,6 +14,8 @@ const (
 	NotifyTypeQuotaExceed   = "quota_exceed"
 	NotifyTypeChannelUpdate = "channel_update"
 	NotifyTypeChannelTest   = "channel_test"
+	NotifyTypeUsageReport   = "usage_report"
+	NotifyTypeTaskReconcile = "task_reconcile"
 )
 
 func NewNotify(t string, title string, content string, values []interface{}) Notify {
@@ -280,18 +280,35 @@ func (r *GeneralOpenAIRequest) ParseInput() []string {
 }
 
 type Message struct {
-	Role             string          `json:"role"`
-	Content          any             `json:"content"`
-	Name             *string         `json:"name,omitempty"`
-	Prefix           *bool           `json:"prefix,omitempty"`
-	ReasoningContent string          `json:"reasoning_content,omitempty"`
-	Reasoning        string          `json:"reasoning,omitempty"`
-	ToolCalls        json.RawMessage `json:"tool_calls,omitempty"`
-	ToolCallId       string          `json:"tool_call_id,omitempty"`
+	Role             string  `json:"role"`
+	Content          any     `json:"content"`
+	Name             *string `json:"name,omitempty"`
+	Prefix           *bool   `json:"prefix,omitempty"`
+	ReasoningContent string  `json:"reasoning_content,omitempty"`
+	Reasoning        string  `json:"reasoning,omitempty"`
+	// 带签名或加密的推理内容（OpenRouter 格式），用于在多轮对话中回传 Claude 的 thinking 与 redacted_thinking
+	ReasoningDetails []ReasoningDetail `json:"reasoning_details,omitempty"`
+	ToolCalls        json.RawMessage   `json:"tool_calls,omitempty"`
+	ToolCallId       string            `json:"tool_call_id,omitempty"`
 	parsedContent    []MediaContent
 	//parsedStringContent *string
 }
 
+const (
+	ReasoningDetailTypeText      = "reasoning.text"
+	ReasoningDetailTypeEncrypted = "reasoning.encrypted"
+)
+
+// ReasoningDetail 推理内容明细，reasoning.text 对应 Claude 的 thinking（含签名），reasoning.encrypted 对应 redacted_thinking
+type ReasoningDetail struct {
+	Type      string `json:"type"`
+	Text      string `json:"text,omitempty"`
+	Signature string `json:"signature,omitempty"`
+	Data      string `json:"data,omitempty"`
+	Format    string `json:"format,omitempty"`
+	Index     *int   `json:"index,omitempty"`
+}
+
 type MediaContent struct {
 	Type       string `json:"type"`
 	Text       string `json:"text,omitempty"`
@@ -34,6 +34,10 @@ type OpenAITextResponseChoice struct {
 	Index        int `json:"index"`
 	Message      `json:"message"`
 	FinishReason string `json:"finish_reason"`
+	// 上游原始的结束原因（OpenRouter 等返回）
+	NativeFinishReason string `json:"native_finish_reason,omitempty"`
+	// 命中的停止序列（vLLM 等返回）
+	StopReason any `json:"stop_reason,omitempty"`
 }
 
 type OpenAITextResponse struct {
@@ -82,6 +86,10 @@ type ChatCompletionsStreamResponseChoice struct {
 	Logprobs     *any                                     `json:"logprobs"`
 	FinishReason *string                                  `json:"finish_reason"`
 	Index        int                                      `json:"index"`
+	// 上游原始的结束原因（OpenRouter 等返回）
+	NativeFinishReason string `json:"native_finish_reason,omitempty"`
+	// 命中的停止序列（vLLM 等返回）
+	StopReason any `json:"stop_reason,omitempty"`
 }
 
 type ChatCompletionsStreamResponseChoiceDelta struct {
@@ -90,6 +98,7 @@ type ChatCompletionsStreamResponseChoiceDelta struct {
 	Reasoning        *string            `json:"reasoning,omitempty"`
 	Role             string             `json:"role,omitempty"`
 	ToolCalls        []ToolCallResponse `json:"tool_calls,omitempty"`
+	ReasoningDetails []ReasoningDetail  `json:"reasoning_details,omitempty"`
 }
 
 func (c *ChatCompletionsStreamResponseChoiceDelta) SetContentString(s string) {
@@ -230,6 +239,8 @@ type Usage struct {
 	InputTokens            int                `json:"input_tokens"`
 	OutputTokens           int                `json:"output_tokens"`
 	InputTokensDetails     *InputTokenDetails `json:"input_tokens_details"`
+	// Responses API 的输出 token 明细
+	OutputTokensDetails *OutputTokenDetails `json:"output_tokens_details,omitempty"`
 
 	// claude cache 1h
 	ClaudeCacheCreation5mTokens int `json:"claude_cache_creation_5_m_tokens"`
@@ -330,17 +341,24 @@ func (o *OpenAIResponsesResponse) GetSize() string {
 }
 
 type IncompleteDetails struct {
-	Reasoning string `json:"reasoning"`
+	Reasoning string `json:"reasoning,omitempty"`
+	Reason    string `json:"reason,omitempty"`
 }
 
 type ResponsesOutput struct {
 	Type    string                   `json:"type"`
 	ID      string                   `json:"id"`
-	Status  string                   `json:"status"`
-	Role    string                   `json:"role"`
-	Content []ResponsesOutputContent `json:"content"`
-	Quality string                   `json:"quality"`
-	Size    string                   `json:"size"`
+	Status  string                   `json:"status,omitempty"`
+	Role    string                   `json:"role,omitempty"`
+	Content []ResponsesOutputContent `json:"content,omitempty"`
+	Quality string                   `json:"quality,omitempty"`
+	Size    string                   `json:"size,omitempty"`
+	// function_call
+	CallId    string `json:"call_id,omitempty"`
+	Name      string `json:"name,omitempty"`
+	Arguments string `json:"arguments,omitempty"`
+	// reasoning
+	Summary []ResponsesOutputContent `json:"summary,omitempty"`
 }
 
 type ResponsesOutputContent struct {
@@ -363,12 +381,45 @@ const (
 	ResponsesOutputTypeItemDone  = "response.output_item.done"
 )
 
+// Responses API 流式事件类型
+const (
+	ResponsesEventCreated                    = "response.created"
+	ResponsesEventInProgress                 = "response.in_progress"
+	ResponsesEventCompleted                  = "response.completed"
+	ResponsesEventIncomplete                 = "response.incomplete"
+	ResponsesEventContentPartAdded           = "response.content_part.added"
+	ResponsesEventContentPartDone            = "response.content_part.done"
+	ResponsesEventOutputTextDelta            = "response.output_text.delta"
+	ResponsesEventOutputTextDone             = "response.output_text.done"
+	ResponsesEventFunctionCallArgumentsDelta = "response.function_call_arguments.delta"
+	ResponsesEventFunctionCallArgumentsDone  = "response.function_call_arguments.done"
+	ResponsesEventReasoningSummaryPartAdded  = "response.reasoning_summary_part.added"
+	ResponsesEventReasoningSummaryPartDone   = "response.reasoning_summary_part.done"
+	ResponsesEventReasoningSummaryTextDelta  = "response.reasoning_summary_text.delta"
+	ResponsesEventReasoningSummaryTextDone   = "response.reasoning_summary_text.done"
+)
+
+// Responses API 输出项类型
+const (
+	ResponsesItemTypeMessage      = "message"
+	ResponsesItemTypeFunctionCall = "function_call"
+	ResponsesItemTypeReasoning    = "reasoning"
+)
+
 // ResponsesStreamResponse 用于处理 /v1/responses 流式响应
 type ResponsesStreamResponse struct {
-	Type     string                   `json:"type"`
-	Response *OpenAIResponsesResponse `json:"response,omitempty"`
-	Delta    string                   `json:"delta,omitempty"`
-	Item     *ResponsesOutput         `json:"item,omitempty"`
+	Type           string                   `json:"type"`
+	SequenceNumber int                      `json:"sequence_number"`
+	Response       *OpenAIResponsesResponse `json:"response,omitempty"`
+	Delta          string                   `json:"delta,omitempty"`
+	Item           *ResponsesOutput         `json:"item,omitempty"`
+	ItemId         string                   `json:"item_id,omitempty"`
+	OutputIndex    *int                     `json:"output_index,omitempty"`
+	ContentIndex   *int                     `json:"content_index,omitempty"`
+	SummaryIndex   *int                     `json:"summary_index,omitempty"`
+	Part           *ResponsesOutputContent  `json:"part,omitempty"`
+	Text           *string                  `json:"text,omitempty"`
+	Arguments      *string                  `json:"arguments,omitempty"`
 }
 
 // GetOpenAIError 从动态错误类型中提取OpenAIError结构
@@ -412,3 +463,9 @@ func GetOpenAIError(errorField any) *types.OpenAIError {
 		}
 	}
 }
+
+type OpenAIResponsesDeleteResponse struct {
+	Id      string `json:"id"`
+	Object  string `json:"object"`
+	Deleted bool   `json:"deleted"`
+}
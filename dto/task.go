@@ -1,5 +1,7 @@
 package dto
 
+import "encoding/json"
+
 type TaskError struct {
 	Code       string `json:"code"`
 	Message    string `json:"message"`
@@ -8,3 +10,38 @@ type TaskError struct {
 	LocalError bool   `json:"-"`
 	Error      error  `json:"-"`
 }
+
+const (
+	TaskObjectStatusQueued     = VideoStatusQueued
+	TaskObjectStatusInProgress = VideoStatusInProgress
+	TaskObjectStatusCompleted  = VideoStatusCompleted
+	TaskObjectStatusFailed     = VideoStatusFailed
+)
+
+// TaskObject 统一任务接口 /v1/tasks 返回的任务，各平台使用相同的状态
+type TaskObject struct {
+	ID          string           `json:"id"`
+	Object      string           `json:"object"`
+	Model       string           `json:"model"`
+	Platform    string           `json:"platform"`
+	Action      string           `json:"action"`
+	Status      string           `json:"status"` // queued / in_progress / completed / failed
+	Progress    int              `json:"progress"`
+	Url         string           `json:"url,omitempty"`        // 成功时的结果地址
+	MediaUrls   []string         `json:"media_urls,omitempty"` // 已保存到文件存储的结果，带签名的网关地址
+	Error       *TaskObjectError `json:"error,omitempty"`
+	CreatedAt   int64            `json:"created_at"`
+	CompletedAt int64            `json:"completed_at,omitempty"`
+	Data        json.RawMessage  `json:"data,omitempty"` // 上游返回的原始结果
+}
+
+type TaskObjectError struct {
+	Code    string `json:"code"`
+	Message string `json:"message"`
+}
+
+type TaskObjectList struct {
+	Object string        `json:"object"`
+	Data   []*TaskObject `json:"data"`
+	Total  int64         `json:"total"`
+}
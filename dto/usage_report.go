@@ -0,0 +1,34 @@
+package dto
+
+// UsageReport 用量报告，UserId 为 0 表示全站报告
+type UsageReport struct {
+	Period               string             `json:"period"`
+	StartTime            int64              `json:"start_time"`
+	EndTime              int64              `json:"end_time"`
+	UserId               int                `json:"user_id"`
+	Username             string             `json:"username,omitempty"`
+	Quota                int                `json:"quota"`
+	PreviousQuota        int                `json:"previous_quota"`
+	QuotaChange          *float64           `json:"quota_change"` // 相对上一周期的变化比例，上一周期无消费时为 null
+	Tokens               int                `json:"tokens"`
+	RequestCount         int                `json:"request_count"`
+	PreviousRequestCount int                `json:"previous_request_count"`
+	ErrorCount           int                `json:"error_count"`
+	ErrorRate            float64            `json:"error_rate"`
+	Models               []UsageReportModel `json:"models"`
+	TopTokens            []UsageReportToken `json:"top_tokens"`
+}
+
+type UsageReportModel struct {
+	ModelName    string `json:"model_name"`
+	Quota        int    `json:"quota"`
+	Tokens       int    `json:"tokens"`
+	RequestCount int    `json:"request_count"`
+}
+
+type UsageReportToken struct {
+	Username     string `json:"username,omitempty"`
+	TokenName    string `json:"token_name"`
+	Quota        int    `json:"quota"`
+	RequestCount int    `json:"request_count"`
+}
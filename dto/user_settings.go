@@ -10,14 +10,27 @@ type UserSetting struct {
 	GotifyUrl             string  `json:"gotify_url,omitempty"`                     // GotifyUrl Gotify服务器地址
 	GotifyToken           string  `json:"gotify_token,omitempty"`                   // GotifyToken Gotify应用令牌
 	GotifyPriority        int     `json:"gotify_priority"`                          // GotifyPriority Gotify消息优先级
+	SlackWebhookUrl       string  `json:"slack_webhook_url,omitempty"`              // SlackWebhookUrl Slack Incoming Webhook地址
+	TelegramChatId        string  `json:"telegram_chat_id,omitempty"`               // TelegramChatId Telegram会话ID，为空时使用绑定的Telegram账号
+	DingtalkWebhookUrl    string  `json:"dingtalk_webhook_url,omitempty"`           // DingtalkWebhookUrl 钉钉机器人地址
+	DingtalkSecret        string  `json:"dingtalk_secret,omitempty"`                // DingtalkSecret 钉钉机器人加签密钥
+	FeishuWebhookUrl      string  `json:"feishu_webhook_url,omitempty"`             // FeishuWebhookUrl 飞书机器人地址
+	FeishuSecret          string  `json:"feishu_secret,omitempty"`                  // FeishuSecret 飞书机器人签名校验密钥
+	WecomWebhookUrl       string  `json:"wecom_webhook_url,omitempty"`              // WecomWebhookUrl 企业微信机器人地址
+	UsageReportPeriod     string  `json:"usage_report_period,omitempty"`            // UsageReportPeriod 用量报告周期 daily/weekly/monthly，为空表示不订阅
 	AcceptUnsetRatioModel bool    `json:"accept_unset_model_ratio_model,omitempty"` // AcceptUnsetRatioModel 是否接受未设置价格的模型
 	RecordIpLog           bool    `json:"record_ip_log,omitempty"`                  // 是否记录请求和错误日志IP
 	SidebarModules        string  `json:"sidebar_modules,omitempty"`                // SidebarModules 左侧边栏模块配置
 }
 
 var (
-	NotifyTypeEmail   = "email"   // Email 邮件
-	NotifyTypeWebhook = "webhook" // Webhook
-	NotifyTypeBark    = "bark"    // Bark 推送
-	NotifyTypeGotify  = "gotify"  // Gotify 推送
+	NotifyTypeEmail    = "email"    // Email 邮件
+	NotifyTypeWebhook  = "webhook"  // Webhook
+	NotifyTypeBark     = "bark"     // Bark 推送
+	NotifyTypeGotify   = "gotify"   // Gotify 推送
+	NotifyTypeSlack    = "slack"    // Slack
+	NotifyTypeTelegram = "telegram" // Telegram 机器人
+	NotifyTypeDingtalk = "dingtalk" // 钉钉机器人
+	NotifyTypeFeishu   = "feishu"   // 飞书机器人
+	NotifyTypeWecom    = "wecom"    // 企业微信机器人
 )
@@ -77,6 +77,9 @@ func main() {
 		}
 	}()
 
+	// 在后台任务与 HTTP 服务启动前订阅，确保所有事件都写入 webhook 投递队列
+	service.SubscribeWebhookDeliveries()
+
 	if common.RedisEnabled {
 		// for compatibility with old versions
 		common.MemoryCacheEnabled = true
@@ -103,6 +106,11 @@ func main() {
 		go model.SyncChannelCache(common.SyncFrequency)
 	}
 
+	if common.RedisEnabled {
+		// 多节点共享渠道熔断状态
+		go model.SyncChannelBreakerState()
+	}
+
 	// 热更新配置
 	go model.SyncOptions(common.SyncFrequency)
 
@@ -119,13 +127,8 @@ func main() {
 
 	go controller.AutomaticallyTestChannels()
 
-	if common.IsMasterNode && constant.UpdateTask {
-		gopool.Go(func() {
-			controller.UpdateMidjourneyTaskBulk()
-		})
-		gopool.Go(func() {
-			controller.UpdateTaskBulk()
-		})
+	if constant.UpdateTask {
+		gopool.Go(controller.StartTaskPollScheduler)
 	}
 	if os.Getenv("BATCH_UPDATE_ENABLED") == "true" {
 		common.BatchUpdateEnabled = true
@@ -172,6 +175,32 @@ func main() {
 
 	// 设置路由
 	router.SetRouter(server, buildFS, indexPage)
+
+	if common.MetricsListenAddr != "" {
+		metricsServer := gin.New()
+		metricsServer.Use(gin.Recovery())
+		router.SetMetricsRouter(metricsServer)
+		gopool.Go(func() {
+			common.SysLog("metrics server listening on " + common.MetricsListenAddr)
+			if err := metricsServer.Run(common.MetricsListenAddr); err != nil {
+				common.SysError("failed to start metrics server: " + err.Error())
+			}
+		})
+	}
+
+	// 批处理的每一行请求都通过主路由执行
+	service.SetBatchRelayHandler(server)
+	gopool.Go(service.StartBatchWorker)
+	gopool.Go(service.StartWebhookDeliveryWorker)
+	controller.SubscribeTaskMediaStorage()
+	if common.IsMasterNode {
+		gopool.Go(service.StartPayloadCaptureCleaner)
+		gopool.Go(service.StartResponsesStoreCleaner)
+		gopool.Go(service.StartWebhookDeliveryCleaner)
+		gopool.Go(service.StartUsageReportScheduler)
+		gopool.Go(service.StartTaskReconcileScheduler)
+		gopool.Go(service.StartMediaAssetCleaner)
+	}
 	var port = os.Getenv("PORT")
 	if port == "" {
 		port = strconv.Itoa(*common.Port)
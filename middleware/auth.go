@@ -337,6 +337,13 @@ func SetupContextForToken(c *gin.Context, token *model.Token, parts ...string) e
 		c.Set("token_model_limit_enabled", false)
 	}
 	c.Set("token_group", token.Group)
+	c.Set("token_tpm_limit", token.TpmLimit)
+	c.Set("token_concurrency_limit", token.ConcurrencyLimit)
+	if token.ModelFallback != "" {
+		c.Set("token_model_fallback", token.GetModelFallbackMap())
+	}
+	c.Set("token_callback_url", token.CallbackUrl)
+	c.Set("token_callback_secret", token.CallbackSecret)
 	if len(parts) > 1 {
 		if model.IsAdmin(token.UserId) {
 			c.Set("specific_channel_id", parts[1])
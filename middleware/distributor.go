@@ -98,6 +98,15 @@ func Distribute() func(c *gin.Context) {
 					}
 				}
 				channel, selectGroup, err = service.CacheGetRandomSatisfiedChannel(c, usingGroup, modelRequest.Model, 0)
+				if err != nil || channel == nil {
+					// 主模型无可用渠道时按模型回退链选择渠道
+					fallbackModels := service.GetModelFallbackChain(c, usingGroup, modelRequest.Model)
+					if fallbackChannel, fallbackModel := service.CacheGetFallbackChannel(c, usingGroup, fallbackModels); fallbackChannel != nil {
+						common.SetContextKey(c, constant.ContextKeyModelFallbackFrom, modelRequest.Model)
+						modelRequest.Model = fallbackModel
+						channel, err = fallbackChannel, nil
+					}
+				}
 				if err != nil {
 					showGroup := usingGroup
 					if usingGroup == "auto" {
@@ -202,6 +211,13 @@ func getModelRequest(c *gin.Context) (*ModelRequest, bool, error) {
 			shouldSelectChannel = false
 		}
 		c.Set("relay_mode", relayMode)
+	} else if c.Request.URL.Path == "/v1/tasks" {
+		// 统一任务接口，relay_mode 由提交接口按渠道类型设置
+		req, err := getModelFromRequest(c)
+		if err != nil {
+			return nil, false, err
+		}
+		modelRequest.Model = req.Model
 	} else if strings.Contains(c.Request.URL.Path, "/v1/video/generations") {
 		relayMode := relayconstant.RelayModeUnknown
 		if c.Request.Method == http.MethodPost {
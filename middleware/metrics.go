@@ -0,0 +1,28 @@
+package middleware
+
+import (
+	"crypto/subtle"
+	"net/http"
+	"strings"
+
+	"github.com/QuantumNous/new-api/common"
+
+	"github.com/gin-gonic/gin"
+)
+
+// MetricsAuth 配置了 METRICS_TOKEN 时校验 Bearer Token，否则需要管理员权限
+func MetricsAuth() func(c *gin.Context) {
+	return func(c *gin.Context) {
+		if common.MetricsToken == "" {
+			authHelper(c, common.RoleAdminUser)
+			return
+		}
+		token := strings.TrimPrefix(c.Request.Header.Get("Authorization"), "Bearer ")
+		if subtle.ConstantTimeCompare([]byte(token), []byte(common.MetricsToken)) != 1 {
+			c.String(http.StatusUnauthorized, "unauthorized")
+			c.Abort()
+			return
+		}
+		c.Next()
+	}
+}
@@ -7,6 +7,7 @@ import (
 	"sync"
 
 	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/setting/operation_setting"
 
 	"github.com/samber/lo"
 	"gorm.io/gorm"
@@ -58,8 +59,8 @@ func GetAllEnableAbilities() []Ability {
 	return abilities
 }
 
-func getPriority(group string, model string, retry int) (int, error) {
-
+// getPriorities 返回分组下模型可用渠道的优先级，按降序排列
+func getPriorities(group string, model string) ([]int, error) {
 	var priorities []int
 	err := DB.Model(&Ability{}).
 		Select("DISTINCT(priority)").
@@ -69,12 +70,20 @@ func getPriority(group string, model string, retry int) (int, error) {
 
 	if err != nil {
 		// 处理错误
-		return 0, err
+		return nil, err
 	}
 
 	if len(priorities) == 0 {
 		// 如果没有查询到优先级，则返回错误
-		return 0, errors.New("数据库一致性被破坏")
+		return nil, errors.New("数据库一致性被破坏")
+	}
+	return priorities, nil
+}
+
+func getPriority(group string, model string, retry int) (int, error) {
+	priorities, err := getPriorities(group, model)
+	if err != nil {
+		return 0, err
 	}
 
 	// 确定要使用的优先级
@@ -119,6 +128,24 @@ func GetChannel(group string, model string, retry int) (*Channel, error) {
 	if err != nil {
 		return nil, err
 	}
+	// 过滤已熔断的渠道，当前优先级全部熔断时降级到更低的优先级
+	if len(abilities) > 0 && operation_setting.GetChannelBreakerSetting().Enabled {
+		abilities, err = filterAbilitiesByBreaker(group, model, retry, abilities)
+		if err != nil {
+			return nil, err
+		}
+		if len(abilities) == 0 {
+			return nil, fmt.Errorf("分组 %s 下模型 %s 的渠道均已熔断，请稍后再试", group, model)
+		}
+	}
+	// 非静态权重策略下，结合渠道健康统计选择
+	if strategy := operation_setting.GetChannelSelectStrategy(group); len(abilities) > 0 && strategy != operation_setting.ChannelSelectStrategyWeighted {
+		channels, err := getAbilityChannels(abilities)
+		if err != nil {
+			return nil, err
+		}
+		return selectChannelByHealth(channels, strategy), nil
+	}
 	channel := Channel{}
 	if len(abilities) > 0 {
 		// Randomly choose one
@@ -143,6 +170,68 @@ func GetChannel(group string, model string, retry int) (*Channel, error) {
 	return &channel, err
 }
 
+// filterAbilitiesByBreaker 过滤渠道已熔断的 abilities，当前优先级全部熔断时依次尝试更低的优先级
+func filterAbilitiesByBreaker(group string, model string, retry int, abilities []Ability) ([]Ability, error) {
+	priorities, err := getPriorities(group, model)
+	if err != nil {
+		return nil, err
+	}
+	for i := min(retry, len(priorities)-1); ; i++ {
+		channels, err := getAbilityChannels(abilities)
+		if err != nil {
+			return nil, err
+		}
+		available := make(map[int]bool, len(channels))
+		for _, channel := range filterChannelsByBreaker(channels) {
+			available[channel.Id] = true
+		}
+		filtered := lo.Filter(abilities, func(ability Ability, _ int) bool {
+			return available[ability.ChannelId]
+		})
+		if len(filtered) > 0 || i+1 >= len(priorities) {
+			return filtered, nil
+		}
+		abilities = nil
+		err = DB.Where(commonGroupCol+" = ? and model = ? and enabled = ? and priority = ?", group, model, true, priorities[i+1]).
+			Order("weight DESC").Find(&abilities).Error
+		if err != nil {
+			return nil, err
+		}
+	}
+}
+
+// getSamePriorityChannels 查询与 channelId 同一优先级的其他已启用渠道
+func getSamePriorityChannels(group string, model string, channelId int) ([]*Channel, error) {
+	var primary Ability
+	err := DB.Where(commonGroupCol+" = ? and model = ? and channel_id = ?", group, model, channelId).First(&primary).Error
+	if err != nil {
+		return nil, err
+	}
+	var abilities []Ability
+	err = DB.Where(commonGroupCol+" = ? and model = ? and enabled = ? and priority = ? and channel_id <> ?", group, model, true, lo.FromPtr(primary.Priority), channelId).
+		Find(&abilities).Error
+	if err != nil || len(abilities) == 0 {
+		return nil, err
+	}
+	return getAbilityChannels(abilities)
+}
+
+// getAbilityChannels 查询 abilities 对应的渠道，渠道不存在时返回错误
+func getAbilityChannels(abilities []Ability) ([]*Channel, error) {
+	ids := make([]int, 0, len(abilities))
+	for _, ability := range abilities {
+		ids = append(ids, ability.ChannelId)
+	}
+	var channels []*Channel
+	if err := DB.Where("id in (?)", ids).Find(&channels).Error; err != nil {
+		return nil, err
+	}
+	if len(channels) == 0 {
+		return nil, fmt.Errorf("数据库一致性错误，渠道# %d 不存在，请联系管理员修复", ids[0])
+	}
+	return channels, nil
+}
+
 func (channel *Channel) AddAbilities(tx *gorm.DB) error {
 	models_ := strings.Split(channel.Models, ",")
 	groups_ := strings.Split(channel.Group, ",")
@@ -0,0 +1,196 @@
+package model
+
+import (
+	"errors"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/dto"
+)
+
+const (
+	BatchStatusValidating = "validating"
+	BatchStatusFailed     = "failed"
+	BatchStatusInProgress = "in_progress"
+	BatchStatusFinalizing = "finalizing"
+	BatchStatusCompleted  = "completed"
+	BatchStatusExpired    = "expired"
+	BatchStatusCancelling = "cancelling"
+	BatchStatusCancelled  = "cancelled"
+)
+
+// Batch 批处理任务，每一行请求都以提交者的令牌经过正常的转发流程执行
+type Batch struct {
+	Id               string `json:"id" gorm:"type:varchar(64);primaryKey"`
+	UserId           int    `json:"user_id" gorm:"index"`
+	TokenId          int    `json:"token_id" gorm:"index"`
+	ClientIp         string `json:"-" gorm:"type:varchar(64)"`
+	Endpoint         string `json:"endpoint" gorm:"type:varchar(64)"`
+	InputFileId      string `json:"input_file_id" gorm:"type:varchar(64)"`
+	OutputFileId     string `json:"output_file_id" gorm:"type:varchar(64)"`
+	ErrorFileId      string `json:"error_file_id" gorm:"type:varchar(64)"`
+	CompletionWindow string `json:"completion_window" gorm:"type:varchar(16)"`
+	Status           string `json:"status" gorm:"type:varchar(20);index"`
+	Errors           string `json:"errors" gorm:"type:text"`
+	Metadata         string `json:"metadata" gorm:"type:text"`
+	TotalCount       int    `json:"total_count"`
+	CompletedCount   int    `json:"completed_count"`
+	FailedCount      int    `json:"failed_count"`
+	CreatedAt        int64  `json:"created_at" gorm:"bigint;index"`
+	InProgressAt     int64  `json:"in_progress_at" gorm:"bigint"`
+	ExpiresAt        int64  `json:"expires_at" gorm:"bigint"`
+	FinalizingAt     int64  `json:"finalizing_at" gorm:"bigint"`
+	CompletedAt      int64  `json:"completed_at" gorm:"bigint"`
+	FailedAt         int64  `json:"failed_at" gorm:"bigint"`
+	ExpiredAt        int64  `json:"expired_at" gorm:"bigint"`
+	CancellingAt     int64  `json:"cancelling_at" gorm:"bigint"`
+	CancelledAt      int64  `json:"cancelled_at" gorm:"bigint"`
+	HeartbeatAt      int64  `json:"heartbeat_at" gorm:"bigint"` // 执行节点定期更新，用于发现中断的任务
+}
+
+func NewBatchId() string {
+	return "batch_" + common.GetRandomString(24)
+}
+
+func (batch *Batch) Insert() error {
+	if batch.CreatedAt == 0 {
+		batch.CreatedAt = common.GetTimestamp()
+	}
+	return DB.Create(batch).Error
+}
+
+func (batch *Batch) Update() error {
+	return DB.Save(batch).Error
+}
+
+func (batch *Batch) IsFinished() bool {
+	switch batch.Status {
+	case BatchStatusCompleted, BatchStatusFailed, BatchStatusExpired, BatchStatusCancelled:
+		return true
+	}
+	return false
+}
+
+func optionalInt64(v int64) *int64 {
+	if v == 0 {
+		return nil
+	}
+	return &v
+}
+
+func optionalString(v string) *string {
+	if v == "" {
+		return nil
+	}
+	return &v
+}
+
+func (batch *Batch) ToOpenAIBatch() dto.OpenAIBatch {
+	result := dto.OpenAIBatch{
+		Id:               batch.Id,
+		Object:           "batch",
+		Endpoint:         batch.Endpoint,
+		InputFileId:      batch.InputFileId,
+		CompletionWindow: batch.CompletionWindow,
+		Status:           batch.Status,
+		OutputFileId:     optionalString(batch.OutputFileId),
+		ErrorFileId:      optionalString(batch.ErrorFileId),
+		CreatedAt:        batch.CreatedAt,
+		InProgressAt:     optionalInt64(batch.InProgressAt),
+		ExpiresAt:        optionalInt64(batch.ExpiresAt),
+		FinalizingAt:     optionalInt64(batch.FinalizingAt),
+		CompletedAt:      optionalInt64(batch.CompletedAt),
+		FailedAt:         optionalInt64(batch.FailedAt),
+		ExpiredAt:        optionalInt64(batch.ExpiredAt),
+		CancellingAt:     optionalInt64(batch.CancellingAt),
+		CancelledAt:      optionalInt64(batch.CancelledAt),
+		RequestCounts: dto.BatchRequestCounts{
+			Total:     batch.TotalCount,
+			Completed: batch.CompletedCount,
+			Failed:    batch.FailedCount,
+		},
+	}
+	if batch.Errors != "" {
+		var errs dto.BatchErrors
+		if err := common.UnmarshalJsonStr(batch.Errors, &errs); err == nil {
+			result.Errors = &errs
+		}
+	}
+	if batch.Metadata != "" {
+		_ = common.UnmarshalJsonStr(batch.Metadata, &result.Metadata)
+	}
+	return result
+}
+
+func GetBatchById(id string, userId int) (*Batch, error) {
+	if id == "" {
+		return nil, errors.New("id 为空！")
+	}
+	var batch Batch
+	err := DB.Where("id = ? AND user_id = ?", id, userId).First(&batch).Error
+	if err != nil {
+		return nil, err
+	}
+	return &batch, nil
+}
+
+func GetUserBatches(userId int, after string, limit int) ([]*Batch, error) {
+	var batches []*Batch
+	query := DB.Where("user_id = ?", userId)
+	if after != "" {
+		var cursor Batch
+		if err := DB.Select("created_at").Where("id = ? AND user_id = ?", after, userId).First(&cursor).Error; err == nil {
+			query = query.Where("created_at < ? OR (created_at = ? AND id < ?)", cursor.CreatedAt, cursor.CreatedAt, after)
+		}
+	}
+	err := query.Order("created_at desc, id desc").Limit(limit).Find(&batches).Error
+	return batches, err
+}
+
+// GetBatchStatus 只读取状态，用于执行过程中检查是否被取消
+func GetBatchStatus(id string) (string, error) {
+	var batch Batch
+	err := DB.Select("status").Where("id = ?", id).First(&batch).Error
+	return batch.Status, err
+}
+
+// ClaimBatch 以条件更新的方式领取任务，多节点部署时只有一个节点能领取成功
+func ClaimBatch(id string, status string, heartbeatBefore int64) (bool, error) {
+	result := DB.Model(&Batch{}).
+		Where("id = ? AND status = ? AND heartbeat_at < ?", id, status, heartbeatBefore).
+		Update("heartbeat_at", common.GetTimestamp())
+	return result.RowsAffected == 1, result.Error
+}
+
+// GetPendingBatches 获取待执行的任务，以及心跳超时（执行节点已退出）的任务
+func GetPendingBatches(heartbeatBefore int64, limit int) ([]*Batch, error) {
+	var batches []*Batch
+	err := DB.Where("status = ? OR (status IN ? AND heartbeat_at < ?)",
+		BatchStatusValidating, []string{BatchStatusInProgress, BatchStatusFinalizing, BatchStatusCancelling}, heartbeatBefore).
+		Order("created_at asc").Limit(limit).Find(&batches).Error
+	return batches, err
+}
+
+func UpdateBatchHeartbeat(id string) error {
+	return DB.Model(&Batch{}).Where("id = ?", id).Update("heartbeat_at", common.GetTimestamp()).Error
+}
+
+func UpdateBatchFields(id string, fields map[string]interface{}) error {
+	return DB.Model(&Batch{}).Where("id = ?", id).Updates(fields).Error
+}
+
+// TransitBatchStatus 仅当任务处于 fromStatus 时更新，避免覆盖用户在此期间发起的取消
+func TransitBatchStatus(id string, fromStatus string, fields map[string]interface{}) (bool, error) {
+	result := DB.Model(&Batch{}).Where("id = ? AND status = ?", id, fromStatus).Updates(fields)
+	return result.RowsAffected == 1, result.Error
+}
+
+// CancelBatch 将未结束的任务标记为取消中，由执行节点完成取消
+func CancelBatch(id string, userId int) (bool, error) {
+	result := DB.Model(&Batch{}).
+		Where("id = ? AND user_id = ? AND status IN ?", id, userId, []string{BatchStatusValidating, BatchStatusInProgress}).
+		Updates(map[string]interface{}{
+			"status":        BatchStatusCancelling,
+			"cancelling_at": common.GetTimestamp(),
+		})
+	return result.RowsAffected == 1, result.Error
+}
@@ -6,12 +6,14 @@ import (
 	"errors"
 	"fmt"
 	"math/rand"
+	"net/http"
 	"strings"
 	"sync"
 
 	"github.com/QuantumNous/new-api/common"
 	"github.com/QuantumNous/new-api/constant"
 	"github.com/QuantumNous/new-api/dto"
+	"github.com/QuantumNous/new-api/setting/operation_setting"
 	"github.com/QuantumNous/new-api/types"
 
 	"github.com/samber/lo"
@@ -55,6 +57,8 @@ type Channel struct {
 
 	// cache info
 	Keys []string `json:"-" gorm:"-"`
+	// 熔断状态，仅用于接口展示
+	Breaker []ChannelBreakerInfo `json:"breaker,omitempty" gorm:"-"`
 }
 
 type ChannelInfo struct {
@@ -144,12 +148,45 @@ func (channel *Channel) GetNextEnabledKey() (string, int, *types.NewAPIError) {
 	if len(enabledIdx) == 0 {
 		return "", 0, types.NewError(errors.New("no enabled keys"), types.ErrorCodeChannelNoAvailableKey)
 	}
+	// Skip keys whose circuit breaker is open; this is transient and must not disable the channel
+	availableIdx := make([]int, 0, len(enabledIdx))
+	for _, idx := range enabledIdx {
+		if ChannelBreakerAllow(channel.Id, idx) {
+			availableIdx = append(availableIdx, idx)
+		}
+	}
+	if len(availableIdx) == 0 {
+		return "", 0, types.NewErrorWithStatusCode(errors.New("all enabled keys are circuit open"), types.ErrorCodeChannelCircuitOpen, http.StatusServiceUnavailable)
+	}
+	enabledIdx = availableIdx
+	isAvailable := func(idx int) bool {
+		return getStatus(idx) == common.ChannelStatusEnabled && ChannelBreakerAllow(channel.Id, idx)
+	}
+
+	// 依次占用半开探测机会，全部被并发请求占用时视为熔断
+	acquireFirst := func(candidates []int) (string, int, *types.NewAPIError) {
+		for _, idx := range candidates {
+			if acquireChannelBreaker(channel.Id, idx) {
+				return keys[idx], idx, nil
+			}
+		}
+		return "", 0, types.NewErrorWithStatusCode(errors.New("all enabled keys are circuit open"), types.ErrorCodeChannelCircuitOpen, http.StatusServiceUnavailable)
+	}
 
 	switch channel.ChannelInfo.MultiKeyMode {
 	case constant.MultiKeyModeRandom:
-		// Randomly pick one enabled key
-		selectedIdx := enabledIdx[rand.Intn(len(enabledIdx))]
-		return keys[selectedIdx], selectedIdx, nil
+		// Randomly pick one enabled key, optionally weighted by per-key health score
+		for len(enabledIdx) > 0 {
+			selectedIdx := enabledIdx[rand.Intn(len(enabledIdx))]
+			if operation_setting.GetChannelSelectSetting().KeyHealthAware {
+				selectedIdx = selectKeyByHealth(channel.Id, enabledIdx)
+			}
+			if acquireChannelBreaker(channel.Id, selectedIdx) {
+				return keys[selectedIdx], selectedIdx, nil
+			}
+			enabledIdx = lo.Without(enabledIdx, selectedIdx)
+		}
+		return acquireFirst(enabledIdx)
 	case constant.MultiKeyModePolling:
 		// Use channel-specific lock to ensure thread-safe polling
 
@@ -175,17 +212,17 @@ func (channel *Channel) GetNextEnabledKey() (string, int, *types.NewAPIError) {
 		}
 		for i := 0; i < len(keys); i++ {
 			idx := (start + i) % len(keys)
-			if getStatus(idx) == common.ChannelStatusEnabled {
+			if isAvailable(idx) && acquireChannelBreaker(channel.Id, idx) {
 				// update polling index for next call (point to the next position)
 				channel.ChannelInfo.MultiKeyPollingIndex = (idx + 1) % len(keys)
 				return keys[idx], idx, nil
 			}
 		}
 		// Fallback – should not happen, but return first enabled key
-		return keys[enabledIdx[0]], enabledIdx[0], nil
+		return acquireFirst(enabledIdx)
 	default:
 		// Unknown mode, default to first enabled key (or original key string)
-		return keys[enabledIdx[0]], enabledIdx[0], nil
+		return acquireFirst(enabledIdx)
 	}
 }
 
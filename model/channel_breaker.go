@@ -0,0 +1,362 @@
+package model
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/setting/operation_setting"
+
+	"github.com/bytedance/gopkg/util/gopool"
+)
+
+// 熔断器状态
+const (
+	ChannelBreakerStateClosed   = "closed"
+	ChannelBreakerStateOpen     = "open"
+	ChannelBreakerStateHalfOpen = "half_open"
+)
+
+// channelBreakerRedisKey 多节点共享熔断状态的 Redis hash，field 为 "渠道id:key索引"
+const channelBreakerRedisKey = "channel_breaker"
+
+// 已关闭的熔断记录在 Redis 中保留的时间
+const channelBreakerClosedRetention = time.Hour
+
+// ChannelBreakerInfo 熔断器状态快照，用于渠道列表展示
+type ChannelBreakerInfo struct {
+	KeyIndex            int    `json:"key_index"`
+	State               string `json:"state"`
+	ConsecutiveFailures int    `json:"consecutive_failures"`
+	OpenedAt            int64  `json:"opened_at,omitempty"`
+	UpdatedAt           int64  `json:"updated_at"`
+}
+
+// channelBreakerShared 写入 Redis 的熔断状态，只包含需要跨节点同步的字段
+type channelBreakerShared struct {
+	Open      bool  `json:"open"`
+	OpenedAt  int64 `json:"opened_at"`
+	UpdatedAt int64 `json:"updated_at"`
+}
+
+// channelBreaker 熔断器只记录 open/closed，half-open 由冷却时间推导，
+// 因此跨节点同步时只需要同步 open 与 opened_at
+type channelBreaker struct {
+	mu          sync.Mutex
+	open        bool
+	failures    int
+	openedAt    int64 // unix second
+	lastProbeAt int64 // unix milli
+	updatedAt   int64 // unix milli
+}
+
+var channelBreakerMap = make(map[channelKeyRef]*channelBreaker)
+var channelBreakerLock sync.RWMutex
+
+func getChannelBreaker(channelId int, keyIndex int, create bool) *channelBreaker {
+	key := channelKeyRef{ChannelId: channelId, KeyIndex: keyIndex}
+	channelBreakerLock.RLock()
+	b, ok := channelBreakerMap[key]
+	channelBreakerLock.RUnlock()
+	if ok || !create {
+		return b
+	}
+	channelBreakerLock.Lock()
+	defer channelBreakerLock.Unlock()
+	if b, ok = channelBreakerMap[key]; ok {
+		return b
+	}
+	b = &channelBreaker{}
+	channelBreakerMap[key] = b
+	return b
+}
+
+// state 需持有 b.mu
+func (b *channelBreaker) state(now time.Time) string {
+	if !b.open {
+		return ChannelBreakerStateClosed
+	}
+	cooldown := int64(operation_setting.GetChannelBreakerSetting().CooldownSeconds)
+	if now.Unix()-b.openedAt >= cooldown {
+		return ChannelBreakerStateHalfOpen
+	}
+	return ChannelBreakerStateOpen
+}
+
+// allow 判断是否放行请求，acquire 为 true 时半开状态会占用一次探测机会，
+// 检查与占用在同一把锁内完成，同一探测间隔内只有一个请求能占用成功
+func (b *channelBreaker) allow(acquire bool) bool {
+	if b == nil {
+		return true
+	}
+	now := time.Now()
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	switch b.state(now) {
+	case ChannelBreakerStateOpen:
+		return false
+	case ChannelBreakerStateHalfOpen:
+		interval := int64(operation_setting.GetChannelBreakerSetting().HalfOpenProbeIntervalSeconds) * 1000
+		if now.UnixMilli()-b.lastProbeAt < interval {
+			return false
+		}
+		if acquire {
+			b.lastProbeAt = now.UnixMilli()
+		}
+		return true
+	default:
+		return true
+	}
+}
+
+// record 记录请求结果，返回状态是否发生变化
+func (b *channelBreaker) record(success bool) bool {
+	setting := operation_setting.GetChannelBreakerSetting()
+	now := time.Now()
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if success {
+		b.failures = 0
+		if b.open {
+			b.open = false
+			b.updatedAt = now.UnixMilli()
+			return true
+		}
+		return false
+	}
+	switch b.state(now) {
+	case ChannelBreakerStateOpen:
+		// 冷却中的失败（已在途的请求）不延长冷却时间
+		return false
+	case ChannelBreakerStateHalfOpen:
+		// 探测失败，重新熔断
+		b.openedAt = now.Unix()
+		b.updatedAt = now.UnixMilli()
+		return true
+	default:
+		b.failures++
+		if setting.FailureThreshold > 0 && b.failures >= setting.FailureThreshold {
+			b.open = true
+			b.openedAt = now.Unix()
+			b.updatedAt = now.UnixMilli()
+			return true
+		}
+		return false
+	}
+}
+
+func (b *channelBreaker) info(keyIndex int) ChannelBreakerInfo {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	info := ChannelBreakerInfo{
+		KeyIndex:            keyIndex,
+		State:               b.state(time.Now()),
+		ConsecutiveFailures: b.failures,
+		UpdatedAt:           b.updatedAt,
+	}
+	if b.open {
+		info.OpenedAt = b.openedAt
+	}
+	return info
+}
+
+func (b *channelBreaker) shared() channelBreakerShared {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return channelBreakerShared{
+		Open:      b.open,
+		OpenedAt:  b.openedAt,
+		UpdatedAt: b.updatedAt,
+	}
+}
+
+// ChannelBreakerAllow 判断渠道（或多 Key 渠道中的某个 Key）是否可以接收请求，不占用半开探测机会
+func ChannelBreakerAllow(channelId int, keyIndex int) bool {
+	if !operation_setting.GetChannelBreakerSetting().Enabled {
+		return true
+	}
+	return getChannelBreaker(channelId, keyIndex, false).allow(false)
+}
+
+// acquireChannelBreaker 选中渠道（或 Key）时调用，半开状态下占用探测机会。
+// 返回 false 表示探测机会已被并发请求占用，调用方需放弃该渠道重新选择，
+// 此时该渠道在本探测间隔内已不再通过熔断过滤
+func acquireChannelBreaker(channelId int, keyIndex int) bool {
+	if !operation_setting.GetChannelBreakerSetting().Enabled {
+		return true
+	}
+	return getChannelBreaker(channelId, keyIndex, false).allow(true)
+}
+
+// channelBreakerAvailable 判断渠道是否有可用的入口：单 Key 渠道看渠道自身，多 Key 渠道只要有一个 Key 未熔断即可
+func channelBreakerAvailable(channel *Channel) bool {
+	if !operation_setting.GetChannelBreakerSetting().Enabled {
+		return true
+	}
+	if !channel.ChannelInfo.IsMultiKey {
+		return ChannelBreakerAllow(channel.Id, channelKeyIndexAll)
+	}
+	for i := 0; i < channel.ChannelInfo.MultiKeySize; i++ {
+		if ChannelBreakerAllow(channel.Id, i) {
+			return true
+		}
+	}
+	return false
+}
+
+func filterChannelsByBreaker(channels []*Channel) []*Channel {
+	if !operation_setting.GetChannelBreakerSetting().Enabled {
+		return channels
+	}
+	filtered := make([]*Channel, 0, len(channels))
+	for _, channel := range channels {
+		if channelBreakerAvailable(channel) {
+			filtered = append(filtered, channel)
+		}
+	}
+	return filtered
+}
+
+// RecordChannelBreakerResult 记录请求结果并驱动熔断器状态变化，状态变化时同步到 Redis
+// 多 Key 渠道只按 Key 熔断，渠道在所有 Key 熔断后自然不可用
+func RecordChannelBreakerResult(channelId int, keyIndex int, success bool) {
+	if !operation_setting.GetChannelBreakerSetting().Enabled {
+		return
+	}
+	b := getChannelBreaker(channelId, keyIndex, !success)
+	if b == nil {
+		return
+	}
+	if !b.record(success) {
+		return
+	}
+	info := b.info(keyIndex)
+	common.SysLog(fmt.Sprintf("channel breaker state changed: channel_id=%d, key_index=%d, state=%s", channelId, keyIndex, info.State))
+	if common.RedisEnabled {
+		shared := b.shared()
+		gopool.Go(func() {
+			publishChannelBreaker(channelId, keyIndex, shared)
+		})
+	}
+}
+
+// ResetChannelBreaker 清除渠道的熔断状态，渠道被编辑后调用
+func ResetChannelBreaker(channelId int) {
+	channelBreakerLock.Lock()
+	var keys []channelKeyRef
+	for key := range channelBreakerMap {
+		if key.ChannelId == channelId {
+			keys = append(keys, key)
+			delete(channelBreakerMap, key)
+		}
+	}
+	channelBreakerLock.Unlock()
+	if common.RedisEnabled && len(keys) > 0 {
+		now := time.Now().UnixMilli()
+		for _, key := range keys {
+			publishChannelBreaker(key.ChannelId, key.KeyIndex, channelBreakerShared{UpdatedAt: now})
+		}
+	}
+}
+
+// GetChannelBreakerInfos 获取渠道所有非关闭状态或有失败计数的熔断器信息
+func GetChannelBreakerInfos(channelId int) []ChannelBreakerInfo {
+	channelBreakerLock.RLock()
+	breakers := make(map[int]*channelBreaker)
+	for key, b := range channelBreakerMap {
+		if key.ChannelId == channelId {
+			breakers[key.KeyIndex] = b
+		}
+	}
+	channelBreakerLock.RUnlock()
+
+	infos := make([]ChannelBreakerInfo, 0, len(breakers))
+	for keyIndex, b := range breakers {
+		info := b.info(keyIndex)
+		if info.State == ChannelBreakerStateClosed && info.ConsecutiveFailures == 0 {
+			continue
+		}
+		infos = append(infos, info)
+	}
+	sort.Slice(infos, func(i, j int) bool { return infos[i].KeyIndex < infos[j].KeyIndex })
+	return infos
+}
+
+func channelBreakerField(channelId int, keyIndex int) string {
+	return fmt.Sprintf("%d:%d", channelId, keyIndex)
+}
+
+func publishChannelBreaker(channelId int, keyIndex int, shared channelBreakerShared) {
+	data, err := common.Marshal(shared)
+	if err != nil {
+		return
+	}
+	err = common.RDB.HSet(context.Background(), channelBreakerRedisKey, channelBreakerField(channelId, keyIndex), string(data)).Err()
+	if err != nil {
+		common.SysError(fmt.Sprintf("failed to publish channel breaker state: channel_id=%d, key_index=%d, error=%v", channelId, keyIndex, err))
+	}
+}
+
+// syncChannelBreakerFromRedis 以更新时间较新的一方为准合并其他节点的熔断状态
+func syncChannelBreakerFromRedis() {
+	ctx := context.Background()
+	values, err := common.RDB.HGetAll(ctx, channelBreakerRedisKey).Result()
+	if err != nil {
+		common.SysError("failed to sync channel breaker state: " + err.Error())
+		return
+	}
+	now := time.Now()
+	for field, value := range values {
+		parts := strings.SplitN(field, ":", 2)
+		if len(parts) != 2 {
+			continue
+		}
+		channelId, err1 := strconv.Atoi(parts[0])
+		keyIndex, err2 := strconv.Atoi(parts[1])
+		if err1 != nil || err2 != nil {
+			continue
+		}
+		var shared channelBreakerShared
+		if err := common.UnmarshalJsonStr(value, &shared); err != nil {
+			continue
+		}
+		if !shared.Open && now.UnixMilli()-shared.UpdatedAt > channelBreakerClosedRetention.Milliseconds() {
+			common.RDB.HDel(ctx, channelBreakerRedisKey, field)
+			continue
+		}
+		b := getChannelBreaker(channelId, keyIndex, shared.Open)
+		if b == nil {
+			continue
+		}
+		b.mu.Lock()
+		if shared.UpdatedAt > b.updatedAt {
+			b.open = shared.Open
+			b.openedAt = shared.OpenedAt
+			b.updatedAt = shared.UpdatedAt
+			if !shared.Open {
+				b.failures = 0
+			}
+		}
+		b.mu.Unlock()
+	}
+}
+
+// SyncChannelBreakerState 定期从 Redis 同步熔断状态
+func SyncChannelBreakerState() {
+	for {
+		interval := operation_setting.GetChannelBreakerSetting().SyncIntervalSeconds
+		if interval <= 0 {
+			interval = 5
+		}
+		time.Sleep(time.Duration(interval) * time.Second)
+		if !common.RedisEnabled || !operation_setting.GetChannelBreakerSetting().Enabled {
+			continue
+		}
+		syncChannelBreakerFromRedis()
+	}
+}
@@ -0,0 +1,128 @@
+package model
+
+import (
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/QuantumNous/new-api/setting/operation_setting"
+)
+
+func setupChannelBreakerTest(t *testing.T) {
+	t.Helper()
+	setting := operation_setting.GetChannelBreakerSetting()
+	saved := *setting
+	setting.Enabled = true
+	setting.FailureThreshold = 3
+	setting.CooldownSeconds = 60
+	setting.HalfOpenProbeIntervalSeconds = 5
+	channelBreakerLock.Lock()
+	channelBreakerMap = make(map[channelKeyRef]*channelBreaker)
+	channelBreakerLock.Unlock()
+	t.Cleanup(func() {
+		*setting = saved
+	})
+}
+
+func TestChannelBreakerTransitions(t *testing.T) {
+	success, failure := true, false
+	tests := []struct {
+		name       string
+		failures   int
+		cooldown   bool // 冷却时间已过
+		probe      *bool
+		wantState  string
+		wantChange bool
+	}{
+		{name: "below threshold stays closed", failures: 2, wantState: ChannelBreakerStateClosed},
+		{name: "threshold opens", failures: 3, wantState: ChannelBreakerStateOpen, wantChange: true},
+		{name: "failures while open stay open", failures: 5, wantState: ChannelBreakerStateOpen, wantChange: true},
+		{name: "cooldown elapsed is half open", failures: 3, cooldown: true, wantState: ChannelBreakerStateHalfOpen, wantChange: true},
+		{name: "probe success closes", failures: 3, cooldown: true, probe: &success, wantState: ChannelBreakerStateClosed, wantChange: true},
+		{name: "probe failure reopens", failures: 3, cooldown: true, probe: &failure, wantState: ChannelBreakerStateOpen, wantChange: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			setupChannelBreakerTest(t)
+			b := &channelBreaker{}
+			changed := false
+			for i := 0; i < tt.failures; i++ {
+				changed = b.record(false) || changed
+			}
+			if tt.cooldown {
+				b.openedAt -= 61
+			}
+			if tt.probe != nil {
+				if !b.allow(true) {
+					t.Fatal("half open breaker must allow one probe")
+				}
+				changed = b.record(*tt.probe) || changed
+			}
+			if got := b.info(0).State; got != tt.wantState {
+				t.Errorf("state = %s, want %s", got, tt.wantState)
+			}
+			if changed != tt.wantChange {
+				t.Errorf("changed = %v, want %v", changed, tt.wantChange)
+			}
+		})
+	}
+}
+
+func TestChannelBreakerHalfOpenProbeSlot(t *testing.T) {
+	setupChannelBreakerTest(t)
+	b := getChannelBreaker(1, channelKeyIndexAll, true)
+	b.open = true
+	b.openedAt = time.Now().Unix() - 61
+
+	var acquired atomic.Int32
+	var wg sync.WaitGroup
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if ChannelBreakerAllow(1, channelKeyIndexAll) && acquireChannelBreaker(1, channelKeyIndexAll) {
+				acquired.Add(1)
+			}
+		}()
+	}
+	wg.Wait()
+	if got := acquired.Load(); got != 1 {
+		t.Fatalf("acquired probe slots = %d, want 1", got)
+	}
+	if ChannelBreakerAllow(1, channelKeyIndexAll) {
+		t.Error("half open channel must be filtered out after its probe slot is taken")
+	}
+}
+
+func TestSelectAcquiredChannelSkipsTakenProbeSlot(t *testing.T) {
+	setupChannelBreakerTest(t)
+	halfOpen := &Channel{Id: 1}
+	healthy := &Channel{Id: 2}
+	b := getChannelBreaker(halfOpen.Id, channelKeyIndexAll, true)
+	b.open = true
+	b.openedAt = time.Now().Unix() - 61
+
+	// 总是优先选择半开渠道，模拟并发请求都选中了同一个半开渠道
+	selectFn := func() (*Channel, error) {
+		candidates := filterChannelsByBreaker([]*Channel{halfOpen, healthy})
+		return candidates[0], nil
+	}
+	// 在选择与占用之间，探测机会被另一个请求占用
+	first := true
+	racingSelectFn := func() (*Channel, error) {
+		channel, err := selectFn()
+		if first {
+			first = false
+			acquireChannelBreaker(halfOpen.Id, channelKeyIndexAll)
+		}
+		return channel, err
+	}
+	channel, err := selectAcquiredChannel(racingSelectFn)
+	if err != nil {
+		t.Fatalf("selectAcquiredChannel: %v", err)
+	}
+	if channel.Id != healthy.Id {
+		t.Errorf("selected channel %d, want %d", channel.Id, healthy.Id)
+	}
+}
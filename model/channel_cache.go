@@ -11,6 +11,7 @@ import (
 
 	"github.com/QuantumNous/new-api/common"
 	"github.com/QuantumNous/new-api/constant"
+	"github.com/QuantumNous/new-api/setting/operation_setting"
 	"github.com/QuantumNous/new-api/setting/ratio_setting"
 )
 
@@ -94,14 +95,31 @@ func SyncChannelCache(frequency int) {
 }
 
 func GetRandomSatisfiedChannel(group string, model string, retry int) (*Channel, error) {
-	// if memory cache is disabled, get channel directly from database
-	if !common.MemoryCacheEnabled {
-		return GetChannel(group, model, retry)
-	}
+	return selectAcquiredChannel(func() (*Channel, error) {
+		if !common.MemoryCacheEnabled {
+			// if memory cache is disabled, get channel directly from database
+			return GetChannel(group, model, retry)
+		}
+		channelSyncLock.RLock()
+		defer channelSyncLock.RUnlock()
+		return getRandomSatisfiedChannel(group, model, retry)
+	})
+}
 
-	channelSyncLock.RLock()
-	defer channelSyncLock.RUnlock()
+// selectAcquiredChannel 选中渠道后占用半开探测机会，占用失败时重新选择。
+// 占用失败的渠道在本探测间隔内已不再通过熔断过滤，因此重新选择不会再次选中它
+func selectAcquiredChannel(selectFn func() (*Channel, error)) (*Channel, error) {
+	for {
+		channel, err := selectFn()
+		// 多 Key 渠道在选择 Key 时占用探测机会
+		if err != nil || channel == nil || channel.ChannelInfo.IsMultiKey || acquireChannelBreaker(channel.Id, channelKeyIndexAll) {
+			return channel, err
+		}
+	}
+}
 
+// getRandomSatisfiedChannel 需持有 channelSyncLock 读锁
+func getRandomSatisfiedChannel(group string, model string, retry int) (*Channel, error) {
 	// First, try to find channels with the exact model name.
 	channels := group2model2channels[group][model]
 
@@ -117,6 +135,9 @@ func GetRandomSatisfiedChannel(group string, model string, retry int) (*Channel,
 
 	if len(channels) == 1 {
 		if channel, ok := channelsIDM[channels[0]]; ok {
+			if !channelBreakerAvailable(channel) {
+				return nil, fmt.Errorf("渠道# %d 已熔断，请稍后再试", channel.Id)
+			}
 			return channel, nil
 		}
 		return nil, fmt.Errorf("数据库一致性错误，渠道# %d 不存在，请联系管理员修复", channels[0])
@@ -142,21 +163,73 @@ func GetRandomSatisfiedChannel(group string, model string, retry int) (*Channel,
 	targetPriority := int64(sortedUniquePriorities[retry])
 
 	// get the priority for the given retry number
-	var sumWeight = 0
-	var targetChannels []*Channel
-	for _, channelId := range channels {
-		if channel, ok := channelsIDM[channelId]; ok {
-			if channel.GetPriority() == targetPriority {
-				sumWeight += channel.GetWeight()
-				targetChannels = append(targetChannels, channel)
+	targetChannels := getChannelsByPriority(channels, targetPriority)
+
+	if len(targetChannels) == 0 {
+		return nil, errors.New(fmt.Sprintf("no channel found, group: %s, model: %s, priority: %d", group, model, targetPriority))
+	}
+
+	// 过滤已熔断的渠道，当前优先级全部熔断时降级到更低的优先级
+	targetChannels = filterChannelsByBreaker(targetChannels)
+	for i := retry + 1; len(targetChannels) == 0 && i < len(sortedUniquePriorities); i++ {
+		targetChannels = filterChannelsByBreaker(getChannelsByPriority(channels, int64(sortedUniquePriorities[i])))
+	}
+	if len(targetChannels) == 0 {
+		return nil, fmt.Errorf("分组 %s 下模型 %s 的渠道均已熔断，请稍后再试", group, model)
+	}
+
+	return selectChannel(group, targetChannels)
+}
+
+// GetRandomSatisfiedChannelExcept 在与 channelId 同一优先级的其他渠道中选择一个，用于对冲请求，没有可用渠道时返回 nil
+func GetRandomSatisfiedChannelExcept(group string, model string, channelId int) (*Channel, error) {
+	return selectAcquiredChannel(func() (*Channel, error) {
+		return getRandomSatisfiedChannelExcept(group, model, channelId)
+	})
+}
+
+func getRandomSatisfiedChannelExcept(group string, model string, channelId int) (*Channel, error) {
+	var candidates []*Channel
+	if !common.MemoryCacheEnabled {
+		var err error
+		candidates, err = getSamePriorityChannels(group, model, channelId)
+		if err != nil {
+			return nil, err
+		}
+	} else {
+		channelSyncLock.RLock()
+		defer channelSyncLock.RUnlock()
+		primary, ok := channelsIDM[channelId]
+		if !ok {
+			return nil, fmt.Errorf("渠道# %d，已不存在", channelId)
+		}
+		channels := group2model2channels[group][model]
+		if len(channels) == 0 {
+			channels = group2model2channels[group][ratio_setting.FormatMatchingModelName(model)]
+		}
+		for _, channel := range getChannelsByPriority(channels, primary.GetPriority()) {
+			if channel.Id != channelId {
+				candidates = append(candidates, channel)
 			}
-		} else {
-			return nil, fmt.Errorf("数据库一致性错误，渠道# %d 不存在，请联系管理员修复", channelId)
 		}
 	}
+	candidates = filterChannelsByBreaker(candidates)
+	if len(candidates) == 0 {
+		return nil, nil
+	}
+	return selectChannel(group, candidates)
+}
 
-	if len(targetChannels) == 0 {
-		return nil, errors.New(fmt.Sprintf("no channel found, group: %s, model: %s, priority: %d", group, model, targetPriority))
+// selectChannel 按分组的渠道选择策略在同一优先级的渠道中选择
+func selectChannel(group string, targetChannels []*Channel) (*Channel, error) {
+	// 非静态权重策略下，结合渠道健康统计选择
+	if strategy := operation_setting.GetChannelSelectStrategy(group); strategy != operation_setting.ChannelSelectStrategyWeighted {
+		return selectChannelByHealth(targetChannels, strategy), nil
+	}
+
+	var sumWeight = 0
+	for _, channel := range targetChannels {
+		sumWeight += channel.GetWeight()
 	}
 
 	// smoothing factor and adjustment
@@ -190,6 +263,17 @@ func GetRandomSatisfiedChannel(group string, model string, retry int) (*Channel,
 	return nil, errors.New("channel not found")
 }
 
+// getChannelsByPriority 需持有 channelSyncLock 读锁
+func getChannelsByPriority(channels []int, priority int64) []*Channel {
+	var result []*Channel
+	for _, channelId := range channels {
+		if channel, ok := channelsIDM[channelId]; ok && channel.GetPriority() == priority {
+			result = append(result, channel)
+		}
+	}
+	return result
+}
+
 func CacheGetChannel(id int) (*Channel, error) {
 	if !common.MemoryCacheEnabled {
 		return GetChannelById(id, true)
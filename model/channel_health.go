@@ -0,0 +1,328 @@
+package model
+
+import (
+	"math"
+	"math/rand"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/QuantumNous/new-api/setting/operation_setting"
+)
+
+// channelKeyIndexAll 表示渠道整体（不区分多 Key 索引）
+const channelKeyIndexAll = -1
+
+const channelHealthMaxSamples = 256
+
+type channelKeyRef struct {
+	ChannelId int
+	KeyIndex  int
+}
+
+type channelHealthSample struct {
+	At          int64 // unix milli
+	Success     bool
+	LatencyMs   int64 // 首字延迟，<=0 表示未知
+	RateLimited bool
+}
+
+// channelHealth 记录单个渠道（或多 Key 渠道中单个 Key）最近的请求结果
+type channelHealth struct {
+	mu      sync.Mutex
+	samples []channelHealthSample
+	next    int
+
+	ewmaSuccess   float64
+	ewmaLatencyMs float64
+	ewmaLimited   float64
+	lastUpdated   int64 // unix milli
+}
+
+// ChannelHealthStats 渠道健康统计快照，用于接口展示
+type ChannelHealthStats struct {
+	ChannelId    int     `json:"channel_id"`
+	KeyIndex     int     `json:"key_index"`
+	Samples      int     `json:"samples"`
+	SuccessRate  float64 `json:"success_rate"`
+	P50LatencyMs int64   `json:"p50_latency_ms"`
+	P95LatencyMs int64   `json:"p95_latency_ms"`
+	RateLimited  int     `json:"rate_limited"`
+	Score        float64 `json:"score"`
+	LastUpdated  int64   `json:"last_updated"`
+}
+
+var channelHealthMap = make(map[channelKeyRef]*channelHealth)
+var channelHealthLock sync.RWMutex
+
+func getChannelHealth(channelId int, keyIndex int, create bool) *channelHealth {
+	key := channelKeyRef{ChannelId: channelId, KeyIndex: keyIndex}
+	channelHealthLock.RLock()
+	h, ok := channelHealthMap[key]
+	channelHealthLock.RUnlock()
+	if ok || !create {
+		return h
+	}
+	channelHealthLock.Lock()
+	defer channelHealthLock.Unlock()
+	if h, ok = channelHealthMap[key]; ok {
+		return h
+	}
+	h = &channelHealth{ewmaSuccess: 1}
+	channelHealthMap[key] = h
+	return h
+}
+
+// RecordChannelHealth 记录一次渠道请求结果，keyIndex < 0 时只记录渠道整体
+func RecordChannelHealth(channelId int, keyIndex int, success bool, latency time.Duration, rateLimited bool) {
+	sample := channelHealthSample{
+		At:          time.Now().UnixMilli(),
+		Success:     success,
+		LatencyMs:   latency.Milliseconds(),
+		RateLimited: rateLimited,
+	}
+	getChannelHealth(channelId, channelKeyIndexAll, true).record(sample)
+	if keyIndex >= 0 {
+		getChannelHealth(channelId, keyIndex, true).record(sample)
+	}
+}
+
+// ResetChannelHealth 清除渠道的健康统计，渠道被手动启用或编辑后调用
+func ResetChannelHealth(channelId int) {
+	channelHealthLock.Lock()
+	defer channelHealthLock.Unlock()
+	for key := range channelHealthMap {
+		if key.ChannelId == channelId {
+			delete(channelHealthMap, key)
+		}
+	}
+}
+
+func (h *channelHealth) record(sample channelHealthSample) {
+	setting := operation_setting.GetChannelSelectSetting()
+	alpha := setting.EWMAAlpha
+	if alpha <= 0 || alpha > 1 {
+		alpha = 0.2
+	}
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	// 长时间没有流量时，旧的 EWMA 已不可信，重新开始统计
+	if h.lastUpdated > 0 && sample.At-h.lastUpdated > int64(setting.WindowSeconds)*1000 {
+		h.ewmaSuccess = 1
+		h.ewmaLatencyMs = 0
+		h.ewmaLimited = 0
+	}
+
+	if len(h.samples) < channelHealthMaxSamples {
+		h.samples = append(h.samples, sample)
+	} else {
+		h.samples[h.next] = sample
+	}
+	h.next = (h.next + 1) % channelHealthMaxSamples
+
+	successValue, limitedValue := 0.0, 0.0
+	if sample.Success {
+		successValue = 1
+	}
+	if sample.RateLimited {
+		limitedValue = 1
+	}
+	h.ewmaSuccess = alpha*successValue + (1-alpha)*h.ewmaSuccess
+	h.ewmaLimited = alpha*limitedValue + (1-alpha)*h.ewmaLimited
+	if sample.Success && sample.LatencyMs > 0 {
+		if h.ewmaLatencyMs == 0 {
+			h.ewmaLatencyMs = float64(sample.LatencyMs)
+		} else {
+			h.ewmaLatencyMs = alpha*float64(sample.LatencyMs) + (1-alpha)*h.ewmaLatencyMs
+		}
+	}
+	h.lastUpdated = sample.At
+}
+
+func (h *channelHealth) stats(channelId int, keyIndex int) ChannelHealthStats {
+	setting := operation_setting.GetChannelSelectSetting()
+	stats := ChannelHealthStats{
+		ChannelId:   channelId,
+		KeyIndex:    keyIndex,
+		SuccessRate: 1,
+		Score:       1,
+	}
+	if h == nil {
+		return stats
+	}
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	stats.LastUpdated = h.lastUpdated
+	windowStart := time.Now().UnixMilli() - int64(setting.WindowSeconds)*1000
+	successCount := 0
+	latencies := make([]int64, 0, len(h.samples))
+	for _, sample := range h.samples {
+		if sample.At < windowStart {
+			continue
+		}
+		stats.Samples++
+		if sample.Success {
+			successCount++
+			if sample.LatencyMs > 0 {
+				latencies = append(latencies, sample.LatencyMs)
+			}
+		}
+		if sample.RateLimited {
+			stats.RateLimited++
+		}
+	}
+	if stats.Samples > 0 {
+		stats.SuccessRate = float64(successCount) / float64(stats.Samples)
+	}
+	if len(latencies) > 0 {
+		sort.Slice(latencies, func(i, j int) bool { return latencies[i] < latencies[j] })
+		stats.P50LatencyMs = percentile(latencies, 0.5)
+		stats.P95LatencyMs = percentile(latencies, 0.95)
+	}
+
+	// 样本不足时视为健康
+	if stats.Samples < setting.MinSamples {
+		return stats
+	}
+
+	latencyFactor := 1.0
+	if h.ewmaLatencyMs > 0 && setting.LatencyReferenceMs > 0 {
+		ref := float64(setting.LatencyReferenceMs)
+		latencyFactor = ref / (ref + h.ewmaLatencyMs)
+	}
+	score := h.ewmaSuccess * latencyFactor * (1 - 0.5*h.ewmaLimited)
+	stats.Score = math.Max(score, setting.MinScoreRatio)
+	return stats
+}
+
+func percentile(sorted []int64, p float64) int64 {
+	if len(sorted) == 0 {
+		return 0
+	}
+	idx := int(math.Ceil(p*float64(len(sorted)))) - 1
+	if idx < 0 {
+		idx = 0
+	}
+	if idx >= len(sorted) {
+		idx = len(sorted) - 1
+	}
+	return sorted[idx]
+}
+
+// GetChannelHealthStats 获取渠道（或其某个 Key）的健康统计
+func GetChannelHealthStats(channelId int, keyIndex int) ChannelHealthStats {
+	return getChannelHealth(channelId, keyIndex, false).stats(channelId, keyIndex)
+}
+
+// GetAllChannelHealthStats 获取所有渠道的健康统计
+func GetAllChannelHealthStats() []ChannelHealthStats {
+	channelHealthLock.RLock()
+	keys := make([]channelKeyRef, 0, len(channelHealthMap))
+	for key := range channelHealthMap {
+		keys = append(keys, key)
+	}
+	channelHealthLock.RUnlock()
+
+	sort.Slice(keys, func(i, j int) bool {
+		if keys[i].ChannelId != keys[j].ChannelId {
+			return keys[i].ChannelId < keys[j].ChannelId
+		}
+		return keys[i].KeyIndex < keys[j].KeyIndex
+	})
+	result := make([]ChannelHealthStats, 0, len(keys))
+	for _, key := range keys {
+		result = append(result, GetChannelHealthStats(key.ChannelId, key.KeyIndex))
+	}
+	return result
+}
+
+// selectChannelByHealth 在同一优先级的渠道中，根据分组策略结合健康统计选择渠道
+func selectChannelByHealth(channels []*Channel, strategy string) *Channel {
+	if len(channels) == 0 {
+		return nil
+	}
+	stats := make([]ChannelHealthStats, len(channels))
+	for i, channel := range channels {
+		stats[i] = GetChannelHealthStats(channel.Id, channelKeyIndexAll)
+	}
+
+	switch strategy {
+	case operation_setting.ChannelSelectStrategyLeastLatency:
+		minSamples := operation_setting.GetChannelSelectSetting().MinSamples
+		// 样本不足的渠道优先探测，以便尽快获得延迟数据
+		var unknown []*Channel
+		var best *Channel
+		var bestLatency int64
+		for i, channel := range channels {
+			if stats[i].Samples < minSamples {
+				unknown = append(unknown, channel)
+				continue
+			}
+			// 没有成功记录（因此没有延迟数据）或成功率过低的渠道不参与延迟比较
+			if stats[i].P50LatencyMs == 0 || stats[i].SuccessRate < 0.5 {
+				continue
+			}
+			if best == nil || stats[i].P50LatencyMs < bestLatency {
+				best = channel
+				bestLatency = stats[i].P50LatencyMs
+			}
+		}
+		if len(unknown) > 0 {
+			return unknown[rand.Intn(len(unknown))]
+		}
+		if best != nil {
+			return best
+		}
+		// 没有可比较延迟的渠道，退化为按评分加权，失败多的渠道评分低
+		fallthrough
+	default:
+		sumWeight := 0
+		for _, channel := range channels {
+			sumWeight += channel.GetWeight()
+		}
+		weights := make([]float64, len(channels))
+		totalWeight := 0.0
+		for i, channel := range channels {
+			weight := float64(channel.GetWeight())
+			if sumWeight == 0 {
+				// 所有渠道权重为 0 时视为等权重
+				weight = 100
+			}
+			weights[i] = weight * stats[i].Score
+			totalWeight += weights[i]
+		}
+		if totalWeight <= 0 {
+			return channels[rand.Intn(len(channels))]
+		}
+		randomWeight := rand.Float64() * totalWeight
+		for i, channel := range channels {
+			randomWeight -= weights[i]
+			if randomWeight < 0 {
+				return channel
+			}
+		}
+		return channels[len(channels)-1]
+	}
+}
+
+// selectKeyByHealth 在多 Key 渠道的可用 Key 中按健康评分加权随机选择
+func selectKeyByHealth(channelId int, enabledIdx []int) int {
+	totalWeight := 0.0
+	weights := make([]float64, len(enabledIdx))
+	for i, idx := range enabledIdx {
+		weights[i] = GetChannelHealthStats(channelId, idx).Score
+		totalWeight += weights[i]
+	}
+	randomWeight := rand.Float64() * totalWeight
+	for i, idx := range enabledIdx {
+		randomWeight -= weights[i]
+		if randomWeight < 0 {
+			return idx
+		}
+	}
+	return enabledIdx[len(enabledIdx)-1]
+}
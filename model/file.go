@@ -0,0 +1,85 @@
+package model
+
+import (
+	"errors"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/dto"
+)
+
+const (
+	FilePurposeBatch       = "batch"
+	FilePurposeBatchOutput = "batch_output"
+)
+
+const (
+	FileStatusUploaded  = "uploaded"
+	FileStatusProcessed = "processed"
+)
+
+// File 用户上传或系统生成的文件，内容保存在存储后端
+type File struct {
+	Id         string `json:"id" gorm:"type:varchar(64);primaryKey"`
+	UserId     int    `json:"user_id" gorm:"index"`
+	Purpose    string `json:"purpose" gorm:"type:varchar(32);index"`
+	Filename   string `json:"filename" gorm:"type:varchar(255)"`
+	Bytes      int64  `json:"bytes"`
+	Status     string `json:"status" gorm:"type:varchar(20)"`
+	StorageKey string `json:"-" gorm:"type:varchar(255)"`
+	CreatedAt  int64  `json:"created_at" gorm:"bigint;index"`
+}
+
+func NewFileId() string {
+	return "file-" + common.GetRandomString(24)
+}
+
+func (file *File) Insert() error {
+	if file.CreatedAt == 0 {
+		file.CreatedAt = common.GetTimestamp()
+	}
+	return DB.Create(file).Error
+}
+
+func (file *File) ToOpenAIFile() dto.OpenAIFile {
+	return dto.OpenAIFile{
+		Id:        file.Id,
+		Object:    "file",
+		Bytes:     file.Bytes,
+		CreatedAt: file.CreatedAt,
+		Filename:  file.Filename,
+		Purpose:   file.Purpose,
+		Status:    file.Status,
+	}
+}
+
+func GetFileById(id string, userId int) (*File, error) {
+	if id == "" {
+		return nil, errors.New("id 为空！")
+	}
+	var file File
+	err := DB.Where("id = ? AND user_id = ?", id, userId).First(&file).Error
+	if err != nil {
+		return nil, err
+	}
+	return &file, nil
+}
+
+func GetUserFiles(userId int, purpose string, after string, limit int) ([]*File, error) {
+	var files []*File
+	query := DB.Where("user_id = ?", userId)
+	if purpose != "" {
+		query = query.Where("purpose = ?", purpose)
+	}
+	if after != "" {
+		var cursor File
+		if err := DB.Select("created_at").Where("id = ? AND user_id = ?", after, userId).First(&cursor).Error; err == nil {
+			query = query.Where("created_at < ? OR (created_at = ? AND id < ?)", cursor.CreatedAt, cursor.CreatedAt, after)
+		}
+	}
+	err := query.Order("created_at desc, id desc").Limit(limit).Find(&files).Error
+	return files, err
+}
+
+func DeleteFileById(id string, userId int) error {
+	return DB.Where("id = ? AND user_id = ?", id, userId).Delete(&File{}).Error
+}
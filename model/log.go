@@ -41,13 +41,15 @@ type Log struct {
 
 // don't use iota, avoid change log type value
 const (
-	LogTypeUnknown = 0
-	LogTypeTopup   = 1
-	LogTypeConsume = 2
-	LogTypeManage  = 3
-	LogTypeSystem  = 4
-	LogTypeError   = 5
-	LogTypeRefund  = 6
+	LogTypeUnknown       = 0
+	LogTypeTopup         = 1
+	LogTypeConsume       = 2
+	LogTypeManage        = 3
+	LogTypeSystem        = 4
+	LogTypeError         = 5
+	LogTypeRefund        = 6
+	LogTypeCacheHit      = 7 // 命中响应缓存的消费
+	LogTypeContentPolicy = 8 // 命中内容策略
 )
 
 func formatUserLogs(logs []*Log) {
@@ -100,7 +102,7 @@ func RecordErrorLog(c *gin.Context, userId int, channelId int, modelName string,
 	isStream bool, group string, other map[string]interface{}) {
 	logger.LogInfo(c, fmt.Sprintf("record error log: userId=%d, channelId=%d, modelName=%s, tokenName=%s, content=%s", userId, channelId, modelName, tokenName, content))
 	username := c.GetString("username")
-	otherStr := common.MapToJsonStr(other)
+	otherStr := common.MapToJsonStr(appendPayloadCaptureRef(c, other))
 	// 判断是否需要记录 IP - 系统设置优先
 	needRecordIp := common.LogIpEnabled
 	if !needRecordIp {
@@ -141,6 +143,59 @@ func RecordErrorLog(c *gin.Context, userId int, channelId int, modelName string,
 	}
 }
 
+// RecordContentPolicyLog 记录内容策略命中情况，other 中包含命中的规则明细
+func RecordContentPolicyLog(c *gin.Context, userId int, modelName string, tokenName string, tokenId int, group string, content string, other map[string]interface{}) {
+	logger.LogInfo(c, fmt.Sprintf("record content policy log: userId=%d, modelName=%s, tokenName=%s, content=%s", userId, modelName, tokenName, content))
+	log := &Log{
+		UserId:    userId,
+		Username:  c.GetString("username"),
+		CreatedAt: common.GetTimestamp(),
+		Type:      LogTypeContentPolicy,
+		Content:   content,
+		TokenName: tokenName,
+		ModelName: modelName,
+		TokenId:   tokenId,
+		Group:     group,
+		Ip:        c.ClientIP(),
+		Other:     common.MapToJsonStr(other),
+	}
+	if !common.LogIpEnabled {
+		if settingMap, err := GetUserSetting(userId, false); err != nil || !settingMap.RecordIpLog {
+			log.Ip = ""
+		}
+	}
+	err := LOG_DB.Create(log).Error
+	if err != nil {
+		logger.LogError(c, "failed to record log: "+err.Error())
+	}
+}
+
+// RecordTaskLog 记录异步任务结算产生的退款或补扣费日志，渠道、令牌与分组取自任务
+func RecordTaskLog(task *Task, logType int, params RecordConsumeLogParams) {
+	if logType == LogTypeConsume && !common.LogConsumeEnabled {
+		return
+	}
+	username, _ := GetUsernameById(task.UserId, false)
+	log := &Log{
+		UserId:    task.UserId,
+		Username:  username,
+		CreatedAt: common.GetTimestamp(),
+		Type:      logType,
+		Content:   params.Content,
+		TokenName: params.TokenName,
+		ModelName: params.ModelName,
+		Quota:     params.Quota,
+		ChannelId: task.ChannelId,
+		TokenId:   task.TokenId,
+		Group:     task.Group,
+		Other:     common.MapToJsonStr(params.Other),
+	}
+	err := LOG_DB.Create(log).Error
+	if err != nil {
+		common.SysLog("failed to record log: " + err.Error())
+	}
+}
+
 type RecordConsumeLogParams struct {
 	ChannelId        int                    `json:"channel_id"`
 	PromptTokens     int                    `json:"prompt_tokens"`
@@ -154,15 +209,17 @@ type RecordConsumeLogParams struct {
 	IsStream         bool                   `json:"is_stream"`
 	Group            string                 `json:"group"`
 	Other            map[string]interface{} `json:"other"`
+	LogType          int                    `json:"log_type"` // 默认为 LogTypeConsume
 }
 
 func RecordConsumeLog(c *gin.Context, userId int, params RecordConsumeLogParams) {
+	recordQuotaConsumedMetric(params.ModelName, params.Group, params.Quota)
 	if !common.LogConsumeEnabled {
 		return
 	}
 	logger.LogInfo(c, fmt.Sprintf("record consume log: userId=%d, params=%s", userId, common.GetJsonString(params)))
 	username := c.GetString("username")
-	otherStr := common.MapToJsonStr(params.Other)
+	otherStr := common.MapToJsonStr(appendPayloadCaptureRef(c, params.Other))
 	// 判断是否需要记录 IP - 系统设置优先
 	needRecordIp := common.LogIpEnabled
 	if !needRecordIp {
@@ -173,11 +230,15 @@ func RecordConsumeLog(c *gin.Context, userId int, params RecordConsumeLogParams)
 			}
 		}
 	}
+	logType := params.LogType
+	if logType == LogTypeUnknown {
+		logType = LogTypeConsume
+	}
 	log := &Log{
 		UserId:           userId,
 		Username:         username,
 		CreatedAt:        common.GetTimestamp(),
-		Type:             LogTypeConsume,
+		Type:             logType,
 		Content:          params.Content,
 		PromptTokens:     params.PromptTokens,
 		CompletionTokens: params.CompletionTokens,
@@ -326,9 +387,12 @@ type Stat struct {
 	Tpm   int `json:"tpm"`
 }
 
+// consumeLogTypes 计入消费统计的日志类型
+var consumeLogTypes = []int{LogTypeConsume, LogTypeCacheHit}
+
 func SumUsedQuota(logType int, startTimestamp int64, endTimestamp int64, modelName string, username string, tokenName string, channel int, group string) (stat Stat) {
 	// Query for quota (potentially wide time range)
-	txQuota := LOG_DB.Table("logs").Select("COALESCE(sum(quota), 0) as quota").Where("type = ?", LogTypeConsume)
+	txQuota := LOG_DB.Table("logs").Select("COALESCE(sum(quota), 0) as quota").Where("type IN ?", consumeLogTypes)
 
 	if username != "" {
 		txQuota = txQuota.Where("username = ?", username)
@@ -354,7 +418,7 @@ func SumUsedQuota(logType int, startTimestamp int64, endTimestamp int64, modelNa
 
 	// Query for rpm/tpm (last 60 seconds only for rate metrics)
 	rpmStart := time.Now().Add(-60 * time.Second).Unix()
-	txRate := LOG_DB.Table("logs").Select("COALESCE(count(*), 0) as rpm, COALESCE(sum(prompt_tokens) + sum(completion_tokens), 0) as tpm").Where("type = ? AND created_at >= ?", LogTypeConsume, rpmStart)
+	txRate := LOG_DB.Table("logs").Select("COALESCE(count(*), 0) as rpm, COALESCE(sum(prompt_tokens) + sum(completion_tokens), 0) as tpm").Where("type IN ? AND created_at >= ?", consumeLogTypes, rpmStart)
 
 	if username != "" {
 		txRate = txRate.Where("username = ?", username)
@@ -282,11 +282,21 @@ func migrateDB() error {
 		&TwoFA{},
 		&TwoFABackupCode{},
 		&CheckinLog{},
+		&QuotaBudget{},
+		&File{},
+		&Batch{},
+		&StoredResponse{},
+		&WebhookSubscription{},
+		&WebhookDelivery{},
+		&WebhookEvent{},
+		&UsageReport{},
+		&MediaAsset{},
+		&MediaUsage{},
 	)
 	if err != nil {
 		return err
 	}
-	return nil
+	return migrateMidjourneyTasks()
 }
 
 func migrateDBFast() error {
@@ -316,6 +326,16 @@ func migrateDBFast() error {
 		{&TwoFA{}, "TwoFA"},
 		{&TwoFABackupCode{}, "TwoFABackupCode"},
 		{&CheckinLog{}, "CheckinLog"},
+		{&QuotaBudget{}, "QuotaBudget"},
+		{&File{}, "File"},
+		{&Batch{}, "Batch"},
+		{&StoredResponse{}, "StoredResponse"},
+		{&WebhookSubscription{}, "WebhookSubscription"},
+		{&WebhookDelivery{}, "WebhookDelivery"},
+		{&WebhookEvent{}, "WebhookEvent"},
+		{&UsageReport{}, "UsageReport"},
+		{&MediaAsset{}, "MediaAsset"},
+		{&MediaUsage{}, "MediaUsage"},
 	}
 	// 动态计算migration数量，确保errChan缓冲区足够大
 	errChan := make(chan error, len(migrations))
@@ -341,12 +361,12 @@ func migrateDBFast() error {
 		}
 	}
 	common.SysLog("database migrated")
-	return nil
+	return migrateMidjourneyTasks()
 }
 
 func migrateLOGDB() error {
 	var err error
-	if err = LOG_DB.AutoMigrate(&Log{}); err != nil {
+	if err = LOG_DB.AutoMigrate(&Log{}, &PayloadCapture{}); err != nil {
 		return err
 	}
 	return nil
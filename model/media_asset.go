@@ -0,0 +1,210 @@
+package model
+
+import (
+	"github.com/QuantumNous/new-api/common"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+const (
+	MediaKindImage = "image"
+	MediaKindVideo = "video"
+	MediaKindAudio = "audio"
+)
+
+// 媒体文件的来源，SourceId 分别为任务 ID 与请求 ID
+const (
+	MediaSourceTask  = "task"
+	MediaSourceImage = "image"
+	MediaSourceAudio = "audio"
+)
+
+// MediaAsset 保存在文件存储后端的生成结果，(user_id, source, source_id, seq) 唯一，
+// 同一来源有多个文件时（如多张图片、多首歌曲）按 Seq 区分
+type MediaAsset struct {
+	Id          int    `json:"id"`
+	UserId      int    `json:"user_id" gorm:"uniqueIndex:idx_media_asset_source,priority:1"`
+	Source      string `json:"source" gorm:"type:varchar(16);uniqueIndex:idx_media_asset_source,priority:2"`
+	SourceId    string `json:"source_id" gorm:"type:varchar(191);uniqueIndex:idx_media_asset_source,priority:3"`
+	Seq         int    `json:"seq" gorm:"default:0;uniqueIndex:idx_media_asset_source,priority:4"`
+	Kind        string `json:"kind" gorm:"type:varchar(16);index"`
+	ModelName   string `json:"model_name" gorm:"default:''"`
+	ContentType string `json:"content_type" gorm:"type:varchar(128);default:''"`
+	Size        int64  `json:"size" gorm:"bigint;default:0"`
+	StorageKey  string `json:"-" gorm:"type:varchar(255)"`
+	CreatedAt   int64  `json:"created_at" gorm:"bigint;index"`
+	// 过期时间，0 表示永久保留
+	ExpiresAt int64 `json:"expires_at" gorm:"bigint;index"`
+}
+
+// MediaUsage 用户已使用与已预留的存储空间（字节），保存文件前先在此按条件预留，避免并发保存超出上限
+type MediaUsage struct {
+	UserId int   `json:"user_id" gorm:"primaryKey;autoIncrement:false"`
+	Used   int64 `json:"used" gorm:"bigint;default:0"`
+}
+
+// ClaimMediaAsset 插入媒体文件记录，同一来源已保存过时返回 false
+func ClaimMediaAsset(asset *MediaAsset) (bool, error) {
+	if asset.CreatedAt == 0 {
+		asset.CreatedAt = common.GetTimestamp()
+	}
+	result := DB.Clauses(clause.OnConflict{DoNothing: true}).Create(asset)
+	return result.RowsAffected == 1, result.Error
+}
+
+func GetMediaAssetById(id int) (*MediaAsset, error) {
+	var asset MediaAsset
+	err := DB.First(&asset, "id = ?", id).Error
+	if err != nil {
+		return nil, err
+	}
+	return &asset, nil
+}
+
+func GetUserMediaAsset(userId int, id int) (*MediaAsset, error) {
+	var asset MediaAsset
+	err := DB.First(&asset, "id = ? AND user_id = ?", id, userId).Error
+	if err != nil {
+		return nil, err
+	}
+	return &asset, nil
+}
+
+// GetMediaAssetsBySource 获取同一来源保存的全部文件，按 Seq 排序
+func GetMediaAssetsBySource(userId int, source string, sourceId string) ([]*MediaAsset, error) {
+	var assets []*MediaAsset
+	err := DB.Where("user_id = ? AND source = ? AND source_id = ?", userId, source, sourceId).
+		Order("seq").Find(&assets).Error
+	return assets, err
+}
+
+func GetUserMediaAssets(userId int, kind string, startIdx int, num int) (assets []*MediaAsset, total int64, err error) {
+	query := DB.Model(&MediaAsset{}).Where("user_id = ?", userId)
+	if kind != "" {
+		query = query.Where("kind = ?", kind)
+	}
+	err = query.Count(&total).Error
+	if err != nil {
+		return nil, 0, err
+	}
+	err = query.Order("id desc").Limit(num).Offset(startIdx).Find(&assets).Error
+	return assets, total, err
+}
+
+// initUserMediaUsage 用户首次保存文件时按已保存文件的大小初始化已用空间
+func initUserMediaUsage(userId int) error {
+	var count int64
+	if err := DB.Model(&MediaUsage{}).Where("user_id = ?", userId).Count(&count).Error; err != nil {
+		return err
+	}
+	if count > 0 {
+		return nil
+	}
+	var used int64
+	err := DB.Model(&MediaAsset{}).Select("COALESCE(sum(size), 0)").Where("user_id = ?", userId).Scan(&used).Error
+	if err != nil {
+		return err
+	}
+	return DB.Clauses(clause.OnConflict{DoNothing: true}).Create(&MediaUsage{UserId: userId, Used: used}).Error
+}
+
+// GetUserMediaUsage 返回用户已使用的存储空间（字节），包含正在保存的文件预留的空间
+func GetUserMediaUsage(userId int) (int64, error) {
+	if err := initUserMediaUsage(userId); err != nil {
+		return 0, err
+	}
+	var usage MediaUsage
+	err := DB.Where("user_id = ?", userId).First(&usage).Error
+	return usage.Used, err
+}
+
+// ReserveUserMediaUsage 在存储空间上限内为待保存的文件预留 size 字节，空间不足时返回 false，quota 为 0 表示不限制
+func ReserveUserMediaUsage(userId int, size int64, quota int64) (bool, error) {
+	if err := initUserMediaUsage(userId); err != nil {
+		return false, err
+	}
+	if size <= 0 {
+		return true, nil
+	}
+	query := DB.Model(&MediaUsage{}).Where("user_id = ?", userId)
+	if quota > 0 {
+		query = query.Where("used + ? <= ?", size, quota)
+	}
+	result := query.Update("used", gorm.Expr("used + ?", size))
+	return result.RowsAffected == 1, result.Error
+}
+
+// ReleaseUserMediaUsage 释放保存失败的文件预留的空间
+func ReleaseUserMediaUsage(userId int, size int64) error {
+	return updateUserMediaUsage(DB, userId, -size)
+}
+
+func updateUserMediaUsage(tx *gorm.DB, userId int, delta int64) error {
+	if delta == 0 {
+		return nil
+	}
+	return tx.Model(&MediaUsage{}).Where("user_id = ?", userId).Update("used", gorm.Expr("used + ?", delta)).Error
+}
+
+// UpdateMediaAssetContent 文件写入存储后端后更新大小与类型，并将预留的空间修正为实际大小
+func UpdateMediaAssetContent(asset *MediaAsset, reserved int64) error {
+	return DB.Transaction(func(tx *gorm.DB) error {
+		err := tx.Model(&MediaAsset{}).Where("id = ?", asset.Id).Updates(map[string]any{
+			"size":         asset.Size,
+			"content_type": asset.ContentType,
+			"kind":         asset.Kind,
+		}).Error
+		if err != nil {
+			return err
+		}
+		return updateUserMediaUsage(tx, asset.UserId, asset.Size-reserved)
+	})
+}
+
+// DeleteMediaAsset 删除文件记录并释放其占用的空间
+func DeleteMediaAsset(id int) error {
+	return DB.Transaction(func(tx *gorm.DB) error {
+		var asset MediaAsset
+		err := tx.Select("id", "user_id", "size").Where("id = ?", id).Limit(1).Find(&asset).Error
+		if err != nil || asset.Id == 0 {
+			return err
+		}
+		result := tx.Delete(&MediaAsset{}, id)
+		if result.Error != nil || result.RowsAffected == 0 {
+			return result.Error
+		}
+		return updateUserMediaUsage(tx, asset.UserId, -asset.Size)
+	})
+}
+
+// GetExpiredMediaAssets 返回过期时间早于 now 的文件，用于清理
+func GetExpiredMediaAssets(now int64, limit int) ([]*MediaAsset, error) {
+	var assets []*MediaAsset
+	err := DB.Select("id", "storage_key").Where("expires_at > 0 AND expires_at < ?", now).Order("id").Limit(limit).Find(&assets).Error
+	return assets, err
+}
+
+// DeleteMediaAssetsByIds 批量删除文件记录并释放各用户占用的空间
+func DeleteMediaAssetsByIds(ids []int) error {
+	if len(ids) == 0 {
+		return nil
+	}
+	return DB.Transaction(func(tx *gorm.DB) error {
+		var usages []*MediaUsage
+		err := tx.Model(&MediaAsset{}).Select("user_id, COALESCE(sum(size), 0) AS used").
+			Where("id IN ?", ids).Group("user_id").Scan(&usages).Error
+		if err != nil {
+			return err
+		}
+		if err := tx.Where("id IN ?", ids).Delete(&MediaAsset{}).Error; err != nil {
+			return err
+		}
+		for _, usage := range usages {
+			if err := updateUserMediaUsage(tx, usage.UserId, -usage.Used); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
@@ -0,0 +1,99 @@
+package model
+
+import (
+	"strconv"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/common/metrics"
+)
+
+var batchUpdateTypeNames = []string{"user_quota", "token_quota", "used_quota", "channel_used_quota", "request_count"}
+
+var quotaConsumedTotal = metrics.NewCounterVec("new_api_quota_consumed_total",
+	"Quota finally charged for relayed requests.", "model", "group")
+
+func init() {
+	metrics.NewGaugeFunc("new_api_channel_status", "Channel status, 1 for the current status of each channel.",
+		collectChannelStatus, "channel", "name", "type", "status")
+	metrics.NewGaugeFunc("new_api_channel_multi_key_keys", "Number of keys of multi-key channels by key status.",
+		collectChannelMultiKeyStatus, "channel", "status")
+	metrics.NewGaugeFunc("new_api_batch_update_queue_depth", "Number of pending records in the batch updater.",
+		collectBatchUpdateQueueDepth, "type")
+}
+
+func recordQuotaConsumedMetric(modelName string, group string, quota int) {
+	quotaConsumedTotal.Add(float64(quota), modelName, group)
+}
+
+func getChannelsForMetrics() []*Channel {
+	var channels []*Channel
+	err := DB.Select("id", "name", "type", "status", "channel_info").Find(&channels).Error
+	if err != nil {
+		common.SysError("failed to get channels for metrics: " + err.Error())
+		return nil
+	}
+	return channels
+}
+
+func channelStatusName(status int) string {
+	switch status {
+	case common.ChannelStatusEnabled:
+		return "enabled"
+	case common.ChannelStatusManuallyDisabled:
+		return "manually_disabled"
+	case common.ChannelStatusAutoDisabled:
+		return "auto_disabled"
+	default:
+		return "unknown"
+	}
+}
+
+func collectChannelStatus() []metrics.Sample {
+	channels := getChannelsForMetrics()
+	samples := make([]metrics.Sample, 0, len(channels))
+	for _, channel := range channels {
+		samples = append(samples, metrics.Sample{
+			Labels: []string{strconv.Itoa(channel.Id), channel.Name, strconv.Itoa(channel.Type), channelStatusName(channel.Status)},
+			Value:  1,
+		})
+	}
+	return samples
+}
+
+func collectChannelMultiKeyStatus() []metrics.Sample {
+	var samples []metrics.Sample
+	for _, channel := range getChannelsForMetrics() {
+		info := channel.ChannelInfo
+		if !info.IsMultiKey {
+			continue
+		}
+		counts := make(map[int]int)
+		for i := 0; i < info.MultiKeySize; i++ {
+			// 未记录状态的 key 视为启用
+			status, ok := info.MultiKeyStatusList[i]
+			if !ok {
+				status = common.ChannelStatusEnabled
+			}
+			counts[status]++
+		}
+		channelId := strconv.Itoa(channel.Id)
+		for _, status := range []int{common.ChannelStatusEnabled, common.ChannelStatusManuallyDisabled, common.ChannelStatusAutoDisabled} {
+			samples = append(samples, metrics.Sample{
+				Labels: []string{channelId, channelStatusName(status)},
+				Value:  float64(counts[status]),
+			})
+		}
+	}
+	return samples
+}
+
+func collectBatchUpdateQueueDepth() []metrics.Sample {
+	samples := make([]metrics.Sample, 0, BatchUpdateTypeCount)
+	for i := 0; i < BatchUpdateTypeCount; i++ {
+		batchUpdateLocks[i].Lock()
+		depth := len(batchUpdateStores[i])
+		batchUpdateLocks[i].Unlock()
+		samples = append(samples, metrics.Sample{Labels: []string{batchUpdateTypeNames[i]}, Value: float64(depth)})
+	}
+	return samples
+}
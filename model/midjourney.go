@@ -1,5 +1,20 @@
 package model
 
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/constant"
+	"github.com/QuantumNous/new-api/dto"
+
+	"gorm.io/gorm"
+)
+
+// Midjourney 旧版 Midjourney 任务记录，新任务保存在 tasks 表。
+// 旧记录在开启迁移后复制到 tasks 表并记录对应的任务 ID，原记录保留不删除；现同时作为 /mj 接口与管理页面的返回格式
 type Midjourney struct {
 	Id          int    `json:"id"`
 	Code        int    `json:"code"`
@@ -23,185 +38,274 @@ type Midjourney struct {
 	Quota       int    `json:"quota"`
 	Buttons     string `json:"buttons"`
 	Properties  string `json:"properties"`
+	TaskId      int64  `json:"task_id" gorm:"index;default:0"` // 迁移后 tasks 表中对应任务的 ID，0 表示尚未迁移
 }
 
-// TaskQueryParams 用于包含所有搜索条件的结构体，可以根据需求添加更多字段
-type TaskQueryParams struct {
-	ChannelID      string
-	MjID           string
-	StartTimestamp string
-	EndTimestamp   string
+// MidjourneyTaskPlatforms Midjourney 任务在 tasks 表中的平台，即 Midjourney 与 Midjourney Plus 渠道类型
+var MidjourneyTaskPlatforms = []constant.TaskPlatform{
+	constant.TaskPlatform(strconv.Itoa(constant.ChannelTypeMidjourney)),
+	constant.TaskPlatform(strconv.Itoa(constant.ChannelTypeMidjourneyPlus)),
 }
 
-func GetAllUserTask(userId int, startIdx int, num int, queryParams TaskQueryParams) []*Midjourney {
-	var tasks []*Midjourney
-	var err error
-
-	// 初始化查询构建器
-	query := DB.Where("user_id = ?", userId)
-
-	if queryParams.MjID != "" {
-		query = query.Where("mj_id = ?", queryParams.MjID)
-	}
-	if queryParams.StartTimestamp != "" {
-		// 假设您已将前端传来的时间戳转换为数据库所需的时间格式，并处理了时间戳的验证和解析
-		query = query.Where("submit_time >= ?", queryParams.StartTimestamp)
+// GetMidjourneyTask 按 Midjourney 任务 id 查询任务，不限用户，未迁移的旧记录转换为任务返回
+func GetMidjourneyTask(taskId string) (*Task, bool, error) {
+	if taskId == "" {
+		return nil, false, nil
 	}
-	if queryParams.EndTimestamp != "" {
-		query = query.Where("submit_time <= ?", queryParams.EndTimestamp)
+	var task *Task
+	err := DB.Where("task_id = ? AND platform IN ?", taskId, MidjourneyTaskPlatforms).First(&task).Error
+	exist, err := RecordExist(err)
+	if err != nil || exist {
+		return task, exist, err
 	}
-
-	// 获取数据
-	err = query.Order("id desc").Limit(num).Offset(startIdx).Find(&tasks).Error
-	if err != nil {
-		return nil
-	}
-
-	return tasks
+	return getLegacyMidjourneyTask(DB.Where("mj_id = ?", taskId))
 }
 
-func GetAllTasks(startIdx int, num int, queryParams TaskQueryParams) []*Midjourney {
-	var tasks []*Midjourney
-	var err error
-
-	// 初始化查询构建器
-	query := DB
-
-	// 添加过滤条件
-	if queryParams.ChannelID != "" {
-		query = query.Where("channel_id = ?", queryParams.ChannelID)
-	}
-	if queryParams.MjID != "" {
-		query = query.Where("mj_id = ?", queryParams.MjID)
-	}
-	if queryParams.StartTimestamp != "" {
-		query = query.Where("submit_time >= ?", queryParams.StartTimestamp)
+// GetUserMidjourneyTask 按 Midjourney 任务 id 查询用户的任务，未迁移的旧记录转换为任务返回
+func GetUserMidjourneyTask(userId int, taskId string) (*Task, bool, error) {
+	if taskId == "" {
+		return nil, false, nil
 	}
-	if queryParams.EndTimestamp != "" {
-		query = query.Where("submit_time <= ?", queryParams.EndTimestamp)
+	var task *Task
+	err := DB.Where("user_id = ? AND task_id = ? AND platform IN ?", userId, taskId, MidjourneyTaskPlatforms).First(&task).Error
+	exist, err := RecordExist(err)
+	if err != nil || exist {
+		return task, exist, err
 	}
-
-	// 获取数据
-	err = query.Order("id desc").Limit(num).Offset(startIdx).Find(&tasks).Error
-	if err != nil {
-		return nil
-	}
-
-	return tasks
+	return getLegacyMidjourneyTask(DB.Where("user_id = ? AND mj_id = ?", userId, taskId))
 }
 
-func GetAllUnFinishTasks() []*Midjourney {
-	var tasks []*Midjourney
-	var err error
-	// get all tasks progress is not 100%
-	err = DB.Where("progress != ?", "100%").Find(&tasks).Error
+// GetUserMidjourneyTasks 按 Midjourney 任务 id 批量查询用户的任务，包含未迁移的旧记录
+func GetUserMidjourneyTasks(userId int, taskIds []string) ([]*Task, error) {
+	if len(taskIds) == 0 {
+		return nil, nil
+	}
+	var tasks []*Task
+	err := DB.Where("user_id = ? AND task_id IN ? AND platform IN ?", userId, taskIds, MidjourneyTaskPlatforms).Find(&tasks).Error
 	if err != nil {
-		return nil
+		return nil, err
 	}
-	return tasks
-}
-
-func GetByOnlyMJId(mjId string) *Midjourney {
-	var mj *Midjourney
-	var err error
-	err = DB.Where("mj_id = ?", mjId).First(&mj).Error
+	var legacy []*Midjourney
+	err = DB.Where("user_id = ? AND mj_id IN ? AND task_id = 0", userId, taskIds).Find(&legacy).Error
 	if err != nil {
-		return nil
+		return nil, err
 	}
-	return mj
+	for _, midjourney := range legacy {
+		tasks = append(tasks, midjourney.toTask(midjourneyTaskPlatform(midjourney.ChannelId)))
+	}
+	return tasks, nil
 }
 
-func GetByMJId(userId int, mjId string) *Midjourney {
-	var mj *Midjourney
-	var err error
-	err = DB.Where("user_id = ? and mj_id = ?", userId, mjId).First(&mj).Error
-	if err != nil {
-		return nil
+func getLegacyMidjourneyTask(query *gorm.DB) (*Task, bool, error) {
+	var midjourney *Midjourney
+	err := query.Where("task_id = 0").First(&midjourney).Error
+	exist, err := RecordExist(err)
+	if err != nil || !exist {
+		return nil, false, err
 	}
-	return mj
+	return midjourney.toTask(midjourneyTaskPlatform(midjourney.ChannelId)), true, nil
 }
 
-func GetByMJIds(userId int, mjIds []string) []*Midjourney {
-	var mj []*Midjourney
-	var err error
-	err = DB.Where("user_id = ? and mj_id in (?)", userId, mjIds).Find(&mj).Error
+// GetUnfinishedMidjourneyTask 按 Midjourney 任务 id 查询未完成的任务
+func GetUnfinishedMidjourneyTask(taskId string) (*Task, bool, error) {
+	if taskId == "" {
+		return nil, false, nil
+	}
+	var task *Task
+	err := DB.Where("task_id = ? AND platform IN ?", taskId, MidjourneyTaskPlatforms).
+		Where("status NOT IN ?", []TaskStatus{TaskStatusFailure, TaskStatusSuccess}).
+		First(&task).Error
+	exist, err := RecordExist(err)
 	if err != nil {
-		return nil
+		return nil, false, err
 	}
-	return mj
+	return task, exist, err
 }
 
-func GetMjByuId(id int) *Midjourney {
-	var mj *Midjourney
-	var err error
-	err = DB.Where("id = ?", id).First(&mj).Error
-	if err != nil {
-		return nil
+// ToMidjourney 将 tasks 表中的 Midjourney 任务转换为旧版记录格式，任务详情取自上游返回的 Data
+func (t *Task) ToMidjourney() *Midjourney {
+	var data dto.MidjourneyDto
+	_ = common.Unmarshal(t.Data, &data)
+	mj := &Midjourney{
+		Id:          int(t.ID),
+		Code:        1,
+		UserId:      t.UserId,
+		Action:      t.Action,
+		MjId:        t.TaskID,
+		Prompt:      data.Prompt,
+		PromptEn:    data.PromptEn,
+		Description: data.Description,
+		State:       data.State,
+		SubmitTime:  t.SubmitTime * 1000,
+		StartTime:   t.StartTime * 1000,
+		FinishTime:  t.FinishTime * 1000,
+		ImageUrl:    data.ImageUrl,
+		VideoUrl:    data.VideoUrl,
+		Status:      string(t.Status),
+		Progress:    t.Progress,
+		ChannelId:   t.ChannelId,
+		Quota:       t.Quota,
+	}
+	// 未结束的任务保留上游状态，如等待补充的 MODAL
+	if t.Status != TaskStatusSuccess && t.Status != TaskStatusFailure && data.Status != "" {
+		mj.Status = data.Status
+	}
+	if t.Status == TaskStatusFailure {
+		mj.FailReason = t.FailReason
+	}
+	if len(data.VideoUrls) > 0 {
+		videoUrls, _ := json.Marshal(data.VideoUrls)
+		mj.VideoUrls = string(videoUrls)
+	}
+	if data.Buttons != nil {
+		buttons, _ := json.Marshal(data.Buttons)
+		mj.Buttons = string(buttons)
+	}
+	if data.Properties != nil {
+		properties, _ := json.Marshal(data.Properties)
+		mj.Properties = string(properties)
 	}
 	return mj
 }
 
-func UpdateProgress(id int, progress string) error {
-	return DB.Model(&Midjourney{}).Where("id = ?", id).Update("progress", progress).Error
-}
-
-func (midjourney *Midjourney) Insert() error {
-	var err error
-	err = DB.Create(midjourney).Error
-	return err
-}
-
-func (midjourney *Midjourney) Update() error {
-	var err error
-	err = DB.Save(midjourney).Error
-	return err
-}
-
-func MjBulkUpdate(mjIds []string, params map[string]any) error {
-	return DB.Model(&Midjourney{}).
-		Where("mj_id in (?)", mjIds).
-		Updates(params).Error
+// midjourneyTaskStatus 与 Midjourney 任务适配器解析上游状态的规则一致，原始状态保存在任务的 Data 中
+func midjourneyTaskStatus(status string) TaskStatus {
+	switch status {
+	case TaskStatusSuccess, TaskStatusFailure, TaskStatusInProgress:
+		return TaskStatus(status)
+	case "MODAL":
+		return TaskStatusInProgress
+	case "":
+		return TaskStatusNotStart
+	}
+	return TaskStatusSubmitted
 }
 
-func MjBulkUpdateByTaskIds(taskIDs []int, params map[string]any) error {
-	return DB.Model(&Midjourney{}).
-		Where("id in (?)", taskIDs).
-		Updates(params).Error
-}
+// toTask 将旧版记录转换为 tasks 表的任务，时间由毫秒转换为秒，任务详情按上游格式保存到 Data
+func (midjourney *Midjourney) toTask(platform constant.TaskPlatform) *Task {
+	data := dto.MidjourneyDto{
+		MjId:        midjourney.MjId,
+		Action:      midjourney.Action,
+		Prompt:      midjourney.Prompt,
+		PromptEn:    midjourney.PromptEn,
+		Description: midjourney.Description,
+		State:       midjourney.State,
+		SubmitTime:  midjourney.SubmitTime,
+		StartTime:   midjourney.StartTime,
+		FinishTime:  midjourney.FinishTime,
+		ImageUrl:    midjourney.ImageUrl,
+		VideoUrl:    midjourney.VideoUrl,
+		Status:      midjourney.Status,
+		Progress:    midjourney.Progress,
+		FailReason:  midjourney.FailReason,
+	}
+	if midjourney.VideoUrls != "" {
+		_ = json.Unmarshal([]byte(midjourney.VideoUrls), &data.VideoUrls)
+	}
+	if midjourney.Buttons != "" {
+		_ = json.Unmarshal([]byte(midjourney.Buttons), &data.Buttons)
+	}
+	if midjourney.Properties != "" {
+		_ = json.Unmarshal([]byte(midjourney.Properties), &data.Properties)
+	}
 
-// CountAllTasks returns total midjourney tasks for admin query
-func CountAllTasks(queryParams TaskQueryParams) int64 {
-	var total int64
-	query := DB.Model(&Midjourney{})
-	if queryParams.ChannelID != "" {
-		query = query.Where("channel_id = ?", queryParams.ChannelID)
+	task := &Task{
+		TaskID:     midjourney.MjId,
+		Platform:   platform,
+		UserId:     midjourney.UserId,
+		ChannelId:  midjourney.ChannelId,
+		Quota:      midjourney.Quota,
+		Action:     midjourney.Action,
+		Status:     midjourneyTaskStatus(midjourney.Status),
+		FailReason: midjourney.FailReason,
+		SubmitTime: midjourney.SubmitTime / 1000,
+		StartTime:  midjourney.StartTime / 1000,
+		FinishTime: midjourney.FinishTime / 1000,
+		Progress:   midjourney.Progress,
 	}
-	if queryParams.MjID != "" {
-		query = query.Where("mj_id = ?", queryParams.MjID)
+	task.SetData(data)
+	// 与 /mj 接口计费使用的模型名一致
+	task.Properties.OriginModelName = "mj_" + strings.ToLower(midjourney.Action)
+	if midjourney.Action == constant.MjActionSwapFace {
+		task.Properties.OriginModelName = "swap_face"
 	}
-	if queryParams.StartTimestamp != "" {
-		query = query.Where("submit_time >= ?", queryParams.StartTimestamp)
+	if task.Status == TaskStatusSuccess {
+		// 与任务轮询一致，成功任务的结果地址保存在 FailReason
+		task.FailReason = midjourney.ImageUrl
+		if midjourney.VideoUrl != "" {
+			task.FailReason = midjourney.VideoUrl
+		}
 	}
-	if queryParams.EndTimestamp != "" {
-		query = query.Where("submit_time <= ?", queryParams.EndTimestamp)
+	return task
+}
+
+// midjourneyTaskPlatform 按旧记录所属渠道的类型确定平台，渠道已删除时按 Midjourney 处理
+func midjourneyTaskPlatform(channelId int) constant.TaskPlatform {
+	channelType := 0
+	DB.Model(&Channel{}).Select("type").Where("id = ?", channelId).Scan(&channelType)
+	if channelType != constant.ChannelTypeMidjourneyPlus {
+		channelType = constant.ChannelTypeMidjourney
 	}
-	_ = query.Count(&total).Error
-	return total
+	return constant.TaskPlatform(strconv.Itoa(channelType))
 }
 
-// CountAllUserTask returns total midjourney tasks for user
-func CountAllUserTask(userId int, queryParams TaskQueryParams) int64 {
-	var total int64
-	query := DB.Model(&Midjourney{}).Where("user_id = ?", userId)
-	if queryParams.MjID != "" {
-		query = query.Where("mj_id = ?", queryParams.MjID)
+// migrateMidjourneyTasks 设置 MIDJOURNEY_TASK_MIGRATION_ENABLED=true 后，将未迁移的旧记录分批复制到 tasks 表，
+// 复制与记录对应任务 ID 在同一事务中完成，原记录保留；未开启时未迁移的记录仍可通过 /mj 接口按任务 id 查询
+func migrateMidjourneyTasks() error {
+	var pending int64
+	if err := DB.Model(&Midjourney{}).Where("task_id = 0").Count(&pending).Error; err != nil {
+		return err
 	}
-	if queryParams.StartTimestamp != "" {
-		query = query.Where("submit_time >= ?", queryParams.StartTimestamp)
+	if pending == 0 {
+		return nil
 	}
-	if queryParams.EndTimestamp != "" {
-		query = query.Where("submit_time <= ?", queryParams.EndTimestamp)
+	if !common.GetEnvOrDefaultBool("MIDJOURNEY_TASK_MIGRATION_ENABLED", false) {
+		common.SysLog(fmt.Sprintf("%d midjourney tasks are not migrated to the tasks table, set MIDJOURNEY_TASK_MIGRATION_ENABLED=true to migrate them", pending))
+		return nil
+	}
+
+	platforms := make(map[int]constant.TaskPlatform)
+	migrated := 0
+	for {
+		var rows []*Midjourney
+		if err := DB.Where("task_id = 0").Order("id").Limit(500).Find(&rows).Error; err != nil {
+			return err
+		}
+		if len(rows) == 0 {
+			break
+		}
+		err := DB.Transaction(func(tx *gorm.DB) error {
+			tasks := make([]*Task, 0, len(rows))
+			for _, row := range rows {
+				platform, ok := platforms[row.ChannelId]
+				if !ok {
+					platform = midjourneyTaskPlatform(row.ChannelId)
+					platforms[row.ChannelId] = platform
+				}
+				tasks = append(tasks, row.toTask(platform))
+			}
+			if err := tx.Create(&tasks).Error; err != nil {
+				return err
+			}
+			for i, row := range rows {
+				if tasks[i].ID == 0 {
+					return fmt.Errorf("midjourney task %d was not copied", row.Id)
+				}
+				result := tx.Model(&Midjourney{}).Where("id = ? AND task_id = 0", row.Id).Update("task_id", tasks[i].ID)
+				if result.Error != nil {
+					return result.Error
+				}
+				if result.RowsAffected != 1 {
+					return fmt.Errorf("midjourney task %d was migrated concurrently", row.Id)
+				}
+			}
+			return nil
+		})
+		if err != nil {
+			return fmt.Errorf("failed to migrate midjourney tasks: %w", err)
+		}
+		migrated += len(rows)
 	}
-	_ = query.Count(&total).Error
-	return total
+	common.SysLog(fmt.Sprintf("migrated %d midjourney tasks", migrated))
+	return nil
 }
@@ -0,0 +1,124 @@
+package model
+
+import (
+	"testing"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/constant"
+
+	"github.com/glebarez/sqlite"
+	"gorm.io/gorm"
+)
+
+func TestMidjourneyTaskStatusMapping(t *testing.T) {
+	tests := []struct {
+		name           string
+		legacyStatus   string
+		wantTaskStatus TaskStatus
+		// 转换回旧版格式后 /mj 接口返回的状态
+		wantMjStatus string
+	}{
+		{name: "success", legacyStatus: "SUCCESS", wantTaskStatus: TaskStatusSuccess, wantMjStatus: "SUCCESS"},
+		{name: "failure", legacyStatus: "FAILURE", wantTaskStatus: TaskStatusFailure, wantMjStatus: "FAILURE"},
+		{name: "in progress", legacyStatus: "IN_PROGRESS", wantTaskStatus: TaskStatusInProgress, wantMjStatus: "IN_PROGRESS"},
+		{name: "modal keeps upstream status", legacyStatus: "MODAL", wantTaskStatus: TaskStatusInProgress, wantMjStatus: "MODAL"},
+		{name: "submitted", legacyStatus: "SUBMITTED", wantTaskStatus: TaskStatusSubmitted, wantMjStatus: "SUBMITTED"},
+		{name: "not start", legacyStatus: "NOT_START", wantTaskStatus: TaskStatusSubmitted, wantMjStatus: "NOT_START"},
+		{name: "empty status is not failed", legacyStatus: "", wantTaskStatus: TaskStatusNotStart, wantMjStatus: "NOT_START"},
+		{name: "unknown status", legacyStatus: "QUEUED", wantTaskStatus: TaskStatusSubmitted, wantMjStatus: "QUEUED"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			legacy := &Midjourney{
+				MjId:       "mj-1",
+				UserId:     1,
+				Action:     constant.MjActionImagine,
+				Status:     tt.legacyStatus,
+				Progress:   "50%",
+				SubmitTime: 1700000000123,
+				ImageUrl:   "https://example.com/image.png",
+				FailReason: "upstream error",
+			}
+			task := legacy.toTask(constant.TaskPlatform("2"))
+			if task.Status != tt.wantTaskStatus {
+				t.Errorf("task status = %s, want %s", task.Status, tt.wantTaskStatus)
+			}
+			if task.SubmitTime != 1700000000 {
+				t.Errorf("submit time = %d, want seconds", task.SubmitTime)
+			}
+			if task.Properties.OriginModelName != "mj_imagine" {
+				t.Errorf("origin model name = %s, want mj_imagine", task.Properties.OriginModelName)
+			}
+			mj := task.ToMidjourney()
+			if mj.Status != tt.wantMjStatus {
+				t.Errorf("mj status = %s, want %s", mj.Status, tt.wantMjStatus)
+			}
+			if mj.Progress != legacy.Progress || mj.ImageUrl != legacy.ImageUrl || mj.MjId != legacy.MjId {
+				t.Errorf("mj = %+v, want fields copied from %+v", mj, legacy)
+			}
+			switch task.Status {
+			case TaskStatusSuccess:
+				if task.FailReason != legacy.ImageUrl {
+					t.Errorf("fail reason = %s, want result url", task.FailReason)
+				}
+			case TaskStatusFailure:
+				if mj.FailReason != legacy.FailReason {
+					t.Errorf("mj fail reason = %s, want %s", mj.FailReason, legacy.FailReason)
+				}
+			}
+		})
+	}
+}
+
+func TestMigrateMidjourneyTasks(t *testing.T) {
+	db, err := gorm.Open(sqlite.Open("file:"+t.Name()+"?mode=memory&cache=shared"), &gorm.Config{})
+	if err != nil {
+		t.Fatalf("open db: %v", err)
+	}
+	if err = db.AutoMigrate(&Channel{}, &Task{}, &Midjourney{}); err != nil {
+		t.Fatalf("migrate: %v", err)
+	}
+	DB = db
+	common.UsingSQLite = true
+
+	legacy := []*Midjourney{
+		{MjId: "mj-1", UserId: 1, Action: constant.MjActionImagine, Status: "SUCCESS", ImageUrl: "https://example.com/1.png"},
+		{MjId: "mj-2", UserId: 1, Action: constant.MjActionImagine, Status: "MODAL"},
+	}
+	if err = DB.Create(&legacy).Error; err != nil {
+		t.Fatalf("create legacy tasks: %v", err)
+	}
+
+	// 未开启迁移时不复制，但仍可按任务 id 查询
+	if err = migrateMidjourneyTasks(); err != nil {
+		t.Fatalf("migrateMidjourneyTasks: %v", err)
+	}
+	var count int64
+	DB.Model(&Task{}).Count(&count)
+	if count != 0 {
+		t.Fatalf("tasks = %d before migration is enabled, want 0", count)
+	}
+	task, exist, err := GetUserMidjourneyTask(1, "mj-2")
+	if err != nil || !exist || task.ToMidjourney().Status != "MODAL" {
+		t.Fatalf("legacy task lookup = %+v, %v, %v", task, exist, err)
+	}
+
+	t.Setenv("MIDJOURNEY_TASK_MIGRATION_ENABLED", "true")
+	for i := 0; i < 2; i++ {
+		if err = migrateMidjourneyTasks(); err != nil {
+			t.Fatalf("migrateMidjourneyTasks: %v", err)
+		}
+	}
+	DB.Model(&Task{}).Count(&count)
+	if count != int64(len(legacy)) {
+		t.Errorf("tasks = %d, want %d", count, len(legacy))
+	}
+	DB.Model(&Midjourney{}).Where("task_id <> 0").Count(&count)
+	if count != int64(len(legacy)) {
+		t.Errorf("migrated legacy rows = %d, want %d", count, len(legacy))
+	}
+	task, exist, err = GetUserMidjourneyTask(1, "mj-1")
+	if err != nil || !exist || task.ID == 0 || task.Status != TaskStatusSuccess {
+		t.Errorf("migrated task lookup = %+v, %v, %v", task, exist, err)
+	}
+}
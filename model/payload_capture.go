@@ -0,0 +1,81 @@
+package model
+
+import (
+	"errors"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/constant"
+
+	"github.com/gin-gonic/gin"
+)
+
+// PayloadCapture 单次请求的完整内容，通过 RequestId 与日志关联
+type PayloadCapture struct {
+	Id        int    `json:"id"`
+	RequestId string `json:"request_id" gorm:"type:varchar(64);uniqueIndex"`
+	CreatedAt int64  `json:"created_at" gorm:"bigint;index"`
+	UserId    int    `json:"user_id" gorm:"index"`
+	TokenId   int    `json:"token_id" gorm:"default:0"`
+	Group     string `json:"group" gorm:"type:varchar(64);default:''"`
+	ModelName string `json:"model_name" gorm:"default:''"`
+	ChannelId int    `json:"channel_id" gorm:"default:0"`
+	IsStream  bool   `json:"is_stream"`
+	// 最终发往上游的请求
+	UpstreamUrl string `json:"upstream_url"`
+	RequestBody string `json:"request_body" gorm:"type:text"`
+	// 上游返回的状态码与响应头
+	UpstreamStatus  int    `json:"upstream_status" gorm:"default:0"`
+	UpstreamHeaders string `json:"upstream_headers" gorm:"type:text"`
+	// 返回给客户端的响应，流式响应为合并后的内容
+	StatusCode   int    `json:"status_code" gorm:"default:0"`
+	ResponseBody string `json:"response_body" gorm:"type:text"`
+	Truncated    bool   `json:"truncated"`
+	// 使用文件存储时请求与响应保存在存储后端，数据库中的内容字段为空
+	StorageKey string `json:"-" gorm:"type:varchar(255);default:''"`
+}
+
+func (capture *PayloadCapture) Insert() error {
+	if capture.CreatedAt == 0 {
+		capture.CreatedAt = common.GetTimestamp()
+	}
+	return LOG_DB.Create(capture).Error
+}
+
+func GetPayloadCaptureByRequestId(requestId string) (*PayloadCapture, error) {
+	if requestId == "" {
+		return nil, errors.New("request_id 为空！")
+	}
+	var capture PayloadCapture
+	err := LOG_DB.Where("request_id = ?", requestId).First(&capture).Error
+	if err != nil {
+		return nil, err
+	}
+	return &capture, nil
+}
+
+// GetExpiredPayloadCaptures 返回早于 targetTimestamp 的记录，用于清理
+func GetExpiredPayloadCaptures(targetTimestamp int64, limit int) ([]*PayloadCapture, error) {
+	var captures []*PayloadCapture
+	err := LOG_DB.Select("id", "storage_key").Where("created_at < ?", targetTimestamp).Order("id").Limit(limit).Find(&captures).Error
+	return captures, err
+}
+
+func DeletePayloadCapturesByIds(ids []int) error {
+	if len(ids) == 0 {
+		return nil
+	}
+	return LOG_DB.Where("id IN ?", ids).Delete(&PayloadCapture{}).Error
+}
+
+// appendPayloadCaptureRef 请求内容被记录时，在日志中写入 request_id 以便查询
+func appendPayloadCaptureRef(c *gin.Context, other map[string]interface{}) map[string]interface{} {
+	if c == nil || !common.GetContextKeyBool(c, constant.ContextKeyPayloadCaptured) {
+		return other
+	}
+	if other == nil {
+		other = make(map[string]interface{})
+	}
+	other["request_id"] = c.GetString(common.RequestIdKey)
+	other["payload_captured"] = true
+	return other
+}
@@ -0,0 +1,296 @@
+package model
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// 预算主体类型
+const (
+	QuotaBudgetSubjectToken = "token"
+	QuotaBudgetSubjectUser  = "user"
+)
+
+// 预算周期，周期边界按服务器本地时区计算
+const (
+	QuotaBudgetPeriodHourly  = "hourly"
+	QuotaBudgetPeriodDaily   = "daily"
+	QuotaBudgetPeriodWeekly  = "weekly"
+	QuotaBudgetPeriodMonthly = "monthly"
+)
+
+// QuotaBudget 令牌或用户在一个周期内的消费上限，与令牌/用户自身的总额度相互独立
+type QuotaBudget struct {
+	Id          int    `json:"id"`
+	SubjectType string `json:"subject_type" gorm:"type:varchar(16);uniqueIndex:idx_quota_budget_subject"`
+	SubjectId   int    `json:"subject_id" gorm:"uniqueIndex:idx_quota_budget_subject"`
+	Period      string `json:"period" gorm:"type:varchar(16);uniqueIndex:idx_quota_budget_subject"`
+	Quota       int    `json:"quota" gorm:"default:0"`      // 周期内可消费额度
+	UsedQuota   int    `json:"used_quota" gorm:"default:0"` // 当前周期已消费额度
+	WindowStart int64  `json:"window_start" gorm:"bigint;default:0"`
+	ResetTime   int64  `json:"reset_time" gorm:"-"` // 当前周期结束时间，仅用于展示
+}
+
+func IsValidQuotaBudgetPeriod(period string) bool {
+	switch period {
+	case QuotaBudgetPeriodHourly, QuotaBudgetPeriodDaily, QuotaBudgetPeriodWeekly, QuotaBudgetPeriodMonthly:
+		return true
+	}
+	return false
+}
+
+// quotaBudgetWindow 返回 now 所在周期的起止时间
+func quotaBudgetWindow(period string, now time.Time) (time.Time, time.Time) {
+	y, m, d := now.Date()
+	switch period {
+	case QuotaBudgetPeriodHourly:
+		start := now.Truncate(time.Hour)
+		return start, start.Add(time.Hour)
+	case QuotaBudgetPeriodWeekly:
+		// 以周一为一周的开始
+		offset := (int(now.Weekday()) + 6) % 7
+		start := time.Date(y, m, d-offset, 0, 0, 0, 0, now.Location())
+		return start, start.AddDate(0, 0, 7)
+	case QuotaBudgetPeriodMonthly:
+		start := time.Date(y, m, 1, 0, 0, 0, 0, now.Location())
+		return start, start.AddDate(0, 1, 0)
+	default:
+		start := time.Date(y, m, d, 0, 0, 0, 0, now.Location())
+		return start, start.AddDate(0, 0, 1)
+	}
+}
+
+// refresh 周期已过时将已用额度视为 0，不写回数据库，写入由 RecordQuotaBudgetUsage 完成
+func (budget *QuotaBudget) refresh(now time.Time) {
+	start, end := quotaBudgetWindow(budget.Period, now)
+	if budget.WindowStart < start.Unix() {
+		budget.UsedQuota = 0
+		budget.WindowStart = start.Unix()
+	}
+	budget.ResetTime = end.Unix()
+}
+
+func (budget *QuotaBudget) Remain() int {
+	return budget.Quota - budget.UsedQuota
+}
+
+func (budget *QuotaBudget) GetSubjectName() string {
+	if budget.SubjectType == QuotaBudgetSubjectUser {
+		return "用户"
+	}
+	return "令牌"
+}
+
+func (budget *QuotaBudget) GetPeriodName() string {
+	switch budget.Period {
+	case QuotaBudgetPeriodHourly:
+		return "每小时"
+	case QuotaBudgetPeriodWeekly:
+		return "每周"
+	case QuotaBudgetPeriodMonthly:
+		return "每月"
+	default:
+		return "每日"
+	}
+}
+
+func getQuotaBudgets(userId int, tokenId int) ([]*QuotaBudget, error) {
+	var budgets []*QuotaBudget
+	query := DB.Where("subject_type = ? AND subject_id = ?", QuotaBudgetSubjectUser, userId)
+	if tokenId != 0 {
+		query = query.Or("subject_type = ? AND subject_id = ?", QuotaBudgetSubjectToken, tokenId)
+	}
+	err := query.Find(&budgets).Error
+	return budgets, err
+}
+
+// GetQuotaBudgets 获取单个主体的预算及当前周期用量
+func GetQuotaBudgets(subjectType string, subjectId int) ([]*QuotaBudget, error) {
+	budgets, err := getQuotaBudgetsBySubjects(subjectType, []int{subjectId})
+	if err != nil {
+		return nil, err
+	}
+	return budgets[subjectId], nil
+}
+
+func getQuotaBudgetsBySubjects(subjectType string, subjectIds []int) (map[int][]*QuotaBudget, error) {
+	result := make(map[int][]*QuotaBudget)
+	if len(subjectIds) == 0 {
+		return result, nil
+	}
+	var budgets []*QuotaBudget
+	err := DB.Where("subject_type = ? AND subject_id IN ?", subjectType, subjectIds).Order("id asc").Find(&budgets).Error
+	if err != nil {
+		return nil, err
+	}
+	now := time.Now()
+	for _, budget := range budgets {
+		budget.refresh(now)
+		result[budget.SubjectId] = append(result[budget.SubjectId], budget)
+	}
+	return result, nil
+}
+
+// FillTokenQuotaBudgets 为令牌列表填充预算信息
+func FillTokenQuotaBudgets(tokens []*Token) error {
+	ids := make([]int, 0, len(tokens))
+	for _, token := range tokens {
+		ids = append(ids, token.Id)
+	}
+	budgets, err := getQuotaBudgetsBySubjects(QuotaBudgetSubjectToken, ids)
+	if err != nil {
+		return err
+	}
+	for _, token := range tokens {
+		token.Budgets = budgets[token.Id]
+	}
+	return nil
+}
+
+// FillUserQuotaBudgets 为用户列表填充预算信息
+func FillUserQuotaBudgets(users []*User) error {
+	ids := make([]int, 0, len(users))
+	for _, user := range users {
+		ids = append(ids, user.Id)
+	}
+	budgets, err := getQuotaBudgetsBySubjects(QuotaBudgetSubjectUser, ids)
+	if err != nil {
+		return err
+	}
+	for _, user := range users {
+		user.Budgets = budgets[user.Id]
+	}
+	return nil
+}
+
+// UpdateQuotaBudgets 以传入的预算列表覆盖主体的全部预算
+// 已存在的周期保留当前用量，除非传入的已用额度与数据库不同（视为手动调整，从当前周期重新计算）
+func UpdateQuotaBudgets(subjectType string, subjectId int, budgets []*QuotaBudget) error {
+	seen := make(map[string]bool)
+	for _, budget := range budgets {
+		if !IsValidQuotaBudgetPeriod(budget.Period) {
+			return fmt.Errorf("无效的预算周期: %s", budget.Period)
+		}
+		if seen[budget.Period] {
+			return fmt.Errorf("预算周期重复: %s", budget.Period)
+		}
+		if budget.Quota < 0 || budget.UsedQuota < 0 {
+			return errors.New("预算额度不能为负数")
+		}
+		seen[budget.Period] = true
+	}
+	now := time.Now()
+	return DB.Transaction(func(tx *gorm.DB) error {
+		var existing []*QuotaBudget
+		if err := tx.Where("subject_type = ? AND subject_id = ?", subjectType, subjectId).Find(&existing).Error; err != nil {
+			return err
+		}
+		existingMap := make(map[string]*QuotaBudget, len(existing))
+		for _, budget := range existing {
+			if !seen[budget.Period] {
+				if err := tx.Delete(budget).Error; err != nil {
+					return err
+				}
+				continue
+			}
+			budget.refresh(now)
+			existingMap[budget.Period] = budget
+		}
+		for _, budget := range budgets {
+			start, _ := quotaBudgetWindow(budget.Period, now)
+			if old, ok := existingMap[budget.Period]; ok {
+				updates := map[string]interface{}{
+					"quota": budget.Quota,
+				}
+				if budget.UsedQuota != old.UsedQuota {
+					updates["used_quota"] = budget.UsedQuota
+					updates["window_start"] = start.Unix()
+				}
+				if err := tx.Model(&QuotaBudget{}).Where("id = ?", old.Id).Updates(updates).Error; err != nil {
+					return err
+				}
+				continue
+			}
+			newBudget := &QuotaBudget{
+				SubjectType: subjectType,
+				SubjectId:   subjectId,
+				Period:      budget.Period,
+				Quota:       budget.Quota,
+				UsedQuota:   budget.UsedQuota,
+				WindowStart: start.Unix(),
+			}
+			if err := tx.Create(newBudget).Error; err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// DeleteQuotaBudgets 删除主体的全部预算
+func DeleteQuotaBudgets(subjectType string, subjectIds ...int) error {
+	if len(subjectIds) == 0 {
+		return nil
+	}
+	return DB.Where("subject_type = ? AND subject_id IN ?", subjectType, subjectIds).Delete(&QuotaBudget{}).Error
+}
+
+// GetExceededQuotaBudget 检查用户与令牌的预算，返回第一个无法再消费 quota 的预算，全部满足时返回 nil
+func GetExceededQuotaBudget(userId int, tokenId int, quota int) (*QuotaBudget, error) {
+	budgets, err := getQuotaBudgets(userId, tokenId)
+	if err != nil {
+		return nil, err
+	}
+	now := time.Now()
+	for _, budget := range budgets {
+		budget.refresh(now)
+		if budget.Remain() <= 0 || budget.Remain() < quota {
+			return budget, nil
+		}
+	}
+	return nil, nil
+}
+
+// addQuotaBudgetUsage 在事务中先以条件更新切换到新周期，未切换时再累加当前周期的用量，
+// 两次更新都只依赖 WHERE 条件，不受 SET 子句的求值顺序影响
+func addQuotaBudgetUsage(budget *QuotaBudget, quota int, now time.Time) error {
+	start, _ := quotaBudgetWindow(budget.Period, now)
+	return DB.Transaction(func(tx *gorm.DB) error {
+		// 跨周期的退还不计入新周期
+		newWindowUsed := quota
+		if newWindowUsed < 0 {
+			newWindowUsed = 0
+		}
+		result := tx.Model(&QuotaBudget{}).Where("id = ? AND window_start < ?", budget.Id, start.Unix()).
+			Updates(map[string]interface{}{
+				"used_quota":   newWindowUsed,
+				"window_start": start.Unix(),
+			})
+		if result.Error != nil || result.RowsAffected > 0 {
+			return result.Error
+		}
+		return tx.Model(&QuotaBudget{}).Where("id = ? AND window_start >= ?", budget.Id, start.Unix()).
+			Update("used_quota", gorm.Expr("used_quota + ?", quota)).Error
+	})
+}
+
+// RecordQuotaBudgetUsage 将额度变化计入用户与令牌的当前周期，quota 为负数时表示退还
+func RecordQuotaBudgetUsage(userId int, tokenId int, quota int) error {
+	if quota == 0 {
+		return nil
+	}
+	budgets, err := getQuotaBudgets(userId, tokenId)
+	if err != nil {
+		return err
+	}
+	now := time.Now()
+	for _, budget := range budgets {
+		if err = addQuotaBudgetUsage(budget, quota, now); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,100 @@
+package model
+
+import (
+	"testing"
+	"time"
+
+	"github.com/QuantumNous/new-api/common"
+
+	"github.com/glebarez/sqlite"
+	"gorm.io/gorm"
+)
+
+func setupQuotaBudgetTestDB(t *testing.T) {
+	t.Helper()
+	db, err := gorm.Open(sqlite.Open("file:"+t.Name()+"?mode=memory&cache=shared"), &gorm.Config{})
+	if err != nil {
+		t.Fatalf("open db: %v", err)
+	}
+	if err = db.AutoMigrate(&QuotaBudget{}); err != nil {
+		t.Fatalf("migrate: %v", err)
+	}
+	DB = db
+	common.UsingSQLite = true
+}
+
+func TestAddQuotaBudgetUsageRollover(t *testing.T) {
+	now := time.Date(2026, 3, 11, 15, 30, 0, 0, time.Local)
+	today := time.Date(2026, 3, 11, 0, 0, 0, 0, time.Local).Unix()
+	yesterday := time.Date(2026, 3, 10, 0, 0, 0, 0, time.Local).Unix()
+
+	tests := []struct {
+		name            string
+		windowStart     int64
+		usedQuota       int
+		quota           int
+		wantUsedQuota   int
+		wantWindowStart int64
+	}{
+		{name: "same window adds usage", windowStart: today, usedQuota: 100, quota: 50, wantUsedQuota: 150, wantWindowStart: today},
+		{name: "same window refund", windowStart: today, usedQuota: 100, quota: -30, wantUsedQuota: 70, wantWindowStart: today},
+		{name: "new window resets usage", windowStart: yesterday, usedQuota: 100, quota: 50, wantUsedQuota: 50, wantWindowStart: today},
+		{name: "refund across windows is dropped", windowStart: yesterday, usedQuota: 100, quota: -30, wantUsedQuota: 0, wantWindowStart: today},
+		{name: "first usage starts window", windowStart: 0, usedQuota: 0, quota: 20, wantUsedQuota: 20, wantWindowStart: today},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			setupQuotaBudgetTestDB(t)
+			budget := &QuotaBudget{
+				SubjectType: QuotaBudgetSubjectUser,
+				SubjectId:   1,
+				Period:      QuotaBudgetPeriodDaily,
+				Quota:       1000,
+				UsedQuota:   tt.usedQuota,
+				WindowStart: tt.windowStart,
+			}
+			if err := DB.Create(budget).Error; err != nil {
+				t.Fatalf("create budget: %v", err)
+			}
+			if err := addQuotaBudgetUsage(budget, tt.quota, now); err != nil {
+				t.Fatalf("addQuotaBudgetUsage: %v", err)
+			}
+			var got QuotaBudget
+			if err := DB.First(&got, budget.Id).Error; err != nil {
+				t.Fatalf("load budget: %v", err)
+			}
+			if got.UsedQuota != tt.wantUsedQuota || got.WindowStart != tt.wantWindowStart {
+				t.Errorf("used_quota=%d window_start=%d, want used_quota=%d window_start=%d",
+					got.UsedQuota, got.WindowStart, tt.wantUsedQuota, tt.wantWindowStart)
+			}
+		})
+	}
+}
+
+func TestQuotaBudgetRefresh(t *testing.T) {
+	now := time.Date(2026, 3, 11, 15, 30, 0, 0, time.Local)
+	tests := []struct {
+		name          string
+		period        string
+		windowStart   int64
+		wantUsedQuota int
+		wantReset     int64
+	}{
+		{name: "hourly current window", period: QuotaBudgetPeriodHourly, windowStart: time.Date(2026, 3, 11, 15, 0, 0, 0, time.Local).Unix(), wantUsedQuota: 100, wantReset: time.Date(2026, 3, 11, 16, 0, 0, 0, time.Local).Unix()},
+		{name: "hourly expired window", period: QuotaBudgetPeriodHourly, windowStart: time.Date(2026, 3, 11, 14, 0, 0, 0, time.Local).Unix(), wantUsedQuota: 0, wantReset: time.Date(2026, 3, 11, 16, 0, 0, 0, time.Local).Unix()},
+		{name: "weekly starts on monday", period: QuotaBudgetPeriodWeekly, windowStart: time.Date(2026, 3, 9, 0, 0, 0, 0, time.Local).Unix(), wantUsedQuota: 100, wantReset: time.Date(2026, 3, 16, 0, 0, 0, 0, time.Local).Unix()},
+		{name: "monthly expired window", period: QuotaBudgetPeriodMonthly, windowStart: time.Date(2026, 2, 1, 0, 0, 0, 0, time.Local).Unix(), wantUsedQuota: 0, wantReset: time.Date(2026, 4, 1, 0, 0, 0, 0, time.Local).Unix()},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			budget := &QuotaBudget{Period: tt.period, Quota: 1000, UsedQuota: 100, WindowStart: tt.windowStart}
+			budget.refresh(now)
+			if budget.UsedQuota != tt.wantUsedQuota {
+				t.Errorf("used_quota=%d, want %d", budget.UsedQuota, tt.wantUsedQuota)
+			}
+			if budget.ResetTime != tt.wantReset {
+				t.Errorf("reset_time=%d, want %d", budget.ResetTime, tt.wantReset)
+			}
+		})
+	}
+}
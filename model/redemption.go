@@ -6,6 +6,7 @@ import (
 	"strconv"
 
 	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/common/event"
 	"github.com/QuantumNous/new-api/logger"
 
 	"gorm.io/gorm"
@@ -151,6 +152,11 @@ func Redeem(key string, userId int) (quota int, err error) {
 		return 0, errors.New("兑换失败，" + err.Error())
 	}
 	RecordLog(userId, LogTypeTopup, fmt.Sprintf("通过兑换码充值 %s，兑换码ID %d", logger.LogQuota(redemption.Quota), redemption.Id))
+	event.Publish(event.RedemptionUsed, userId, event.RedemptionData{
+		RedemptionId: redemption.Id,
+		Name:         redemption.Name,
+		Quota:        redemption.Quota,
+	})
 	return redemption.Quota, nil
 }
 
@@ -0,0 +1,55 @@
+package model
+
+import (
+	"errors"
+
+	"github.com/QuantumNous/new-api/common"
+)
+
+// StoredResponse 网关保存的 Responses API 响应，输入与输出内容保存在存储后端
+type StoredResponse struct {
+	Id                 string `json:"id" gorm:"type:varchar(128);primaryKey"`
+	UserId             int    `json:"user_id" gorm:"index"`
+	PreviousResponseId string `json:"previous_response_id" gorm:"type:varchar(128);default:''"`
+	ModelName          string `json:"model_name" gorm:"default:''"`
+	ChannelId          int    `json:"channel_id" gorm:"default:0"`
+	StorageKey         string `json:"-" gorm:"type:varchar(255)"`
+	CreatedAt          int64  `json:"created_at" gorm:"bigint;index"`
+}
+
+func (response *StoredResponse) Insert() error {
+	if response.CreatedAt == 0 {
+		response.CreatedAt = common.GetTimestamp()
+	}
+	return DB.Create(response).Error
+}
+
+func GetStoredResponseById(id string, userId int) (*StoredResponse, error) {
+	if id == "" {
+		return nil, errors.New("id 为空！")
+	}
+	var response StoredResponse
+	err := DB.Where("id = ? AND user_id = ?", id, userId).First(&response).Error
+	if err != nil {
+		return nil, err
+	}
+	return &response, nil
+}
+
+func DeleteStoredResponseById(id string, userId int) error {
+	return DB.Where("id = ? AND user_id = ?", id, userId).Delete(&StoredResponse{}).Error
+}
+
+// GetExpiredStoredResponses 返回早于 targetTimestamp 的记录，用于清理
+func GetExpiredStoredResponses(targetTimestamp int64, limit int) ([]*StoredResponse, error) {
+	var responses []*StoredResponse
+	err := DB.Select("id", "storage_key").Where("created_at < ?", targetTimestamp).Order("created_at").Limit(limit).Find(&responses).Error
+	return responses, err
+}
+
+func DeleteStoredResponsesByIds(ids []string) error {
+	if len(ids) == 0 {
+		return nil
+	}
+	return DB.Where("id IN ?", ids).Delete(&StoredResponse{}).Error
+}
@@ -5,6 +5,7 @@ import (
 	"encoding/json"
 	"time"
 
+	"github.com/QuantumNous/new-api/common/event"
 	"github.com/QuantumNous/new-api/constant"
 	"github.com/QuantumNous/new-api/dto"
 	commonRelay "github.com/QuantumNous/new-api/relay/common"
@@ -46,6 +47,7 @@ type Task struct {
 	TaskID     string                `json:"task_id" gorm:"type:varchar(191);index"` // 第三方id，不一定有/ song id\ Task id
 	Platform   constant.TaskPlatform `json:"platform" gorm:"type:varchar(30);index"` // 平台
 	UserId     int                   `json:"user_id" gorm:"index"`
+	TokenId    int                   `json:"token_id" gorm:"index"`
 	Group      string                `json:"group" gorm:"type:varchar(50)"` // 修正计费用
 	ChannelId  int                   `json:"channel_id" gorm:"index"`
 	Quota      int                   `json:"quota"`
@@ -56,6 +58,8 @@ type Task struct {
 	StartTime  int64                 `json:"start_time" gorm:"index"`
 	FinishTime int64                 `json:"finish_time" gorm:"index"`
 	Progress   string                `json:"progress" gorm:"type:varchar(20);index"`
+	NextPollAt int64                 `json:"next_poll_at" gorm:"index"` // 下次轮询时间，领取后推迟到租约到期时间
+	SettledAt  int64                 `json:"settled_at"`                // 额度结算时间，0 表示未结算
 	Properties Properties            `json:"properties" gorm:"type:json"`
 	// 禁止返回给用户，内部可能包含key等隐私信息
 	PrivateData TaskPrivateData `json:"-" gorm:"column:private_data;type:json"`
@@ -76,6 +80,8 @@ type Properties struct {
 	Input             string `json:"input"`
 	UpstreamModelName string `json:"upstream_model_name,omitempty"`
 	OriginModelName   string `json:"origin_model_name,omitempty"`
+	// 客户端指定的回调地址，任务状态变化时推送
+	CallbackUrl string `json:"callback_url,omitempty"`
 }
 
 func (m *Properties) Scan(val interface{}) error {
@@ -96,6 +102,12 @@ func (m Properties) Value() (driver.Value, error) {
 
 type TaskPrivateData struct {
 	Key string `json:"key,omitempty"`
+	// 回调签名密钥，来自提交任务所用令牌
+	CallbackSecret string `json:"callback_secret,omitempty"`
+	// 已向上游提交回调地址，等待上游推送状态
+	UpstreamCallback bool `json:"upstream_callback,omitempty"`
+	// 提交时按时长、分辨率等参数预估计费所用的倍率
+	BillingRatios map[string]float64 `json:"billing_ratios,omitempty"`
 }
 
 func (p *TaskPrivateData) Scan(val interface{}) error {
@@ -107,7 +119,7 @@ func (p *TaskPrivateData) Scan(val interface{}) error {
 }
 
 func (p TaskPrivateData) Value() (driver.Value, error) {
-	if (p == TaskPrivateData{}) {
+	if p.Key == "" && p.CallbackSecret == "" && !p.UpstreamCallback && len(p.BillingRatios) == 0 {
 		return nil, nil
 	}
 	return json.Marshal(p)
@@ -121,6 +133,8 @@ type SyncTaskQueryParams struct {
 	UserID         string
 	Action         string
 	Status         string
+	Statuses       []TaskStatus
+	Platforms      []constant.TaskPlatform
 	StartTimestamp int64
 	EndTimestamp   int64
 	UserIDs        []int
@@ -143,6 +157,7 @@ func InitTask(platform constant.TaskPlatform, relayInfo *commonRelay.RelayInfo)
 
 	t := &Task{
 		UserId:      relayInfo.UserId,
+		TokenId:     relayInfo.TokenId,
 		Group:       relayInfo.UsingGroup,
 		SubmitTime:  time.Now().Unix(),
 		Status:      TaskStatusNotStart,
@@ -174,6 +189,12 @@ func TaskGetAllUserTask(userId int, startIdx int, num int, queryParams SyncTaskQ
 	if queryParams.Platform != "" {
 		query = query.Where("platform = ?", queryParams.Platform)
 	}
+	if len(queryParams.Statuses) != 0 {
+		query = query.Where("status IN ?", queryParams.Statuses)
+	}
+	if len(queryParams.Platforms) != 0 {
+		query = query.Where("platform IN ?", queryParams.Platforms)
+	}
 	if queryParams.StartTimestamp != 0 {
 		// 假设您已将前端传来的时间戳转换为数据库所需的时间格式，并处理了时间戳的验证和解析
 		query = query.Where("submit_time >= ?", queryParams.StartTimestamp)
@@ -205,6 +226,9 @@ func TaskGetAllTasks(startIdx int, num int, queryParams SyncTaskQueryParams) []*
 	if queryParams.Platform != "" {
 		query = query.Where("platform = ?", queryParams.Platform)
 	}
+	if len(queryParams.Platforms) != 0 {
+		query = query.Where("platform IN ?", queryParams.Platforms)
+	}
 	if queryParams.UserID != "" {
 		query = query.Where("user_id = ?", queryParams.UserID)
 	}
@@ -236,17 +260,89 @@ func TaskGetAllTasks(startIdx int, num int, queryParams SyncTaskQueryParams) []*
 	return tasks
 }
 
-func GetAllUnFinishSyncTasks(limit int) []*Task {
+// GetDueTasks 获取到达轮询时间的未完成任务
+func GetDueTasks(now int64, limit int) []*Task {
 	var tasks []*Task
 	var err error
-	// get all tasks progress is not 100%
-	err = DB.Where("progress != ?", "100%").Where("status != ?", TaskStatusFailure).Where("status != ?", TaskStatusSuccess).Limit(limit).Order("id").Find(&tasks).Error
+	err = DB.Where("progress != ?", "100%").Where("status != ?", TaskStatusFailure).Where("status != ?", TaskStatusSuccess).
+		Where("next_poll_at <= ?", now).Limit(limit).Order("next_poll_at, id").Find(&tasks).Error
+	if err != nil {
+		return nil
+	}
+	return tasks
+}
+
+// ClaimTaskPoll 以条件更新的方式领取任务并将下次轮询时间推迟到 leaseUntil，多节点时只有一个节点能领取成功
+func ClaimTaskPoll(id int64, nextPollAt int64, leaseUntil int64) (bool, error) {
+	result := DB.Model(&Task{}).
+		Where("id = ? AND next_poll_at = ?", id, nextPollAt).
+		Update("next_poll_at", leaseUntil)
+	return result.RowsAffected == 1, result.Error
+}
+
+// ReleaseTaskPoll 轮询结束后设置下次轮询时间，租约已被其他节点重新领取时不修改
+func ReleaseTaskPoll(id int64, leaseUntil int64, nextPollAt int64) error {
+	return DB.Model(&Task{}).
+		Where("id = ? AND next_poll_at = ?", id, leaseUntil).
+		Update("next_poll_at", nextPollAt).Error
+}
+
+// GetTimedOutTasks 获取提交时间早于 deadline 且当前未被领取的未完成任务，
+// 没有提交时间的任务（如提交失败的旧版 Midjourney 任务）按创建时间计算
+func GetTimedOutTasks(deadline int64, now int64, limit int) []*Task {
+	var tasks []*Task
+	err := DB.Where("status NOT IN ?", []TaskStatus{TaskStatusFailure, TaskStatusSuccess}).
+		Where("(submit_time > 0 AND submit_time < ?) OR (submit_time = 0 AND created_at > 0 AND created_at < ?)", deadline, deadline).
+		Where("next_poll_at <= ?", now).
+		Limit(limit).Order("id").Find(&tasks).Error
 	if err != nil {
 		return nil
 	}
 	return tasks
 }
 
+// FailTimedOutTask 将超时任务标记为失败，返回 false 表示任务已结束或正被轮询
+func FailTimedOutTask(task *Task, reason string, now int64) (bool, error) {
+	result := DB.Model(&Task{}).
+		Where("id = ? AND next_poll_at = ?", task.ID, task.NextPollAt).
+		Where("status NOT IN ?", []TaskStatus{TaskStatusFailure, TaskStatusSuccess}).
+		Updates(map[string]any{
+			"status":      TaskStatusFailure,
+			"progress":    "100%",
+			"fail_reason": reason,
+			"finish_time": now,
+		})
+	if result.Error != nil || result.RowsAffected != 1 {
+		return false, result.Error
+	}
+	task.Status = TaskStatusFailure
+	task.Progress = "100%"
+	task.FailReason = reason
+	task.FinishTime = now
+	return true, nil
+}
+
+// CancelTask 将未完成的任务标记为失败，任务已完成或正在被轮询更新时返回 false
+func CancelTask(task *Task, reason string, now int64) (bool, error) {
+	result := DB.Model(&Task{}).
+		Where("id = ? AND next_poll_at = ?", task.ID, task.NextPollAt).
+		Where("status NOT IN ?", []TaskStatus{TaskStatusFailure, TaskStatusSuccess}).
+		Updates(map[string]any{
+			"status":      TaskStatusFailure,
+			"progress":    "100%",
+			"fail_reason": reason,
+			"finish_time": now,
+		})
+	if result.Error != nil || result.RowsAffected != 1 {
+		return false, result.Error
+	}
+	task.Status = TaskStatusFailure
+	task.Progress = "100%"
+	task.FailReason = reason
+	task.FinishTime = now
+	return true, nil
+}
+
 func GetByOnlyTaskId(taskId string) (*Task, bool, error) {
 	if taskId == "" {
 		return nil, false, nil
@@ -261,6 +357,31 @@ func GetByOnlyTaskId(taskId string) (*Task, bool, error) {
 	return task, exist, err
 }
 
+// GetUnfinishedTaskByChannel 获取渠道下未结束的任务，用于处理上游回调
+func GetUnfinishedTaskByChannel(channelId int, taskId string) (*Task, bool, error) {
+	if taskId == "" {
+		return nil, false, nil
+	}
+	var task *Task
+	err := DB.Where("channel_id = ? and task_id = ?", channelId, taskId).
+		Where("status NOT IN ?", []TaskStatus{TaskStatusFailure, TaskStatusSuccess}).
+		First(&task).Error
+	exist, err := RecordExist(err)
+	if err != nil {
+		return nil, false, err
+	}
+	return task, exist, err
+}
+
+func GetTaskById(id int64) (*Task, error) {
+	var task Task
+	err := DB.Where("id = ?", id).First(&task).Error
+	if err != nil {
+		return nil, err
+	}
+	return &task, nil
+}
+
 func GetByTaskId(userId int, taskId string) (*Task, bool, error) {
 	if taskId == "" {
 		return nil, false, nil
@@ -300,12 +421,68 @@ func (Task *Task) Insert() error {
 	return err
 }
 
+// Update 保存任务，结算时间只由 SettleTaskQuota 修改，避免旧数据覆盖结算标记
 func (Task *Task) Update() error {
 	var err error
-	err = DB.Save(Task).Error
+	err = DB.Omit("settled_at").Save(Task).Error
 	return err
 }
 
+// SettleTaskQuota 记录任务结算后的实际额度，任务已结算时返回 false
+func SettleTaskQuota(id int64, quota int, now int64) (bool, error) {
+	result := DB.Model(&Task{}).
+		Where("id = ? AND settled_at = ?", id, 0).
+		Updates(map[string]any{
+			"quota":      quota,
+			"settled_at": now,
+		})
+	return result.RowsAffected == 1, result.Error
+}
+
+type TaskStuckStat struct {
+	Platform         string `json:"platform"`
+	ChannelId        int    `json:"channel_id"`
+	Count            int64  `json:"count"`
+	OldestSubmitTime int64  `json:"oldest_submit_time"`
+}
+
+// GetStuckTaskStats 按平台和渠道统计提交时间早于 deadline 仍未结束的任务
+func GetStuckTaskStats(deadline int64) ([]*TaskStuckStat, error) {
+	var stats []*TaskStuckStat
+	err := DB.Model(&Task{}).
+		Select("platform, channel_id, count(*) as count, min(submit_time) as oldest_submit_time").
+		Where("status NOT IN ?", []TaskStatus{TaskStatusFailure, TaskStatusSuccess}).
+		Where("submit_time > 0 AND submit_time < ?", deadline).
+		Group("platform, channel_id").Order("count desc").Scan(&stats).Error
+	return stats, err
+}
+
+// PublishTaskStatusEvent 任务从未结束状态变为成功或失败时发布事件
+func PublishTaskStatusEvent(task *Task, preStatus TaskStatus) {
+	if preStatus == task.Status {
+		return
+	}
+	var eventType event.Type
+	failReason := ""
+	switch task.Status {
+	case TaskStatusSuccess:
+		eventType = event.TaskFinished
+	case TaskStatusFailure:
+		eventType = event.TaskFailed
+		failReason = task.FailReason
+	default:
+		return
+	}
+	event.Publish(eventType, task.UserId, event.TaskData{
+		TaskId:     task.TaskID,
+		Platform:   string(task.Platform),
+		Action:     task.Action,
+		Status:     string(task.Status),
+		FailReason: failReason,
+		Quota:      task.Quota,
+	})
+}
+
 func TaskBulkUpdate(TaskIds []string, params map[string]any) error {
 	if len(TaskIds) == 0 {
 		return nil
@@ -379,6 +556,9 @@ func TaskCountAllTasks(queryParams SyncTaskQueryParams) int64 {
 	if queryParams.Platform != "" {
 		query = query.Where("platform = ?", queryParams.Platform)
 	}
+	if len(queryParams.Platforms) != 0 {
+		query = query.Where("platform IN ?", queryParams.Platforms)
+	}
 	if queryParams.UserID != "" {
 		query = query.Where("user_id = ?", queryParams.UserID)
 	}
@@ -420,6 +600,12 @@ func TaskCountAllUserTask(userId int, queryParams SyncTaskQueryParams) int64 {
 	if queryParams.Platform != "" {
 		query = query.Where("platform = ?", queryParams.Platform)
 	}
+	if len(queryParams.Statuses) != 0 {
+		query = query.Where("status IN ?", queryParams.Statuses)
+	}
+	if len(queryParams.Platforms) != 0 {
+		query = query.Where("platform IN ?", queryParams.Platforms)
+	}
 	if queryParams.StartTimestamp != 0 {
 		query = query.Where("submit_time >= ?", queryParams.StartTimestamp)
 	}
@@ -27,7 +27,13 @@ type Token struct {
 	AllowIps           *string        `json:"allow_ips" gorm:"default:''"`
 	UsedQuota          int            `json:"used_quota" gorm:"default:0"` // used quota
 	Group              string         `json:"group" gorm:"default:''"`
+	TpmLimit           int            `json:"tpm_limit" gorm:"default:0"`                          // 每分钟 token 数上限，0 表示不限制
+	ConcurrencyLimit   int            `json:"concurrency_limit" gorm:"default:0"`                  // 在途请求数上限，0 表示不限制
+	ModelFallback      string         `json:"model_fallback" gorm:"type:text"`                     // 模型回退链，JSON 格式：{"gpt-4o":["claude-sonnet-4","gemini-2.5-pro"]}
+	CallbackUrl        string         `json:"callback_url" gorm:"type:varchar(512);default:''"`    // 异步任务默认回调地址
+	CallbackSecret     string         `json:"callback_secret" gorm:"type:varchar(128);default:''"` // 异步任务回调签名密钥
 	DeletedAt          gorm.DeletedAt `gorm:"index"`
+	Budgets            []*QuotaBudget `json:"budgets,omitempty" gorm:"-"`
 }
 
 func (token *Token) Clean() {
@@ -142,6 +148,37 @@ func GetTokenById(id int) (*Token, error) {
 	return &token, err
 }
 
+// EnsureTokenCallbackSecret 返回令牌的任务回调签名密钥，没有密钥的旧令牌在首次使用时生成并保存，客户端可在令牌详情中查看
+func EnsureTokenCallbackSecret(id int) (string, error) {
+	var token Token
+	if err := DB.First(&token, "id = ?", id).Error; err != nil {
+		return "", err
+	}
+	if token.CallbackSecret != "" {
+		return token.CallbackSecret, nil
+	}
+	secret := common.GetRandomString(32)
+	result := DB.Model(&Token{}).Where("id = ? AND callback_secret = ?", id, "").Update("callback_secret", secret)
+	if result.Error != nil {
+		return "", result.Error
+	}
+	if result.RowsAffected == 0 {
+		// 并发生成时以先写入的密钥为准
+		if err := DB.Select("callback_secret").First(&token, "id = ?", id).Error; err != nil {
+			return "", err
+		}
+		return token.CallbackSecret, nil
+	}
+	if common.RedisEnabled {
+		gopool.Go(func() {
+			if err := cacheSetTokenField(token.Key, "CallbackSecret", secret); err != nil {
+				common.SysLog("failed to update token callback secret cache: " + err.Error())
+			}
+		})
+	}
+	return secret, nil
+}
+
 func GetTokenByKey(key string, fromDB bool) (token *Token, err error) {
 	defer func() {
 		// Update Redis cache asynchronously on successful DB read
@@ -185,7 +222,7 @@ func (token *Token) Update() (err error) {
 		}
 	}()
 	err = DB.Model(token).Select("name", "status", "expired_time", "remain_quota", "unlimited_quota",
-		"model_limits_enabled", "model_limits", "allow_ips", "group").Updates(token).Error
+		"model_limits_enabled", "model_limits", "allow_ips", "group", "tpm_limit", "concurrency_limit", "model_fallback", "callback_url", "callback_secret").Updates(token).Error
 	return err
 }
 
@@ -239,6 +276,18 @@ func (token *Token) GetModelLimitsMap() map[string]bool {
 	return limitsMap
 }
 
+// GetModelFallbackMap 解析令牌的模型回退链，格式错误时视为未配置
+func (token *Token) GetModelFallbackMap() map[string][]string {
+	fallbackMap := make(map[string][]string)
+	if strings.TrimSpace(token.ModelFallback) == "" {
+		return fallbackMap
+	}
+	if err := common.UnmarshalJsonStr(token.ModelFallback, &fallbackMap); err != nil {
+		return map[string][]string{}
+	}
+	return fallbackMap
+}
+
 func DisableModelLimits(tokenId int) error {
 	token, err := GetTokenById(tokenId)
 	if err != nil {
@@ -5,6 +5,7 @@ import (
 	"fmt"
 
 	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/common/event"
 	"github.com/QuantumNous/new-api/logger"
 
 	"github.com/shopspring/decimal"
@@ -99,10 +100,22 @@ func Recharge(referenceId string, customerId string) (err error) {
 	}
 
 	RecordLog(topUp.UserId, LogTypeTopup, fmt.Sprintf("使用在线充值成功，充值金额: %v，支付金额：%d", logger.FormatQuota(int(quota)), topUp.Amount))
+	PublishTopUpCompleted(topUp, int(quota))
 
 	return nil
 }
 
+// PublishTopUpCompleted 发布充值完成事件
+func PublishTopUpCompleted(topUp *TopUp, quota int) {
+	event.Publish(event.TopUpCompleted, topUp.UserId, event.TopUpData{
+		TradeNo:       topUp.TradeNo,
+		PaymentMethod: topUp.PaymentMethod,
+		Amount:        topUp.Amount,
+		Money:         topUp.Money,
+		Quota:         quota,
+	})
+}
+
 func GetUserTopUps(userId int, pageInfo *common.PageInfo) (topups []*TopUp, total int64, err error) {
 	// Start transaction
 	tx := DB.Begin()
@@ -248,6 +261,7 @@ func ManualCompleteTopUp(tradeNo string) error {
 	var userId int
 	var quotaToAdd int
 	var payMoney float64
+	var completedTopUp *TopUp
 
 	err := DB.Transaction(func(tx *gorm.DB) error {
 		topUp := &TopUp{}
@@ -294,6 +308,7 @@ func ManualCompleteTopUp(tradeNo string) error {
 
 		userId = topUp.UserId
 		payMoney = topUp.Money
+		completedTopUp = topUp
 		return nil
 	})
 
@@ -303,6 +318,9 @@ func ManualCompleteTopUp(tradeNo string) error {
 
 	// 事务外记录日志，避免阻塞
 	RecordLog(userId, LogTypeTopup, fmt.Sprintf("管理员补单成功，充值金额: %v，支付金额：%f", logger.FormatQuota(quotaToAdd), payMoney))
+	if completedTopUp != nil {
+		PublishTopUpCompleted(completedTopUp, quotaToAdd)
+	}
 	return nil
 }
 func RechargeCreem(referenceId string, customerEmail string, customerName string) (err error) {
@@ -371,6 +389,7 @@ func RechargeCreem(referenceId string, customerEmail string, customerName string
 	}
 
 	RecordLog(topUp.UserId, LogTypeTopup, fmt.Sprintf("使用Creem充值成功，充值额度: %v，支付金额：%.2f", quota, topUp.Money))
+	PublishTopUpCompleted(topUp, int(quota))
 
 	return nil
 }
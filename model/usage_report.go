@@ -0,0 +1,158 @@
+package model
+
+import (
+	"time"
+
+	"github.com/QuantumNous/new-api/common"
+
+	"gorm.io/gorm/clause"
+)
+
+const (
+	UsageReportPeriodDaily   = "daily"
+	UsageReportPeriodWeekly  = "weekly"
+	UsageReportPeriodMonthly = "monthly"
+)
+
+// UsageReport 已生成的用量报告，UserId 为 0 表示全站报告。
+// (user_id, period, period_start) 唯一，用于保证每个周期只生成一次
+type UsageReport struct {
+	Id          int    `json:"id"`
+	UserId      int    `json:"user_id" gorm:"uniqueIndex:idx_usage_report_period,priority:1"`
+	Period      string `json:"period" gorm:"type:varchar(16);uniqueIndex:idx_usage_report_period,priority:2"`
+	PeriodStart int64  `json:"period_start" gorm:"bigint;uniqueIndex:idx_usage_report_period,priority:3"`
+	PeriodEnd   int64  `json:"period_end" gorm:"bigint"`
+	Content     string `json:"content" gorm:"type:text"` // 报告 JSON
+	CreatedAt   int64  `json:"created_at" gorm:"bigint;index"`
+}
+
+func IsValidUsageReportPeriod(period string) bool {
+	switch period {
+	case UsageReportPeriodDaily, UsageReportPeriodWeekly, UsageReportPeriodMonthly:
+		return true
+	}
+	return false
+}
+
+// UsageReportWindow 返回 now 之前最近一个完整周期的起止时间，以及再往前一个周期的开始时间
+func UsageReportWindow(period string, now time.Time) (start time.Time, end time.Time, previousStart time.Time) {
+	y, m, d := now.Date()
+	today := time.Date(y, m, d, 0, 0, 0, 0, now.Location())
+	switch period {
+	case UsageReportPeriodWeekly:
+		// 以周一为一周的开始
+		offset := (int(today.Weekday()) + 6) % 7
+		end = today.AddDate(0, 0, -offset)
+		start = end.AddDate(0, 0, -7)
+		previousStart = start.AddDate(0, 0, -7)
+	case UsageReportPeriodMonthly:
+		end = time.Date(y, m, 1, 0, 0, 0, 0, now.Location())
+		start = end.AddDate(0, -1, 0)
+		previousStart = start.AddDate(0, -1, 0)
+	default:
+		end = today
+		start = end.AddDate(0, 0, -1)
+		previousStart = start.AddDate(0, 0, -1)
+	}
+	return start, end, previousStart
+}
+
+// ClaimUsageReport 插入报告占位记录，已存在（其他节点或之前已生成）时返回 false
+func ClaimUsageReport(report *UsageReport) (bool, error) {
+	report.CreatedAt = common.GetTimestamp()
+	result := DB.Clauses(clause.OnConflict{DoNothing: true}).Create(report)
+	return result.RowsAffected == 1, result.Error
+}
+
+func UpdateUsageReportContent(id int, content string) error {
+	return DB.Model(&UsageReport{}).Where("id = ?", id).Update("content", content).Error
+}
+
+// DeleteUsageReport 删除生成失败的占位记录，以便之后重新生成
+func DeleteUsageReport(id int) error {
+	return DB.Delete(&UsageReport{}, id).Error
+}
+
+func GetUsageReports(userId int, period string, startIdx int, num int) (reports []*UsageReport, total int64, err error) {
+	query := DB.Model(&UsageReport{}).Where("user_id = ?", userId)
+	if period != "" {
+		query = query.Where("period = ?", period)
+	}
+	err = query.Count(&total).Error
+	if err != nil {
+		return nil, 0, err
+	}
+	err = query.Order("period_start desc, id desc").Limit(num).Offset(startIdx).Find(&reports).Error
+	return reports, total, err
+}
+
+// GetUsageReportUsers 获取订阅了指定周期用量报告的用户
+func GetUsageReportUsers(period string) ([]*User, error) {
+	var users []*User
+	err := DB.Select("id", "username", "email", "setting", "telegram_id").
+		Where("status = ? AND setting LIKE ?", common.UserStatusEnabled, "%\"usage_report_period\":\""+period+"\"%").
+		Find(&users).Error
+	return users, err
+}
+
+type UsageModelStat struct {
+	ModelName string `json:"model_name"`
+	Quota     int    `json:"quota"`
+	Tokens    int    `json:"tokens"`
+	Count     int    `json:"count"`
+}
+
+type UsageTokenStat struct {
+	Username  string `json:"username"`
+	TokenName string `json:"token_name"`
+	Quota     int    `json:"quota"`
+	Count     int    `json:"count"`
+}
+
+// GetUsageModelStats 按模型统计 [startTime, endTime) 内的消费，userId 为 0 时统计全站。
+// 开启数据看板时使用按小时聚合的 QuotaData，否则直接统计日志
+func GetUsageModelStats(userId int, startTime int64, endTime int64) ([]*UsageModelStat, error) {
+	var stats []*UsageModelStat
+	if common.DataExportEnabled {
+		tx := DB.Table("quota_data").
+			Select("model_name, COALESCE(sum(quota), 0) as quota, COALESCE(sum(token_used), 0) as tokens, COALESCE(sum(count), 0) as count").
+			Where("created_at >= ? AND created_at < ?", startTime, endTime)
+		if userId != 0 {
+			tx = tx.Where("user_id = ?", userId)
+		}
+		err := tx.Group("model_name").Order("quota desc").Scan(&stats).Error
+		return stats, err
+	}
+	tx := LOG_DB.Table("logs").
+		Select("model_name, COALESCE(sum(quota), 0) as quota, COALESCE(sum(prompt_tokens), 0) + COALESCE(sum(completion_tokens), 0) as tokens, count(*) as count").
+		Where("type IN ? AND created_at >= ? AND created_at < ?", consumeLogTypes, startTime, endTime)
+	if userId != 0 {
+		tx = tx.Where("user_id = ?", userId)
+	}
+	err := tx.Group("model_name").Order("quota desc").Scan(&stats).Error
+	return stats, err
+}
+
+// GetUsageTopTokens 按令牌统计 [startTime, endTime) 内消费最多的令牌
+func GetUsageTopTokens(userId int, startTime int64, endTime int64, limit int) ([]*UsageTokenStat, error) {
+	var stats []*UsageTokenStat
+	tx := LOG_DB.Table("logs").
+		Select("username, token_name, COALESCE(sum(quota), 0) as quota, count(*) as count").
+		Where("type IN ? AND created_at >= ? AND created_at < ?", consumeLogTypes, startTime, endTime)
+	if userId != 0 {
+		tx = tx.Where("user_id = ?", userId)
+	}
+	err := tx.Group("username, token_name").Order("quota desc").Limit(limit).Scan(&stats).Error
+	return stats, err
+}
+
+// CountUsageErrors 统计 [startTime, endTime) 内的错误日志数
+func CountUsageErrors(userId int, startTime int64, endTime int64) (int64, error) {
+	var count int64
+	tx := LOG_DB.Table("logs").Where("type = ? AND created_at >= ? AND created_at < ?", LogTypeError, startTime, endTime)
+	if userId != 0 {
+		tx = tx.Where("user_id = ?", userId)
+	}
+	err := tx.Count(&count).Error
+	return count, err
+}
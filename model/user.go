@@ -8,6 +8,7 @@ import (
 	"strings"
 
 	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/common/event"
 	"github.com/QuantumNous/new-api/dto"
 	"github.com/QuantumNous/new-api/logger"
 
@@ -47,6 +48,7 @@ type User struct {
 	Setting          string         `json:"setting" gorm:"type:text;column:setting"`
 	Remark           string         `json:"remark,omitempty" gorm:"type:varchar(255)" validate:"max=255"`
 	StripeCustomer   string         `json:"stripe_customer" gorm:"type:varchar(64);column:stripe_customer;index"`
+	Budgets          []*QuotaBudget `json:"budgets,omitempty" gorm:"-"`
 }
 
 func (user *User) ToBaseUser() *UserBase {
@@ -411,7 +413,10 @@ func HardDeleteUserById(id int) error {
 		return errors.New("id 为空！")
 	}
 	err := DB.Unscoped().Delete(&User{}, "id = ?", id).Error
-	return err
+	if err != nil {
+		return err
+	}
+	return DeleteQuotaBudgets(QuotaBudgetSubjectUser, id)
 }
 
 func inviteUser(inviterId int) (err error) {
@@ -504,6 +509,11 @@ func (user *User) Insert(inviterId int) error {
 	if common.QuotaForNewUser > 0 {
 		RecordLog(user.Id, LogTypeSystem, fmt.Sprintf("新用户注册赠送 %s", logger.LogQuota(common.QuotaForNewUser)))
 	}
+	event.Publish(event.UserRegistered, user.Id, event.UserData{
+		Username:  user.Username,
+		Email:     user.Email,
+		InviterId: inviterId,
+	})
 	if inviterId != 0 {
 		if common.QuotaForInvitee > 0 {
 			_ = IncreaseUserQuota(user.Id, common.QuotaForInvitee, true)
@@ -0,0 +1,284 @@
+package model
+
+import (
+	"errors"
+	"strings"
+
+	"github.com/QuantumNous/new-api/common"
+
+	"gorm.io/gorm"
+)
+
+const (
+	WebhookStatusEnabled  = 1
+	WebhookStatusDisabled = 2
+)
+
+const (
+	WebhookDeliveryStatusPending = "pending"
+	WebhookDeliveryStatusSuccess = "success"
+	WebhookDeliveryStatusFailed  = "failed"
+)
+
+// WebhookSubscription 事件订阅，UserId 为 0 表示管理员创建的系统订阅，可接收所有用户的事件
+type WebhookSubscription struct {
+	Id          int    `json:"id"`
+	UserId      int    `json:"user_id" gorm:"index"`
+	Name        string `json:"name" gorm:"type:varchar(64)"`
+	Url         string `json:"url" gorm:"type:varchar(512)"`
+	Secret      string `json:"secret" gorm:"type:varchar(128)"`
+	Events      string `json:"events" gorm:"type:text"` // 逗号分隔的事件类型
+	Status      int    `json:"status" gorm:"default:1"`
+	CreatedTime int64  `json:"created_time" gorm:"bigint"`
+	UpdatedTime int64  `json:"updated_time" gorm:"bigint"`
+}
+
+// WebhookDelivery 事件投递记录，同时作为持久化的重试队列。
+// 异步任务回调也使用该队列，此时 TaskId 为任务 id，EventId 为对外的 task_id
+type WebhookDelivery struct {
+	Id             int    `json:"id"`
+	SubscriptionId int    `json:"subscription_id" gorm:"index"`
+	TaskId         int64  `json:"task_id,omitempty" gorm:"index"`
+	UserId         int    `json:"user_id" gorm:"index"` // 订阅或任务所属用户
+	EventId        string `json:"event_id" gorm:"type:varchar(64);index"`
+	EventType      string `json:"event_type" gorm:"type:varchar(64)"`
+	Payload        string `json:"payload" gorm:"type:text"`
+	Status         string `json:"status" gorm:"type:varchar(16);index:idx_webhook_delivery_due,priority:1"`
+	Attempts       int    `json:"attempts" gorm:"default:0"`
+	NextAttemptAt  int64  `json:"next_attempt_at" gorm:"bigint;index:idx_webhook_delivery_due,priority:2"`
+	ResponseStatus int    `json:"response_status"`
+	LastError      string `json:"last_error" gorm:"type:text"`
+	CreatedTime    int64  `json:"created_time" gorm:"bigint;index"`
+	DeliveredAt    int64  `json:"delivered_at" gorm:"bigint"`
+}
+
+// WebhookEvent 待分发的事件，发布事件时只写入一条记录，由投递协程展开为各订阅的投递记录
+type WebhookEvent struct {
+	Id          int    `json:"id"`
+	EventId     string `json:"event_id" gorm:"type:varchar(64)"`
+	EventType   string `json:"event_type" gorm:"type:varchar(64)"`
+	UserId      int    `json:"user_id"`
+	UserScoped  bool   `json:"user_scoped"`
+	Payload     string `json:"payload" gorm:"type:text"`
+	CreatedTime int64  `json:"created_time" gorm:"bigint;index"`
+}
+
+func (subscription *WebhookSubscription) GetEvents() []string {
+	if subscription.Events == "" {
+		return nil
+	}
+	return strings.Split(subscription.Events, ",")
+}
+
+func (subscription *WebhookSubscription) SetEvents(events []string) {
+	subscription.Events = strings.Join(events, ",")
+}
+
+func (subscription *WebhookSubscription) HasEvent(eventType string) bool {
+	for _, e := range subscription.GetEvents() {
+		if e == eventType {
+			return true
+		}
+	}
+	return false
+}
+
+func (subscription *WebhookSubscription) Insert() error {
+	now := common.GetTimestamp()
+	subscription.CreatedTime = now
+	subscription.UpdatedTime = now
+	return DB.Create(subscription).Error
+}
+
+func (subscription *WebhookSubscription) Update() error {
+	subscription.UpdatedTime = common.GetTimestamp()
+	return DB.Model(subscription).Select("name", "url", "secret", "events", "status", "updated_time").Updates(subscription).Error
+}
+
+func GetWebhookSubscriptions(userId int, startIdx int, num int) (subscriptions []*WebhookSubscription, total int64, err error) {
+	query := DB.Model(&WebhookSubscription{}).Where("user_id = ?", userId)
+	err = query.Count(&total).Error
+	if err != nil {
+		return nil, 0, err
+	}
+	err = query.Order("id desc").Limit(num).Offset(startIdx).Find(&subscriptions).Error
+	return subscriptions, total, err
+}
+
+func GetWebhookSubscriptionById(id int, userId int) (*WebhookSubscription, error) {
+	if id == 0 {
+		return nil, errors.New("id 为空！")
+	}
+	var subscription WebhookSubscription
+	err := DB.Where("id = ? AND user_id = ?", id, userId).First(&subscription).Error
+	if err != nil {
+		return nil, err
+	}
+	return &subscription, nil
+}
+
+func CountWebhookSubscriptions(userId int) (int64, error) {
+	var count int64
+	err := DB.Model(&WebhookSubscription{}).Where("user_id = ?", userId).Count(&count).Error
+	return count, err
+}
+
+func DeleteWebhookSubscription(id int, userId int) error {
+	return DB.Transaction(func(tx *gorm.DB) error {
+		result := tx.Where("id = ? AND user_id = ?", id, userId).Delete(&WebhookSubscription{})
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return errors.New("订阅不存在")
+		}
+		// 删除订阅后不再投递尚未完成的事件
+		return tx.Model(&WebhookDelivery{}).
+			Where("subscription_id = ? AND status = ?", id, WebhookDeliveryStatusPending).
+			Updates(map[string]interface{}{
+				"status":     WebhookDeliveryStatusFailed,
+				"last_error": "subscription deleted",
+			}).Error
+	})
+}
+
+// GetEventWebhookSubscriptions 获取应接收事件的已启用订阅：系统订阅，以及事件所属用户自己的订阅
+func GetEventWebhookSubscriptions(eventType string, eventUserId int, userScoped bool) ([]*WebhookSubscription, error) {
+	var subscriptions []*WebhookSubscription
+	query := DB.Where("status = ?", WebhookStatusEnabled)
+	if userScoped && eventUserId != 0 {
+		query = query.Where("user_id IN ?", []int{0, eventUserId})
+	} else {
+		query = query.Where("user_id = ?", 0)
+	}
+	if err := query.Find(&subscriptions).Error; err != nil {
+		return nil, err
+	}
+	result := make([]*WebhookSubscription, 0, len(subscriptions))
+	for _, subscription := range subscriptions {
+		if subscription.HasEvent(eventType) {
+			result = append(result, subscription)
+		}
+	}
+	return result, nil
+}
+
+func CreateWebhookDeliveries(deliveries []*WebhookDelivery) error {
+	if len(deliveries) == 0 {
+		return nil
+	}
+	return DB.Create(&deliveries).Error
+}
+
+func CreateWebhookEvent(e *WebhookEvent) error {
+	return DB.Create(e).Error
+}
+
+// GetPendingWebhookEvents 获取尚未分发的事件
+func GetPendingWebhookEvents(limit int) ([]*WebhookEvent, error) {
+	var events []*WebhookEvent
+	err := DB.Order("id asc").Limit(limit).Find(&events).Error
+	return events, err
+}
+
+// FanOutWebhookEvent 在同一事务中删除事件并写入各订阅的投递记录，
+// 多节点部署时只有删除成功的节点会写入投递记录，写入失败时事件保留等待下次分发
+func FanOutWebhookEvent(e *WebhookEvent, build func(subscriptions []*WebhookSubscription) []*WebhookDelivery) error {
+	subscriptions, err := GetEventWebhookSubscriptions(e.EventType, e.UserId, e.UserScoped)
+	if err != nil {
+		return err
+	}
+	deliveries := build(subscriptions)
+	return DB.Transaction(func(tx *gorm.DB) error {
+		result := tx.Where("id = ?", e.Id).Delete(&WebhookEvent{})
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 || len(deliveries) == 0 {
+			return nil
+		}
+		return tx.Create(&deliveries).Error
+	})
+}
+
+// DeleteOldWebhookEvents 删除早于 targetTimestamp 仍未分发的事件（如 webhook 关闭期间产生的事件）
+func DeleteOldWebhookEvents(targetTimestamp int64) error {
+	return DB.Where("created_time < ?", targetTimestamp).Delete(&WebhookEvent{}).Error
+}
+
+// GetDueWebhookDeliveries 获取到达投递时间的记录
+func GetDueWebhookDeliveries(now int64, limit int) ([]*WebhookDelivery, error) {
+	var deliveries []*WebhookDelivery
+	err := DB.Where("status = ? AND next_attempt_at <= ?", WebhookDeliveryStatusPending, now).
+		Order("next_attempt_at asc").Limit(limit).Find(&deliveries).Error
+	return deliveries, err
+}
+
+// ClaimWebhookDelivery 以条件更新的方式领取投递记录，并将下次投递时间推迟到 leaseUntil，
+// 多节点部署时只有一个节点能领取成功，执行节点退出后记录会在租约到期后被重新领取
+func ClaimWebhookDelivery(id int, nextAttemptAt int64, leaseUntil int64) (bool, error) {
+	result := DB.Model(&WebhookDelivery{}).
+		Where("id = ? AND status = ? AND next_attempt_at = ?", id, WebhookDeliveryStatusPending, nextAttemptAt).
+		Update("next_attempt_at", leaseUntil)
+	return result.RowsAffected == 1, result.Error
+}
+
+func UpdateWebhookDeliveryFields(id int, fields map[string]interface{}) error {
+	return DB.Model(&WebhookDelivery{}).Where("id = ?", id).Updates(fields).Error
+}
+
+// GetWebhookDeliveries 查询投递记录，userId 为 -1 时不限制所属用户
+func GetWebhookDeliveries(userId int, subscriptionId int, eventId string, status string, startIdx int, num int) (deliveries []*WebhookDelivery, total int64, err error) {
+	query := DB.Model(&WebhookDelivery{})
+	if userId >= 0 {
+		query = query.Where("user_id = ?", userId)
+	}
+	if subscriptionId != 0 {
+		query = query.Where("subscription_id = ?", subscriptionId)
+	}
+	if eventId != "" {
+		query = query.Where("event_id = ?", eventId)
+	}
+	if status != "" {
+		query = query.Where("status = ?", status)
+	}
+	err = query.Count(&total).Error
+	if err != nil {
+		return nil, 0, err
+	}
+	err = query.Order("id desc").Limit(num).Offset(startIdx).Find(&deliveries).Error
+	return deliveries, total, err
+}
+
+// RedeliverWebhook 将投递记录重新加入队列，userId 为 -1 时不限制所属用户
+func RedeliverWebhook(id int, userId int) error {
+	query := DB.Model(&WebhookDelivery{}).Where("id = ? AND status <> ?", id, WebhookDeliveryStatusPending)
+	if userId >= 0 {
+		query = query.Where("user_id = ?", userId)
+	}
+	result := query.Updates(map[string]interface{}{
+		"status":          WebhookDeliveryStatusPending,
+		"attempts":        0,
+		"next_attempt_at": common.GetTimestamp(),
+	})
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return errors.New("投递记录不存在或正在投递中")
+	}
+	return nil
+}
+
+// DeleteOldWebhookDeliveries 删除早于 targetTimestamp 的已结束投递记录
+func DeleteOldWebhookDeliveries(targetTimestamp int64, limit int) (int64, error) {
+	var ids []int
+	err := DB.Model(&WebhookDelivery{}).
+		Where("created_time < ? AND status <> ?", targetTimestamp, WebhookDeliveryStatusPending).
+		Limit(limit).Pluck("id", &ids).Error
+	if err != nil || len(ids) == 0 {
+		return 0, err
+	}
+	result := DB.Where("id IN ?", ids).Delete(&WebhookDelivery{})
+	return result.RowsAffected, result.Error
+}
@@ -7,7 +7,9 @@ import (
 
 	"github.com/QuantumNous/new-api/common"
 	"github.com/QuantumNous/new-api/dto"
+	"github.com/QuantumNous/new-api/model"
 	relaycommon "github.com/QuantumNous/new-api/relay/common"
+	relayconstant "github.com/QuantumNous/new-api/relay/constant"
 	"github.com/QuantumNous/new-api/relay/helper"
 	"github.com/QuantumNous/new-api/service"
 	"github.com/QuantumNous/new-api/types"
@@ -61,7 +63,13 @@ func AudioHelper(c *gin.Context, info *relaycommon.RelayInfo) (newAPIError *type
 		}
 	}
 
+	var mediaCapture *mediaCapture
+	if info.RelayMode == relayconstant.RelayModeAudioSpeech {
+		mediaCapture = newMediaCapture(c, info, model.MediaSourceAudio)
+	}
+	mediaCapture.capture()
 	usage, newAPIError := adaptor.DoResponse(c, httpResp, info)
+	mediaCapture.finish(newAPIError == nil)
 	if newAPIError != nil {
 		// reset status code 重置状态码
 		service.ResetStatusCode(newAPIError, statusCodeMappingStr)
@@ -55,3 +55,13 @@ type TaskAdaptor interface {
 type OpenAIVideoConverter interface {
 	ConvertToOpenAIVideo(originTask *model.Task) ([]byte, error)
 }
+
+// UpstreamCallbackSupporter 上游支持任务状态回调的适配器，构建请求时会带上 info.UpstreamCallbackUrl
+type UpstreamCallbackSupporter interface {
+	SupportUpstreamCallback() bool
+}
+
+// TaskCanceler 支持取消上游任务的适配器
+type TaskCanceler interface {
+	CancelTask(baseUrl, key, taskId string) error
+}
@@ -7,9 +7,9 @@ import (
 	"strings"
 
 	"github.com/QuantumNous/new-api/dto"
-	"github.com/QuantumNous/new-api/relay/channel"
 	"github.com/QuantumNous/new-api/relay/channel/claude"
 	relaycommon "github.com/QuantumNous/new-api/relay/common"
+	relayconstant "github.com/QuantumNous/new-api/relay/constant"
 	"github.com/QuantumNous/new-api/service"
 	"github.com/QuantumNous/new-api/types"
 	"github.com/aws/aws-sdk-go-v2/service/bedrockruntime"
@@ -30,15 +30,33 @@ type Adaptor struct {
 	AwsClient  *bedrockruntime.Client
 	AwsModelId string
 	AwsReq     any
-	IsNova     bool
+	// Claude 以外的对话模型通过 Converse 接口调用
+	UseConverse bool
+	// 嵌入、图片与重排序请求通过 InvokeModel 调用
+	InvokeBody      []byte
+	RerankDocuments []string
+	ReturnDocuments bool
 }
 
-func (a *Adaptor) ConvertGeminiRequest(*gin.Context, *relaycommon.RelayInfo, *dto.GeminiChatRequest) (any, error) {
-	//TODO implement me
-	return nil, errors.New("not implemented")
+func (a *Adaptor) ConvertGeminiRequest(c *gin.Context, info *relaycommon.RelayInfo, request *dto.GeminiChatRequest) (any, error) {
+	if !shouldUseConverse(info) {
+		return nil, errors.New("not implemented")
+	}
+	openaiRequest, err := service.GeminiToOpenAIRequest(request, info)
+	if err != nil {
+		return nil, err
+	}
+	return a.ConvertOpenAIRequest(c, info, openaiRequest)
 }
 
 func (a *Adaptor) ConvertClaudeRequest(c *gin.Context, info *relaycommon.RelayInfo, request *dto.ClaudeRequest) (any, error) {
+	if shouldUseConverse(info) {
+		openaiRequest, err := service.ClaudeToOpenAIRequest(*request, info)
+		if err != nil {
+			return nil, err
+		}
+		return a.ConvertOpenAIRequest(c, info, openaiRequest)
+	}
 	for i, message := range request.Messages {
 		updated := false
 		if !message.IsStringContent() {
@@ -79,26 +97,26 @@ func (a *Adaptor) ConvertAudioRequest(c *gin.Context, info *relaycommon.RelayInf
 }
 
 func (a *Adaptor) ConvertImageRequest(c *gin.Context, info *relaycommon.RelayInfo, request dto.ImageRequest) (any, error) {
-	//TODO implement me
-	return nil, errors.New("not implemented")
+	if info.RelayMode != relayconstant.RelayModeImagesGenerations {
+		return nil, errors.New("not implemented")
+	}
+	return convertImageRequest(info, request)
 }
 
 func (a *Adaptor) Init(info *relaycommon.RelayInfo) {
 }
 
 func (a *Adaptor) GetRequestURL(info *relaycommon.RelayInfo) (string, error) {
+	// 两种密钥格式均通过 SDK 客户端发送请求，不需要请求地址
 	if info.ChannelOtherSettings.AwsKeyType == dto.AwsKeyTypeApiKey {
-		awsModelId := getAwsModelID(info.UpstreamModelName)
 		a.ClientMode = ClientModeApiKey
-		awsSecret := strings.Split(info.ApiKey, "|")
-		if len(awsSecret) != 2 {
+		if len(strings.Split(info.ApiKey, "|")) != 2 {
 			return "", errors.New("invalid aws api key, should be in format of <api-key>|<region>")
 		}
-		return fmt.Sprintf("https://bedrock-runtime.%s.amazonaws.com/model/%s/converse", awsModelId, awsSecret[1]), nil
 	} else {
 		a.ClientMode = ClientModeAKSK
-		return "", nil
 	}
+	return "", nil
 }
 
 func (a *Adaptor) SetupRequestHeader(c *gin.Context, req *http.Header, info *relaycommon.RelayInfo) error {
@@ -113,14 +131,11 @@ func (a *Adaptor) ConvertOpenAIRequest(c *gin.Context, info *relaycommon.RelayIn
 	if request == nil {
 		return nil, errors.New("request is nil")
 	}
-	// 检查是否为Nova模型
-	if isNovaModel(request.Model) {
-		novaReq := convertToNovaRequest(request)
-		a.IsNova = true
-		return novaReq, nil
+	if shouldUseConverse(info) {
+		a.UseConverse = true
+		return request, nil
 	}
 
-	// 原有的Claude模型处理逻辑
 	claudeReq, err := claude.RequestOpenAI2ClaudeMessage(c, *request)
 	if err != nil {
 		return nil, errors.Wrap(err, "failed to convert openai request to claude request")
@@ -130,12 +145,11 @@ func (a *Adaptor) ConvertOpenAIRequest(c *gin.Context, info *relaycommon.RelayIn
 }
 
 func (a *Adaptor) ConvertRerankRequest(c *gin.Context, relayMode int, request dto.RerankRequest) (any, error) {
-	return nil, nil
+	return a.convertRerankRequest(request)
 }
 
 func (a *Adaptor) ConvertEmbeddingRequest(c *gin.Context, info *relaycommon.RelayInfo, request dto.EmbeddingRequest) (any, error) {
-	//TODO implement me
-	return nil, errors.New("not implemented")
+	return convertEmbeddingRequest(info, request)
 }
 
 func (a *Adaptor) ConvertOpenAIResponsesRequest(c *gin.Context, info *relaycommon.RelayInfo, request dto.OpenAIResponsesRequest) (any, error) {
@@ -144,27 +158,40 @@ func (a *Adaptor) ConvertOpenAIResponsesRequest(c *gin.Context, info *relaycommo
 }
 
 func (a *Adaptor) DoRequest(c *gin.Context, info *relaycommon.RelayInfo, requestBody io.Reader) (any, error) {
-	if a.ClientMode == ClientModeApiKey {
-		return channel.DoApiRequest(a, c, info, requestBody)
-	} else {
-		return doAwsClientRequest(c, info, a, requestBody)
+	switch info.RelayMode {
+	case relayconstant.RelayModeEmbeddings, relayconstant.RelayModeImagesGenerations, relayconstant.RelayModeRerank:
+		return nil, a.prepareInvokeRequest(c, info, requestBody)
 	}
+	if a.UseConverse {
+		return nil, a.prepareConverseRequest(c, info, requestBody)
+	}
+	return doAwsClientRequest(c, info, a, requestBody)
 }
 
 func (a *Adaptor) DoResponse(c *gin.Context, resp *http.Response, info *relaycommon.RelayInfo) (usage any, err *types.NewAPIError) {
-	if a.ClientMode == ClientModeApiKey {
-		claudeAdaptor := claude.Adaptor{}
-		usage, err = claudeAdaptor.DoResponse(c, resp, info)
-	} else {
-		if a.IsNova {
-			err, usage = handleNovaRequest(c, info, a)
+	switch info.RelayMode {
+	case relayconstant.RelayModeEmbeddings:
+		err, usage = awsEmbeddingHandler(c, info, a)
+		return
+	case relayconstant.RelayModeImagesGenerations:
+		err, usage = awsImageHandler(c, info, a)
+		return
+	case relayconstant.RelayModeRerank:
+		err, usage = awsRerankHandler(c, info, a)
+		return
+	}
+	if a.UseConverse {
+		if info.IsStream {
+			err, usage = awsConverseStreamHandler(c, info, a)
 		} else {
-			if info.IsStream {
-				err, usage = awsStreamHandler(c, info, a)
-			} else {
-				err, usage = awsHandler(c, info, a)
-			}
+			err, usage = awsConverseHandler(c, info, a)
 		}
+		return
+	}
+	if info.IsStream {
+		err, usage = awsStreamHandler(c, info, a)
+	} else {
+		err, usage = awsHandler(c, info, a)
 	}
 	return
 }
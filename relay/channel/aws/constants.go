@@ -1,7 +1,5 @@
 package aws
 
-import "strings"
-
 var awsModelIDMap = map[string]string{
 	"claude-instant-1.2":         "anthropic.claude-instant-v1",
 	"claude-2.0":                 "anthropic.claude-v2",
@@ -28,6 +26,22 @@ var awsModelIDMap = map[string]string{
 	"nova-reel-v1:0":    "amazon.nova-reel-v1:0",
 	"nova-reel-v1:1":    "amazon.nova-reel-v1:1",
 	"nova-sonic-v1:0":   "amazon.nova-sonic-v1:0",
+	// Embedding models
+	"titan-embed-text-v1":          "amazon.titan-embed-text-v1",
+	"titan-embed-text-v2:0":        "amazon.titan-embed-text-v2:0",
+	"titan-embed-image-v1":         "amazon.titan-embed-image-v1",
+	"cohere-embed-english-v3":      "cohere.embed-english-v3",
+	"cohere-embed-multilingual-v3": "cohere.embed-multilingual-v3",
+	"cohere-embed-v4:0":            "cohere.embed-v4:0",
+	// Image models
+	"titan-image-generator-v1":   "amazon.titan-image-generator-v1",
+	"titan-image-generator-v2:0": "amazon.titan-image-generator-v2:0",
+	"sd3-5-large-v1:0":           "stability.sd3-5-large-v1:0",
+	"stable-image-core-v1:1":     "stability.stable-image-core-v1:1",
+	"stable-image-ultra-v1:1":    "stability.stable-image-ultra-v1:1",
+	// Rerank models
+	"cohere-rerank-v3-5:0": "cohere.rerank-v3-5:0",
+	"amazon-rerank-v1:0":   "amazon.rerank-v1:0",
 }
 
 var awsModelCanCrossRegionMap = map[string]map[string]bool{
@@ -133,8 +147,3 @@ var awsRegionCrossModelPrefixMap = map[string]string{
 }
 
 var ChannelName = "aws"
-
-// 判断是否为Nova模型
-func isNovaModel(modelId string) bool {
-	return strings.Contains(modelId, "nova-")
-}
@@ -0,0 +1,488 @@
+package aws
+
+import (
+	"encoding/base64"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/constant"
+	"github.com/QuantumNous/new-api/dto"
+	"github.com/QuantumNous/new-api/relay/channel/openai"
+	relaycommon "github.com/QuantumNous/new-api/relay/common"
+	"github.com/QuantumNous/new-api/relay/helper"
+	"github.com/QuantumNous/new-api/service"
+	"github.com/QuantumNous/new-api/types"
+
+	"github.com/gin-gonic/gin"
+	"github.com/pkg/errors"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/bedrockruntime"
+	"github.com/aws/aws-sdk-go-v2/service/bedrockruntime/document"
+	bedrockruntimeTypes "github.com/aws/aws-sdk-go-v2/service/bedrockruntime/types"
+)
+
+func isClaudeModel(modelName string) bool {
+	return strings.Contains(getAwsModelID(modelName), "anthropic.")
+}
+
+// shouldUseConverse Claude 以外的对话模型通过 Converse 接口调用；Claude 模型默认使用原生 InvokeModel 接口，
+// 以保留 anthropic-beta、思考签名等 Converse 不支持的功能
+func shouldUseConverse(info *relaycommon.RelayInfo) bool {
+	return !isClaudeModel(info.UpstreamModelName) || info.ChannelOtherSettings.AwsClaudeUseConverse
+}
+
+// prepareConverseRequest 将 OpenAI 格式的请求转换为 Converse 请求，请求在 DoResponse 中发出
+func (a *Adaptor) prepareConverseRequest(c *gin.Context, info *relaycommon.RelayInfo, requestBody io.Reader) error {
+	awsCli, err := newAwsClient(c, info)
+	if err != nil {
+		return types.NewError(err, types.ErrorCodeChannelAwsClientError)
+	}
+	a.AwsClient = awsCli
+
+	var request dto.GeneralOpenAIRequest
+	if err := common.DecodeJson(requestBody, &request); err != nil {
+		return types.NewError(errors.Wrap(err, "decode converse request fail"), types.ErrorCodeBadRequestBody)
+	}
+	input, err := convertConverseRequest(c, &request, a.invokeModelId(info))
+	if err != nil {
+		return types.NewErrorWithStatusCode(err, types.ErrorCodeConvertRequestFailed, http.StatusBadRequest, types.ErrOptionWithSkipRetry())
+	}
+	if info.IsStream {
+		a.AwsReq = &bedrockruntime.ConverseStreamInput{
+			ModelId:                      input.ModelId,
+			Messages:                     input.Messages,
+			System:                       input.System,
+			InferenceConfig:              input.InferenceConfig,
+			ToolConfig:                   input.ToolConfig,
+			AdditionalModelRequestFields: input.AdditionalModelRequestFields,
+		}
+	} else {
+		a.AwsReq = input
+	}
+	return nil
+}
+
+func convertConverseRequest(c *gin.Context, request *dto.GeneralOpenAIRequest, modelId string) (*bedrockruntime.ConverseInput, error) {
+	input := &bedrockruntime.ConverseInput{
+		ModelId: aws.String(modelId),
+	}
+
+	for _, message := range request.Messages {
+		switch message.Role {
+		case "system", "developer":
+			for _, part := range converseContentParts(&message) {
+				if part.Type != dto.ContentTypeText || part.Text == "" {
+					continue
+				}
+				input.System = append(input.System, &bedrockruntimeTypes.SystemContentBlockMemberText{Value: part.Text})
+				if len(part.CacheControl) > 0 {
+					input.System = append(input.System, &bedrockruntimeTypes.SystemContentBlockMemberCachePoint{
+						Value: bedrockruntimeTypes.CachePointBlock{Type: bedrockruntimeTypes.CachePointTypeDefault},
+					})
+				}
+			}
+		case "tool":
+			input.Messages = appendConverseMessage(input.Messages, bedrockruntimeTypes.ConversationRoleUser, []bedrockruntimeTypes.ContentBlock{
+				&bedrockruntimeTypes.ContentBlockMemberToolResult{Value: bedrockruntimeTypes.ToolResultBlock{
+					ToolUseId: aws.String(message.ToolCallId),
+					Content: []bedrockruntimeTypes.ToolResultContentBlock{
+						&bedrockruntimeTypes.ToolResultContentBlockMemberText{Value: message.StringContent()},
+					},
+				}},
+			})
+		case "assistant":
+			blocks, err := converseContentBlocks(c, &message)
+			if err != nil {
+				return nil, err
+			}
+			for _, toolCall := range message.ParseToolCalls() {
+				var arguments any = map[string]any{}
+				if toolCall.Function.Arguments != "" {
+					if err := common.UnmarshalJsonStr(toolCall.Function.Arguments, &arguments); err != nil {
+						return nil, fmt.Errorf("invalid arguments of tool call %s: %w", toolCall.ID, err)
+					}
+				}
+				blocks = append(blocks, &bedrockruntimeTypes.ContentBlockMemberToolUse{Value: bedrockruntimeTypes.ToolUseBlock{
+					ToolUseId: aws.String(toolCall.ID),
+					Name:      aws.String(toolCall.Function.Name),
+					Input:     document.NewLazyDocument(arguments),
+				}})
+			}
+			input.Messages = appendConverseMessage(input.Messages, bedrockruntimeTypes.ConversationRoleAssistant, blocks)
+		default:
+			blocks, err := converseContentBlocks(c, &message)
+			if err != nil {
+				return nil, err
+			}
+			input.Messages = appendConverseMessage(input.Messages, bedrockruntimeTypes.ConversationRoleUser, blocks)
+		}
+	}
+
+	inferenceConfig := &bedrockruntimeTypes.InferenceConfiguration{}
+	if maxTokens := request.GetMaxTokens(); maxTokens > 0 {
+		inferenceConfig.MaxTokens = aws.Int32(int32(maxTokens))
+	}
+	if request.Temperature != nil {
+		inferenceConfig.Temperature = aws.Float32(float32(*request.Temperature))
+	}
+	if request.TopP != 0 {
+		inferenceConfig.TopP = aws.Float32(float32(request.TopP))
+	}
+	inferenceConfig.StopSequences = parseStopSequences(request.Stop)
+	input.InferenceConfig = inferenceConfig
+	if request.TopK > 0 && isClaudeModel(modelId) {
+		input.AdditionalModelRequestFields = document.NewLazyDocument(map[string]any{"top_k": request.TopK})
+	}
+
+	input.ToolConfig = convertConverseTools(request)
+	return input, nil
+}
+
+// appendConverseMessage Converse 要求用户与助手消息交替出现，相邻的同角色消息合并为一条
+func appendConverseMessage(messages []bedrockruntimeTypes.Message, role bedrockruntimeTypes.ConversationRole, blocks []bedrockruntimeTypes.ContentBlock) []bedrockruntimeTypes.Message {
+	if len(blocks) == 0 {
+		return messages
+	}
+	if n := len(messages); n > 0 && messages[n-1].Role == role {
+		messages[n-1].Content = append(messages[n-1].Content, blocks...)
+		return messages
+	}
+	return append(messages, bedrockruntimeTypes.Message{Role: role, Content: blocks})
+}
+
+// converseContentParts ParseContent 不保留 cache_control，数组形式的内容重新解析
+func converseContentParts(message *dto.Message) []dto.MediaContent {
+	if _, ok := message.Content.([]any); ok {
+		var parts []dto.MediaContent
+		if data, err := common.Marshal(message.Content); err == nil && common.Unmarshal(data, &parts) == nil {
+			return parts
+		}
+	}
+	return message.ParseContent()
+}
+
+// converseContentBlocks 转换文本与图片内容，带有 cache_control 的内容后追加缓存点
+func converseContentBlocks(c *gin.Context, message *dto.Message) ([]bedrockruntimeTypes.ContentBlock, error) {
+	var blocks []bedrockruntimeTypes.ContentBlock
+	for _, part := range converseContentParts(message) {
+		switch part.Type {
+		case dto.ContentTypeText:
+			if part.Text == "" {
+				continue
+			}
+			blocks = append(blocks, &bedrockruntimeTypes.ContentBlockMemberText{Value: part.Text})
+		case dto.ContentTypeImageURL:
+			imageUrl := part.GetImageMedia()
+			if imageUrl == nil {
+				continue
+			}
+			block, err := converseImageBlock(c, imageUrl.Url)
+			if err != nil {
+				return nil, err
+			}
+			blocks = append(blocks, block)
+		default:
+			continue
+		}
+		if len(part.CacheControl) > 0 {
+			blocks = append(blocks, &bedrockruntimeTypes.ContentBlockMemberCachePoint{
+				Value: bedrockruntimeTypes.CachePointBlock{Type: bedrockruntimeTypes.CachePointTypeDefault},
+			})
+		}
+	}
+	return blocks, nil
+}
+
+func converseImageBlock(c *gin.Context, url string) (bedrockruntimeTypes.ContentBlock, error) {
+	var format, base64Data string
+	if strings.HasPrefix(url, "data:") {
+		_, imageFormat, data, err := service.DecodeBase64ImageData(url)
+		if err != nil {
+			return nil, fmt.Errorf("decode image data failed: %w", err)
+		}
+		format, base64Data = imageFormat, data
+	} else {
+		fileData, err := service.GetFileBase64FromUrl(c, url, "formatting image for Bedrock Converse")
+		if err != nil {
+			return nil, fmt.Errorf("get file base64 from url failed: %w", err)
+		}
+		format, base64Data = strings.TrimPrefix(fileData.MimeType, "image/"), fileData.Base64Data
+	}
+	if format == "jpg" {
+		format = "jpeg"
+	}
+	data, err := base64.StdEncoding.DecodeString(base64Data)
+	if err != nil {
+		return nil, fmt.Errorf("decode image data failed: %w", err)
+	}
+	return &bedrockruntimeTypes.ContentBlockMemberImage{Value: bedrockruntimeTypes.ImageBlock{
+		Format: bedrockruntimeTypes.ImageFormat(format),
+		Source: &bedrockruntimeTypes.ImageSourceMemberBytes{Value: data},
+	}}, nil
+}
+
+// convertConverseTools Converse 不支持 tool_choice 为 none，此时按 auto 处理
+func convertConverseTools(request *dto.GeneralOpenAIRequest) *bedrockruntimeTypes.ToolConfiguration {
+	var tools []bedrockruntimeTypes.Tool
+	for _, tool := range request.Tools {
+		if tool.Type != "" && tool.Type != "function" {
+			continue
+		}
+		parameters := tool.Function.Parameters
+		if parameters == nil {
+			parameters = map[string]any{"type": "object", "properties": map[string]any{}}
+		}
+		spec := bedrockruntimeTypes.ToolSpecification{
+			Name:        aws.String(tool.Function.Name),
+			InputSchema: &bedrockruntimeTypes.ToolInputSchemaMemberJson{Value: document.NewLazyDocument(parameters)},
+		}
+		if tool.Function.Description != "" {
+			spec.Description = aws.String(tool.Function.Description)
+		}
+		tools = append(tools, &bedrockruntimeTypes.ToolMemberToolSpec{Value: spec})
+	}
+	if len(tools) == 0 {
+		return nil
+	}
+
+	toolConfig := &bedrockruntimeTypes.ToolConfiguration{Tools: tools}
+	switch choice := request.ToolChoice.(type) {
+	case string:
+		if choice == "required" {
+			toolConfig.ToolChoice = &bedrockruntimeTypes.ToolChoiceMemberAny{}
+		}
+	case map[string]any:
+		if function, ok := choice["function"].(map[string]any); ok {
+			if name := common.Interface2String(function["name"]); name != "" {
+				toolConfig.ToolChoice = &bedrockruntimeTypes.ToolChoiceMemberTool{
+					Value: bedrockruntimeTypes.SpecificToolChoice{Name: aws.String(name)},
+				}
+			}
+		}
+	}
+	return toolConfig
+}
+
+func converseFinishReason(stopReason bedrockruntimeTypes.StopReason) string {
+	switch stopReason {
+	case bedrockruntimeTypes.StopReasonToolUse:
+		return constant.FinishReasonToolCalls
+	case bedrockruntimeTypes.StopReasonMaxTokens:
+		return constant.FinishReasonLength
+	case bedrockruntimeTypes.StopReasonContentFiltered, bedrockruntimeTypes.StopReasonGuardrailIntervened:
+		return constant.FinishReasonContentFilter
+	default:
+		return constant.FinishReasonStop
+	}
+}
+
+// converseUsage Converse 返回的输入 token 数不含缓存读写部分。Claude 格式的计费与原生接口一致，
+// 提示 token 不含缓存；其余格式的计费会从提示 token 中扣除缓存部分，因此需要加回
+func converseUsage(info *relaycommon.RelayInfo, tokenUsage *bedrockruntimeTypes.TokenUsage) *dto.Usage {
+	usage := &dto.Usage{}
+	if tokenUsage == nil {
+		return usage
+	}
+	cacheReadTokens := int(aws.ToInt32(tokenUsage.CacheReadInputTokens))
+	cacheWriteTokens := int(aws.ToInt32(tokenUsage.CacheWriteInputTokens))
+	usage.PromptTokens = int(aws.ToInt32(tokenUsage.InputTokens))
+	if info.RelayFormat != types.RelayFormatClaude {
+		usage.PromptTokens += cacheReadTokens + cacheWriteTokens
+	}
+	usage.CompletionTokens = int(aws.ToInt32(tokenUsage.OutputTokens))
+	usage.TotalTokens = usage.PromptTokens + usage.CompletionTokens
+	usage.PromptTokensDetails.CachedTokens = cacheReadTokens
+	usage.PromptTokensDetails.CachedCreationTokens = cacheWriteTokens
+	return usage
+}
+
+func converseToolArguments(input document.Interface) string {
+	if input == nil {
+		return "{}"
+	}
+	data, err := input.MarshalSmithyDocument()
+	if err != nil {
+		return "{}"
+	}
+	return string(data)
+}
+
+func responseConverse2OpenAI(c *gin.Context, info *relaycommon.RelayInfo, awsResp *bedrockruntime.ConverseOutput) *dto.OpenAITextResponse {
+	message := dto.Message{Role: "assistant"}
+	var content strings.Builder
+	var toolCalls []dto.ToolCallResponse
+	if output, ok := awsResp.Output.(*bedrockruntimeTypes.ConverseOutputMemberMessage); ok {
+		for _, block := range output.Value.Content {
+			switch v := block.(type) {
+			case *bedrockruntimeTypes.ContentBlockMemberText:
+				content.WriteString(v.Value)
+			case *bedrockruntimeTypes.ContentBlockMemberReasoningContent:
+				if reasoning, ok := v.Value.(*bedrockruntimeTypes.ReasoningContentBlockMemberReasoningText); ok {
+					message.ReasoningContent += aws.ToString(reasoning.Value.Text)
+				}
+			case *bedrockruntimeTypes.ContentBlockMemberToolUse:
+				toolCalls = append(toolCalls, dto.ToolCallResponse{
+					ID:   aws.ToString(v.Value.ToolUseId),
+					Type: "function",
+					Function: dto.FunctionResponse{
+						Name:      aws.ToString(v.Value.Name),
+						Arguments: converseToolArguments(v.Value.Input),
+					},
+				})
+			}
+		}
+	}
+	message.SetStringContent(content.String())
+	if len(toolCalls) > 0 {
+		message.SetToolCalls(toolCalls)
+	}
+	return &dto.OpenAITextResponse{
+		Id:      helper.GetResponseID(c),
+		Object:  "chat.completion",
+		Created: common.GetTimestamp(),
+		Model:   info.UpstreamModelName,
+		Choices: []dto.OpenAITextResponseChoice{{
+			Index:        0,
+			Message:      message,
+			FinishReason: converseFinishReason(awsResp.StopReason),
+		}},
+	}
+}
+
+func awsConverseHandler(c *gin.Context, info *relaycommon.RelayInfo, a *Adaptor) (*types.NewAPIError, *dto.Usage) {
+	awsResp, err := a.AwsClient.Converse(c.Request.Context(), a.AwsReq.(*bedrockruntime.ConverseInput))
+	if err != nil {
+		return newAwsResponseError(err, "Converse"), nil
+	}
+
+	response := responseConverse2OpenAI(c, info, awsResp)
+	usage := converseUsage(info, awsResp.Usage)
+	response.Usage = *usage
+
+	var responseBody any = response
+	switch info.RelayFormat {
+	case types.RelayFormatClaude:
+		responseBody = service.ResponseOpenAI2Claude(response, info)
+	case types.RelayFormatGemini:
+		responseBody = service.ResponseOpenAI2Gemini(response, info)
+	}
+	c.JSON(http.StatusOK, responseBody)
+	return nil, usage
+}
+
+func sendConverseStreamData(c *gin.Context, info *relaycommon.RelayInfo, resp *dto.ChatCompletionsStreamResponse) {
+	data, err := common.Marshal(resp)
+	if err != nil {
+		common.SysLog("error marshalling stream response: " + err.Error())
+		return
+	}
+	if err := openai.HandleStreamFormat(c, info, string(data), info.ChannelSetting.ForceFormat, info.ChannelSetting.ThinkingToContent); err != nil {
+		common.SysLog("error handling stream format: " + err.Error())
+	}
+}
+
+func awsConverseStreamHandler(c *gin.Context, info *relaycommon.RelayInfo, a *Adaptor) (*types.NewAPIError, *dto.Usage) {
+	awsResp, err := a.AwsClient.ConverseStream(c.Request.Context(), a.AwsReq.(*bedrockruntime.ConverseStreamInput))
+	if err != nil {
+		return newAwsResponseError(err, "ConverseStream"), nil
+	}
+	stream := awsResp.GetStream()
+	defer stream.Close()
+
+	helper.SetEventStreamHeaders(c)
+	id := helper.GetResponseID(c)
+	createAt := common.GetTimestamp()
+	finishReason := constant.FinishReasonStop
+	var usage *dto.Usage
+	var responseText strings.Builder
+	// 内容块序号到工具调用序号的映射
+	toolIndexes := make(map[int32]int)
+
+	newChunk := func() (*dto.ChatCompletionsStreamResponse, *dto.ChatCompletionsStreamResponseChoiceDelta) {
+		chunk := &dto.ChatCompletionsStreamResponse{
+			Id:      id,
+			Object:  "chat.completion.chunk",
+			Created: createAt,
+			Model:   info.UpstreamModelName,
+			Choices: []dto.ChatCompletionsStreamResponseChoice{{Index: 0}},
+		}
+		return chunk, &chunk.Choices[0].Delta
+	}
+
+	for event := range stream.Events() {
+		switch v := event.(type) {
+		case *bedrockruntimeTypes.ConverseStreamOutputMemberMessageStart:
+			info.SetFirstResponseTime()
+			sendConverseStreamData(c, info, helper.GenerateStartEmptyResponse(id, createAt, info.UpstreamModelName, nil))
+		case *bedrockruntimeTypes.ConverseStreamOutputMemberContentBlockStart:
+			toolUse, ok := v.Value.Start.(*bedrockruntimeTypes.ContentBlockStartMemberToolUse)
+			if !ok {
+				continue
+			}
+			toolIndex := len(toolIndexes)
+			toolIndexes[aws.ToInt32(v.Value.ContentBlockIndex)] = toolIndex
+			chunk, delta := newChunk()
+			delta.ToolCalls = []dto.ToolCallResponse{{
+				Index: common.GetPointer(toolIndex),
+				ID:    aws.ToString(toolUse.Value.ToolUseId),
+				Type:  "function",
+				Function: dto.FunctionResponse{
+					Name: aws.ToString(toolUse.Value.Name),
+				},
+			}}
+			responseText.WriteString(aws.ToString(toolUse.Value.Name))
+			sendConverseStreamData(c, info, chunk)
+		case *bedrockruntimeTypes.ConverseStreamOutputMemberContentBlockDelta:
+			chunk, delta := newChunk()
+			switch d := v.Value.Delta.(type) {
+			case *bedrockruntimeTypes.ContentBlockDeltaMemberText:
+				delta.SetContentString(d.Value)
+				responseText.WriteString(d.Value)
+			case *bedrockruntimeTypes.ContentBlockDeltaMemberReasoningContent:
+				reasoning, ok := d.Value.(*bedrockruntimeTypes.ReasoningContentBlockDeltaMemberText)
+				if !ok {
+					continue
+				}
+				delta.SetReasoningContent(reasoning.Value)
+				responseText.WriteString(reasoning.Value)
+			case *bedrockruntimeTypes.ContentBlockDeltaMemberToolUse:
+				toolIndex, ok := toolIndexes[aws.ToInt32(v.Value.ContentBlockIndex)]
+				if !ok {
+					continue
+				}
+				arguments := aws.ToString(d.Value.Input)
+				delta.ToolCalls = []dto.ToolCallResponse{{
+					Index:    common.GetPointer(toolIndex),
+					Function: dto.FunctionResponse{Arguments: arguments},
+				}}
+				responseText.WriteString(arguments)
+			default:
+				continue
+			}
+			sendConverseStreamData(c, info, chunk)
+		case *bedrockruntimeTypes.ConverseStreamOutputMemberMessageStop:
+			finishReason = converseFinishReason(v.Value.StopReason)
+		case *bedrockruntimeTypes.ConverseStreamOutputMemberMetadata:
+			usage = converseUsage(info, v.Value.Usage)
+		}
+	}
+	if err := stream.Err(); err != nil {
+		return newAwsResponseError(err, "ConverseStream"), nil
+	}
+	if usage == nil || usage.TotalTokens == 0 {
+		usage = service.ResponseText2Usage(c, responseText.String(), info.UpstreamModelName, info.PromptTokens)
+	}
+
+	sendConverseStreamData(c, info, helper.GenerateStopResponse(id, createAt, info.UpstreamModelName, finishReason))
+	final := helper.GenerateFinalUsageResponse(id, createAt, info.UpstreamModelName, *usage)
+	finalData, err := common.Marshal(final)
+	if err != nil {
+		common.SysLog("error marshalling stream response: " + err.Error())
+	}
+	openai.HandleFinalResponse(c, info, string(finalData), id, createAt, info.UpstreamModelName, "", usage, false)
+	return nil, usage
+}
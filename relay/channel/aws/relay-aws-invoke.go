@@ -0,0 +1,423 @@
+package aws
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/dto"
+	relaycommon "github.com/QuantumNous/new-api/relay/common"
+	"github.com/QuantumNous/new-api/types"
+
+	"github.com/gin-gonic/gin"
+	"github.com/pkg/errors"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	awsmiddleware "github.com/aws/aws-sdk-go-v2/aws/middleware"
+	awshttp "github.com/aws/aws-sdk-go-v2/aws/transport/http"
+	"github.com/aws/aws-sdk-go-v2/service/bedrockruntime"
+	smithyhttp "github.com/aws/smithy-go/transport/http"
+)
+
+// Bedrock 在响应头中返回输入 token 数
+const bedrockInputTokenCountHeader = "X-Amzn-Bedrock-Input-Token-Count"
+
+func isTitanEmbeddingModel(modelId string) bool {
+	return strings.Contains(modelId, "amazon.titan-embed")
+}
+
+func isCohereEmbeddingModel(modelId string) bool {
+	return strings.Contains(modelId, "cohere.embed")
+}
+
+// Nova Canvas 与 Titan Image Generator 使用相同的请求格式
+func isTitanImageModel(modelId string) bool {
+	return strings.Contains(modelId, "amazon.titan-image") || strings.Contains(modelId, "amazon.nova-canvas")
+}
+
+func isStabilityImageModel(modelId string) bool {
+	return strings.Contains(modelId, "stability.")
+}
+
+func isCohereRerankModel(modelId string) bool {
+	return strings.Contains(modelId, "cohere.rerank")
+}
+
+func isAmazonRerankModel(modelId string) bool {
+	return strings.Contains(modelId, "amazon.rerank")
+}
+
+// prepareInvokeRequest 嵌入、图片与重排序请求通过 InvokeModel 调用，请求在 DoResponse 中发出。
+// 两种密钥格式均由 SDK 客户端处理
+func (a *Adaptor) prepareInvokeRequest(c *gin.Context, info *relaycommon.RelayInfo, requestBody io.Reader) error {
+	awsCli, err := newAwsClient(c, info)
+	if err != nil {
+		return types.NewError(err, types.ErrorCodeChannelAwsClientError)
+	}
+	a.AwsClient = awsCli
+	a.InvokeBody, err = io.ReadAll(requestBody)
+	if err != nil {
+		return types.NewError(errors.Wrap(err, "read request body fail"), types.ErrorCodeBadRequestBody)
+	}
+	return nil
+}
+
+func (a *Adaptor) invokeModelId(info *relaycommon.RelayInfo) string {
+	awsModelId := getAwsModelID(info.UpstreamModelName)
+	awsRegionPrefix := getAwsRegionPrefix(a.AwsClient.Options().Region)
+	if awsModelCanCrossRegion(awsModelId, awsRegionPrefix) {
+		awsModelId = awsModelCrossRegion(awsModelId, awsRegionPrefix)
+	}
+	return awsModelId
+}
+
+// invokeBodies 每次调用只能处理一条输入的模型，转换后的请求为数组，逐个调用
+func (a *Adaptor) invokeBodies() ([][]byte, error) {
+	if common.GetJsonType(a.InvokeBody) != "array" {
+		return [][]byte{a.InvokeBody}, nil
+	}
+	var items []json.RawMessage
+	if err := common.Unmarshal(a.InvokeBody, &items); err != nil {
+		return nil, err
+	}
+	bodies := make([][]byte, 0, len(items))
+	for _, item := range items {
+		bodies = append(bodies, item)
+	}
+	return bodies, nil
+}
+
+// newAwsResponseError 保留上游返回的状态码，便于重试与渠道禁用逻辑判断
+func newAwsResponseError(err error, operation string) *types.NewAPIError {
+	statusCode := http.StatusInternalServerError
+	var respErr *awshttp.ResponseError
+	if errors.As(err, &respErr) {
+		statusCode = respErr.HTTPStatusCode()
+	}
+	return types.NewOpenAIError(errors.Wrap(err, operation), types.ErrorCodeAwsInvokeError, statusCode)
+}
+
+// invokeModel 返回响应体与响应头中的输入 token 数
+func (a *Adaptor) invokeModel(c *gin.Context, modelId string, body []byte) ([]byte, int, *types.NewAPIError) {
+	awsResp, err := a.AwsClient.InvokeModel(c.Request.Context(), &bedrockruntime.InvokeModelInput{
+		ModelId:     aws.String(modelId),
+		Accept:      aws.String("application/json"),
+		ContentType: aws.String("application/json"),
+		Body:        body,
+	})
+	if err != nil {
+		return nil, 0, newAwsResponseError(err, "InvokeModel")
+	}
+	inputTokens := 0
+	if rawResp, ok := awsmiddleware.GetRawResponse(awsResp.ResultMetadata).(*smithyhttp.Response); ok {
+		inputTokens, _ = strconv.Atoi(rawResp.Header.Get(bedrockInputTokenCountHeader))
+	}
+	return awsResp.Body, inputTokens, nil
+}
+
+func convertEmbeddingRequest(info *relaycommon.RelayInfo, request dto.EmbeddingRequest) (any, error) {
+	awsModelId := getAwsModelID(info.UpstreamModelName)
+	inputs := request.ParseInput()
+	if len(inputs) == 0 {
+		return nil, errors.New("input is empty")
+	}
+	switch {
+	case isTitanEmbeddingModel(awsModelId):
+		titanReqs := make([]TitanEmbeddingRequest, 0, len(inputs))
+		for _, input := range inputs {
+			titanReqs = append(titanReqs, TitanEmbeddingRequest{
+				InputText:  input,
+				Dimensions: request.Dimensions,
+			})
+		}
+		return titanReqs, nil
+	case isCohereEmbeddingModel(awsModelId):
+		cohereReq := CohereEmbeddingRequest{
+			Texts:          inputs,
+			InputType:      "search_document",
+			EmbeddingTypes: []string{"float"},
+		}
+		// 仅 Embed v4 支持指定维度
+		if strings.Contains(awsModelId, "embed-v4") {
+			cohereReq.OutputDimension = request.Dimensions
+		}
+		return cohereReq, nil
+	default:
+		return nil, fmt.Errorf("unsupported aws embedding model: %s", info.UpstreamModelName)
+	}
+}
+
+func parseCohereEmbeddings(data json.RawMessage) ([][]float64, error) {
+	var embeddings [][]float64
+	if common.GetJsonType(data) == "array" {
+		err := common.Unmarshal(data, &embeddings)
+		return embeddings, err
+	}
+	var byType struct {
+		Float [][]float64 `json:"float"`
+	}
+	err := common.Unmarshal(data, &byType)
+	return byType.Float, err
+}
+
+func awsEmbeddingHandler(c *gin.Context, info *relaycommon.RelayInfo, a *Adaptor) (*types.NewAPIError, *dto.Usage) {
+	awsModelId := a.invokeModelId(info)
+	bodies, err := a.invokeBodies()
+	if err != nil {
+		return types.NewError(errors.Wrap(err, "decode embedding request fail"), types.ErrorCodeBadRequestBody), nil
+	}
+
+	embeddingResp := dto.OpenAIEmbeddingResponse{
+		Object: "list",
+		Data:   make([]dto.OpenAIEmbeddingResponseItem, 0, len(bodies)),
+		Model:  info.UpstreamModelName,
+	}
+	usage := &dto.Usage{}
+	for _, body := range bodies {
+		respBody, inputTokens, apiErr := a.invokeModel(c, awsModelId, body)
+		if apiErr != nil {
+			return apiErr, nil
+		}
+		if isTitanEmbeddingModel(awsModelId) {
+			var titanResp TitanEmbeddingResponse
+			if err := common.Unmarshal(respBody, &titanResp); err != nil {
+				return types.NewError(errors.Wrap(err, "unmarshal titan embedding response"), types.ErrorCodeBadResponseBody), nil
+			}
+			embeddingResp.Data = append(embeddingResp.Data, dto.OpenAIEmbeddingResponseItem{
+				Object:    "embedding",
+				Index:     len(embeddingResp.Data),
+				Embedding: titanResp.Embedding,
+			})
+			if titanResp.InputTextTokenCount > 0 {
+				inputTokens = titanResp.InputTextTokenCount
+			}
+		} else {
+			var cohereResp CohereEmbeddingResponse
+			if err := common.Unmarshal(respBody, &cohereResp); err != nil {
+				return types.NewError(errors.Wrap(err, "unmarshal cohere embedding response"), types.ErrorCodeBadResponseBody), nil
+			}
+			embeddings, err := parseCohereEmbeddings(cohereResp.Embeddings)
+			if err != nil {
+				return types.NewError(errors.Wrap(err, "unmarshal cohere embeddings"), types.ErrorCodeBadResponseBody), nil
+			}
+			for _, embedding := range embeddings {
+				embeddingResp.Data = append(embeddingResp.Data, dto.OpenAIEmbeddingResponseItem{
+					Object:    "embedding",
+					Index:     len(embeddingResp.Data),
+					Embedding: embedding,
+				})
+			}
+		}
+		usage.PromptTokens += inputTokens
+	}
+	if usage.PromptTokens == 0 {
+		usage.PromptTokens = info.PromptTokens
+	}
+	usage.TotalTokens = usage.PromptTokens
+	embeddingResp.Usage = *usage
+
+	c.JSON(http.StatusOK, embeddingResp)
+	return nil, usage
+}
+
+func parseImageSize(size string) (int, int) {
+	width, height := 1024, 1024
+	parts := strings.Split(strings.ToLower(size), "x")
+	if len(parts) == 2 {
+		w, errW := strconv.Atoi(strings.TrimSpace(parts[0]))
+		h, errH := strconv.Atoi(strings.TrimSpace(parts[1]))
+		if errW == nil && errH == nil && w > 0 && h > 0 {
+			width, height = w, h
+		}
+	}
+	return width, height
+}
+
+// stabilityAspectRatios Stability 模型只接受固定的宽高比
+var stabilityAspectRatios = []struct {
+	name  string
+	ratio float64
+}{
+	{"21:9", 21.0 / 9}, {"16:9", 16.0 / 9}, {"3:2", 3.0 / 2}, {"5:4", 5.0 / 4}, {"1:1", 1},
+	{"4:5", 4.0 / 5}, {"2:3", 2.0 / 3}, {"9:16", 9.0 / 16}, {"9:21", 9.0 / 21},
+}
+
+func stabilityAspectRatio(width int, height int) string {
+	target := float64(width) / float64(height)
+	best := "1:1"
+	bestDiff := math.MaxFloat64
+	for _, ar := range stabilityAspectRatios {
+		if diff := math.Abs(ar.ratio - target); diff < bestDiff {
+			best, bestDiff = ar.name, diff
+		}
+	}
+	return best
+}
+
+func convertImageRequest(info *relaycommon.RelayInfo, request dto.ImageRequest) (any, error) {
+	awsModelId := getAwsModelID(info.UpstreamModelName)
+	n := int(request.N)
+	if n <= 0 {
+		n = 1
+	}
+	width, height := parseImageSize(request.Size)
+	switch {
+	case isTitanImageModel(awsModelId):
+		quality := "standard"
+		if request.Quality == "hd" || request.Quality == "high" {
+			quality = "premium"
+		}
+		return TitanImageRequest{
+			TaskType:          "TEXT_IMAGE",
+			TextToImageParams: TitanTextToImageParams{Text: request.Prompt},
+			ImageGenerationConfig: TitanImageGenerationConfig{
+				NumberOfImages: n,
+				Width:          width,
+				Height:         height,
+				Quality:        quality,
+			},
+		}, nil
+	case isStabilityImageModel(awsModelId):
+		outputFormat := "png"
+		if len(request.OutputFormat) > 0 {
+			var format string
+			if err := common.Unmarshal(request.OutputFormat, &format); err == nil && format != "" {
+				outputFormat = format
+			}
+		}
+		stabilityReqs := make([]StabilityImageRequest, 0, n)
+		for i := 0; i < n; i++ {
+			stabilityReqs = append(stabilityReqs, StabilityImageRequest{
+				Prompt:       request.Prompt,
+				AspectRatio:  stabilityAspectRatio(width, height),
+				OutputFormat: outputFormat,
+			})
+		}
+		return stabilityReqs, nil
+	default:
+		return nil, fmt.Errorf("unsupported aws image model: %s", info.UpstreamModelName)
+	}
+}
+
+func awsImageHandler(c *gin.Context, info *relaycommon.RelayInfo, a *Adaptor) (*types.NewAPIError, *dto.Usage) {
+	awsModelId := a.invokeModelId(info)
+	bodies, err := a.invokeBodies()
+	if err != nil {
+		return types.NewError(errors.Wrap(err, "decode image request fail"), types.ErrorCodeBadRequestBody), nil
+	}
+
+	imageResp := dto.ImageResponse{
+		Created: common.GetTimestamp(),
+		Data:    make([]dto.ImageData, 0, len(bodies)),
+	}
+	for _, body := range bodies {
+		respBody, _, apiErr := a.invokeModel(c, awsModelId, body)
+		if apiErr != nil {
+			return apiErr, nil
+		}
+		var images []string
+		if isTitanImageModel(awsModelId) {
+			var titanResp TitanImageResponse
+			if err := common.Unmarshal(respBody, &titanResp); err != nil {
+				return types.NewError(errors.Wrap(err, "unmarshal titan image response"), types.ErrorCodeBadResponseBody), nil
+			}
+			if titanResp.Error != "" {
+				return types.NewOpenAIError(errors.New(titanResp.Error), types.ErrorCodeAwsInvokeError, http.StatusBadRequest), nil
+			}
+			images = titanResp.Images
+		} else {
+			var stabilityResp StabilityImageResponse
+			if err := common.Unmarshal(respBody, &stabilityResp); err != nil {
+				return types.NewError(errors.Wrap(err, "unmarshal stability image response"), types.ErrorCodeBadResponseBody), nil
+			}
+			for i, image := range stabilityResp.Images {
+				// 被内容过滤的图片会返回 finish_reason
+				if i < len(stabilityResp.FinishReasons) && stabilityResp.FinishReasons[i] != nil {
+					continue
+				}
+				images = append(images, image)
+			}
+		}
+		for _, image := range images {
+			imageResp.Data = append(imageResp.Data, dto.ImageData{B64Json: image})
+		}
+	}
+	if len(imageResp.Data) == 0 {
+		return types.NewOpenAIError(errors.New("no images generated"), types.ErrorCodeBadResponseBody, http.StatusInternalServerError), nil
+	}
+
+	c.JSON(http.StatusOK, imageResp)
+	// 图片按张数计费，由 ImageHelper 根据请求的张数补全用量
+	return nil, &dto.Usage{}
+}
+
+func rerankDocumentText(document any) string {
+	switch v := document.(type) {
+	case string:
+		return v
+	case map[string]any:
+		if text, ok := v["text"].(string); ok {
+			return text
+		}
+	}
+	data, _ := common.Marshal(document)
+	return string(data)
+}
+
+func (a *Adaptor) convertRerankRequest(request dto.RerankRequest) (any, error) {
+	awsModelId := getAwsModelID(request.Model)
+	documents := make([]string, 0, len(request.Documents))
+	for _, document := range request.Documents {
+		documents = append(documents, rerankDocumentText(document))
+	}
+	a.RerankDocuments = documents
+	a.ReturnDocuments = request.ReturnDocuments != nil && *request.ReturnDocuments
+	rerankReq := BedrockRerankRequest{
+		Query:     request.Query,
+		Documents: documents,
+		TopN:      request.TopN,
+	}
+	switch {
+	case isCohereRerankModel(awsModelId):
+		rerankReq.ApiVersion = 2
+	case isAmazonRerankModel(awsModelId):
+	default:
+		return nil, fmt.Errorf("unsupported aws rerank model: %s", request.Model)
+	}
+	return rerankReq, nil
+}
+
+func awsRerankHandler(c *gin.Context, info *relaycommon.RelayInfo, a *Adaptor) (*types.NewAPIError, *dto.Usage) {
+	respBody, inputTokens, apiErr := a.invokeModel(c, a.invokeModelId(info), a.InvokeBody)
+	if apiErr != nil {
+		return apiErr, nil
+	}
+	var bedrockResp BedrockRerankResponse
+	if err := common.Unmarshal(respBody, &bedrockResp); err != nil {
+		return types.NewError(errors.Wrap(err, "unmarshal rerank response"), types.ErrorCodeBadResponseBody), nil
+	}
+	if a.ReturnDocuments {
+		for i, result := range bedrockResp.Results {
+			if result.Index >= 0 && result.Index < len(a.RerankDocuments) {
+				bedrockResp.Results[i].Document = dto.RerankDocument{Text: a.RerankDocuments[result.Index]}
+			}
+		}
+	}
+
+	usage := &dto.Usage{PromptTokens: inputTokens}
+	if usage.PromptTokens == 0 {
+		usage.PromptTokens = info.PromptTokens
+	}
+	usage.TotalTokens = usage.PromptTokens
+
+	c.JSON(http.StatusOK, dto.RerankResponse{
+		Results: bedrockResp.Results,
+		Usage:   *usage,
+	})
+	return nil, usage
+}
@@ -10,6 +10,7 @@ import (
 	"github.com/QuantumNous/new-api/dto"
 	"github.com/QuantumNous/new-api/relay/channel"
 	relaycommon "github.com/QuantumNous/new-api/relay/common"
+	relayconstant "github.com/QuantumNous/new-api/relay/constant"
 	"github.com/QuantumNous/new-api/setting/model_setting"
 	"github.com/QuantumNous/new-api/types"
 
@@ -54,7 +55,9 @@ func (a *Adaptor) Init(info *relaycommon.RelayInfo) {
 
 func (a *Adaptor) GetRequestURL(info *relaycommon.RelayInfo) (string, error) {
 	baseURL := ""
-	if a.RequestMode == RequestModeMessage {
+	if info.RelayMode == relayconstant.RelayModeCountTokens {
+		baseURL = fmt.Sprintf("%s/v1/messages/count_tokens", info.ChannelBaseUrl)
+	} else if a.RequestMode == RequestModeMessage {
 		baseURL = fmt.Sprintf("%s/v1/messages", info.ChannelBaseUrl)
 	} else {
 		baseURL = fmt.Sprintf("%s/v1/complete", info.ChannelBaseUrl)
@@ -0,0 +1,133 @@
+package claude
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"regexp"
+	"testing"
+
+	"github.com/QuantumNous/new-api/constant"
+	"github.com/QuantumNous/new-api/dto"
+	relaycommon "github.com/QuantumNous/new-api/relay/common"
+	"github.com/QuantumNous/new-api/types"
+
+	"github.com/gin-gonic/gin"
+)
+
+var update = flag.Bool("update", false, "update golden files")
+
+// createdPattern 响应中的 created 为当前时间，比较前统一替换
+var createdPattern = regexp.MustCompile(`("created":\s*)\d+`)
+
+func TestMain(m *testing.M) {
+	gin.SetMode(gin.TestMode)
+	constant.StreamingTimeout = 60
+	os.Exit(m.Run())
+}
+
+func readTestdata(t *testing.T, name string) []byte {
+	t.Helper()
+	data, err := os.ReadFile(filepath.Join("testdata", name))
+	if err != nil {
+		t.Fatalf("read %s: %v", name, err)
+	}
+	return data
+}
+
+// assertGolden 比较输出与 testdata 中的 golden 文件，-update 时重新生成
+func assertGolden(t *testing.T, name string, got []byte) {
+	t.Helper()
+	got = createdPattern.ReplaceAll(got, []byte("${1}0"))
+	path := filepath.Join("testdata", name)
+	if *update {
+		if err := os.WriteFile(path, got, 0644); err != nil {
+			t.Fatalf("write %s: %v", name, err)
+		}
+		return
+	}
+	want, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("read %s: %v", name, err)
+	}
+	if !bytes.Equal(got, want) {
+		t.Errorf("%s mismatch\n--- got ---\n%s\n--- want ---\n%s", name, got, want)
+	}
+}
+
+func newOpenAIRelayInfo(stream bool) *relaycommon.RelayInfo {
+	return &relaycommon.RelayInfo{
+		RelayFormat: types.RelayFormatOpenAI,
+		IsStream:    stream,
+		DisablePing: true,
+		ChannelMeta: &relaycommon.ChannelMeta{
+			ChannelType:       constant.ChannelTypeAnthropic,
+			UpstreamModelName: "claude-test",
+		},
+	}
+}
+
+func newTestContext() (*gin.Context, *httptest.ResponseRecorder) {
+	recorder := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(recorder)
+	c.Request = httptest.NewRequest(http.MethodPost, "/v1/chat/completions", nil)
+	return c, recorder
+}
+
+func newUpstreamResponse(body []byte) *http.Response {
+	return &http.Response{
+		StatusCode: http.StatusOK,
+		Header:     http.Header{"Content-Type": []string{"text/event-stream"}},
+		Body:       io.NopCloser(bytes.NewReader(body)),
+	}
+}
+
+func TestOpenAIRequestToClaude(t *testing.T) {
+	var request dto.GeneralOpenAIRequest
+	if err := json.Unmarshal(readTestdata(t, "openai_request.json"), &request); err != nil {
+		t.Fatalf("unmarshal openai request: %v", err)
+	}
+	c, _ := newTestContext()
+	claudeRequest, err := RequestOpenAI2ClaudeMessage(c, request)
+	if err != nil {
+		t.Fatalf("convert request: %v", err)
+	}
+	got, err := json.MarshalIndent(claudeRequest, "", "  ")
+	if err != nil {
+		t.Fatalf("marshal request: %v", err)
+	}
+	assertGolden(t, "openai_request.claude.golden.json", append(got, '\n'))
+}
+
+func TestOpenAIStreamFromClaude(t *testing.T) {
+	for _, name := range []string{
+		"openai_stream_stop_sequence",
+		"openai_stream_pause_turn",
+	} {
+		t.Run(name, func(t *testing.T) {
+			c, recorder := newTestContext()
+			if _, apiErr := ClaudeStreamHandler(c, newUpstreamResponse(readTestdata(t, name+".sse")), newOpenAIRelayInfo(true), RequestModeMessage); apiErr != nil {
+				t.Fatalf("stream handler: %v", apiErr)
+			}
+			assertGolden(t, name+".golden", recorder.Body.Bytes())
+		})
+	}
+}
+
+func TestOpenAIResponseFromClaude(t *testing.T) {
+	c, recorder := newTestContext()
+	if _, apiErr := ClaudeHandler(c, newUpstreamResponse(readTestdata(t, "openai_response_stop_sequence.json")), newOpenAIRelayInfo(false), RequestModeMessage); apiErr != nil {
+		t.Fatalf("handler: %v", apiErr)
+	}
+	var out bytes.Buffer
+	if err := json.Indent(&out, recorder.Body.Bytes(), "", "  "); err != nil {
+		t.Fatalf("indent response: %v", err)
+	}
+	out.WriteByte('\n')
+	assertGolden(t, "openai_response_stop_sequence.golden.json", out.Bytes())
+}
@@ -18,6 +18,7 @@ import (
 	"github.com/QuantumNous/new-api/types"
 
 	"github.com/gin-gonic/gin"
+	"github.com/samber/lo"
 )
 
 const (
@@ -36,6 +37,13 @@ func stopReasonClaude2OpenAI(reason string) string {
 		return "length"
 	case "tool_use":
 		return "tool_calls"
+	case "refusal":
+		return "content_filter"
+	case "pause_turn":
+		// 服务端工具执行中暂停，客户端需继续请求，OpenAI 格式中没有对应值
+		return "stop"
+	case "model_context_window_exceeded":
+		return "length"
 	default:
 		return reason
 	}
@@ -252,8 +260,10 @@ func RequestOpenAI2ClaudeMessage(c *gin.Context, textRequest dto.GeneralOpenAIRe
 			textRequest.Messages[i].Role = "user"
 		}
 		fmtMessage := dto.Message{
-			Role:    message.Role,
-			Content: message.Content,
+			Role:             message.Role,
+			Content:          message.Content,
+			ReasoningContent: message.ReasoningContent,
+			ReasoningDetails: message.ReasoningDetails,
 		}
 		if message.Role == "tool" {
 			fmtMessage.ToolCallId = message.ToolCallId
@@ -264,6 +274,11 @@ func RequestOpenAI2ClaudeMessage(c *gin.Context, textRequest dto.GeneralOpenAIRe
 		if lastMessage.Role == message.Role && lastMessage.Role != "tool" {
 			if lastMessage.IsStringContent() && message.IsStringContent() {
 				fmtMessage.SetStringContent(strings.Trim(fmt.Sprintf("%s %s", lastMessage.StringContent(), message.StringContent()), "\""))
+				// 合并后保留上一条消息的思考内容
+				fmtMessage.ReasoningDetails = append(append([]dto.ReasoningDetail{}, lastMessage.ReasoningDetails...), message.ReasoningDetails...)
+				if fmtMessage.ReasoningContent == "" {
+					fmtMessage.ReasoningContent = lastMessage.ReasoningContent
+				}
 				// delete last message
 				formatMessages = formatMessages[:len(formatMessages)-1]
 			}
@@ -348,10 +363,11 @@ func RequestOpenAI2ClaudeMessage(c *gin.Context, textRequest dto.GeneralOpenAIRe
 						},
 					}
 				}
-			} else if message.IsStringContent() && message.ToolCalls == nil {
+			} else if reasoningBlocks := claudeReasoningBlocks(message); message.IsStringContent() && message.ToolCalls == nil && len(reasoningBlocks) == 0 {
 				claudeMessage.Content = message.StringContent()
 			} else {
-				claudeMediaMessages := make([]dto.ClaudeMediaMessage, 0)
+				// 思考内容块需位于文本与工具调用之前
+				claudeMediaMessages := reasoningBlocks
 				for _, mediaMessage := range message.ParseContent() {
 					claudeMediaMessage := dto.ClaudeMediaMessage{
 						Type: mediaMessage.Type,
@@ -415,19 +431,67 @@ func RequestOpenAI2ClaudeMessage(c *gin.Context, textRequest dto.GeneralOpenAIRe
 	return &claudeRequest, nil
 }
 
-func StreamResponseClaude2OpenAI(reqMode int, claudeResponse *dto.ClaudeResponse) *dto.ChatCompletionsStreamResponse {
+// claudeReasoningBlocks 将助手消息的 reasoning_details 还原为 thinking 与 redacted_thinking 内容块，只还原带签名的思考内容。
+// 流式响应中签名单独返回，客户端回传的明细不含思考内容时以 reasoning_content 补全
+func claudeReasoningBlocks(message dto.Message) []dto.ClaudeMediaMessage {
+	if message.Role != "assistant" {
+		return nil
+	}
+	details := lo.Filter(message.ReasoningDetails, func(detail dto.ReasoningDetail, _ int) bool {
+		return detail.Format == "" || detail.Format == service.ClaudeReasoningFormat
+	})
+	signedCount := lo.CountBy(details, func(detail dto.ReasoningDetail) bool {
+		return detail.Type == dto.ReasoningDetailTypeText && detail.Signature != ""
+	})
+	blocks := make([]dto.ClaudeMediaMessage, 0)
+	for _, detail := range details {
+		switch detail.Type {
+		case dto.ReasoningDetailTypeText:
+			if detail.Signature == "" || detail.Signature == service.ClaudeThinkingSignaturePlaceholder {
+				continue
+			}
+			thinking := detail.Text
+			if thinking == "" && signedCount == 1 {
+				thinking = message.ReasoningContent
+			}
+			blocks = append(blocks, dto.ClaudeMediaMessage{
+				Type:      "thinking",
+				Thinking:  common.GetPointer[string](thinking),
+				Signature: detail.Signature,
+			})
+		case dto.ReasoningDetailTypeEncrypted:
+			if detail.Data == "" {
+				continue
+			}
+			blocks = append(blocks, dto.ClaudeMediaMessage{
+				Type: "redacted_thinking",
+				Data: detail.Data,
+			})
+		}
+	}
+	return blocks
+}
+
+// claudeStopSequence 结束原因为 stop_sequence 时返回命中的停止序列
+func claudeStopSequence(stopReason string, stopSequence *string) any {
+	if stopReason != "stop_sequence" || stopSequence == nil {
+		return nil
+	}
+	return *stopSequence
+}
+
+// StreamResponseClaude2OpenAI 工具调用序号按 tool_use 内容块出现的顺序计算，思考与文本块不占用序号
+func StreamResponseClaude2OpenAI(reqMode int, claudeResponse *dto.ClaudeResponse, claudeInfo *ClaudeResponseInfo) *dto.ChatCompletionsStreamResponse {
 	var response dto.ChatCompletionsStreamResponse
 	response.Object = "chat.completion.chunk"
 	response.Model = claudeResponse.Model
 	response.Choices = make([]dto.ChatCompletionsStreamResponseChoice, 0)
 	tools := make([]dto.ToolCallResponse, 0)
-	fcIdx := 0
-	if claudeResponse.Index != nil {
-		fcIdx = *claudeResponse.Index - 1
-		if fcIdx < 0 {
-			fcIdx = 0
-		}
+	blockIdx := claudeResponse.GetIndex()
+	if claudeResponse.Type == "content_block_start" && claudeResponse.ContentBlock != nil && claudeResponse.ContentBlock.Type == "tool_use" {
+		claudeInfo.startToolCall(blockIdx)
 	}
+	fcIdx := claudeInfo.toolCallIndex(blockIdx)
 	var choice dto.ChatCompletionsStreamResponseChoice
 	if reqMode == RequestModeCompletion {
 		choice.Delta.SetContentString(claudeResponse.Completion)
@@ -448,6 +512,13 @@ func StreamResponseClaude2OpenAI(reqMode int, claudeResponse *dto.ClaudeResponse
 				if claudeResponse.ContentBlock.Type == "text" && claudeResponse.ContentBlock.Text != nil {
 					choice.Delta.SetContentString(*claudeResponse.ContentBlock.Text)
 				}
+				if claudeResponse.ContentBlock.Type == "redacted_thinking" {
+					choice.Delta.ReasoningDetails = []dto.ReasoningDetail{{
+						Type:   dto.ReasoningDetailTypeEncrypted,
+						Data:   claudeResponse.ContentBlock.Data,
+						Format: service.ClaudeReasoningFormat,
+					}}
+				}
 				if claudeResponse.ContentBlock.Type == "tool_use" {
 					tools = append(tools, dto.ToolCallResponse{
 						Index: common.GetPointer(fcIdx),
@@ -475,9 +546,12 @@ func StreamResponseClaude2OpenAI(reqMode int, claudeResponse *dto.ClaudeResponse
 						},
 					})
 				case "signature_delta":
-					// 加密的不处理
-					signatureContent := "\n"
-					choice.Delta.ReasoningContent = &signatureContent
+					// 签名放在 reasoning_details 中，客户端回传时还原为 thinking 内容块
+					choice.Delta.ReasoningDetails = []dto.ReasoningDetail{{
+						Type:      dto.ReasoningDetailTypeText,
+						Signature: claudeResponse.Delta.Signature,
+						Format:    service.ClaudeReasoningFormat,
+					}}
 				case "thinking_delta":
 					choice.Delta.ReasoningContent = claudeResponse.Delta.Thinking
 				}
@@ -487,6 +561,9 @@ func StreamResponseClaude2OpenAI(reqMode int, claudeResponse *dto.ClaudeResponse
 			if finishReason != "null" {
 				choice.FinishReason = &finishReason
 			}
+			// 保留 Claude 原始结束原因（如 pause_turn）与命中的停止序列
+			choice.NativeFinishReason = *claudeResponse.Delta.StopReason
+			choice.StopReason = claudeStopSequence(*claudeResponse.Delta.StopReason, claudeResponse.Delta.StopSequence)
 			//claudeUsage = &claudeResponse.Usage
 		} else if claudeResponse.Type == "message_stop" {
 			return nil
@@ -520,6 +597,7 @@ func ResponseClaude2OpenAI(reqMode int, claudeResponse *dto.ClaudeResponse) *dto
 	}
 	tools := make([]dto.ToolCallResponse, 0)
 	thinkingContent := ""
+	var reasoningDetails []dto.ReasoningDetail
 
 	if reqMode == RequestModeCompletion {
 		choice := dto.OpenAITextResponseChoice{
@@ -534,6 +612,8 @@ func ResponseClaude2OpenAI(reqMode int, claudeResponse *dto.ClaudeResponse) *dto
 		choices = append(choices, choice)
 	} else {
 		fullTextResponse.Id = claudeResponse.Id
+		// 多个文本块（如带引用的回答）按顺序拼接
+		responseText = ""
 		for _, message := range claudeResponse.Content {
 			switch message.Type {
 			case "tool_use":
@@ -547,12 +627,25 @@ func ResponseClaude2OpenAI(reqMode int, claudeResponse *dto.ClaudeResponse) *dto
 					},
 				})
 			case "thinking":
-				// 加密的不管， 只输出明文的推理过程
+				thinking := ""
 				if message.Thinking != nil {
-					thinkingContent = *message.Thinking
+					thinking = *message.Thinking
 				}
+				thinkingContent += thinking
+				reasoningDetails = append(reasoningDetails, dto.ReasoningDetail{
+					Type:      dto.ReasoningDetailTypeText,
+					Text:      thinking,
+					Signature: message.Signature,
+					Format:    service.ClaudeReasoningFormat,
+				})
+			case "redacted_thinking":
+				reasoningDetails = append(reasoningDetails, dto.ReasoningDetail{
+					Type:   dto.ReasoningDetailTypeEncrypted,
+					Data:   message.Data,
+					Format: service.ClaudeReasoningFormat,
+				})
 			case "text":
-				responseText = message.GetText()
+				responseText += message.GetText()
 			}
 		}
 	}
@@ -561,7 +654,9 @@ func ResponseClaude2OpenAI(reqMode int, claudeResponse *dto.ClaudeResponse) *dto
 		Message: dto.Message{
 			Role: "assistant",
 		},
-		FinishReason: stopReasonClaude2OpenAI(claudeResponse.StopReason),
+		FinishReason:       stopReasonClaude2OpenAI(claudeResponse.StopReason),
+		NativeFinishReason: claudeResponse.StopReason,
+		StopReason:         claudeStopSequence(claudeResponse.StopReason, claudeResponse.StopSequence),
 	}
 	choice.SetStringContent(responseText)
 	if len(responseThinking) > 0 {
@@ -571,6 +666,7 @@ func ResponseClaude2OpenAI(reqMode int, claudeResponse *dto.ClaudeResponse) *dto
 		choice.Message.SetToolCalls(tools)
 	}
 	choice.Message.ReasoningContent = thinkingContent
+	choice.Message.ReasoningDetails = reasoningDetails
 	fullTextResponse.Model = claudeResponse.Model
 	choices = append(choices, choice)
 	fullTextResponse.Choices = choices
@@ -584,6 +680,21 @@ type ClaudeResponseInfo struct {
 	ResponseText strings.Builder
 	Usage        *dto.Usage
 	Done         bool
+	// 内容块序号到工具调用序号的映射
+	toolCallIndexes map[int]int
+}
+
+func (c *ClaudeResponseInfo) startToolCall(blockIdx int) {
+	if c.toolCallIndexes == nil {
+		c.toolCallIndexes = make(map[int]int)
+	}
+	if _, ok := c.toolCallIndexes[blockIdx]; !ok {
+		c.toolCallIndexes[blockIdx] = len(c.toolCallIndexes)
+	}
+}
+
+func (c *ClaudeResponseInfo) toolCallIndex(blockIdx int) int {
+	return c.toolCallIndexes[blockIdx]
 }
 
 func FormatClaudeResponseInfo(requestMode int, claudeResponse *dto.ClaudeResponse, oaiResponse *dto.ChatCompletionsStreamResponse, claudeInfo *ClaudeResponseInfo) bool {
@@ -656,7 +767,7 @@ func HandleStreamResponseData(c *gin.Context, info *relaycommon.RelayInfo, claud
 		}
 		helper.ClaudeChunkData(c, claudeResponse, data)
 	} else if info.RelayFormat == types.RelayFormatOpenAI {
-		response := StreamResponseClaude2OpenAI(requestMode, &claudeResponse)
+		response := StreamResponseClaude2OpenAI(requestMode, &claudeResponse, claudeInfo)
 
 		if !FormatClaudeResponseInfo(requestMode, &claudeResponse, response, claudeInfo) {
 			return nil
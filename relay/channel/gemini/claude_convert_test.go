@@ -0,0 +1,140 @@
+package gemini
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/constant"
+	"github.com/QuantumNous/new-api/dto"
+	relaycommon "github.com/QuantumNous/new-api/relay/common"
+	"github.com/QuantumNous/new-api/types"
+
+	"github.com/gin-gonic/gin"
+)
+
+var update = flag.Bool("update", false, "update golden files")
+
+func TestMain(m *testing.M) {
+	gin.SetMode(gin.TestMode)
+	constant.StreamingTimeout = 60
+	os.Exit(m.Run())
+}
+
+func readTestdata(t *testing.T, name string) []byte {
+	t.Helper()
+	data, err := os.ReadFile(filepath.Join("testdata", name))
+	if err != nil {
+		t.Fatalf("read %s: %v", name, err)
+	}
+	return data
+}
+
+// assertGolden 比较输出与 testdata 中的 golden 文件，-update 时重新生成
+func assertGolden(t *testing.T, name string, got []byte) {
+	t.Helper()
+	path := filepath.Join("testdata", name)
+	if *update {
+		if err := os.WriteFile(path, got, 0644); err != nil {
+			t.Fatalf("write %s: %v", name, err)
+		}
+		return
+	}
+	want, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("read %s: %v", name, err)
+	}
+	if !bytes.Equal(got, want) {
+		t.Errorf("%s mismatch\n--- got ---\n%s\n--- want ---\n%s", name, got, want)
+	}
+}
+
+func loadClaudeRequest(t *testing.T) *dto.ClaudeRequest {
+	t.Helper()
+	var request dto.ClaudeRequest
+	if err := json.Unmarshal(readTestdata(t, "claude_request.json"), &request); err != nil {
+		t.Fatalf("unmarshal claude request: %v", err)
+	}
+	return &request
+}
+
+func newClaudeRelayInfo(request *dto.ClaudeRequest) *relaycommon.RelayInfo {
+	return &relaycommon.RelayInfo{
+		RelayFormat:     types.RelayFormatClaude,
+		IsStream:        request.Stream,
+		DisablePing:     true,
+		OriginModelName: request.Model,
+		Request:         request,
+		ClaudeConvertInfo: &relaycommon.ClaudeConvertInfo{
+			LastMessagesType: relaycommon.LastMessageTypeNone,
+		},
+		ChannelMeta: &relaycommon.ChannelMeta{
+			ChannelType:       constant.ChannelTypeGemini,
+			UpstreamModelName: request.Model,
+		},
+	}
+}
+
+func newTestContext() (*gin.Context, *httptest.ResponseRecorder) {
+	recorder := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(recorder)
+	c.Request = httptest.NewRequest(http.MethodPost, "/v1/messages", nil)
+	c.Set(common.RequestIdKey, "test")
+	return c, recorder
+}
+
+func newUpstreamResponse(body []byte) *http.Response {
+	return &http.Response{
+		StatusCode: http.StatusOK,
+		Header:     http.Header{"Content-Type": []string{"text/event-stream"}},
+		Body:       io.NopCloser(bytes.NewReader(body)),
+	}
+}
+
+func TestClaudeRequestToGemini(t *testing.T) {
+	request := loadClaudeRequest(t)
+	c, _ := newTestContext()
+	adaptor := Adaptor{}
+	geminiRequest, err := adaptor.ConvertClaudeRequest(c, newClaudeRelayInfo(request), request)
+	if err != nil {
+		t.Fatalf("convert request: %v", err)
+	}
+	got, err := json.MarshalIndent(geminiRequest, "", "  ")
+	if err != nil {
+		t.Fatalf("marshal request: %v", err)
+	}
+	assertGolden(t, "claude_request.gemini.golden.json", append(got, '\n'))
+}
+
+func TestClaudeStreamFromGemini(t *testing.T) {
+	request := loadClaudeRequest(t)
+	info := newClaudeRelayInfo(request)
+	c, recorder := newTestContext()
+	if _, apiErr := GeminiChatStreamHandler(c, info, newUpstreamResponse(readTestdata(t, "claude_stream_stop_sequence.sse"))); apiErr != nil {
+		t.Fatalf("stream handler: %v", apiErr)
+	}
+	assertGolden(t, "claude_stream_stop_sequence.golden", recorder.Body.Bytes())
+}
+
+func TestClaudeResponseFromGemini(t *testing.T) {
+	request := loadClaudeRequest(t)
+	request.Stream = false
+	info := newClaudeRelayInfo(request)
+	c, recorder := newTestContext()
+	if _, apiErr := GeminiChatHandler(c, info, newUpstreamResponse(readTestdata(t, "claude_response.json"))); apiErr != nil {
+		t.Fatalf("handler: %v", apiErr)
+	}
+	var out bytes.Buffer
+	if err := json.Indent(&out, recorder.Body.Bytes(), "", "  "); err != nil {
+		t.Fatalf("indent response: %v", err)
+	}
+	out.WriteByte('\n')
+	assertGolden(t, "claude_response.golden.json", out.Bytes())
+}
@@ -192,6 +192,7 @@ func CovertOpenAI2Gemini(c *gin.Context, textRequest dto.GeneralOpenAIRequest, i
 			TopP:            textRequest.TopP,
 			MaxOutputTokens: textRequest.GetMaxTokens(),
 			Seed:            int64(textRequest.Seed),
+			StopSequences:   parseStopSequences(textRequest.Stop),
 		},
 	}
 
@@ -530,6 +531,27 @@ func CovertOpenAI2Gemini(c *gin.Context, textRequest dto.GeneralOpenAIRequest, i
 	return &geminiRequest, nil
 }
 
+// parseStopSequences OpenAI 的 stop 可以是字符串或字符串数组
+func parseStopSequences(stop any) []string {
+	switch v := stop.(type) {
+	case string:
+		if v != "" {
+			return []string{v}
+		}
+	case []string:
+		return v
+	case []interface{}:
+		var sequences []string
+		for _, item := range v {
+			if str, ok := item.(string); ok && str != "" {
+				sequences = append(sequences, str)
+			}
+		}
+		return sequences
+	}
+	return nil
+}
+
 func hasFunctionCallContent(call *dto.FunctionCall) bool {
 	if call == nil {
 		return false
@@ -806,6 +828,22 @@ func getResponseToolCall(item *dto.GeminiPart) *dto.ToolCallResponse {
 	}
 }
 
+// thoughtSignatureReasoningDetail 将 part 上的 thoughtSignature 转换为 reasoning_details，转换为 Claude 格式时作为思考签名
+func thoughtSignatureReasoningDetail(part dto.GeminiPart) (dto.ReasoningDetail, bool) {
+	if len(part.ThoughtSignature) == 0 {
+		return dto.ReasoningDetail{}, false
+	}
+	var signature string
+	if err := common.Unmarshal(part.ThoughtSignature, &signature); err != nil || signature == "" {
+		return dto.ReasoningDetail{}, false
+	}
+	return dto.ReasoningDetail{
+		Type:      dto.ReasoningDetailTypeText,
+		Signature: signature,
+		Format:    "google-gemini-v1",
+	}, true
+}
+
 func responseGeminiChat2OpenAI(c *gin.Context, response *dto.GeminiChatResponse) *dto.OpenAITextResponse {
 	fullTextResponse := dto.OpenAITextResponse{
 		Id:      helper.GetResponseID(c),
@@ -827,6 +865,9 @@ func responseGeminiChat2OpenAI(c *gin.Context, response *dto.GeminiChatResponse)
 			var texts []string
 			var toolCalls []dto.ToolCallResponse
 			for _, part := range candidate.Content.Parts {
+				if detail, ok := thoughtSignatureReasoningDetail(part); ok {
+					choice.Message.ReasoningDetails = append(choice.Message.ReasoningDetails, detail)
+				}
 				if part.InlineData != nil {
 					// 媒体内容
 					if strings.HasPrefix(part.InlineData.MimeType, "image") {
@@ -911,6 +952,9 @@ func streamResponseGeminiChat2OpenAI(geminiResponse *dto.GeminiChatResponse) (*d
 			}
 		}
 		for _, part := range candidate.Content.Parts {
+			if detail, ok := thoughtSignatureReasoningDetail(part); ok {
+				choice.Delta.ReasoningDetails = append(choice.Delta.ReasoningDetails, detail)
+			}
 			if part.InlineData != nil {
 				if strings.HasPrefix(part.InlineData.MimeType, "image") {
 					imgText := "![image](data:" + part.InlineData.MimeType + ";base64," + part.InlineData.Data + ")"
@@ -411,6 +411,28 @@ func (a *TaskAdaptor) FetchTask(baseUrl, key string, body map[string]any) (*http
 	return service.GetHttpClient().Do(req)
 }
 
+// CancelTask 取消排队中的任务，上游已开始处理的任务无法取消
+func (a *TaskAdaptor) CancelTask(baseUrl, key, taskId string) error {
+	uri := fmt.Sprintf("%s/api/v1/tasks/%s/cancel", baseUrl, taskId)
+
+	req, err := http.NewRequest(http.MethodPost, uri, nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Authorization", "Bearer "+key)
+
+	resp, err := service.GetHttpClient().Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(resp.Body)
+		return fmt.Errorf("cancel task failed: status=%d, body=%s", resp.StatusCode, body)
+	}
+	return nil
+}
+
 func (a *TaskAdaptor) GetModelList() []string {
 	return ModelList
 }
@@ -440,6 +462,12 @@ func (a *TaskAdaptor) ParseTaskResult(respBody []byte) (*relaycommon.TaskInfo, e
 		taskResult.Status = model.TaskStatusSuccess
 		// 阿里直接返回视频URL，不需要额外的代理端点
 		taskResult.Url = aliResp.Output.VideoURL
+		// 按实际生成的时长结算
+		if aliResp.Usage != nil && aliResp.Usage.Duration > 0 {
+			taskResult.BillingRatios = map[string]float64{
+				"seconds": float64(aliResp.Usage.Duration),
+			}
+		}
 	case "FAILED", "CANCELED", "UNKNOWN":
 		taskResult.Status = model.TaskStatusFailure
 		if aliResp.Message != "" {
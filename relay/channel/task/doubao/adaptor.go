@@ -166,6 +166,28 @@ func (a *TaskAdaptor) FetchTask(baseUrl, key string, body map[string]any) (*http
 	return service.GetHttpClient().Do(req)
 }
 
+// CancelTask 取消排队中的任务，上游已开始处理的任务无法取消
+func (a *TaskAdaptor) CancelTask(baseUrl, key, taskId string) error {
+	uri := fmt.Sprintf("%s/api/v3/contents/generations/tasks/%s", baseUrl, taskId)
+
+	req, err := http.NewRequest(http.MethodDelete, uri, nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Authorization", "Bearer "+key)
+
+	resp, err := service.GetHttpClient().Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(resp.Body)
+		return fmt.Errorf("cancel task failed: status=%d, body=%s", resp.StatusCode, body)
+	}
+	return nil
+}
+
 func (a *TaskAdaptor) GetModelList() []string {
 	return ModelList
 }
@@ -64,6 +64,9 @@ func (a *TaskAdaptor) BuildRequestBody(c *gin.Context, info *relaycommon.RelayIn
 	if err != nil {
 		return nil, errors.Wrap(err, "convert request payload failed")
 	}
+	if info.UpstreamCallbackUrl != "" {
+		body.CallbackURL = info.UpstreamCallbackUrl
+	}
 
 	data, err := json.Marshal(body)
 	if err != nil {
@@ -137,6 +140,10 @@ func (a *TaskAdaptor) GetChannelName() string {
 	return ChannelName
 }
 
+func (a *TaskAdaptor) SupportUpstreamCallback() bool {
+	return true
+}
+
 func (a *TaskAdaptor) convertToRequestPayload(req *relaycommon.TaskSubmitReq) (*VideoRequest, error) {
 	modelConfig := GetModelConfig(req.Model)
 	duration := DefaultDuration
@@ -153,6 +153,9 @@ func (a *TaskAdaptor) BuildRequestBody(c *gin.Context, info *relaycommon.RelayIn
 	if err != nil {
 		return nil, err
 	}
+	if info.UpstreamCallbackUrl != "" {
+		body.CallbackUrl = info.UpstreamCallbackUrl
+	}
 	if body.Image == "" && body.ImageTail == "" {
 		c.Set("action", constant.TaskActionTextGenerate)
 	}
@@ -239,6 +242,10 @@ func (a *TaskAdaptor) GetChannelName() string {
 	return "kling"
 }
 
+func (a *TaskAdaptor) SupportUpstreamCallback() bool {
+	return true
+}
+
 // ============================
 // helpers
 // ============================
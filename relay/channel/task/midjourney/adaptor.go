@@ -0,0 +1,263 @@
+package midjourney
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/constant"
+	"github.com/QuantumNous/new-api/dto"
+	"github.com/QuantumNous/new-api/model"
+	"github.com/QuantumNous/new-api/relay/channel"
+	relaycommon "github.com/QuantumNous/new-api/relay/common"
+	"github.com/QuantumNous/new-api/service"
+	"github.com/QuantumNous/new-api/setting"
+	"github.com/QuantumNous/new-api/types"
+
+	"github.com/gin-gonic/gin"
+	"github.com/pkg/errors"
+	"github.com/samber/lo"
+)
+
+// TaskAdaptor 提交统一任务接口与 /mj 接口的 Midjourney Proxy 任务，任务保存在 tasks 表并由任务轮询更新。
+// 地址与密钥在构建请求时从 info 读取，基于原任务的动作会切换到原任务所在渠道
+type TaskAdaptor struct {
+	ChannelType int
+	// 通过 /mj 接口提交时按原路径转发
+	submitPath string
+}
+
+func (a *TaskAdaptor) Init(info *relaycommon.RelayInfo) {
+	a.ChannelType = info.ChannelType
+}
+
+func (a *TaskAdaptor) ValidateRequestAndSetAction(c *gin.Context, info *relaycommon.RelayInfo) (taskErr *dto.TaskError) {
+	modelName := info.OriginModelName
+	action, ok := constant.MidjourneyModel2Action[modelName]
+	if !ok || !lo.Contains(ModelList, modelName) {
+		return service.TaskErrorWrapperLocal(fmt.Errorf("unsupported midjourney model: %s", modelName), "invalid_model", http.StatusBadRequest)
+	}
+	var req map[string]any
+	if err := common.UnmarshalBodyReusable(c, &req); err != nil {
+		return service.TaskErrorWrapperLocal(err, "invalid_request", http.StatusBadRequest)
+	}
+	prompt, _ := req["prompt"].(string)
+	taskId, _ := req["taskId"].(string)
+	customId, _ := req["customId"].(string)
+	if info.RelayFormat == types.RelayFormatMjProxy {
+		// /mj 接口的请求体保持 Midjourney Proxy 格式，simple-change 的原任务写在 content 中
+		a.submitPath = mjRequestPath(c.Request.URL.String())
+		if content, _ := req["content"].(string); content != "" && taskId == "" {
+			if params := service.ConvertSimpleChangeParams(content); params != nil {
+				taskId = params.TaskId
+			}
+		}
+	}
+
+	switch action {
+	case constant.MjActionImagine, constant.MjActionShorten:
+		if prompt == "" {
+			return service.TaskErrorWrapperLocal(fmt.Errorf("prompt is required"), "invalid_request", http.StatusBadRequest)
+		}
+	case constant.MjActionDescribe, constant.MjActionBlend, constant.MjActionEdits, constant.MjActionVideo:
+	case constant.MjActionSwapFace:
+		source, _ := req["sourceBase64"].(string)
+		target, _ := req["targetBase64"].(string)
+		if source == "" || target == "" {
+			return service.TaskErrorWrapperLocal(fmt.Errorf("sourceBase64 and targetBase64 are required"), "invalid_request", http.StatusBadRequest)
+		}
+	case constant.MjActionModal:
+		if taskId == "" {
+			return service.TaskErrorWrapperLocal(fmt.Errorf("taskId is required"), "invalid_request", http.StatusBadRequest)
+		}
+	default:
+		// 放大、变换等按钮动作需要原任务，统一任务接口通过按钮的 customId 指定动作
+		if taskId == "" || (customId == "" && a.submitPath == "") {
+			return service.TaskErrorWrapperLocal(fmt.Errorf("taskId and customId are required"), "invalid_request", http.StatusBadRequest)
+		}
+	}
+	// 基于原任务的动作必须提交到原任务所在渠道
+	if taskId != "" {
+		if setting.MjActionCheckSuccessEnabled && action != constant.MjActionModal {
+			originTask, exist, err := model.GetByTaskId(info.UserId, taskId)
+			if err == nil && exist && originTask.Status != model.TaskStatusSuccess {
+				return service.TaskErrorWrapperLocal(fmt.Errorf("origin task is not finished"), "task_status_not_success", http.StatusBadRequest)
+			}
+		}
+		info.OriginTaskID = taskId
+	}
+
+	delete(req, "model")
+	delete(req, "callback_url")
+	if !setting.MjAccountFilterEnabled {
+		delete(req, "accountFilter")
+	}
+	if !setting.MjNotifyEnabled {
+		delete(req, "notifyHook")
+	}
+	if setting.MjModeClearEnabled && prompt != "" {
+		for _, mode := range []string{"--fast", "--relax", "--turbo"} {
+			prompt = strings.ReplaceAll(prompt, mode, "")
+		}
+		req["prompt"] = prompt
+	}
+
+	info.Action = action
+	c.Set("task_request", req)
+	return nil
+}
+
+func (a *TaskAdaptor) BuildRequestURL(info *relaycommon.RelayInfo) (string, error) {
+	if a.submitPath != "" {
+		return fmt.Sprintf("%s%s", info.ChannelBaseUrl, a.submitPath), nil
+	}
+	path, ok := submitPaths[info.Action]
+	if !ok {
+		path = "/mj/submit/action"
+	}
+	return fmt.Sprintf("%s%s", info.ChannelBaseUrl, path), nil
+}
+
+func (a *TaskAdaptor) BuildRequestHeader(c *gin.Context, req *http.Request, info *relaycommon.RelayInfo) error {
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Accept", "application/json")
+	req.Header.Set("mj-api-secret", info.ApiKey)
+	return nil
+}
+
+func (a *TaskAdaptor) BuildRequestBody(c *gin.Context, info *relaycommon.RelayInfo) (io.Reader, error) {
+	req, exists := c.Get("task_request")
+	if !exists {
+		return nil, fmt.Errorf("request not found in context")
+	}
+	data, err := json.Marshal(req)
+	if err != nil {
+		return nil, err
+	}
+	return bytes.NewReader(data), nil
+}
+
+func (a *TaskAdaptor) DoRequest(c *gin.Context, info *relaycommon.RelayInfo, requestBody io.Reader) (*http.Response, error) {
+	return channel.DoTaskApiRequest(a, c, info, requestBody)
+}
+
+func (a *TaskAdaptor) DoResponse(c *gin.Context, resp *http.Response, info *relaycommon.RelayInfo) (taskID string, taskData []byte, taskErr *dto.TaskError) {
+	responseBody, err := io.ReadAll(resp.Body)
+	if err != nil {
+		taskErr = service.TaskErrorWrapper(err, "read_response_body_failed", http.StatusInternalServerError)
+		return
+	}
+	_ = resp.Body.Close()
+
+	var mjResp dto.MidjourneyResponse
+	if err := json.Unmarshal(responseBody, &mjResp); err != nil {
+		taskErr = service.TaskErrorWrapper(errors.Wrapf(err, "body: %s", responseBody), "unmarshal_response_body_failed", http.StatusInternalServerError)
+		return
+	}
+	if mjResp.Code == 3 {
+		// 无实例账号时自动禁用渠道（No available account instance）
+		if ch, err := model.GetChannelById(info.ChannelId, true); err == nil && ch.GetAutoBan() && common.AutomaticDisableChannelEnabled {
+			model.UpdateChannelStatus(info.ChannelId, "", common.ChannelStatusAutoDisabled, "No available account instance")
+		}
+	}
+	// 1 提交成功，21 任务已存在或等待 modal 补充，22 排队中
+	if mjResp.Code != 1 && mjResp.Code != 21 && mjResp.Code != 22 || mjResp.Result == "" {
+		taskErr = service.TaskErrorWrapper(fmt.Errorf("midjourney error: %s", mjResp.Description), fmt.Sprintf("mj_%d", mjResp.Code), http.StatusBadRequest)
+		return
+	}
+	// 局部重绘与自定义缩放需要客户端根据 21 继续提交 modal，其余按提交成功返回
+	if mjResp.Code == 22 || (mjResp.Code == 21 && info.Action != constant.MjActionInPaint && info.Action != constant.MjActionCustomZoom) {
+		mjResp.Code = 1
+	}
+	c.JSON(http.StatusOK, mjResp)
+
+	// 提交时保存任务的基本信息，轮询后替换为上游返回的完整任务
+	data := dto.MidjourneyDto{
+		MjId:        mjResp.Result,
+		Action:      info.Action,
+		Description: mjResp.Description,
+		SubmitTime:  time.Now().UnixMilli(),
+	}
+	if req, ok := c.Get("task_request"); ok {
+		if m, ok := req.(map[string]any); ok {
+			data.Prompt, _ = m["prompt"].(string)
+		}
+	}
+	taskData, _ = common.Marshal(data)
+	return mjResp.Result, taskData, nil
+}
+
+func (a *TaskAdaptor) FetchTask(baseUrl, key string, body map[string]any) (*http.Response, error) {
+	taskID, ok := body["task_id"].(string)
+	if !ok {
+		return nil, fmt.Errorf("invalid task_id")
+	}
+
+	uri := fmt.Sprintf("%s/mj/task/%s/fetch", baseUrl, taskID)
+
+	req, err := http.NewRequest(http.MethodGet, uri, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	req.Header.Set("Accept", "application/json")
+	req.Header.Set("mj-api-secret", key)
+
+	return service.GetHttpClient().Do(req)
+}
+
+func (a *TaskAdaptor) GetModelList() []string {
+	return ModelList
+}
+
+func (a *TaskAdaptor) GetChannelName() string {
+	return ChannelName
+}
+
+func (a *TaskAdaptor) ParseTaskResult(respBody []byte) (*relaycommon.TaskInfo, error) {
+	var mjTask dto.MidjourneyDto
+	if err := common.Unmarshal(respBody, &mjTask); err != nil {
+		return nil, errors.Wrap(err, "unmarshal task result failed")
+	}
+
+	taskResult := relaycommon.TaskInfo{
+		TaskID:   mjTask.MjId,
+		Progress: mjTask.Progress,
+	}
+	switch mjTask.Status {
+	case model.TaskStatusSuccess:
+		taskResult.Status = model.TaskStatusSuccess
+		taskResult.Url = mjTask.ImageUrl
+		if mjTask.VideoUrl != "" {
+			taskResult.Url = mjTask.VideoUrl
+		}
+	case model.TaskStatusFailure:
+		taskResult.Status = model.TaskStatusFailure
+		taskResult.Reason = mjTask.FailReason
+		if taskResult.Reason == "" {
+			taskResult.Reason = "task failed"
+		}
+	case model.TaskStatusInProgress, "MODAL":
+		taskResult.Status = model.TaskStatusInProgress
+	default:
+		taskResult.Status = model.TaskStatusSubmitted
+	}
+	return &taskResult, nil
+}
+
+// mjRequestPath 去掉 /mj-xxx 前缀，与旧版 /mj 接口转发到上游的路径一致
+func mjRequestPath(path string) string {
+	if !strings.Contains(path, "/mj-") {
+		return path
+	}
+	urls := strings.Split(path, "/mj/")
+	if len(urls) < 2 {
+		return path
+	}
+	return "/mj/" + urls[1]
+}
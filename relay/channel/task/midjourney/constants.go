@@ -0,0 +1,40 @@
+package midjourney
+
+import "github.com/QuantumNous/new-api/constant"
+
+const (
+	ChannelName = "midjourney"
+)
+
+// ModelList 统一任务接口支持的 Midjourney 模型，上传图片不是异步任务，仍需使用 /mj 接口
+var ModelList = []string{
+	"mj_imagine",
+	"mj_describe",
+	"mj_blend",
+	"mj_shorten",
+	"mj_edits",
+	"mj_video",
+	"mj_modal",
+	"mj_upscale",
+	"mj_variation",
+	"mj_reroll",
+	"mj_inpaint",
+	"mj_zoom",
+	"mj_custom_zoom",
+	"mj_high_variation",
+	"mj_low_variation",
+	"mj_pan",
+	"swap_face",
+}
+
+// submitPaths 各动作对应的上游提交接口，未列出的动作（放大、变换等按钮动作）使用 /mj/submit/action
+var submitPaths = map[string]string{
+	constant.MjActionImagine:  "/mj/submit/imagine",
+	constant.MjActionDescribe: "/mj/submit/describe",
+	constant.MjActionBlend:    "/mj/submit/blend",
+	constant.MjActionShorten:  "/mj/submit/shorten",
+	constant.MjActionEdits:    "/mj/submit/edits",
+	constant.MjActionVideo:    "/mj/submit/video",
+	constant.MjActionModal:    "/mj/submit/modal",
+	constant.MjActionSwapFace: "/mj/insight-face/swap",
+}
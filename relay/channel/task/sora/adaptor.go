@@ -5,6 +5,7 @@ import (
 	"fmt"
 	"io"
 	"net/http"
+	"strconv"
 
 	"github.com/QuantumNous/new-api/common"
 	"github.com/QuantumNous/new-api/dto"
@@ -169,6 +170,14 @@ func (a *TaskAdaptor) ParseTaskResult(respBody []byte) (*relaycommon.TaskInfo, e
 	case "completed":
 		taskResult.Status = model.TaskStatusSuccess
 		taskResult.Url = fmt.Sprintf("%s/v1/videos/%s/content", system_setting.ServerAddress, resTask.ID)
+		// 按实际生成的时长与尺寸结算
+		taskResult.BillingRatios = map[string]float64{}
+		if seconds, err := strconv.Atoi(resTask.Seconds); err == nil && seconds > 0 {
+			taskResult.BillingRatios["seconds"] = float64(seconds)
+		}
+		if resTask.Size != "" {
+			taskResult.BillingRatios["size"] = relaycommon.SoraSizeRatio(resTask.Size)
+		}
 	case "failed", "cancelled":
 		taskResult.Status = model.TaskStatusFailure
 		if resTask.Error != nil {
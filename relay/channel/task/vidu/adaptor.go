@@ -119,6 +119,9 @@ func (a *TaskAdaptor) BuildRequestBody(c *gin.Context, info *relaycommon.RelayIn
 	if err != nil {
 		return nil, err
 	}
+	if info.UpstreamCallbackUrl != "" {
+		body.CallbackUrl = info.UpstreamCallbackUrl
+	}
 
 	if info.Action == constant.TaskActionReferenceGenerate {
 		if strings.Contains(body.Model, "viduq2") {
@@ -215,6 +218,10 @@ func (a *TaskAdaptor) GetChannelName() string {
 	return "vidu"
 }
 
+func (a *TaskAdaptor) SupportUpstreamCallback() bool {
+	return true
+}
+
 // ============================
 // helpers
 // ============================
@@ -28,6 +28,8 @@ const (
 	LastMessageTypeText     = "text"
 	LastMessageTypeTools    = "tools"
 	LastMessageTypeThinking = "thinking"
+	// redacted_thinking 内容块没有增量，下一个内容块开始时关闭
+	LastMessageTypeRedactedThinking = "redacted_thinking"
 )
 
 type ClaudeConvertInfo struct {
@@ -36,6 +38,14 @@ type ClaudeConvertInfo struct {
 	Usage            *dto.Usage
 	FinishReason     string
 	Done             bool
+	// 当前 tool_use 内容块对应的上游工具调用序号与 ID
+	ToolCallIndex int
+	ToolCallId    string
+	// 当前 thinking 内容块的上游签名
+	ThinkingSignature string
+	// 上游原始结束原因与命中的停止序列
+	NativeFinishReason  string
+	MatchedStopSequence string
 }
 
 type RerankerInfo struct {
@@ -110,6 +120,8 @@ type RelayInfo struct {
 	EmptyResponse          bool // 标记是否为空响应，用于跳过计费
 	FinalPreConsumedQuota  int  // 最终预消耗的配额
 	IsClaudeBetaQuery      bool // /v1/messages?beta=true
+	ResponseCacheHit       bool // 响应来自缓存，未请求上游
+	ResponsesToChat        bool // Responses 请求转换为 Chat Completions 处理
 
 	PriceData types.PriceData
 
@@ -479,9 +491,33 @@ func (info *RelayInfo) HasSendResponse() bool {
 	return info.FirstResponseTime.After(info.StartTime)
 }
 
+// Clone 复制一份可独立用于另一次上游请求的 RelayInfo，请求过程中会被修改的字段均深拷贝
+func (info *RelayInfo) Clone() *RelayInfo {
+	clone := *info
+	if info.ClaudeConvertInfo != nil {
+		claudeConvertInfo := *info.ClaudeConvertInfo
+		clone.ClaudeConvertInfo = &claudeConvertInfo
+	}
+	if info.ResponsesUsageInfo != nil {
+		builtInTools := make(map[string]*BuildInToolInfo, len(info.ResponsesUsageInfo.BuiltInTools))
+		for name, tool := range info.ResponsesUsageInfo.BuiltInTools {
+			toolCopy := *tool
+			builtInTools[name] = &toolCopy
+		}
+		clone.ResponsesUsageInfo = &ResponsesUsageInfo{BuiltInTools: builtInTools}
+	}
+	if info.ChannelMeta != nil {
+		channelMeta := *info.ChannelMeta
+		clone.ChannelMeta = &channelMeta
+	}
+	return &clone
+}
+
 type TaskRelayInfo struct {
 	Action       string
 	OriginTaskID string
+	// 提交给上游的任务状态回调地址，为空时不设置
+	UpstreamCallbackUrl string
 
 	ConsumeQuota bool
 }
@@ -563,6 +599,8 @@ type TaskInfo struct {
 	Progress         string `json:"progress,omitempty"`
 	CompletionTokens int    `json:"completion_tokens,omitempty"` // 用于按倍率计费
 	TotalTokens      int    `json:"total_tokens,omitempty"`      // 用于按倍率计费
+	// 上游返回的实际计费参数（如 seconds、size），与提交时的预估不同时重新计费
+	BillingRatios map[string]float64 `json:"billing_ratios,omitempty"`
 }
 
 func FailTaskInfo(reason string) *TaskInfo {
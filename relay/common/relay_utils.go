@@ -178,10 +178,7 @@ func ValidateMultipartDirect(c *gin.Context, info *RelayInfo) *dto.TaskError {
 		}
 		info.PriceData.OtherRatios = map[string]float64{
 			"seconds": float64(seconds),
-			"size":    1,
-		}
-		if lo.Contains([]string{"1792x1024", "1024x1792"}, size) {
-			info.PriceData.OtherRatios["size"] = 1.666667
+			"size":    SoraSizeRatio(size),
 		}
 	}
 
@@ -190,6 +187,14 @@ func ValidateMultipartDirect(c *gin.Context, info *RelayInfo) *dto.TaskError {
 	return nil
 }
 
+// SoraSizeRatio 返回 sora 视频尺寸的计费倍率
+func SoraSizeRatio(size string) float64 {
+	if lo.Contains([]string{"1792x1024", "1024x1792"}, size) {
+		return 1.666667
+	}
+	return 1
+}
+
 func isKnownTaskField(field string) bool {
 	knownFields := map[string]bool{
 		"prompt":          true,
@@ -200,6 +205,7 @@ func isKnownTaskField(field string) bool {
 		"size":            true,
 		"duration":        true,
 		"input_reference": true, // Sora 特有字段
+		"callback_url":    true,
 	}
 	return knownFields[field]
 }
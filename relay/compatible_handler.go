@@ -48,6 +48,10 @@ func TextHelper(c *gin.Context, info *relaycommon.RelayInfo) (newAPIError *types
 		return types.NewError(err, types.ErrorCodeChannelModelMappedError, types.ErrOptionWithSkipRetry())
 	}
 
+	// 缓存已在预扣费前查询，此处仅在未命中时记录响应
+	responseCache := newResponseCache(c, info, textResponseCacheable(info, request))
+	defer responseCache.finish()
+
 	includeUsage := true
 	// 判断用户是否需要返回使用情况
 	if request.StreamOptions != nil {
@@ -75,7 +79,8 @@ func TextHelper(c *gin.Context, info *relaycommon.RelayInfo) (newAPIError *types
 	adaptor.Init(info)
 	var requestBody io.Reader
 
-	if model_setting.GetGlobalSettings().PassThroughRequestEnabled || info.ChannelSetting.PassThroughBodyEnabled {
+	// 由 Responses 请求转换而来时原始请求体不是 Chat Completions 格式，不能透传
+	if (model_setting.GetGlobalSettings().PassThroughRequestEnabled || info.ChannelSetting.PassThroughBodyEnabled) && !info.ResponsesToChat {
 		body, err := common.GetRequestBody(c)
 		if err != nil {
 			return types.NewErrorWithStatusCode(err, types.ErrorCodeReadRequestBodyFailed, http.StatusBadRequest, types.ErrOptionWithSkipRetry())
@@ -156,6 +161,7 @@ func TextHelper(c *gin.Context, info *relaycommon.RelayInfo) (newAPIError *types
 		requestBody = bytes.NewBuffer(jsonData)
 	}
 
+	responseCache.capture()
 	var httpResp *http.Response
 	resp, err := adaptor.DoRequest(c, info, requestBody)
 	if err != nil {
@@ -185,12 +191,16 @@ func TextHelper(c *gin.Context, info *relaycommon.RelayInfo) (newAPIError *types
 	if strings.HasPrefix(info.OriginModelName, "gpt-4o-audio") {
 		service.PostAudioConsumeQuota(c, info, usage.(*dto.Usage), "")
 	} else {
+		responseCache.save(info, usage.(*dto.Usage))
 		postConsumeQuota(c, info, usage.(*dto.Usage), "")
 	}
 	return nil
 }
 
 func postConsumeQuota(ctx *gin.Context, relayInfo *relaycommon.RelayInfo, usage *dto.Usage, extraContent string) {
+	if service.IsRelayHedgeLost(ctx) {
+		return
+	}
 	if usage == nil {
 		usage = &dto.Usage{
 			PromptTokens:     relayInfo.PromptTokens,
@@ -199,6 +209,12 @@ func postConsumeQuota(ctx *gin.Context, relayInfo *relaycommon.RelayInfo, usage
 		}
 		extraContent += "（可能是请求出错）"
 	}
+	if relayInfo.ResponseCacheHit {
+		// 命中缓存未消耗上游 token，退还请求前按预估 token 数占用的 TPM
+		service.ReconcileTokenRateLimit(ctx, &dto.Usage{})
+	} else {
+		service.ReconcileTokenRateLimit(ctx, usage)
+	}
 	useTimeSeconds := time.Now().Unix() - relayInfo.StartTime.Unix()
 	promptTokens := usage.PromptTokens
 	cacheTokens := usage.PromptTokensDetails.CachedTokens
@@ -367,7 +383,11 @@ func postConsumeQuota(ctx *gin.Context, relayInfo *relaycommon.RelayInfo, usage
 	var logContent string
 
 	// record all the consume log even if quota is 0
-	if applyEmptyFree {
+	if relayInfo.ResponseCacheHit {
+		quota = service.GetResponseCacheHitQuota(quota)
+		logContent += "命中响应缓存"
+		model.UpdateUserUsedQuotaAndRequestCount(relayInfo.UserId, quota)
+	} else if applyEmptyFree {
 		logContent += "空回不计费已生效"
 		quota = 0
 	} else if totalTokens == 0 {
@@ -465,6 +485,12 @@ func postConsumeQuota(ctx *gin.Context, relayInfo *relaycommon.RelayInfo, usage
 		other["image_generation_call"] = true
 		other["image_generation_call_price"] = imageGenerationCallPrice
 	}
+	logType := model.LogTypeConsume
+	if relayInfo.ResponseCacheHit {
+		logType = model.LogTypeCacheHit
+		other["response_cache_hit"] = true
+		other["response_cache_billing_mode"] = operation_setting.GetResponseCacheSetting().BillingMode
+	}
 	model.RecordConsumeLog(ctx, relayInfo.UserId, model.RecordConsumeLogParams{
 		ChannelId:        relayInfo.ChannelId,
 		PromptTokens:     promptTokens,
@@ -478,5 +504,6 @@ func postConsumeQuota(ctx *gin.Context, relayInfo *relaycommon.RelayInfo, usage
 		IsStream:         relayInfo.IsStream,
 		Group:            relayInfo.UsingGroup,
 		Other:            other,
+		LogType:          logType,
 	})
 }
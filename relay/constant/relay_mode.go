@@ -50,6 +50,8 @@ const (
 	RelayModeRealtime
 
 	RelayModeGemini
+
+	RelayModeCountTokens
 )
 
 func Path2RelayMode(path string) int {
@@ -82,8 +84,14 @@ func Path2RelayMode(path string) int {
 		relayMode = RelayModeRerank
 	} else if strings.HasPrefix(path, "/v1/realtime") {
 		relayMode = RelayModeRealtime
+	} else if strings.HasPrefix(path, "/v1/messages/count_tokens") {
+		relayMode = RelayModeCountTokens
 	} else if strings.HasPrefix(path, "/v1beta/models") || strings.HasPrefix(path, "/v1/models") {
-		relayMode = RelayModeGemini
+		if strings.HasSuffix(path, ":countTokens") {
+			relayMode = RelayModeCountTokens
+		} else {
+			relayMode = RelayModeGemini
+		}
 	} else if strings.HasPrefix(path, "/mj") {
 		relayMode = Path2RelayModeMidjourney(path)
 	}
@@ -0,0 +1,159 @@
+package relay
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/constant"
+	"github.com/QuantumNous/new-api/dto"
+	"github.com/QuantumNous/new-api/logger"
+	relaycommon "github.com/QuantumNous/new-api/relay/common"
+	"github.com/QuantumNous/new-api/relay/helper"
+	"github.com/QuantumNous/new-api/service"
+	"github.com/QuantumNous/new-api/setting/model_setting"
+	"github.com/QuantumNous/new-api/types"
+
+	"github.com/gin-gonic/gin"
+)
+
+// geminiCountTokensUpstreamRequest 以 generateContentRequest 形式转发，保留 systemInstruction 与 tools
+type geminiCountTokensUpstreamRequest struct {
+	GenerateContentRequest geminiGenerateContentRequest `json:"generateContentRequest"`
+}
+
+type geminiGenerateContentRequest struct {
+	Model string `json:"model"`
+	*dto.GeminiChatRequest
+}
+
+// supportsNativeCountTokens 渠道是否提供与请求格式一致的原生计数接口
+func supportsNativeCountTokens(info *relaycommon.RelayInfo) bool {
+	switch info.RelayFormat {
+	case types.RelayFormatClaude:
+		return info.ApiType == constant.APITypeAnthropic
+	case types.RelayFormatGemini:
+		return info.ApiType == constant.APITypeGemini
+	}
+	return false
+}
+
+// CountTokensHelper 处理 count_tokens / countTokens 请求，不预扣与结算额度。
+// 渠道支持时转发到上游原生接口，否则（或上游不可用时）使用本地估算
+func CountTokensHelper(c *gin.Context, info *relaycommon.RelayInfo) (newAPIError *types.NewAPIError) {
+	info.InitChannelMeta(c)
+
+	err := helper.ModelMappedHelper(c, info, info.Request)
+	if err != nil {
+		return types.NewError(err, types.ErrorCodeChannelModelMappedError, types.ErrOptionWithSkipRetry())
+	}
+
+	switch request := info.Request.(type) {
+	case *dto.ClaudeRequest:
+		if model_setting.GetClaudeSettings().ThinkingAdapterEnabled &&
+			strings.HasSuffix(request.Model, "-thinking") &&
+			!model_setting.ShouldPreserveThinkingSuffix(info.OriginModelName) {
+			request.Model = strings.TrimSuffix(request.Model, "-thinking")
+			info.UpstreamModelName = request.Model
+		}
+	case *dto.GeminiChatRequest:
+	default:
+		return types.NewErrorWithStatusCode(fmt.Errorf("invalid request type for count tokens: %T", info.Request), types.ErrorCodeInvalidRequest, http.StatusBadRequest, types.ErrOptionWithSkipRetry())
+	}
+
+	if supportsNativeCountTokens(info) {
+		handled, newAPIError := doNativeCountTokens(c, info)
+		if handled || newAPIError != nil {
+			return newAPIError
+		}
+	}
+
+	return localCountTokens(c, info)
+}
+
+func buildCountTokensUpstreamRequest(info *relaycommon.RelayInfo) any {
+	switch request := info.Request.(type) {
+	case *dto.ClaudeRequest:
+		return dto.ClaudeCountTokensRequest{
+			Model:      request.Model,
+			System:     request.System,
+			Messages:   request.Messages,
+			Tools:      request.Tools,
+			ToolChoice: request.ToolChoice,
+			Thinking:   request.Thinking,
+			McpServers: request.McpServers,
+		}
+	case *dto.GeminiChatRequest:
+		return geminiCountTokensUpstreamRequest{
+			GenerateContentRequest: geminiGenerateContentRequest{
+				Model:             "models/" + info.UpstreamModelName,
+				GeminiChatRequest: request,
+			},
+		}
+	}
+	return info.Request
+}
+
+// doNativeCountTokens 转发到上游计数接口，上游不可用时返回 handled=false 以回退本地估算
+func doNativeCountTokens(c *gin.Context, info *relaycommon.RelayInfo) (bool, *types.NewAPIError) {
+	adaptor := GetAdaptor(info.ApiType)
+	if adaptor == nil {
+		return false, nil
+	}
+	adaptor.Init(info)
+	// GetRequestURL 会规范化上游模型名（如 Gemini 去除 -thinking 后缀），需在构造请求体前调用
+	if _, err := adaptor.GetRequestURL(info); err != nil {
+		return false, types.NewError(err, types.ErrorCodeConvertRequestFailed, types.ErrOptionWithSkipRetry())
+	}
+
+	jsonData, err := common.Marshal(buildCountTokensUpstreamRequest(info))
+	if err != nil {
+		return false, types.NewError(err, types.ErrorCodeConvertRequestFailed, types.ErrOptionWithSkipRetry())
+	}
+	resp, err := adaptor.DoRequest(c, info, bytes.NewBuffer(jsonData))
+	if err != nil {
+		logger.LogWarn(c, fmt.Sprintf("count tokens upstream request failed, fallback to local estimation: %s", err.Error()))
+		return false, nil
+	}
+	httpResp, ok := resp.(*http.Response)
+	if !ok || httpResp == nil {
+		return false, nil
+	}
+	if httpResp.StatusCode != http.StatusOK {
+		// 上游故障或未提供计数接口时回退本地估算，其余错误（如请求无效）直接返回
+		if httpResp.StatusCode >= http.StatusInternalServerError || httpResp.StatusCode == http.StatusNotFound {
+			service.CloseResponseBodyGracefully(httpResp)
+			logger.LogWarn(c, fmt.Sprintf("count tokens upstream returned status %d, fallback to local estimation", httpResp.StatusCode))
+			return false, nil
+		}
+		newAPIError := service.RelayErrorHandler(c.Request.Context(), httpResp, false)
+		service.ResetStatusCode(newAPIError, c.GetString("status_code_mapping"))
+		return true, newAPIError
+	}
+	defer service.CloseResponseBodyGracefully(httpResp)
+
+	body, err := io.ReadAll(httpResp.Body)
+	if err != nil {
+		return true, types.NewOpenAIError(err, types.ErrorCodeReadResponseBodyFailed, http.StatusInternalServerError)
+	}
+	c.Data(http.StatusOK, "application/json", body)
+	return true, nil
+}
+
+func localCountTokens(c *gin.Context, info *relaycommon.RelayInfo) *types.NewAPIError {
+	common.SetContextKey(c, constant.ContextKeyLocalCountTokens, true)
+	switch request := info.Request.(type) {
+	case *dto.ClaudeRequest:
+		tokens, err := service.CountTokenClaudeRequest(*request, info.UpstreamModelName)
+		if err != nil {
+			return types.NewErrorWithStatusCode(err, types.ErrorCodeCountTokenFailed, http.StatusBadRequest, types.ErrOptionWithSkipRetry())
+		}
+		c.JSON(http.StatusOK, dto.ClaudeCountTokensResponse{InputTokens: tokens})
+	case *dto.GeminiChatRequest:
+		c.JSON(http.StatusOK, dto.GeminiCountTokensResponse{TotalTokens: service.CountTokenGeminiRequest(request, info.UpstreamModelName)})
+	}
+	return nil
+}
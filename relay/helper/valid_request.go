@@ -309,6 +309,38 @@ func GetAndValidateGeminiRequest(c *gin.Context) (*dto.GeminiChatRequest, error)
 	return request, nil
 }
 
+// GetAndValidateCountTokensRequest 解析 Claude count_tokens 与 Gemini countTokens 请求
+func GetAndValidateCountTokensRequest(c *gin.Context, format types.RelayFormat) (dto.Request, error) {
+	switch format {
+	case types.RelayFormatClaude:
+		request := &dto.ClaudeRequest{}
+		err := common.UnmarshalBodyReusable(c, request)
+		if err != nil {
+			return nil, err
+		}
+		if len(request.Messages) == 0 {
+			return nil, errors.New("field messages is required")
+		}
+		if request.Model == "" {
+			return nil, errors.New("field model is required")
+		}
+		return request, nil
+	case types.RelayFormatGemini:
+		countRequest := &dto.GeminiCountTokensRequest{}
+		err := common.UnmarshalBodyReusable(c, countRequest)
+		if err != nil {
+			return nil, err
+		}
+		request := countRequest.ToChatRequest()
+		if len(request.Contents) == 0 {
+			return nil, errors.New("contents is required")
+		}
+		return request, nil
+	default:
+		return nil, fmt.Errorf("unsupported relay format: %s", format)
+	}
+}
+
 func GetAndValidateGeminiEmbeddingRequest(c *gin.Context) (*dto.GeminiEmbeddingRequest, error) {
 	request := &dto.GeminiEmbeddingRequest{}
 	err := common.UnmarshalBodyReusable(c, request)
@@ -0,0 +1,133 @@
+package relay
+
+import (
+	"bytes"
+	"encoding/base64"
+	"fmt"
+	"math"
+	"net/http"
+	"strings"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/logger"
+	"github.com/QuantumNous/new-api/model"
+	relaycommon "github.com/QuantumNous/new-api/relay/common"
+	"github.com/QuantumNous/new-api/service"
+	"github.com/QuantumNous/new-api/setting/operation_setting"
+
+	"github.com/bytedance/gopkg/util/gopool"
+	"github.com/gin-gonic/gin"
+)
+
+// mediaCapture 保存图片生成与语音合成的结果
+type mediaCapture struct {
+	context *gin.Context
+	info    *relaycommon.RelayInfo
+	source  string
+	origin  gin.ResponseWriter
+	writer  *responseCaptureWriter
+}
+
+func newMediaCapture(c *gin.Context, info *relaycommon.RelayInfo, source string) *mediaCapture {
+	if !service.MediaStorageEnabled(source) {
+		return nil
+	}
+	return &mediaCapture{context: c, info: info, source: source}
+}
+
+// capture 在上游返回前替换 ResponseWriter，响应边写出边记录
+func (mc *mediaCapture) capture() {
+	if mc == nil || mc.origin != nil {
+		return
+	}
+	c := mc.context
+	mc.origin = c.Writer
+	limit := operation_setting.GetMediaStorageSetting().MaxFileSizeMB << 20
+	if limit <= 0 {
+		limit = math.MaxInt
+	}
+	mc.writer = &responseCaptureWriter{
+		ResponseWriter: c.Writer,
+		limit:          limit,
+	}
+	c.Writer = mc.writer
+}
+
+// finish 恢复原始的 ResponseWriter，请求成功时异步保存结果，不影响返回给客户端的响应
+func (mc *mediaCapture) finish(success bool) {
+	if mc == nil || mc.origin == nil {
+		return
+	}
+	mc.context.Writer = mc.origin
+	mc.origin = nil
+	w := mc.writer
+	mc.writer = nil
+	if !success || w.overflow || w.buf.Len() == 0 || w.Status() != http.StatusOK {
+		return
+	}
+	if mc.source == model.MediaSourceImage {
+		if !mc.info.IsStream {
+			mc.saveImages(bytes.Clone(w.buf.Bytes()))
+		}
+		return
+	}
+	mc.saveAudio(w)
+}
+
+func (mc *mediaCapture) params(kind string, seq int) service.MediaSaveParams {
+	return service.MediaSaveParams{
+		UserId:    mc.info.UserId,
+		Group:     mc.info.UsingGroup,
+		Source:    mc.source,
+		SourceId:  mc.context.GetString(common.RequestIdKey),
+		Seq:       seq,
+		Kind:      kind,
+		ModelName: mc.info.OriginModelName,
+	}
+}
+
+// saveImages 异步保存生成的图片，支持 url 与 b64_json 两种返回形式
+func (mc *mediaCapture) saveImages(body []byte) {
+	params := mc.params(model.MediaKindImage, 0)
+	ctx := mc.context.Copy()
+	gopool.Go(func() {
+		var resp struct {
+			Data []struct {
+				Url     string `json:"url"`
+				B64Json string `json:"b64_json"`
+			} `json:"data"`
+		}
+		if err := common.Unmarshal(body, &resp); err != nil {
+			return
+		}
+		for i, item := range resp.Data {
+			itemParams := params
+			itemParams.Seq = i
+			var err error
+			switch {
+			case item.B64Json != "":
+				itemParams.Size = int64(base64.StdEncoding.DecodedLen(len(item.B64Json)))
+				_, err = service.SaveMediaAsset(itemParams, base64.NewDecoder(base64.StdEncoding, strings.NewReader(item.B64Json)))
+			case item.Url != "":
+				_, err = service.SaveMediaAssetFromUrl(itemParams, item.Url)
+			}
+			if err != nil {
+				logger.LogWarn(ctx, fmt.Sprintf("failed to save generated image: %s", err.Error()))
+			}
+		}
+	})
+}
+
+// saveAudio 异步保存语音合成的音频，超出记录上限时不保存
+func (mc *mediaCapture) saveAudio(w *responseCaptureWriter) {
+	params := mc.params(model.MediaKindAudio, 0)
+	params.ContentType = w.Header().Get("Content-Type")
+	params.Size = int64(w.buf.Len())
+	data := bytes.Clone(w.buf.Bytes())
+	ctx := mc.context.Copy()
+	gopool.Go(func() {
+		if _, err := service.SaveMediaAsset(params, bytes.NewReader(data)); err != nil {
+			logger.LogWarn(ctx, fmt.Sprintf("failed to save generated audio: %s", err.Error()))
+		}
+	})
+}
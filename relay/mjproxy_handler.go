@@ -27,13 +27,21 @@ import (
 
 func RelayMidjourneyImage(c *gin.Context) {
 	taskId := c.Param("id")
-	midjourneyTask := model.GetByOnlyMJId(taskId)
-	if midjourneyTask == nil {
+	task, exist, err := model.GetMidjourneyTask(taskId)
+	if err != nil || !exist {
 		c.JSON(400, gin.H{
 			"error": "midjourney_task_not_found",
 		})
 		return
 	}
+	midjourneyTask := task.ToMidjourney()
+	// 已保存到文件存储时直接返回保存的文件，上游地址可能已经过期
+	for _, asset := range service.GetMediaAssets(midjourneyTask.UserId, model.MediaSourceTask, midjourneyTask.MjId) {
+		if asset.Kind == model.MediaKindImage {
+			service.ServeMediaAsset(c, asset)
+			return
+		}
+	}
 	var httpClient *http.Client
 	if channel, err := model.CacheGetChannel(midjourneyTask.ChannelId); err == nil {
 		proxy := channel.GetSetting().Proxy
@@ -80,49 +88,6 @@ func RelayMidjourneyImage(c *gin.Context) {
 	return
 }
 
-func RelayMidjourneyNotify(c *gin.Context) *dto.MidjourneyResponse {
-	var midjRequest dto.MidjourneyDto
-	err := common.UnmarshalBodyReusable(c, &midjRequest)
-	if err != nil {
-		return &dto.MidjourneyResponse{
-			Code:        4,
-			Description: "bind_request_body_failed",
-			Properties:  nil,
-			Result:      "",
-		}
-	}
-	midjourneyTask := model.GetByOnlyMJId(midjRequest.MjId)
-	if midjourneyTask == nil {
-		return &dto.MidjourneyResponse{
-			Code:        4,
-			Description: "midjourney_task_not_found",
-			Properties:  nil,
-			Result:      "",
-		}
-	}
-	midjourneyTask.Progress = midjRequest.Progress
-	midjourneyTask.PromptEn = midjRequest.PromptEn
-	midjourneyTask.State = midjRequest.State
-	midjourneyTask.SubmitTime = midjRequest.SubmitTime
-	midjourneyTask.StartTime = midjRequest.StartTime
-	midjourneyTask.FinishTime = midjRequest.FinishTime
-	midjourneyTask.ImageUrl = midjRequest.ImageUrl
-	midjourneyTask.VideoUrl = midjRequest.VideoUrl
-	videoUrlsStr, _ := json.Marshal(midjRequest.VideoUrls)
-	midjourneyTask.VideoUrls = string(videoUrlsStr)
-	midjourneyTask.Status = midjRequest.Status
-	midjourneyTask.FailReason = midjRequest.FailReason
-	err = midjourneyTask.Update()
-	if err != nil {
-		return &dto.MidjourneyResponse{
-			Code:        4,
-			Description: "update_midjourney_task_failed",
-		}
-	}
-
-	return nil
-}
-
 func coverMidjourneyTaskDto(c *gin.Context, originTask *model.Midjourney) (midjourneyTask dto.MidjourneyDto) {
 	midjourneyTask.MjId = originTask.MjId
 	midjourneyTask.Progress = originTask.Progress
@@ -143,6 +108,17 @@ func coverMidjourneyTaskDto(c *gin.Context, originTask *model.Midjourney) (midjo
 	if originTask.VideoUrl != "" {
 		midjourneyTask.VideoUrl = originTask.VideoUrl
 	}
+	// 已保存到文件存储的图片与视频改用签名地址
+	for _, asset := range service.GetMediaAssets(originTask.UserId, model.MediaSourceTask, originTask.MjId) {
+		switch asset.Kind {
+		case model.MediaKindImage:
+			if !setting.MjForwardUrlEnabled {
+				midjourneyTask.ImageUrl = service.SignMediaUrl(asset)
+			}
+		case model.MediaKindVideo:
+			midjourneyTask.VideoUrl = service.SignMediaUrl(asset)
+		}
+	}
 	midjourneyTask.Status = originTask.Status
 	midjourneyTask.FailReason = originTask.FailReason
 	midjourneyTask.Action = originTask.Action
@@ -172,108 +148,11 @@ func coverMidjourneyTaskDto(c *gin.Context, originTask *model.Midjourney) (midjo
 	return
 }
 
-func RelaySwapFace(c *gin.Context, info *relaycommon.RelayInfo) *dto.MidjourneyResponse {
-	var swapFaceRequest dto.SwapFaceRequest
-	err := common.UnmarshalBodyReusable(c, &swapFaceRequest)
-	if err != nil {
-		return service.MidjourneyErrorWrapper(constant.MjRequestError, "bind_request_body_failed")
-	}
-
-	info.InitChannelMeta(c)
-
-	if swapFaceRequest.SourceBase64 == "" || swapFaceRequest.TargetBase64 == "" {
-		return service.MidjourneyErrorWrapper(constant.MjRequestError, "sour_base64_and_target_base64_is_required")
-	}
-	modelName := service.CoverActionToModelName(constant.MjActionSwapFace)
-
-	priceData := helper.ModelPriceHelperPerCall(c, info)
-
-	userQuota, err := model.GetUserQuota(info.UserId, false)
-	if err != nil {
-		return &dto.MidjourneyResponse{
-			Code:        4,
-			Description: err.Error(),
-		}
-	}
-
-	if userQuota-priceData.Quota < 0 {
-		return &dto.MidjourneyResponse{
-			Code:        4,
-			Description: "quota_not_enough",
-		}
-	}
-	requestURL := getMjRequestPath(c.Request.URL.String())
-	baseURL := c.GetString("base_url")
-	fullRequestURL := fmt.Sprintf("%s%s", baseURL, requestURL)
-	mjResp, _, err := service.DoMidjourneyHttpRequest(c, time.Second*60, fullRequestURL)
-	if err != nil {
-		return &mjResp.Response
-	}
-	defer func() {
-		if mjResp.StatusCode == 200 && mjResp.Response.Code == 1 {
-			err := service.PostConsumeQuota(info, priceData.Quota, 0, true)
-			if err != nil {
-				common.SysLog("error consuming token remain quota: " + err.Error())
-			}
-
-			tokenName := c.GetString("token_name")
-			logContent := fmt.Sprintf("模型固定价格 %.2f，分组倍率 %.2f，操作 %s", priceData.ModelPrice, priceData.GroupRatioInfo.GroupRatio, constant.MjActionSwapFace)
-			other := service.GenerateMjOtherInfo(info, priceData)
-			model.RecordConsumeLog(c, info.UserId, model.RecordConsumeLogParams{
-				ChannelId: info.ChannelId,
-				ModelName: modelName,
-				TokenName: tokenName,
-				Quota:     priceData.Quota,
-				Content:   logContent,
-				TokenId:   info.TokenId,
-				Group:     info.UsingGroup,
-				Other:     other,
-			})
-			model.UpdateUserUsedQuotaAndRequestCount(info.UserId, priceData.Quota)
-			model.UpdateChannelUsedQuota(info.ChannelId, priceData.Quota)
-		}
-	}()
-	midjResponse := &mjResp.Response
-	midjourneyTask := &model.Midjourney{
-		UserId:      info.UserId,
-		Code:        midjResponse.Code,
-		Action:      constant.MjActionSwapFace,
-		MjId:        midjResponse.Result,
-		Prompt:      "InsightFace",
-		PromptEn:    "",
-		Description: midjResponse.Description,
-		State:       "",
-		SubmitTime:  info.StartTime.UnixNano() / int64(time.Millisecond),
-		StartTime:   time.Now().UnixNano() / int64(time.Millisecond),
-		FinishTime:  0,
-		ImageUrl:    "",
-		Status:      "",
-		Progress:    "0%",
-		FailReason:  "",
-		ChannelId:   c.GetInt("channel_id"),
-		Quota:       priceData.Quota,
-	}
-	err = midjourneyTask.Insert()
-	if err != nil {
-		return service.MidjourneyErrorWrapper(constant.MjRequestError, "insert_midjourney_task_failed")
-	}
-	c.Writer.WriteHeader(mjResp.StatusCode)
-	respBody, err := json.Marshal(midjResponse)
-	if err != nil {
-		return service.MidjourneyErrorWrapper(constant.MjRequestError, "unmarshal_response_body_failed")
-	}
-	_, err = io.Copy(c.Writer, bytes.NewBuffer(respBody))
-	if err != nil {
-		return service.MidjourneyErrorWrapper(constant.MjRequestError, "copy_response_body_failed")
-	}
-	return nil
-}
-
 func RelayMidjourneyTaskImageSeed(c *gin.Context) *dto.MidjourneyResponse {
 	taskId := c.Param("id")
 	userId := c.GetInt("id")
-	originTask := model.GetByMJId(userId, taskId)
-	if originTask == nil {
+	originTask, exist, err := model.GetUserMidjourneyTask(userId, taskId)
+	if err != nil || !exist {
 		return service.MidjourneyErrorWrapper(constant.MjRequestError, "task_no_found")
 	}
 	channel, err := model.GetChannelById(originTask.ChannelId, true)
@@ -283,8 +162,12 @@ func RelayMidjourneyTaskImageSeed(c *gin.Context) *dto.MidjourneyResponse {
 	if channel.Status != common.ChannelStatusEnabled {
 		return service.MidjourneyErrorWrapper(constant.MjRequestError, "该任务所属渠道已被禁用")
 	}
+	key, _, newAPIError := channel.GetNextEnabledKey()
+	if newAPIError != nil {
+		return service.MidjourneyErrorWrapper(constant.MjRequestError, "get_channel_key_failed")
+	}
 	c.Set("channel_id", originTask.ChannelId)
-	c.Request.Header.Set("Authorization", fmt.Sprintf("Bearer %s", channel.Key))
+	common.SetContextKey(c, constant.ContextKeyChannelKey, key)
 
 	requestURL := getMjRequestPath(c.Request.URL.String())
 	fullRequestURL := fmt.Sprintf("%s%s", channel.GetBaseURL(), requestURL)
@@ -309,14 +192,14 @@ func RelayMidjourneyTask(c *gin.Context, relayMode int) *dto.MidjourneyResponse
 	switch relayMode {
 	case relayconstant.RelayModeMidjourneyTaskFetch:
 		taskId := c.Param("id")
-		originTask := model.GetByMJId(userId, taskId)
-		if originTask == nil {
+		originTask, exist, err := model.GetUserMidjourneyTask(userId, taskId)
+		if err != nil || !exist {
 			return &dto.MidjourneyResponse{
 				Code:        4,
 				Description: "task_no_found",
 			}
 		}
-		midjourneyTask := coverMidjourneyTaskDto(c, originTask)
+		midjourneyTask := coverMidjourneyTaskDto(c, originTask.ToMidjourney())
 		respBody, err = json.Marshal(midjourneyTask)
 		if err != nil {
 			return &dto.MidjourneyResponse{
@@ -337,9 +220,9 @@ func RelayMidjourneyTask(c *gin.Context, relayMode int) *dto.MidjourneyResponse
 		}
 		var tasks []dto.MidjourneyDto
 		if len(condition.IDs) != 0 {
-			originTasks := model.GetByMJIds(userId, condition.IDs)
+			originTasks, _ := model.GetUserMidjourneyTasks(userId, condition.IDs)
 			for _, originTask := range originTasks {
-				midjourneyTask := coverMidjourneyTaskDto(c, originTask)
+				midjourneyTask := coverMidjourneyTaskDto(c, originTask.ToMidjourney())
 				tasks = append(tasks, midjourneyTask)
 			}
 		}
@@ -367,126 +250,16 @@ func RelayMidjourneyTask(c *gin.Context, relayMode int) *dto.MidjourneyResponse
 	return nil
 }
 
-func RelayMidjourneySubmit(c *gin.Context, relayInfo *relaycommon.RelayInfo) *dto.MidjourneyResponse {
-	consumeQuota := true
-	var midjRequest dto.MidjourneyRequest
-	err := common.UnmarshalBodyReusable(c, &midjRequest)
-	if err != nil {
-		return service.MidjourneyErrorWrapper(constant.MjRequestError, "bind_request_body_failed")
-	}
-
+// RelayMidjourneyUpload 上传图片到 Discord，结果随响应直接返回，不是异步任务，不写入任务表。
+// 其余提交接口通过 Midjourney 任务适配器保存到 tasks 表
+func RelayMidjourneyUpload(c *gin.Context, relayInfo *relaycommon.RelayInfo) *dto.MidjourneyResponse {
 	relayInfo.InitChannelMeta(c)
 
-	if relayInfo.RelayMode == relayconstant.RelayModeMidjourneyAction { // midjourney plus，需要从customId中获取任务信息
-		mjErr := service.CoverPlusActionToNormalAction(&midjRequest)
-		if mjErr != nil {
-			return mjErr
-		}
-		relayInfo.RelayMode = relayconstant.RelayModeMidjourneyChange
-	}
-	if relayInfo.RelayMode == relayconstant.RelayModeMidjourneyVideo {
-		midjRequest.Action = constant.MjActionVideo
-	}
-
-	if relayInfo.RelayMode == relayconstant.RelayModeMidjourneyImagine { //绘画任务，此类任务可重复
-		if midjRequest.Prompt == "" {
-			return service.MidjourneyErrorWrapper(constant.MjRequestError, "prompt_is_required")
-		}
-		midjRequest.Action = constant.MjActionImagine
-	} else if relayInfo.RelayMode == relayconstant.RelayModeMidjourneyDescribe { //按图生文任务，此类任务可重复
-		midjRequest.Action = constant.MjActionDescribe
-	} else if relayInfo.RelayMode == relayconstant.RelayModeMidjourneyEdits { //编辑任务，此类任务可重复
-		midjRequest.Action = constant.MjActionEdits
-	} else if relayInfo.RelayMode == relayconstant.RelayModeMidjourneyShorten { //缩短任务，此类任务可重复，plus only
-		midjRequest.Action = constant.MjActionShorten
-	} else if relayInfo.RelayMode == relayconstant.RelayModeMidjourneyBlend { //绘画任务，此类任务可重复
-		midjRequest.Action = constant.MjActionBlend
-	} else if relayInfo.RelayMode == relayconstant.RelayModeMidjourneyUpload { //绘画任务，此类任务可重复
-		midjRequest.Action = constant.MjActionUpload
-	} else if midjRequest.TaskId != "" { //放大、变换任务，此类任务，如果重复且已有结果，远端api会直接返回最终结果
-		mjId := ""
-		if relayInfo.RelayMode == relayconstant.RelayModeMidjourneyChange {
-			if midjRequest.TaskId == "" {
-				return service.MidjourneyErrorWrapper(constant.MjRequestError, "task_id_is_required")
-			} else if midjRequest.Action == "" {
-				return service.MidjourneyErrorWrapper(constant.MjRequestError, "action_is_required")
-			} else if midjRequest.Index == 0 {
-				return service.MidjourneyErrorWrapper(constant.MjRequestError, "index_is_required")
-			}
-			//action = midjRequest.Action
-			mjId = midjRequest.TaskId
-		} else if relayInfo.RelayMode == relayconstant.RelayModeMidjourneySimpleChange {
-			if midjRequest.Content == "" {
-				return service.MidjourneyErrorWrapper(constant.MjRequestError, "content_is_required")
-			}
-			params := service.ConvertSimpleChangeParams(midjRequest.Content)
-			if params == nil {
-				return service.MidjourneyErrorWrapper(constant.MjRequestError, "content_parse_failed")
-			}
-			mjId = params.TaskId
-			midjRequest.Action = params.Action
-		} else if relayInfo.RelayMode == relayconstant.RelayModeMidjourneyModal {
-			//if midjRequest.MaskBase64 == "" {
-			//	return service.MidjourneyErrorWrapper(constant.MjRequestError, "mask_base64_is_required")
-			//}
-			mjId = midjRequest.TaskId
-			midjRequest.Action = constant.MjActionModal
-		} else if relayInfo.RelayMode == relayconstant.RelayModeMidjourneyVideo {
-			midjRequest.Action = constant.MjActionVideo
-			if midjRequest.TaskId == "" {
-				return service.MidjourneyErrorWrapper(constant.MjRequestError, "task_id_is_required")
-			} else if midjRequest.Action == "" {
-				return service.MidjourneyErrorWrapper(constant.MjRequestError, "action_is_required")
-			}
-			mjId = midjRequest.TaskId
-		}
-
-		originTask := model.GetByMJId(relayInfo.UserId, mjId)
-		if originTask == nil {
-			return service.MidjourneyErrorWrapper(constant.MjRequestError, "task_not_found")
-		} else { //原任务的Status=SUCCESS，则可以做放大UPSCALE、变换VARIATION等动作，此时必须使用原来的请求地址才能正确处理
-			if setting.MjActionCheckSuccessEnabled {
-				if originTask.Status != "SUCCESS" && relayInfo.RelayMode != relayconstant.RelayModeMidjourneyModal {
-					return service.MidjourneyErrorWrapper(constant.MjRequestError, "task_status_not_success")
-				}
-			}
-			channel, err := model.GetChannelById(originTask.ChannelId, true)
-			if err != nil {
-				return service.MidjourneyErrorWrapper(constant.MjRequestError, "get_channel_info_failed")
-			}
-			if channel.Status != common.ChannelStatusEnabled {
-				return service.MidjourneyErrorWrapper(constant.MjRequestError, "该任务所属渠道已被禁用")
-			}
-			c.Set("base_url", channel.GetBaseURL())
-			c.Set("channel_id", originTask.ChannelId)
-			c.Request.Header.Set("Authorization", fmt.Sprintf("Bearer %s", channel.Key))
-			log.Printf("检测到此操作为放大、变换、重绘，获取原channel信息: %s,%s", strconv.Itoa(originTask.ChannelId), channel.GetBaseURL())
-		}
-		midjRequest.Prompt = originTask.Prompt
-
-		//if channelType == common.ChannelTypeMidjourneyPlus {
-		//	// plus
-		//} else {
-		//	// 普通版渠道
-		//
-		//}
-	}
-
-	if midjRequest.Action == constant.MjActionInPaint || midjRequest.Action == constant.MjActionCustomZoom {
-		consumeQuota = false
-	}
-
-	//baseURL := common.ChannelBaseURLs[channelType]
 	requestURL := getMjRequestPath(c.Request.URL.String())
-
 	baseURL := c.GetString("base_url")
-
-	//midjRequest.NotifyHook = "http://127.0.0.1:3000/mj/notify"
-
 	fullRequestURL := fmt.Sprintf("%s%s", baseURL, requestURL)
 
-	modelName := service.CoverActionToModelName(midjRequest.Action)
-
+	modelName := service.CoverActionToModelName(constant.MjActionUpload)
 	priceData := helper.ModelPriceHelperPerCall(c, relayInfo)
 
 	userQuota, err := model.GetUserQuota(relayInfo.UserId, false)
@@ -496,148 +269,54 @@ func RelayMidjourneySubmit(c *gin.Context, relayInfo *relaycommon.RelayInfo) *dt
 			Description: err.Error(),
 		}
 	}
-
-	if consumeQuota && userQuota-priceData.Quota < 0 {
+	if userQuota-priceData.Quota < 0 {
 		return &dto.MidjourneyResponse{
 			Code:        4,
 			Description: "quota_not_enough",
 		}
 	}
+	if newAPIError := service.CheckQuotaBudget(relayInfo, priceData.Quota); newAPIError != nil {
+		return &dto.MidjourneyResponse{
+			Code:        4,
+			Description: newAPIError.Error(),
+		}
+	}
 
 	midjResponseWithStatus, responseBody, err := service.DoMidjourneyHttpRequest(c, time.Second*60, fullRequestURL)
 	if err != nil {
 		return &midjResponseWithStatus.Response
 	}
 	midjResponse := &midjResponseWithStatus.Response
-
-	defer func() {
-		if consumeQuota && midjResponseWithStatus.StatusCode == 200 {
-			err := service.PostConsumeQuota(relayInfo, priceData.Quota, 0, true)
-			if err != nil {
-				common.SysLog("error consuming token remain quota: " + err.Error())
-			}
-			tokenName := c.GetString("token_name")
-			logContent := fmt.Sprintf("模型固定价格 %.2f，分组倍率 %.2f，操作 %s，ID %s", priceData.ModelPrice, priceData.GroupRatioInfo.GroupRatio, midjRequest.Action, midjResponse.Result)
-			other := service.GenerateMjOtherInfo(relayInfo, priceData)
-			model.RecordConsumeLog(c, relayInfo.UserId, model.RecordConsumeLogParams{
-				ChannelId: relayInfo.ChannelId,
-				ModelName: modelName,
-				TokenName: tokenName,
-				Quota:     priceData.Quota,
-				Content:   logContent,
-				TokenId:   relayInfo.TokenId,
-				Group:     relayInfo.UsingGroup,
-				Other:     other,
-			})
-			model.UpdateUserUsedQuotaAndRequestCount(relayInfo.UserId, priceData.Quota)
-			model.UpdateChannelUsedQuota(relayInfo.ChannelId, priceData.Quota)
-		}
-	}()
-
-	// 文档：https://github.com/novicezk/midjourney-proxy/blob/main/docs/api.md
-	//1-提交成功
-	// 21-任务已存在（处理中或者有结果了） {"code":21,"description":"任务已存在","result":"0741798445574458","properties":{"status":"SUCCESS","imageUrl":"https://xxxx"}}
-	// 22-排队中 {"code":22,"description":"排队中，前面还有1个任务","result":"0741798445574458","properties":{"numberOfQueues":1,"discordInstanceId":"1118138338562560102"}}
-	// 23-队列已满，请稍后再试 {"code":23,"description":"队列已满，请稍后尝试","result":"14001929738841620","properties":{"discordInstanceId":"1118138338562560102"}}
-	// 24-prompt包含敏感词 {"code":24,"description":"可能包含敏感词","properties":{"promptEn":"nude body","bannedWord":"nude"}}
-	// other: 提交错误，description为错误描述
-	midjourneyTask := &model.Midjourney{
-		UserId:      relayInfo.UserId,
-		Code:        midjResponse.Code,
-		Action:      midjRequest.Action,
-		MjId:        midjResponse.Result,
-		Prompt:      midjRequest.Prompt,
-		PromptEn:    "",
-		Description: midjResponse.Description,
-		State:       "",
-		SubmitTime:  time.Now().UnixNano() / int64(time.Millisecond),
-		StartTime:   0,
-		FinishTime:  0,
-		ImageUrl:    "",
-		Status:      "",
-		Progress:    "0%",
-		FailReason:  "",
-		ChannelId:   c.GetInt("channel_id"),
-		Quota:       priceData.Quota,
-	}
-	if midjResponse.Code == 3 {
-		//无实例账号自动禁用渠道（No available account instance）
-		channel, err := model.GetChannelById(midjourneyTask.ChannelId, true)
+	if midjResponseWithStatus.StatusCode == 200 && midjResponse.Code == 1 {
+		err := service.PostConsumeQuota(relayInfo, priceData.Quota, 0, true)
 		if err != nil {
-			common.SysLog("get_channel_null: " + err.Error())
-		}
-		if channel.GetAutoBan() && common.AutomaticDisableChannelEnabled {
-			model.UpdateChannelStatus(midjourneyTask.ChannelId, "", 2, "No available account instance")
-		}
-	}
-	if midjResponse.Code != 1 && midjResponse.Code != 21 && midjResponse.Code != 22 {
-		//非1-提交成功,21-任务已存在和22-排队中，则记录错误原因
-		midjourneyTask.FailReason = midjResponse.Description
-		consumeQuota = false
-	}
-
-	if midjResponse.Code == 21 { //21-任务已存在（处理中或者有结果了）
-		// 将 properties 转换为一个 map
-		properties, ok := midjResponse.Properties.(map[string]interface{})
-		if ok {
-			imageUrl, ok1 := properties["imageUrl"].(string)
-			status, ok2 := properties["status"].(string)
-			if ok1 && ok2 {
-				midjourneyTask.ImageUrl = imageUrl
-				midjourneyTask.Status = status
-				if status == "SUCCESS" {
-					midjourneyTask.Progress = "100%"
-					midjourneyTask.StartTime = time.Now().UnixNano() / int64(time.Millisecond)
-					midjourneyTask.FinishTime = time.Now().UnixNano() / int64(time.Millisecond)
-					midjResponse.Code = 1
-				}
-			}
-		}
-		//修改返回值
-		if midjRequest.Action != constant.MjActionInPaint && midjRequest.Action != constant.MjActionCustomZoom {
-			newBody := strings.Replace(string(responseBody), `"code":21`, `"code":1`, -1)
-			responseBody = []byte(newBody)
-		}
-	}
-	if midjResponse.Code == 1 && midjRequest.Action == "UPLOAD" {
-		midjourneyTask.Progress = "100%"
-		midjourneyTask.Status = "SUCCESS"
-	}
-	err = midjourneyTask.Insert()
-	if err != nil {
-		return &dto.MidjourneyResponse{
-			Code:        4,
-			Description: "insert_midjourney_task_failed",
-		}
-	}
-
-	if midjResponse.Code == 22 { //22-排队中，说明任务已存在
-		//修改返回值
-		newBody := strings.Replace(string(responseBody), `"code":22`, `"code":1`, -1)
-		responseBody = []byte(newBody)
+			common.SysLog("error consuming token remain quota: " + err.Error())
+		}
+		tokenName := c.GetString("token_name")
+		logContent := fmt.Sprintf("模型固定价格 %.2f，分组倍率 %.2f，操作 %s", priceData.ModelPrice, priceData.GroupRatioInfo.GroupRatio, constant.MjActionUpload)
+		other := service.GenerateMjOtherInfo(relayInfo, priceData)
+		model.RecordConsumeLog(c, relayInfo.UserId, model.RecordConsumeLogParams{
+			ChannelId: relayInfo.ChannelId,
+			ModelName: modelName,
+			TokenName: tokenName,
+			Quota:     priceData.Quota,
+			Content:   logContent,
+			TokenId:   relayInfo.TokenId,
+			Group:     relayInfo.UsingGroup,
+			Other:     other,
+		})
+		model.UpdateUserUsedQuotaAndRequestCount(relayInfo.UserId, priceData.Quota)
+		model.UpdateChannelUsedQuota(relayInfo.ChannelId, priceData.Quota)
 	}
-	//resp.Body = io.NopCloser(bytes.NewBuffer(responseBody))
-	bodyReader := io.NopCloser(bytes.NewBuffer(responseBody))
 
-	//for k, v := range resp.Header {
-	//	c.Writer.Header().Set(k, v[0])
-	//}
 	c.Writer.WriteHeader(midjResponseWithStatus.StatusCode)
-
-	_, err = io.Copy(c.Writer, bodyReader)
+	_, err = io.Copy(c.Writer, bytes.NewBuffer(responseBody))
 	if err != nil {
 		return &dto.MidjourneyResponse{
 			Code:        4,
 			Description: "copy_response_body_failed",
 		}
 	}
-	err = bodyReader.Close()
-	if err != nil {
-		return &dto.MidjourneyResponse{
-			Code:        4,
-			Description: "close_response_body_failed",
-		}
-	}
 	return nil
 }
 
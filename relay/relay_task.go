@@ -43,6 +43,11 @@ func RelayTaskSubmit(c *gin.Context, info *relaycommon.RelayInfo) (taskErr *dto.
 		return service.TaskErrorWrapperLocal(fmt.Errorf("invalid api platform: %s", platform), "invalid_api_platform", http.StatusBadRequest)
 	}
 	adaptor.Init(info)
+	// 需在解析 multipart 表单前读取，以便缓存请求体
+	callbackUrl, taskErr := getTaskCallbackUrl(c)
+	if taskErr != nil {
+		return
+	}
 	// get & validate taskRequest 获取并验证文本请求
 	taskErr = adaptor.ValidateRequestAndSetAction(c, info)
 	if taskErr != nil {
@@ -93,6 +98,10 @@ func RelayTaskSubmit(c *gin.Context, info *relaycommon.RelayInfo) (taskErr *dto.
 		taskErr = service.TaskErrorWrapperLocal(errors.New("user quota is not enough"), "quota_not_enough", http.StatusForbidden)
 		return
 	}
+	if newAPIError := service.CheckQuotaBudget(info, quota); newAPIError != nil {
+		taskErr = service.TaskErrorWrapperLocal(newAPIError.Err, string(newAPIError.GetErrorCode()), newAPIError.StatusCode)
+		return
+	}
 
 	if info.OriginTaskID != "" {
 		originTask, exist, err := model.GetByTaskId(info.UserId, info.OriginTaskID)
@@ -113,15 +122,26 @@ func RelayTaskSubmit(c *gin.Context, info *relaycommon.RelayInfo) (taskErr *dto.
 			if channel.Status != common.ChannelStatusEnabled {
 				return service.TaskErrorWrapperLocal(errors.New("该任务所属渠道已被禁用"), "task_channel_disable", http.StatusBadRequest)
 			}
+			key, _, newAPIError := channel.GetNextEnabledKey()
+			if newAPIError != nil {
+				taskErr = service.TaskErrorWrapperLocal(newAPIError.Err, "task_channel_key_unavailable", http.StatusBadRequest)
+				return
+			}
 			c.Set("base_url", channel.GetBaseURL())
 			c.Set("channel_id", originTask.ChannelId)
-			c.Request.Header.Set("Authorization", fmt.Sprintf("Bearer %s", channel.Key))
+			c.Request.Header.Set("Authorization", fmt.Sprintf("Bearer %s", key))
 
+			// 适配器从 info 中读取上游密钥（如 Midjourney 的 mj-api-secret），需与任务所属渠道一致
 			info.ChannelBaseUrl = channel.GetBaseURL()
 			info.ChannelId = originTask.ChannelId
+			info.ApiKey = key
 		}
 	}
 
+	if _, ok := adaptor.(channel.UpstreamCallbackSupporter); ok {
+		info.UpstreamCallbackUrl = service.GetTaskUpstreamCallbackUrl(info.ChannelId)
+	}
+
 	// build body
 	requestBody, err := adaptor.BuildRequestBody(c, info)
 	if err != nil {
@@ -208,11 +228,28 @@ func RelayTaskSubmit(c *gin.Context, info *relaycommon.RelayInfo) (taskErr *dto.
 	task.Quota = quota
 	task.Data = taskData
 	task.Action = info.Action
+	task.Properties.CallbackUrl = callbackUrl
+	if callbackUrl != "" {
+		// 回调始终签名，令牌没有密钥时生成并保存到令牌上
+		task.PrivateData.CallbackSecret = common.GetContextKeyString(c, constant.ContextKeyTokenCallbackSecret)
+		if task.PrivateData.CallbackSecret == "" {
+			task.PrivateData.CallbackSecret, err = model.EnsureTokenCallbackSecret(info.TokenId)
+			if err != nil {
+				common.SysError(fmt.Sprintf("failed to ensure token callback secret: token_id=%d, error=%v", info.TokenId, err))
+			}
+		}
+	}
+	task.PrivateData.UpstreamCallback = info.UpstreamCallbackUrl != ""
+	// 记录预估计费参数，任务完成后按实际结果重新计费
+	if !common.StringsContains(constant.TaskPricePatches, modelName) && len(info.PriceData.OtherRatios) > 0 {
+		task.PrivateData.BillingRatios = info.PriceData.OtherRatios
+	}
 	err = task.Insert()
 	if err != nil {
 		taskErr = service.TaskErrorWrapper(err, "insert_task_failed", http.StatusInternalServerError)
 		return
 	}
+	common.SetContextKey(c, constant.ContextKeySubmittedTask, task)
 	return nil
 }
 
@@ -344,6 +381,7 @@ func videoFetchByIDRespBodyBuilder(c *gin.Context) (respBody []byte, taskResp *d
 		}
 		ti, err2 := adaptor.ParseTaskResult(body)
 		if err2 == nil && ti != nil {
+			preStatus := originTask.Status
 			if ti.Status != "" {
 				originTask.Status = model.TaskStatus(ti.Status)
 			}
@@ -356,7 +394,11 @@ func videoFetchByIDRespBodyBuilder(c *gin.Context) (respBody []byte, taskResp *d
 					originTask.FailReason = ti.Url
 				}
 			}
-			_ = originTask.Update()
+			if originTask.Update() == nil {
+				model.PublishTaskStatusEvent(originTask, preStatus)
+				NotifyTaskCallback(originTask, preStatus)
+				service.SettleTask(c, originTask, preStatus, ti)
+			}
 			var raw map[string]any
 			_ = json.Unmarshal(body, &raw)
 			format := "mp4"
@@ -0,0 +1,221 @@
+package relay
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/dto"
+	"github.com/QuantumNous/new-api/logger"
+	relaycommon "github.com/QuantumNous/new-api/relay/common"
+	relayconstant "github.com/QuantumNous/new-api/relay/constant"
+	"github.com/QuantumNous/new-api/relay/helper"
+	"github.com/QuantumNous/new-api/service"
+	"github.com/QuantumNous/new-api/setting/operation_setting"
+
+	"github.com/gin-gonic/gin"
+)
+
+const responseCacheHeader = "X-Response-Cache"
+
+// responseCaptureWriter 在写给客户端的同时记录响应内容，超过上限后停止记录
+type responseCaptureWriter struct {
+	gin.ResponseWriter
+	buf      bytes.Buffer
+	limit    int
+	overflow bool
+}
+
+func (w *responseCaptureWriter) capture(data []byte) {
+	if w.overflow {
+		return
+	}
+	if w.buf.Len()+len(data) > w.limit {
+		w.overflow = true
+		w.buf.Reset()
+		return
+	}
+	w.buf.Write(data)
+}
+
+func (w *responseCaptureWriter) Write(data []byte) (int, error) {
+	w.capture(data)
+	return w.ResponseWriter.Write(data)
+}
+
+func (w *responseCaptureWriter) WriteString(s string) (int, error) {
+	w.capture([]byte(s))
+	return w.ResponseWriter.WriteString(s)
+}
+
+type responseCache struct {
+	key     string
+	ttl     time.Duration
+	store   bool
+	writer  *responseCaptureWriter
+	origin  gin.ResponseWriter
+	context *gin.Context
+}
+
+// newResponseCache 为可缓存的请求计算缓存键，未开启缓存或请求不可缓存时返回 nil
+// 客户端可通过 Cache-Control: no-cache 跳过读取缓存，no-store 同时跳过写入缓存
+func newResponseCache(c *gin.Context, info *relaycommon.RelayInfo, cacheable bool) *responseCache {
+	setting := operation_setting.GetResponseCacheSetting()
+	if !setting.Enabled || !cacheable {
+		return nil
+	}
+	ttl := time.Duration(setting.GetTTLSeconds(info.OriginModelName)) * time.Second
+	if ttl <= 0 {
+		return nil
+	}
+	cacheControl := strings.ToLower(c.GetHeader("Cache-Control"))
+	if strings.Contains(cacheControl, "no-cache") && strings.Contains(cacheControl, "no-store") {
+		return nil
+	}
+	key, err := getResponseCacheKey(c, info)
+	if err != nil {
+		logger.LogDebug(c, "skip response cache: "+err.Error())
+		return nil
+	}
+	return &responseCache{
+		key:     key,
+		ttl:     ttl,
+		store:   !strings.Contains(cacheControl, "no-store"),
+		context: c,
+	}
+}
+
+// getResponseCacheKey 缓存键由规范化后的请求体、请求模型、分组、用户与请求类型组成，
+// 开启 ShareAcrossUsers 时不区分用户。请求体中的 model 字段由请求模型替代，其余字段按键名排序后参与计算。
+// 缓存在选择渠道前查询，因此不包含渠道映射后的上游模型
+func getResponseCacheKey(c *gin.Context, info *relaycommon.RelayInfo) (string, error) {
+	body, err := common.GetRequestBody(c)
+	if err != nil {
+		return "", err
+	}
+	var payload map[string]any
+	if err := common.Unmarshal(body, &payload); err != nil {
+		return "", fmt.Errorf("request body is not a json object: %w", err)
+	}
+	delete(payload, "model")
+	normalized, err := json.Marshal(payload)
+	if err != nil {
+		return "", err
+	}
+	hash := sha256.New()
+	userId := info.UserId
+	if operation_setting.GetResponseCacheSetting().ShareAcrossUsers {
+		userId = 0
+	}
+	hash.Write([]byte(fmt.Sprintf("%d\n%s\n%s\n%d\n", info.RelayMode, info.OriginModelName, info.UsingGroup, userId)))
+	hash.Write(normalized)
+	return hex.EncodeToString(hash.Sum(nil)), nil
+}
+
+// ReplayResponseCache 在选择渠道与预扣费之前查询响应缓存，命中时直接返回缓存的响应并按缓存计费方式扣费
+func ReplayResponseCache(c *gin.Context, info *relaycommon.RelayInfo) bool {
+	var cacheable bool
+	switch request := info.Request.(type) {
+	case *dto.GeneralOpenAIRequest:
+		cacheable = textResponseCacheable(info, request)
+	case *dto.EmbeddingRequest:
+		cacheable = info.RelayMode == relayconstant.RelayModeEmbeddings
+	}
+	return newResponseCache(c, info, cacheable).replay(info)
+}
+
+// replay 命中缓存时直接返回缓存的响应并按缓存计费方式扣费
+func (rc *responseCache) replay(info *relaycommon.RelayInfo) bool {
+	if rc == nil {
+		return false
+	}
+	c := rc.context
+	if strings.Contains(strings.ToLower(c.GetHeader("Cache-Control")), "no-cache") {
+		return false
+	}
+	entry, ok := service.GetResponseCache(rc.key)
+	if !ok {
+		c.Header(responseCacheHeader, "MISS")
+		return false
+	}
+	// 未请求渠道，日志中记录分发阶段选中的渠道
+	info.InitChannelMeta(c)
+	info.ResponseCacheHit = true
+	info.IsStream = entry.IsStream
+	info.SetFirstResponseTime()
+	c.Header(responseCacheHeader, "HIT")
+	if entry.IsStream {
+		helper.SetEventStreamHeaders(c)
+	}
+	c.Data(http.StatusOK, entry.ContentType, entry.Body)
+	usage := entry.Usage
+	postConsumeQuota(c, info, &usage, "")
+	return true
+}
+
+// capture 在请求上游前开始记录返回给客户端的响应
+func (rc *responseCache) capture() {
+	if rc == nil || !rc.store {
+		return
+	}
+	c := rc.context
+	rc.origin = c.Writer
+	rc.writer = &responseCaptureWriter{
+		ResponseWriter: c.Writer,
+		limit:          operation_setting.GetResponseCacheSetting().MaxEntryBytes,
+	}
+	c.Writer = rc.writer
+}
+
+// save 上游成功返回且响应完整时写入缓存，并恢复原始的 ResponseWriter
+func (rc *responseCache) save(info *relaycommon.RelayInfo, usage *dto.Usage) {
+	if rc == nil || rc.writer == nil {
+		return
+	}
+	w := rc.writer
+	rc.finish()
+	if usage == nil || info.EmptyResponse || w.overflow || w.buf.Len() == 0 || w.Status() != http.StatusOK {
+		return
+	}
+	if rc.context.Request.Context().Err() != nil {
+		return
+	}
+	body := w.buf.Bytes()
+	// 流式响应中途断开时不缓存
+	if info.IsStream && !bytes.Contains(body, []byte("[DONE]")) {
+		return
+	}
+	service.SetResponseCache(rc.key, &service.ResponseCacheEntry{
+		ContentType: w.Header().Get("Content-Type"),
+		Body:        body,
+		IsStream:    info.IsStream,
+		Usage:       *usage,
+		CreatedAt:   common.GetTimestamp(),
+	}, rc.ttl)
+}
+
+// finish 恢复原始的 ResponseWriter，请求失败重试时需保证不会重复包装
+func (rc *responseCache) finish() {
+	if rc == nil || rc.writer == nil {
+		return
+	}
+	rc.context.Writer = rc.origin
+	rc.writer = nil
+}
+
+func textResponseCacheable(info *relaycommon.RelayInfo, request *dto.GeneralOpenAIRequest) bool {
+	if info.RelayMode != relayconstant.RelayModeChatCompletions && info.RelayMode != relayconstant.RelayModeCompletions {
+		return false
+	}
+	if strings.HasPrefix(info.OriginModelName, "gpt-4o-audio") {
+		return false
+	}
+	// 仅缓存确定性的请求
+	return request.Temperature != nil && *request.Temperature == 0 && request.N <= 1
+}
@@ -0,0 +1,198 @@
+package relay
+
+import (
+	"bytes"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/constant"
+	"github.com/QuantumNous/new-api/dto"
+	relaycommon "github.com/QuantumNous/new-api/relay/common"
+	relayconstant "github.com/QuantumNous/new-api/relay/constant"
+	"github.com/QuantumNous/new-api/service"
+	"github.com/QuantumNous/new-api/types"
+
+	"github.com/gin-gonic/gin"
+)
+
+// responsesNativeSupported 渠道是否原生支持 Responses API，其余渠道转换为 Chat Completions 处理
+func responsesNativeSupported(info *relaycommon.RelayInfo) bool {
+	if info.ChannelOtherSettings.ResponsesToChatCompletions {
+		return false
+	}
+	switch info.ApiType {
+	case constant.APITypeOpenAI, constant.APITypeOpenRouter, constant.APITypeCloudflare:
+		return true
+	}
+	return false
+}
+
+// responsesViaChatCompletions 将 Responses 请求转换为 Chat Completions 请求交给 TextHelper 处理，
+// 再将返回的内容转换为 Responses API 格式，计费、模型映射与缓存均沿用 TextHelper 的逻辑
+func responsesViaChatCompletions(c *gin.Context, info *relaycommon.RelayInfo, request *dto.OpenAIResponsesRequest) *types.NewAPIError {
+	chatRequest, err := service.ResponsesRequestToChatCompletionsRequest(request)
+	if err != nil {
+		return types.NewErrorWithStatusCode(err, types.ErrorCodeConvertRequestFailed, http.StatusBadRequest, types.ErrOptionWithSkipRetry())
+	}
+
+	originRequest, originRelayMode, originRelayFormat, originURLPath := info.Request, info.RelayMode, info.RelayFormat, info.RequestURLPath
+	info.Request = chatRequest
+	info.RelayMode = relayconstant.RelayModeChatCompletions
+	info.RelayFormat = types.RelayFormatOpenAI
+	info.RequestURLPath = "/v1/chat/completions"
+	info.ResponsesToChat = true
+
+	writer := newResponsesChatWriter(c, request)
+	c.Writer = writer
+	defer func() {
+		writer.Finish()
+		c.Writer = writer.ResponseWriter
+		info.Request, info.RelayMode, info.RelayFormat, info.RequestURLPath = originRequest, originRelayMode, originRelayFormat, originURLPath
+		info.ResponsesToChat = false
+	}()
+	return TextHelper(c, info)
+}
+
+const (
+	responsesChatWriterUndecided = iota
+	responsesChatWriterPassThrough
+	responsesChatWriterStream
+	responsesChatWriterJSON
+)
+
+// responsesChatWriter 将 Chat Completions 格式的输出转换为 Responses API 格式，错误响应原样输出
+type responsesChatWriter struct {
+	gin.ResponseWriter
+	request    *dto.OpenAIResponsesRequest
+	responseId string
+	createdAt  int
+	converter  *service.ChatToResponsesStreamConverter
+	mode       int
+	pending    []byte
+	finished   bool
+}
+
+func newResponsesChatWriter(c *gin.Context, request *dto.OpenAIResponsesRequest) *responsesChatWriter {
+	responseId := "resp_" + common.GetUUID()
+	createdAt := int(common.GetTimestamp())
+	return &responsesChatWriter{
+		ResponseWriter: c.Writer,
+		request:        request,
+		responseId:     responseId,
+		createdAt:      createdAt,
+		converter:      service.NewChatToResponsesStreamConverter(request, responseId, createdAt),
+	}
+}
+
+func (w *responsesChatWriter) decideMode() {
+	if w.mode != responsesChatWriterUndecided {
+		return
+	}
+	contentType := w.Header().Get("Content-Type")
+	switch {
+	case w.finished || w.Status() != http.StatusOK:
+		w.mode = responsesChatWriterPassThrough
+	case strings.Contains(contentType, "text/event-stream"):
+		w.mode = responsesChatWriterStream
+	case strings.Contains(contentType, "application/json"):
+		w.mode = responsesChatWriterJSON
+	default:
+		w.mode = responsesChatWriterPassThrough
+	}
+}
+
+func (w *responsesChatWriter) Write(data []byte) (int, error) {
+	w.decideMode()
+	switch w.mode {
+	case responsesChatWriterStream:
+		w.pending = append(w.pending, data...)
+		for {
+			idx := bytes.IndexByte(w.pending, '\n')
+			if idx < 0 {
+				break
+			}
+			line := strings.TrimRight(string(w.pending[:idx]), "\r")
+			w.pending = w.pending[idx+1:]
+			if _, err := w.ResponseWriter.Write(w.processLine(line)); err != nil {
+				return 0, err
+			}
+		}
+		return len(data), nil
+	case responsesChatWriterJSON:
+		w.pending = append(w.pending, data...)
+		return len(data), nil
+	default:
+		return w.ResponseWriter.Write(data)
+	}
+}
+
+func (w *responsesChatWriter) WriteString(s string) (int, error) {
+	return w.Write([]byte(s))
+}
+
+func (w *responsesChatWriter) encodeEvents(events []dto.ResponsesStreamResponse) []byte {
+	var buf bytes.Buffer
+	for _, event := range events {
+		data, err := common.Marshal(event)
+		if err != nil {
+			continue
+		}
+		fmt.Fprintf(&buf, "event: %s\ndata: %s\n\n", event.Type, data)
+	}
+	return buf.Bytes()
+}
+
+// processLine 逐行转换 SSE，注释行（如 ping）原样保留
+func (w *responsesChatWriter) processLine(line string) []byte {
+	if strings.HasPrefix(line, ":") {
+		return []byte(line + "\n\n")
+	}
+	if !strings.HasPrefix(line, "data:") {
+		return nil
+	}
+	payload := strings.TrimSpace(strings.TrimPrefix(line, "data:"))
+	if payload == "" || payload == "[DONE]" {
+		return nil
+	}
+	var chunk dto.ChatCompletionsStreamResponse
+	if err := common.UnmarshalJsonStr(payload, &chunk); err != nil {
+		return nil
+	}
+	return w.encodeEvents(w.converter.ProcessChunk(&chunk))
+}
+
+func (w *responsesChatWriter) processJSON(body []byte) []byte {
+	var chatResponse dto.OpenAITextResponse
+	if err := common.Unmarshal(body, &chatResponse); err != nil || chatResponse.Error != nil {
+		return body
+	}
+	data, err := common.Marshal(service.ChatCompletionsResponseToResponses(w.request, &chatResponse, w.responseId, w.createdAt))
+	if err != nil {
+		return body
+	}
+	return data
+}
+
+// Finish 输出最终的 Responses 事件或响应体，未写入任何内容时不输出
+func (w *responsesChatWriter) Finish() {
+	if w.finished {
+		return
+	}
+	w.finished = true
+	switch w.mode {
+	case responsesChatWriterJSON:
+		body := w.processJSON(w.pending)
+		w.Header().Del("Content-Length")
+		_, _ = w.ResponseWriter.Write(body)
+	case responsesChatWriterStream:
+		if len(w.pending) > 0 {
+			_, _ = w.ResponseWriter.Write(w.processLine(strings.TrimRight(string(w.pending), "\r")))
+		}
+		_, _ = w.ResponseWriter.Write(w.encodeEvents(w.converter.Finish(nil)))
+		w.ResponseWriter.Flush()
+	}
+	w.pending = nil
+	w.mode = responsesChatWriterPassThrough
+}
@@ -13,6 +13,7 @@ import (
 	"github.com/QuantumNous/new-api/relay/helper"
 	"github.com/QuantumNous/new-api/service"
 	"github.com/QuantumNous/new-api/setting/model_setting"
+	"github.com/QuantumNous/new-api/setting/operation_setting"
 	"github.com/QuantumNous/new-api/types"
 
 	"github.com/gin-gonic/gin"
@@ -31,6 +32,24 @@ func ResponsesHelper(c *gin.Context, info *relaycommon.RelayInfo) (newAPIError *
 		return types.NewError(fmt.Errorf("failed to copy request to GeneralOpenAIRequest: %w", err), types.ErrorCodeInvalidRequest, types.ErrOptionWithSkipRetry())
 	}
 
+	if recorder := service.NewResponsesStoreRecorder(c, request); recorder != nil {
+		defer recorder.Finish()
+	}
+
+	native := responsesNativeSupported(info)
+	// 展开网关保存的上下文，使 previous_response_id 不依赖上游渠道
+	if _, err := service.ExpandPreviousResponse(info.UserId, request, !native); err != nil {
+		return types.NewError(err, types.ErrorCodeQueryDataError, types.ErrOptionWithSkipRetry())
+	}
+	// 转换为 Chat Completions 的渠道无法引用上游保存的响应，网关未能展开的部分直接报错
+	if request.PreviousResponseID != "" && !native && operation_setting.GetResponsesStoreSetting().Enabled {
+		return types.NewErrorWithStatusCode(fmt.Errorf("previous response with id '%s' not found or exceeds the max chain depth", request.PreviousResponseID), types.ErrorCodeInvalidRequest, http.StatusBadRequest, types.ErrOptionWithSkipRetry())
+	}
+
+	if !native {
+		return responsesViaChatCompletions(c, info, request)
+	}
+
 	err = helper.ModelMappedHelper(c, info, request)
 	if err != nil {
 		return types.NewError(err, types.ErrorCodeChannelModelMappedError, types.ErrOptionWithSkipRetry())
@@ -0,0 +1,70 @@
+package relay
+
+import (
+	"fmt"
+	"net/http"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/constant"
+	"github.com/QuantumNous/new-api/dto"
+	"github.com/QuantumNous/new-api/model"
+	"github.com/QuantumNous/new-api/relay/channel"
+	"github.com/QuantumNous/new-api/service"
+	"github.com/QuantumNous/new-api/setting/operation_setting"
+
+	"github.com/gin-gonic/gin"
+)
+
+// getTaskCallbackUrl 读取请求中的 callback_url，未提供时使用令牌的默认回调地址
+func getTaskCallbackUrl(c *gin.Context) (string, *dto.TaskError) {
+	if !operation_setting.GetTaskCallbackSetting().Enabled {
+		return "", nil
+	}
+	var req struct {
+		CallbackUrl string `json:"callback_url"`
+	}
+	_ = common.UnmarshalBodyReusable(c, &req)
+	callbackUrl := req.CallbackUrl
+	if callbackUrl == "" {
+		callbackUrl = common.GetContextKeyString(c, constant.ContextKeyTokenCallbackUrl)
+	}
+	if err := service.ValidateTaskCallbackUrl(callbackUrl); err != nil {
+		return "", service.TaskErrorWrapperLocal(err, "invalid_callback_url", http.StatusBadRequest)
+	}
+	return callbackUrl, nil
+}
+
+// BuildTaskCallbackPayload 生成任务回调内容，优先使用适配器转换的 OpenAI 视频格式
+func BuildTaskCallbackPayload(task *model.Task) ([]byte, error) {
+	adaptor := GetTaskAdaptor(task.Platform)
+	if converter, ok := adaptor.(channel.OpenAIVideoConverter); ok {
+		if data, err := converter.ConvertToOpenAIVideo(task); err == nil && len(data) > 0 {
+			return data, nil
+		}
+	}
+	video := task.ToOpenAIVideo()
+	if task.Status == model.TaskStatusFailure {
+		video.Error = &dto.OpenAIVideoError{
+			Message: task.FailReason,
+			Code:    "task_failed",
+		}
+	}
+	if task.Platform == constant.TaskPlatformSuno {
+		video.SetMetadata("action", task.Action)
+		video.SetMetadata("data", task.Data)
+	}
+	return common.Marshal(video)
+}
+
+// NotifyTaskCallback 任务状态变化时向客户端的回调地址推送
+func NotifyTaskCallback(task *model.Task, preStatus model.TaskStatus) {
+	if task.Properties.CallbackUrl == "" || preStatus == task.Status {
+		return
+	}
+	payload, err := BuildTaskCallbackPayload(task)
+	if err != nil {
+		common.SysError(fmt.Sprintf("failed to build task callback payload: task_id=%s, error=%v", task.TaskID, err))
+		return
+	}
+	service.EnqueueTaskCallback(task, preStatus, payload)
+}
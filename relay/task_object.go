@@ -0,0 +1,89 @@
+package relay
+
+import (
+	"strconv"
+	"strings"
+
+	"github.com/QuantumNous/new-api/constant"
+	"github.com/QuantumNous/new-api/dto"
+	"github.com/QuantumNous/new-api/model"
+	"github.com/QuantumNous/new-api/service"
+)
+
+// GetTaskPlatformName 返回任务平台的名称，如 suno、midjourney、kling
+func GetTaskPlatformName(platform constant.TaskPlatform) string {
+	adaptor := GetTaskAdaptor(platform)
+	if adaptor == nil {
+		return string(platform)
+	}
+	return adaptor.GetChannelName()
+}
+
+// GetTaskPlatformsByName 按平台名称查找对应的任务平台，同一名称可能对应多个渠道类型
+func GetTaskPlatformsByName(name string) []constant.TaskPlatform {
+	name = strings.ToLower(name)
+	if name == string(constant.TaskPlatformSuno) {
+		return []constant.TaskPlatform{constant.TaskPlatformSuno}
+	}
+	var platforms []constant.TaskPlatform
+	for channelType := range constant.ChannelTypeNames {
+		platform := constant.TaskPlatform(strconv.Itoa(channelType))
+		if adaptor := GetTaskAdaptor(platform); adaptor != nil && adaptor.GetChannelName() == name {
+			platforms = append(platforms, platform)
+		}
+	}
+	return platforms
+}
+
+// TaskObjectStatuses 统一任务状态对应的内部任务状态
+func TaskObjectStatuses(status string) []model.TaskStatus {
+	switch status {
+	case dto.TaskObjectStatusQueued:
+		return []model.TaskStatus{model.TaskStatusNotStart, model.TaskStatusSubmitted, model.TaskStatusQueued}
+	case dto.TaskObjectStatusInProgress:
+		return []model.TaskStatus{model.TaskStatusInProgress}
+	case dto.TaskObjectStatusCompleted:
+		return []model.TaskStatus{model.TaskStatusSuccess}
+	case dto.TaskObjectStatusFailed:
+		return []model.TaskStatus{model.TaskStatusFailure}
+	}
+	return nil
+}
+
+// BuildTaskObject 将任务转换为统一任务接口的返回格式
+func BuildTaskObject(task *model.Task) *dto.TaskObject {
+	obj := &dto.TaskObject{
+		ID:          task.TaskID,
+		Object:      "task",
+		Model:       task.Properties.OriginModelName,
+		Platform:    GetTaskPlatformName(task.Platform),
+		Action:      task.Action,
+		Status:      task.Status.ToVideoStatus(),
+		CreatedAt:   task.SubmitTime,
+		CompletedAt: task.FinishTime,
+		Data:        task.Data,
+	}
+	if obj.Model == "" {
+		obj.Model = service.CoverTaskActionToModelName(constant.TaskPlatform(obj.Platform), task.Action)
+	}
+	if task.Status == model.TaskStatusNotStart || task.Status == "" {
+		obj.Status = dto.TaskObjectStatusQueued
+	}
+	if progress, err := strconv.Atoi(strings.TrimSuffix(task.Progress, "%")); err == nil {
+		obj.Progress = progress
+	}
+	switch task.Status {
+	case model.TaskStatusSuccess:
+		obj.Url = task.FailReason
+		if urls := service.GetMediaUrls(task.UserId, model.MediaSourceTask, task.TaskID); len(urls) > 0 {
+			obj.Url = urls[0]
+			obj.MediaUrls = urls
+		}
+	case model.TaskStatusFailure:
+		obj.Error = &dto.TaskObjectError{
+			Code:    "task_failed",
+			Message: task.FailReason,
+		}
+	}
+	return obj
+}
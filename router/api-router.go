@@ -86,6 +86,10 @@ func SetApiRouter(router *gin.Engine) {
 				selfRoute.POST("/creem/pay", middleware.CriticalRateLimit(), controller.RequestCreemPay)
 				selfRoute.POST("/aff_transfer", controller.TransferAffQuota)
 				selfRoute.PUT("/setting", controller.UpdateUserSetting)
+				selfRoute.GET("/usage_report/self", controller.GetSelfUsageReports)
+				selfRoute.GET("/media/self", controller.GetUserMediaAssets)
+				selfRoute.GET("/media/self/usage", controller.GetUserMediaUsage)
+				selfRoute.DELETE("/media/self/:id", controller.DeleteUserMediaAsset)
 
 				// Checkin routes
 				selfRoute.POST("/checkin", controller.DoCheckin)
@@ -106,6 +110,7 @@ func SetApiRouter(router *gin.Engine) {
 				adminRoute.GET("/topup", controller.GetAllTopUps)
 				adminRoute.POST("/topup/complete", controller.AdminCompleteTopUp)
 				adminRoute.GET("/search", controller.SearchUsers)
+				adminRoute.GET("/usage_report", controller.GetSiteUsageReports)
 				adminRoute.GET("/:id", controller.GetUser)
 				adminRoute.POST("/", controller.CreateUser)
 				adminRoute.POST("/manage", controller.ManageUser)
@@ -140,6 +145,7 @@ func SetApiRouter(router *gin.Engine) {
 			channelRoute.GET("/search", controller.SearchChannels)
 			channelRoute.GET("/models", controller.ChannelListModels)
 			channelRoute.GET("/models_enabled", controller.EnabledListModels)
+			channelRoute.GET("/health", controller.GetChannelHealth)
 			channelRoute.GET("/:id", controller.GetChannel)
 			channelRoute.POST("/:id/key", middleware.RootAuth(), middleware.CriticalRateLimit(), middleware.DisableCache(), middleware.SecureVerificationRequired(), controller.GetChannelKey)
 			channelRoute.GET("/test", controller.TestAllChannels)
@@ -201,6 +207,7 @@ func SetApiRouter(router *gin.Engine) {
 		logRoute.GET("/stat", middleware.AdminAuth(), controller.GetLogsStat)
 		logRoute.GET("/self/stat", middleware.UserAuth(), controller.GetLogsSelfStat)
 		logRoute.GET("/search", middleware.AdminAuth(), controller.SearchAllLogs)
+		logRoute.GET("/payload/:request_id", middleware.AdminAuth(), controller.GetPayloadCapture)
 		logRoute.GET("/self", middleware.UserAuth(), controller.GetUserLogs)
 		logRoute.GET("/self/search", middleware.UserAuth(), controller.SearchUserLogs)
 
@@ -235,6 +242,32 @@ func SetApiRouter(router *gin.Engine) {
 		{
 			taskRoute.GET("/self", middleware.UserAuth(), controller.GetUserTask)
 			taskRoute.GET("/", middleware.AdminAuth(), controller.GetAllTask)
+			taskRoute.POST("/callback/:channel_id/:sign", controller.TaskUpstreamCallback)
+		}
+
+		webhookRoute := apiRouter.Group("/webhook")
+		{
+			webhookRoute.GET("/events", middleware.UserAuth(), controller.GetWebhookEventTypes)
+			webhookSelfRoute := webhookRoute.Group("/self")
+			webhookSelfRoute.Use(middleware.UserAuth())
+			{
+				webhookSelfRoute.GET("/", controller.GetSelfWebhooks)
+				webhookSelfRoute.POST("/", controller.AddSelfWebhook)
+				webhookSelfRoute.PUT("/", controller.UpdateSelfWebhook)
+				webhookSelfRoute.DELETE("/:id", controller.DeleteSelfWebhook)
+				webhookSelfRoute.GET("/delivery", controller.GetSelfWebhookDeliveries)
+				webhookSelfRoute.POST("/delivery/:id/redeliver", controller.RedeliverSelfWebhook)
+			}
+			webhookAdminRoute := webhookRoute.Group("/")
+			webhookAdminRoute.Use(middleware.AdminAuth())
+			{
+				webhookAdminRoute.GET("/", controller.GetSystemWebhooks)
+				webhookAdminRoute.POST("/", controller.AddSystemWebhook)
+				webhookAdminRoute.PUT("/", controller.UpdateSystemWebhook)
+				webhookAdminRoute.DELETE("/:id", controller.DeleteSystemWebhook)
+				webhookAdminRoute.GET("/delivery", controller.GetAllWebhookDeliveries)
+				webhookAdminRoute.POST("/delivery/:id/redeliver", controller.RedeliverAnyWebhook)
+			}
 		}
 
 		vendorRoute := apiRouter.Group("/vendors")
@@ -8,6 +8,8 @@ import (
 	"strings"
 
 	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/controller"
+	"github.com/QuantumNous/new-api/middleware"
 
 	"github.com/gin-gonic/gin"
 )
@@ -17,6 +19,11 @@ func SetRouter(router *gin.Engine, buildFS embed.FS, indexPage []byte) {
 	SetDashboardRouter(router)
 	SetRelayRouter(router)
 	SetVideoRouter(router)
+	SetTaskRouter(router)
+	// 单独监听时不在主服务上暴露 /metrics
+	if common.MetricsListenAddr == "" {
+		SetMetricsRouter(router, middleware.MetricsAuth())
+	}
 	frontendBaseUrl := os.Getenv("FRONTEND_BASE_URL")
 	if common.IsMasterNode && frontendBaseUrl != "" {
 		frontendBaseUrl = ""
@@ -31,3 +38,7 @@ func SetRouter(router *gin.Engine, buildFS embed.FS, indexPage []byte) {
 		})
 	}
 }
+
+func SetMetricsRouter(router *gin.Engine, handlers ...gin.HandlerFunc) {
+	router.GET("/metrics", append(handlers, controller.Metrics)...)
+}
@@ -1,6 +1,8 @@
 package router
 
 import (
+	"strings"
+
 	"github.com/QuantumNous/new-api/constant"
 	"github.com/QuantumNous/new-api/controller"
 	"github.com/QuantumNous/new-api/middleware"
@@ -60,6 +62,8 @@ func SetRelayRouter(router *gin.Engine) {
 	{
 		playgroundRouter.POST("/chat/completions", controller.Playground)
 	}
+	// 保存的生成结果，通过签名校验访问，不需要令牌
+	router.GET("/v1/media/:id", controller.GetMedia)
 	relayV1Router := router.Group("/v1")
 	relayV1Router.Use(middleware.TokenAuth())
 	relayV1Router.Use(middleware.ModelRequestRateLimit())
@@ -71,6 +75,25 @@ func SetRelayRouter(router *gin.Engine) {
 			controller.Relay(c, types.RelayFormatOpenAIRealtime)
 		})
 	}
+	{
+		// files & batches，不需要按模型分发渠道
+		fileRouter := relayV1Router.Group("")
+		fileRouter.GET("/files", controller.ListFiles)
+		fileRouter.POST("/files", controller.UploadFile)
+		fileRouter.DELETE("/files/:id", controller.DeleteFile)
+		fileRouter.GET("/files/:id", controller.GetFile)
+		fileRouter.GET("/files/:id/content", controller.GetFileContent)
+		fileRouter.POST("/batches", controller.CreateBatch)
+		fileRouter.GET("/batches", controller.ListBatches)
+		fileRouter.GET("/batches/:id", controller.GetBatch)
+		fileRouter.POST("/batches/:id/cancel", controller.CancelBatch)
+	}
+	{
+		// 网关保存的 Responses API 响应，不需要按模型分发渠道
+		responsesRouter := relayV1Router.Group("")
+		responsesRouter.GET("/responses/:id", controller.GetResponse)
+		responsesRouter.DELETE("/responses/:id", controller.DeleteResponse)
+	}
 	{
 		//http router
 		httpRouter := relayV1Router.Group("")
@@ -80,6 +103,9 @@ func SetRelayRouter(router *gin.Engine) {
 		httpRouter.POST("/messages", func(c *gin.Context) {
 			controller.Relay(c, types.RelayFormatClaude)
 		})
+		httpRouter.POST("/messages/count_tokens", func(c *gin.Context) {
+			controller.RelayCountTokens(c, types.RelayFormatClaude)
+		})
 
 		// chat related routes
 		httpRouter.POST("/completions", func(c *gin.Context) {
@@ -130,9 +156,7 @@ func SetRelayRouter(router *gin.Engine) {
 		httpRouter.POST("/engines/:model/embeddings", func(c *gin.Context) {
 			controller.Relay(c, types.RelayFormatGemini)
 		})
-		httpRouter.POST("/models/*path", func(c *gin.Context) {
-			controller.Relay(c, types.RelayFormatGemini)
-		})
+		httpRouter.POST("/models/*path", relayGemini)
 
 		// other relay routes
 		httpRouter.POST("/moderations", func(c *gin.Context) {
@@ -141,11 +165,6 @@ func SetRelayRouter(router *gin.Engine) {
 
 		// not implemented
 		httpRouter.POST("/images/variations", controller.RelayNotImplemented)
-		httpRouter.GET("/files", controller.RelayNotImplemented)
-		httpRouter.POST("/files", controller.RelayNotImplemented)
-		httpRouter.DELETE("/files/:id", controller.RelayNotImplemented)
-		httpRouter.GET("/files/:id", controller.RelayNotImplemented)
-		httpRouter.GET("/files/:id/content", controller.RelayNotImplemented)
 		httpRouter.POST("/fine-tunes", controller.RelayNotImplemented)
 		httpRouter.GET("/fine-tunes", controller.RelayNotImplemented)
 		httpRouter.GET("/fine-tunes/:id", controller.RelayNotImplemented)
@@ -175,10 +194,17 @@ func SetRelayRouter(router *gin.Engine) {
 	relayGeminiRouter.Use(middleware.Distribute())
 	{
 		// Gemini API 路径格式: /v1beta/models/{model_name}:{action}
-		relayGeminiRouter.POST("/models/*path", func(c *gin.Context) {
-			controller.Relay(c, types.RelayFormatGemini)
-		})
+		relayGeminiRouter.POST("/models/*path", relayGemini)
+	}
+}
+
+// relayGemini 按 Gemini 路径中的 action 分发，countTokens 仅计数不扣费
+func relayGemini(c *gin.Context) {
+	if strings.HasSuffix(c.Request.URL.Path, ":countTokens") {
+		controller.RelayCountTokens(c, types.RelayFormatGemini)
+		return
 	}
+	controller.Relay(c, types.RelayFormatGemini)
 }
 
 func registerMjRouterGroup(relayMjRouter *gin.RouterGroup) {
@@ -0,0 +1,20 @@
+package router
+
+import (
+	"github.com/QuantumNous/new-api/controller"
+	"github.com/QuantumNous/new-api/middleware"
+
+	"github.com/gin-gonic/gin"
+)
+
+// SetTaskRouter 统一异步任务接口，Suno、Midjourney 与视频平台的任务使用相同的提交、查询与取消方式
+func SetTaskRouter(router *gin.Engine) {
+	taskV1Router := router.Group("/v1/tasks")
+	taskV1Router.Use(middleware.TokenAuth())
+	{
+		taskV1Router.GET("", controller.ListTasks)
+		taskV1Router.GET("/:task_id", controller.GetTask)
+		taskV1Router.POST("/:task_id/cancel", controller.CancelTask)
+		taskV1Router.POST("", middleware.Distribute(), controller.SubmitTask)
+	}
+}
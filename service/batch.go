@@ -0,0 +1,532 @@
+package service
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/dto"
+	"github.com/QuantumNous/new-api/model"
+	"github.com/QuantumNous/new-api/service/storage"
+	"github.com/QuantumNous/new-api/setting/operation_setting"
+
+	"github.com/bytedance/gopkg/util/gopool"
+)
+
+// SupportedBatchEndpoints 批处理支持的接口，与 OpenAI Batch API 保持一致
+var SupportedBatchEndpoints = map[string]bool{
+	"/v1/chat/completions": true,
+	"/v1/completions":      true,
+	"/v1/embeddings":       true,
+	"/v1/responses":        true,
+}
+
+// 单行输入的最大长度
+const batchMaxLineBytes = 16 << 20
+
+// 单个批处理任务的请求数上限，与 OpenAI Batch API 一致
+const batchMaxRequests = 50000
+
+// 输入文件校验失败时最多返回的错误数
+const batchMaxValidationErrors = 100
+
+var batchRelayHandler http.Handler
+
+var runningBatchCount int32
+
+// SetBatchRelayHandler 设置执行批处理请求使用的 HTTP 处理器（主路由），
+// 使每一行请求都经过鉴权、渠道分发、计费与日志等完整的转发流程
+func SetBatchRelayHandler(handler http.Handler) {
+	batchRelayHandler = handler
+}
+
+// FileStorageKey 文件在存储后端中的路径
+func FileStorageKey(userId int, fileId string) string {
+	return fmt.Sprintf("%d/%s", userId, fileId)
+}
+
+// StartBatchWorker 定期领取待执行的批处理任务
+func StartBatchWorker() {
+	for {
+		time.Sleep(5 * time.Second)
+		dispatchBatches()
+	}
+}
+
+func dispatchBatches() {
+	setting := operation_setting.GetBatchSetting()
+	free := setting.MaxRunningBatches - int(atomic.LoadInt32(&runningBatchCount))
+	if free <= 0 || batchRelayHandler == nil {
+		return
+	}
+	staleBefore := common.GetTimestamp() - int64(setting.HeartbeatTimeoutSeconds)
+	batches, err := model.GetPendingBatches(staleBefore, free)
+	if err != nil {
+		common.SysError("failed to get pending batches: " + err.Error())
+		return
+	}
+	for _, batch := range batches {
+		ok, err := model.ClaimBatch(batch.Id, batch.Status, staleBefore)
+		if err != nil || !ok {
+			continue
+		}
+		atomic.AddInt32(&runningBatchCount, 1)
+		gopool.Go(func() {
+			defer atomic.AddInt32(&runningBatchCount, -1)
+			runBatch(batch)
+		})
+	}
+}
+
+func failBatch(batch *model.Batch, errs []dto.BatchError) {
+	data, _ := common.Marshal(dto.BatchErrors{Object: "list", Data: errs})
+	err := model.UpdateBatchFields(batch.Id, map[string]interface{}{
+		"status":    model.BatchStatusFailed,
+		"errors":    string(data),
+		"failed_at": common.GetTimestamp(),
+	})
+	if err != nil {
+		common.SysError(fmt.Sprintf("failed to update batch %s: %s", batch.Id, err.Error()))
+	}
+}
+
+func cancelBatchDirectly(batch *model.Batch) {
+	err := model.UpdateBatchFields(batch.Id, map[string]interface{}{
+		"status":       model.BatchStatusCancelled,
+		"cancelled_at": common.GetTimestamp(),
+	})
+	if err != nil {
+		common.SysError(fmt.Sprintf("failed to update batch %s: %s", batch.Id, err.Error()))
+	}
+}
+
+func runBatch(batch *model.Batch) {
+	switch batch.Status {
+	case model.BatchStatusCancelling:
+		// 尚未开始或执行节点已退出
+		cancelBatchDirectly(batch)
+		return
+	case model.BatchStatusInProgress, model.BatchStatusFinalizing:
+		// 执行节点中断，已执行的请求已计费，重新执行会重复计费，因此直接标记失败
+		failBatch(batch, []dto.BatchError{{Code: "batch_interrupted", Message: "batch processing was interrupted"}})
+		return
+	}
+
+	total, validationErrors, err := validateBatchInput(batch)
+	if err != nil {
+		failBatch(batch, []dto.BatchError{{Code: "invalid_input_file", Message: err.Error()}})
+		return
+	}
+	if len(validationErrors) > 0 {
+		failBatch(batch, validationErrors)
+		return
+	}
+	token, err := model.GetTokenByIds(batch.TokenId, batch.UserId)
+	if err != nil {
+		failBatch(batch, []dto.BatchError{{Code: "invalid_token", Message: "the token used to create this batch is no longer available"}})
+		return
+	}
+
+	ok, err := model.TransitBatchStatus(batch.Id, model.BatchStatusValidating, map[string]interface{}{
+		"status":         model.BatchStatusInProgress,
+		"in_progress_at": common.GetTimestamp(),
+		"total_count":    total,
+	})
+	if err != nil {
+		common.SysError(fmt.Sprintf("failed to update batch %s: %s", batch.Id, err.Error()))
+		return
+	}
+	if !ok {
+		// 验证期间被取消
+		cancelBatchDirectly(batch)
+		return
+	}
+
+	executeBatch(batch, token)
+}
+
+// getBatchMaxRequests 单个批处理任务的最大请求数，未配置或超过上限时使用上限
+func getBatchMaxRequests() int {
+	maxRequests := operation_setting.GetBatchSetting().MaxRequests
+	if maxRequests <= 0 || maxRequests > batchMaxRequests {
+		return batchMaxRequests
+	}
+	return maxRequests
+}
+
+// scanBatchInput 逐行读取输入文件，跳过空行，fn 返回 false 时停止读取
+func scanBatchInput(batch *model.Batch, fn func(lineNo int, raw []byte) bool) error {
+	file, err := model.GetFileById(batch.InputFileId, batch.UserId)
+	if err != nil {
+		return fmt.Errorf("input file %s not found", batch.InputFileId)
+	}
+	store, err := storage.Get()
+	if err != nil {
+		return err
+	}
+	reader, err := store.Open(file.StorageKey)
+	if err != nil {
+		return fmt.Errorf("failed to open input file: %w", err)
+	}
+	defer reader.Close()
+
+	scanner := bufio.NewScanner(reader)
+	scanner.Buffer(make([]byte, 64*1024), batchMaxLineBytes)
+	lineNo := 0
+	for scanner.Scan() {
+		lineNo++
+		raw := bytes.TrimSpace(scanner.Bytes())
+		if len(raw) == 0 {
+			continue
+		}
+		if !fn(lineNo, raw) {
+			return nil
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return fmt.Errorf("failed to read input file: %w", err)
+	}
+	return nil
+}
+
+// validateBatchInput 校验输入文件的每一行，返回请求数，不在内存中保留请求内容
+func validateBatchInput(batch *model.Batch) (int, []dto.BatchError, error) {
+	maxRequests := getBatchMaxRequests()
+	var errs []dto.BatchError
+	customIds := make(map[string]bool)
+	addError := func(lineNo int, code string, message string) {
+		if len(errs) < batchMaxValidationErrors {
+			n := lineNo
+			errs = append(errs, dto.BatchError{Code: code, Message: message, Line: &n})
+		}
+	}
+
+	total := 0
+	exceeded := false
+	err := scanBatchInput(batch, func(lineNo int, raw []byte) bool {
+		// 无效的行同样计入上限，避免读取过大的文件
+		total++
+		if total > maxRequests {
+			exceeded = true
+			return false
+		}
+		var line dto.BatchRequestLine
+		if err := common.Unmarshal(raw, &line); err != nil {
+			addError(lineNo, "invalid_json_line", "this line is not parseable as valid JSON")
+			return true
+		}
+		if line.CustomId == "" {
+			addError(lineNo, "missing_required_parameter", "custom_id is required")
+			return true
+		}
+		if customIds[line.CustomId] {
+			addError(lineNo, "duplicate_custom_id", fmt.Sprintf("the custom_id %s is duplicated", line.CustomId))
+			return true
+		}
+		customIds[line.CustomId] = true
+		if !strings.EqualFold(line.Method, http.MethodPost) {
+			addError(lineNo, "invalid_method", "only POST method is supported")
+			return true
+		}
+		if line.Url != batch.Endpoint {
+			addError(lineNo, "mismatched_endpoint", fmt.Sprintf("the url %s does not match the batch endpoint %s", line.Url, batch.Endpoint))
+			return true
+		}
+		var body struct {
+			Model  string `json:"model"`
+			Stream bool   `json:"stream"`
+		}
+		if err := common.Unmarshal(line.Body, &body); err != nil {
+			addError(lineNo, "invalid_request", "body must be a JSON object")
+			return true
+		}
+		if body.Model == "" {
+			addError(lineNo, "missing_required_parameter", "body.model is required")
+			return true
+		}
+		if body.Stream {
+			addError(lineNo, "invalid_request", "streaming is not supported in batch requests")
+		}
+		return true
+	})
+	if err != nil {
+		return 0, nil, err
+	}
+	if exceeded {
+		return 0, nil, fmt.Errorf("batch input file exceeds the maximum of %d requests", maxRequests)
+	}
+	if total == 0 {
+		return 0, nil, errors.New("input file is empty")
+	}
+	return total, errs, nil
+}
+
+// executeBatch 再次逐行读取输入文件，以有限并发执行请求，结果按完成顺序写入输出与错误文件
+func executeBatch(batch *model.Batch, token *model.Token) {
+	concurrency := operation_setting.GetBatchSetting().Concurrency
+	if concurrency <= 0 {
+		concurrency = 1
+	}
+	outputFile := newBatchResultFile(batch, "output")
+	errorFile := newBatchResultFile(batch, "error")
+	var completed, failed int32
+	var cancelled, expired atomic.Bool
+	ctx, stop := context.WithCancel(context.Background())
+	defer stop()
+
+	// 心跳、进度与取消检查
+	done := make(chan struct{})
+	go func() {
+		ticker := time.NewTicker(10 * time.Second)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-done:
+				return
+			case <-ticker.C:
+			}
+			_ = model.UpdateBatchFields(batch.Id, map[string]interface{}{
+				"heartbeat_at":    common.GetTimestamp(),
+				"completed_count": atomic.LoadInt32(&completed),
+				"failed_count":    atomic.LoadInt32(&failed),
+			})
+			if status, err := model.GetBatchStatus(batch.Id); err == nil && status == model.BatchStatusCancelling {
+				cancelled.Store(true)
+				stop()
+			}
+			if batch.ExpiresAt > 0 && common.GetTimestamp() > batch.ExpiresAt {
+				expired.Store(true)
+				stop()
+			}
+		}
+	}()
+
+	sem := make(chan struct{}, concurrency)
+	var wg sync.WaitGroup
+	err := scanBatchInput(batch, func(lineNo int, raw []byte) bool {
+		// 扫描缓冲区会被复用，请求异步执行，需要复制
+		var line dto.BatchRequestLine
+		if err := common.Unmarshal(bytes.Clone(raw), &line); err != nil {
+			return true
+		}
+		if ctx.Err() == nil {
+			select {
+			case <-ctx.Done():
+			case sem <- struct{}{}:
+			}
+		}
+		if ctx.Err() != nil {
+			if !expired.Load() {
+				return false
+			}
+			// 过期后未执行的请求写入错误文件
+			errorFile.write(&dto.BatchResponseLine{
+				Id:       "batch_req_" + common.GetRandomString(24),
+				CustomId: line.CustomId,
+				Error:    &dto.BatchError{Code: "batch_expired", Message: "this request could not be executed before the completion window expired"},
+			})
+			atomic.AddInt32(&failed, 1)
+			return true
+		}
+		wg.Add(1)
+		gopool.Go(func() {
+			defer wg.Done()
+			defer func() { <-sem }()
+			// 已发出的请求不随取消中断，保证计费与结果一致
+			result := executeBatchLine(batch, token, &line)
+			if result.Error == nil && result.Response != nil && result.Response.StatusCode < http.StatusBadRequest {
+				outputFile.write(result)
+				atomic.AddInt32(&completed, 1)
+			} else {
+				errorFile.write(result)
+				atomic.AddInt32(&failed, 1)
+			}
+		})
+		return true
+	})
+	wg.Wait()
+	close(done)
+	if err != nil {
+		common.SysError(fmt.Sprintf("failed to read input file of batch %s: %s", batch.Id, err.Error()))
+	}
+	finalizeBatch(batch, outputFile, errorFile, int(atomic.LoadInt32(&completed)), int(atomic.LoadInt32(&failed)), cancelled.Load(), expired.Load())
+}
+
+func executeBatchLine(batch *model.Batch, token *model.Token, line *dto.BatchRequestLine) (result *dto.BatchResponseLine) {
+	result = &dto.BatchResponseLine{
+		Id:       "batch_req_" + common.GetRandomString(24),
+		CustomId: line.CustomId,
+	}
+	defer func() {
+		if r := recover(); r != nil {
+			common.SysError(fmt.Sprintf("panic in batch %s line %s: %v", batch.Id, line.CustomId, r))
+			result.Response = nil
+			result.Error = &dto.BatchError{Code: "internal_error", Message: "internal error while processing request"}
+		}
+	}()
+
+	req, err := http.NewRequest(http.MethodPost, line.Url, bytes.NewReader(line.Body))
+	if err != nil {
+		result.Error = &dto.BatchError{Code: "invalid_request", Message: err.Error()}
+		return result
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Authorization", "Bearer sk-"+token.Key)
+	// 保留提交者的 IP，使令牌的 IP 白名单依然生效
+	clientIp := batch.ClientIp
+	if clientIp == "" {
+		clientIp = "127.0.0.1"
+	}
+	req.RemoteAddr = net.JoinHostPort(clientIp, "0")
+
+	recorder := httptest.NewRecorder()
+	batchRelayHandler.ServeHTTP(recorder, req)
+
+	body := recorder.Body.Bytes()
+	if !json.Valid(body) {
+		body, _ = common.Marshal(string(body))
+	}
+	result.Response = &dto.BatchResponseBody{
+		StatusCode: recorder.Code,
+		RequestId:  recorder.Header().Get(common.RequestIdKey),
+		Body:       body,
+	}
+	return result
+}
+
+func finalizeBatch(batch *model.Batch, outputFile *batchResultFile, errorFile *batchResultFile, completed int, failed int, cancelled bool, expired bool) {
+	_, _ = model.TransitBatchStatus(batch.Id, model.BatchStatusInProgress, map[string]interface{}{
+		"status":        model.BatchStatusFinalizing,
+		"finalizing_at": common.GetTimestamp(),
+	})
+
+	fields := map[string]interface{}{
+		"completed_count": completed,
+		"failed_count":    failed,
+		"heartbeat_at":    common.GetTimestamp(),
+	}
+	if fileId, err := outputFile.close(); err != nil {
+		common.SysError(fmt.Sprintf("failed to save output file of batch %s: %s", batch.Id, err.Error()))
+	} else {
+		fields["output_file_id"] = fileId
+	}
+	if fileId, err := errorFile.close(); err != nil {
+		common.SysError(fmt.Sprintf("failed to save error file of batch %s: %s", batch.Id, err.Error()))
+	} else {
+		fields["error_file_id"] = fileId
+	}
+
+	now := common.GetTimestamp()
+	switch {
+	case cancelled:
+		fields["status"] = model.BatchStatusCancelled
+		fields["cancelled_at"] = now
+	case expired:
+		fields["status"] = model.BatchStatusExpired
+		fields["expired_at"] = now
+	default:
+		fields["status"] = model.BatchStatusCompleted
+		fields["completed_at"] = now
+	}
+	if err := model.UpdateBatchFields(batch.Id, fields); err != nil {
+		common.SysError(fmt.Sprintf("failed to update batch %s: %s", batch.Id, err.Error()))
+	}
+}
+
+// batchResultFile 将结果逐行写入存储后端，写入第一行时才创建文件，没有结果时不生成文件
+type batchResultFile struct {
+	batch  *model.Batch
+	kind   string
+	mu     sync.Mutex
+	file   *model.File
+	writer *io.PipeWriter
+	saved  chan error
+	err    error
+}
+
+func newBatchResultFile(batch *model.Batch, kind string) *batchResultFile {
+	return &batchResultFile{batch: batch, kind: kind}
+}
+
+func (f *batchResultFile) write(line *dto.BatchResponseLine) {
+	data, err := common.Marshal(line)
+	if err != nil {
+		common.SysError(fmt.Sprintf("failed to marshal result of batch %s line %s: %s", f.batch.Id, line.CustomId, err.Error()))
+		return
+	}
+	data = append(data, '\n')
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.err != nil {
+		return
+	}
+	if f.writer == nil {
+		f.open()
+	}
+	if _, err := f.writer.Write(data); err != nil {
+		f.err = err
+	}
+}
+
+// open 需持有 f.mu
+func (f *batchResultFile) open() {
+	f.file = &model.File{
+		Id:       model.NewFileId(),
+		UserId:   f.batch.UserId,
+		Purpose:  model.FilePurposeBatchOutput,
+		Filename: fmt.Sprintf("%s_%s.jsonl", f.batch.Id, f.kind),
+		Status:   model.FileStatusProcessed,
+	}
+	f.file.StorageKey = FileStorageKey(f.batch.UserId, f.file.Id)
+	reader, writer := io.Pipe()
+	f.writer = writer
+	f.saved = make(chan error, 1)
+	go func() {
+		n, err := SaveFile(f.file.StorageKey, reader)
+		// 保存失败时让后续写入立即返回错误
+		_ = reader.CloseWithError(err)
+		f.file.Bytes = n
+		f.saved <- err
+	}()
+}
+
+// close 结束写入并记录文件，返回文件 id
+func (f *batchResultFile) close() (string, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.writer == nil {
+		return "", f.err
+	}
+	_ = f.writer.Close()
+	if err := <-f.saved; err != nil {
+		return "", err
+	}
+	if f.err != nil {
+		return "", f.err
+	}
+	if err := f.file.Insert(); err != nil {
+		return "", err
+	}
+	return f.file.Id, nil
+}
+
+// SaveFile 保存文件到当前配置的存储后端
+func SaveFile(key string, reader io.Reader) (int64, error) {
+	store, err := storage.Get()
+	if err != nil {
+		return 0, err
+	}
+	return store.Save(key, reader)
+}
@@ -6,6 +6,7 @@ import (
 	"strings"
 
 	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/common/event"
 	"github.com/QuantumNous/new-api/constant"
 	"github.com/QuantumNous/new-api/dto"
 	"github.com/QuantumNous/new-api/model"
@@ -32,6 +33,24 @@ func DisableChannel(channelError types.ChannelError, reason string) {
 		subject := fmt.Sprintf("通道「%s」（#%d）已被禁用", channelError.ChannelName, channelError.ChannelId)
 		content := fmt.Sprintf("通道「%s」（#%d）已被禁用，原因：%s", channelError.ChannelName, channelError.ChannelId, reason)
 		NotifyRootUser(formatNotifyType(channelError.ChannelId, common.ChannelStatusAutoDisabled), subject, content)
+		publishChannelDisabled(channelError, reason)
+	}
+}
+
+// publishChannelDisabled 多 Key 渠道每次禁用一个 Key，所有 Key 都被禁用时渠道本身才被禁用
+func publishChannelDisabled(channelError types.ChannelError, reason string) {
+	data := event.ChannelData{
+		ChannelId:   channelError.ChannelId,
+		ChannelName: channelError.ChannelName,
+		Reason:      reason,
+	}
+	if !channelError.IsMultiKey {
+		event.Publish(event.ChannelDisabled, 0, data)
+		return
+	}
+	event.Publish(event.ChannelKeyExhausted, 0, data)
+	if channel, err := model.GetChannelById(channelError.ChannelId, false); err == nil && channel.Status != common.ChannelStatusEnabled {
+		event.Publish(event.ChannelDisabled, 0, data)
 	}
 }
 
@@ -41,6 +60,7 @@ func EnableChannel(channelId int, usingKey string, channelName string) {
 		subject := fmt.Sprintf("通道「%s」（#%d）已被启用", channelName, channelId)
 		content := fmt.Sprintf("通道「%s」（#%d）已被启用", channelName, channelId)
 		NotifyRootUser(formatNotifyType(channelId, common.ChannelStatusEnabled), subject, content)
+		event.Publish(event.ChannelEnabled, 0, event.ChannelData{ChannelId: channelId, ChannelName: channelName})
 	}
 }
 
@@ -0,0 +1,48 @@
+package service
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/QuantumNous/new-api/model"
+	"github.com/QuantumNous/new-api/types"
+)
+
+// IsChannelHealthFailure 判断错误是否应计入渠道健康统计
+// 只有上游故障（5xx、429、超时、渠道错误）才计入，客户端请求错误不影响渠道评分
+func IsChannelHealthFailure(err *types.NewAPIError) bool {
+	if err == nil {
+		return false
+	}
+	// 熔断拒绝是本地行为，不能再反过来计入失败
+	if err.GetErrorCode() == types.ErrorCodeChannelCircuitOpen {
+		return false
+	}
+	if types.IsChannelError(err) {
+		return true
+	}
+	switch err.GetErrorCode() {
+	case types.ErrorCodeDoRequestFailed, types.ErrorCodeBadResponse, types.ErrorCodeBadResponseBody,
+		types.ErrorCodeReadResponseBodyFailed, types.ErrorCodeEmptyResponse, types.ErrorCodeAwsInvokeError:
+		return true
+	}
+	if err.StatusCode == http.StatusTooManyRequests || err.StatusCode == http.StatusRequestTimeout {
+		return true
+	}
+	return err.StatusCode/100 == 5
+}
+
+// RecordChannelSuccess 记录渠道请求成功及首字延迟
+func RecordChannelSuccess(channelId int, keyIndex int, firstResponseLatency time.Duration) {
+	model.RecordChannelHealth(channelId, keyIndex, true, firstResponseLatency, false)
+	model.RecordChannelBreakerResult(channelId, keyIndex, true)
+}
+
+// RecordChannelFailure 记录渠道请求失败，keyIndex < 0 表示非多 Key 渠道
+func RecordChannelFailure(channelId int, keyIndex int, err *types.NewAPIError) {
+	if !IsChannelHealthFailure(err) {
+		return
+	}
+	model.RecordChannelHealth(channelId, keyIndex, false, 0, err.StatusCode == http.StatusTooManyRequests)
+	model.RecordChannelBreakerResult(channelId, keyIndex, false)
+}
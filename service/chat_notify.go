@@ -0,0 +1,240 @@
+package service
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"html"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/dto"
+	"github.com/QuantumNous/new-api/setting/system_setting"
+)
+
+// renderNotifyContent 替换通知内容中的占位符
+func renderNotifyContent(data dto.Notify) string {
+	content := data.Content
+	for _, value := range data.Values {
+		content = strings.Replace(content, dto.ContentValueParam, fmt.Sprintf("%v", value), 1)
+	}
+	return content
+}
+
+// postNotifyJSON 以 JSON 形式发送通知请求并返回响应体，启用 Worker 时通过 Worker 转发
+func postNotifyJSON(finalURL string, payload any) ([]byte, error) {
+	payloadBytes, err := json.Marshal(payload)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal notify payload: %v", err)
+	}
+
+	var resp *http.Response
+	if system_setting.EnableWorker() {
+		workerReq := &WorkerRequest{
+			URL:    finalURL,
+			Key:    system_setting.WorkerValidKey,
+			Method: http.MethodPost,
+			Headers: map[string]string{
+				"Content-Type": "application/json; charset=utf-8",
+				"User-Agent":   "NewAPI-Notify/1.0",
+			},
+			Body: payloadBytes,
+		}
+		resp, err = DoWorkerRequest(workerReq)
+		if err != nil {
+			return nil, fmt.Errorf("failed to send notify request through worker: %s", redactNotifyURL(err, finalURL))
+		}
+	} else {
+		// SSRF防护：验证通知地址（非Worker模式）
+		fetchSetting := system_setting.GetFetchSetting()
+		if err := common.ValidateURLWithFetchSetting(finalURL, fetchSetting.EnableSSRFProtection, fetchSetting.AllowPrivateIp, fetchSetting.DomainFilterMode, fetchSetting.IpFilterMode, fetchSetting.DomainList, fetchSetting.IpList, fetchSetting.AllowedPorts, fetchSetting.ApplyIPFilterForDomain); err != nil {
+			return nil, fmt.Errorf("request reject: %s", redactNotifyURL(err, finalURL))
+		}
+		req, err := http.NewRequest(http.MethodPost, finalURL, bytes.NewBuffer(payloadBytes))
+		if err != nil {
+			return nil, fmt.Errorf("failed to create notify request: %s", redactNotifyURL(err, finalURL))
+		}
+		req.Header.Set("Content-Type", "application/json; charset=utf-8")
+		req.Header.Set("User-Agent", "NewAPI-Notify/1.0")
+		resp, err = GetHttpClient().Do(req)
+		if err != nil {
+			return nil, fmt.Errorf("failed to send notify request: %s", redactNotifyURL(err, finalURL))
+		}
+	}
+	defer resp.Body.Close()
+
+	body, _ := io.ReadAll(io.LimitReader(resp.Body, 64<<10))
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return body, fmt.Errorf("notify request failed with status code: %d", resp.StatusCode)
+	}
+	return body, nil
+}
+
+// redactNotifyURL 通知地址中含有机器人 token、access_token 或签名，错误信息中去掉请求地址，只保留协议与域名
+func redactNotifyURL(err error, finalURL string) string {
+	var urlErr *url.Error
+	if errors.As(err, &urlErr) {
+		err = urlErr.Err
+	}
+	replacement := "***"
+	if u, parseErr := url.Parse(finalURL); parseErr == nil && u.Host != "" {
+		replacement = u.Scheme + "://" + u.Host + "/***"
+	}
+	return strings.ReplaceAll(err.Error(), finalURL, replacement)
+}
+
+// checkRobotResponse 钉钉、企业微信（errcode）与飞书（code）在 HTTP 200 时通过响应体返回错误
+func checkRobotResponse(name string, body []byte) error {
+	var result struct {
+		ErrCode *int   `json:"errcode"`
+		ErrMsg  string `json:"errmsg"`
+		Code    *int   `json:"code"`
+		Msg     string `json:"msg"`
+	}
+	if len(body) == 0 || json.Unmarshal(body, &result) != nil {
+		return nil
+	}
+	if result.ErrCode != nil && *result.ErrCode != 0 {
+		return fmt.Errorf("%s notify failed: %d %s", name, *result.ErrCode, result.ErrMsg)
+	}
+	if result.Code != nil && *result.Code != 0 {
+		return fmt.Errorf("%s notify failed: %d %s", name, *result.Code, result.Msg)
+	}
+	return nil
+}
+
+func sendSlackNotify(webhookURL string, data dto.Notify) error {
+	content := renderNotifyContent(data)
+	payload := map[string]any{
+		// text 用于通知预览及不支持 blocks 的客户端
+		"text": data.Title + "\n" + content,
+		"blocks": []map[string]any{
+			{
+				"type": "header",
+				"text": map[string]any{"type": "plain_text", "text": data.Title},
+			},
+			{
+				"type": "section",
+				"text": map[string]any{"type": "mrkdwn", "text": content},
+			},
+			{
+				"type": "context",
+				"elements": []map[string]any{
+					{"type": "mrkdwn", "text": fmt.Sprintf("%s · %s", common.SystemName, time.Now().Format("2006-01-02 15:04:05"))},
+				},
+			},
+		},
+	}
+	_, err := postNotifyJSON(webhookURL, payload)
+	return err
+}
+
+// sendTelegramNotify 使用 Telegram 登录所配置的机器人发送消息，用户需先与机器人开始会话
+func sendTelegramNotify(chatId string, data dto.Notify) error {
+	if common.TelegramBotToken == "" {
+		return fmt.Errorf("telegram bot token is not configured")
+	}
+	content := renderNotifyContent(data)
+	payload := map[string]any{
+		"chat_id":                  chatId,
+		"text":                     fmt.Sprintf("<b>%s</b>\n\n%s", html.EscapeString(data.Title), html.EscapeString(content)),
+		"parse_mode":               "HTML",
+		"disable_web_page_preview": true,
+	}
+	finalURL := fmt.Sprintf("https://api.telegram.org/bot%s/sendMessage", common.TelegramBotToken)
+	body, err := postNotifyJSON(finalURL, payload)
+	if err != nil {
+		var result struct {
+			Description string `json:"description"`
+		}
+		if json.Unmarshal(body, &result) == nil && result.Description != "" {
+			return fmt.Errorf("telegram notify failed: %s", result.Description)
+		}
+		return err
+	}
+	return nil
+}
+
+// sendDingtalkNotify 钉钉自定义机器人，配置了加签密钥时在 URL 上附加 timestamp 与 sign
+func sendDingtalkNotify(webhookURL string, secret string, data dto.Notify) error {
+	finalURL := webhookURL
+	if secret != "" {
+		timestamp := strconv.FormatInt(time.Now().UnixMilli(), 10)
+		h := hmac.New(sha256.New, []byte(secret))
+		h.Write([]byte(timestamp + "\n" + secret))
+		sign := base64.StdEncoding.EncodeToString(h.Sum(nil))
+		separator := "?"
+		if strings.Contains(finalURL, "?") {
+			separator = "&"
+		}
+		finalURL += separator + "timestamp=" + timestamp + "&sign=" + url.QueryEscape(sign)
+	}
+	payload := map[string]any{
+		"msgtype": "markdown",
+		"markdown": map[string]any{
+			"title": data.Title,
+			"text":  fmt.Sprintf("### %s\n\n%s", data.Title, renderNotifyContent(data)),
+		},
+	}
+	body, err := postNotifyJSON(finalURL, payload)
+	if err != nil {
+		return err
+	}
+	return checkRobotResponse("dingtalk", body)
+}
+
+// sendFeishuNotify 飞书自定义机器人，配置了签名校验时在请求体中附加 timestamp 与 sign
+func sendFeishuNotify(webhookURL string, secret string, data dto.Notify) error {
+	template := "blue"
+	if strings.HasPrefix(data.Type, dto.NotifyTypeQuotaExceed) {
+		template = "orange"
+	}
+	payload := map[string]any{
+		"msg_type": "interactive",
+		"card": map[string]any{
+			"header": map[string]any{
+				"title":    map[string]any{"tag": "plain_text", "content": data.Title},
+				"template": template,
+			},
+			"elements": []map[string]any{
+				{"tag": "markdown", "content": renderNotifyContent(data)},
+			},
+		},
+	}
+	if secret != "" {
+		timestamp := strconv.FormatInt(time.Now().Unix(), 10)
+		// 飞书以 timestamp + "\n" + secret 作为密钥对空消息签名
+		h := hmac.New(sha256.New, []byte(timestamp+"\n"+secret))
+		payload["timestamp"] = timestamp
+		payload["sign"] = base64.StdEncoding.EncodeToString(h.Sum(nil))
+	}
+	body, err := postNotifyJSON(webhookURL, payload)
+	if err != nil {
+		return err
+	}
+	return checkRobotResponse("feishu", body)
+}
+
+// sendWecomNotify 企业微信群机器人
+func sendWecomNotify(webhookURL string, data dto.Notify) error {
+	payload := map[string]any{
+		"msgtype": "markdown",
+		"markdown": map[string]any{
+			"content": fmt.Sprintf("### %s\n%s", data.Title, renderNotifyContent(data)),
+		},
+	}
+	body, err := postNotifyJSON(webhookURL, payload)
+	if err != nil {
+		return err
+	}
+	return checkRobotResponse("wecom", body)
+}
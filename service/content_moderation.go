@@ -0,0 +1,122 @@
+package service
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/model"
+	"github.com/QuantumNous/new-api/setting/operation_setting"
+
+	"github.com/gin-gonic/gin"
+)
+
+type moderationResponse struct {
+	Results []struct {
+		Flagged    bool            `json:"flagged"`
+		Categories map[string]bool `json:"categories"`
+	} `json:"results"`
+}
+
+// moderateContent 调用配置的渠道的 /v1/moderations 接口审核请求内容，未命中时返回 nil
+func moderateContent(c *gin.Context, texts []string, images []string) ([]string, error) {
+	moderation := operation_setting.GetContentPolicySetting().Moderation
+	text := strings.Join(texts, "\n")
+	if strings.TrimSpace(text) == "" && len(images) == 0 {
+		return nil, nil
+	}
+	channel, err := model.CacheGetChannel(moderation.ChannelId)
+	if err != nil {
+		return nil, fmt.Errorf("get moderation channel #%d failed: %w", moderation.ChannelId, err)
+	}
+	key, _, apiErr := channel.GetNextEnabledKey()
+	if apiErr != nil {
+		return nil, fmt.Errorf("get moderation channel key failed: %w", apiErr.Err)
+	}
+
+	// 没有图片时使用纯文本输入，兼容仅支持文本的审核接口
+	var input any = text
+	if len(images) > 0 {
+		parts := make([]map[string]any, 0, len(images)+1)
+		if strings.TrimSpace(text) != "" {
+			parts = append(parts, map[string]any{"type": "text", "text": text})
+		}
+		for _, image := range images {
+			parts = append(parts, map[string]any{"type": "image_url", "image_url": map[string]any{"url": image}})
+		}
+		input = parts
+	}
+	body, err := common.Marshal(map[string]any{
+		"model": moderation.Model,
+		"input": input,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	timeout := time.Duration(moderation.TimeoutSeconds) * time.Second
+	if timeout <= 0 {
+		timeout = 10 * time.Second
+	}
+	ctx, cancel := context.WithTimeout(c.Request.Context(), timeout)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, strings.TrimRight(channel.GetBaseURL(), "/")+"/v1/moderations", bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Authorization", "Bearer "+key)
+
+	client := GetHttpClient()
+	if proxy := channel.GetSetting().Proxy; proxy != "" {
+		client, err = NewProxyHttpClient(proxy)
+		if err != nil {
+			return nil, err
+		}
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	respBody, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("moderation request failed with status %d: %s", resp.StatusCode, string(respBody))
+	}
+	var result moderationResponse
+	if err := common.Unmarshal(respBody, &result); err != nil {
+		return nil, err
+	}
+
+	flagged := false
+	categorySet := make(map[string]bool)
+	for _, r := range result.Results {
+		if !r.Flagged {
+			continue
+		}
+		flagged = true
+		for category, hit := range r.Categories {
+			if hit {
+				categorySet[category] = true
+			}
+		}
+	}
+	if !flagged {
+		return nil, nil
+	}
+	categories := make([]string, 0, len(categorySet))
+	for category := range categorySet {
+		categories = append(categories, category)
+	}
+	sort.Strings(categories)
+	return categories, nil
+}
@@ -0,0 +1,782 @@
+package service
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/constant"
+	"github.com/QuantumNous/new-api/logger"
+	"github.com/QuantumNous/new-api/model"
+	"github.com/QuantumNous/new-api/setting"
+	"github.com/QuantumNous/new-api/setting/operation_setting"
+	"github.com/QuantumNous/new-api/types"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	defaultContentPolicyMask = "***"
+	// 旧版敏感词列表作为一条仅作用于 prompt 的拦截规则
+	sensitiveWordsRuleName = "sensitive_words"
+	moderationRuleName     = "moderation"
+	maxViolationSamples    = 5
+)
+
+// 需要检查的 JSON 字段，数组元素沿用所在字段名
+var (
+	contentPolicyPromptKeys = map[string]bool{
+		"content": true, "text": true, "input": true, "prompt": true,
+		"instructions": true, "system": true, "query": true, "documents": true,
+	}
+	contentPolicyCompletionKeys = map[string]bool{
+		"content": true, "text": true, "delta": true, "output_text": true,
+		"reasoning_content": true, "refusal": true,
+	}
+)
+
+// ContentPolicyViolation 单条规则的命中情况
+type ContentPolicyViolation struct {
+	Rule       string   `json:"rule"`
+	Type       string   `json:"type"`
+	Action     string   `json:"action"`
+	Target     string   `json:"target"`
+	Count      int      `json:"count"`
+	Samples    []string `json:"samples,omitempty"`
+	Categories []string `json:"categories,omitempty"`
+}
+
+type contentPolicyMatch struct {
+	start int
+	end   int
+}
+
+type piiDetector struct {
+	re *regexp.Regexp
+	// 匹配前后不能紧邻数字，避免从更长的数字串中截取
+	digitBoundary bool
+	validate      func(string) bool
+}
+
+var piiDetectorNames = []string{
+	operation_setting.ContentPolicyPIIEmail,
+	operation_setting.ContentPolicyPIIPhone,
+	operation_setting.ContentPolicyPIICreditCard,
+	operation_setting.ContentPolicyPIIIdNumber,
+}
+
+var piiDetectors = map[string]piiDetector{
+	operation_setting.ContentPolicyPIIEmail: {
+		re: regexp.MustCompile(`[A-Za-z0-9._%+\-]+@[A-Za-z0-9\-]+(?:\.[A-Za-z0-9\-]+)*\.[A-Za-z]{2,}`),
+	},
+	operation_setting.ContentPolicyPIIPhone: {
+		re:            regexp.MustCompile(`(?:\+?86[- ]?)?1[3-9]\d{9}|\+\d{1,3}[- ]\d{2,4}[- ]?\d{3,4}[- ]?\d{3,4}`),
+		digitBoundary: true,
+	},
+	operation_setting.ContentPolicyPIICreditCard: {
+		re:            regexp.MustCompile(`\d(?:[ -]?\d){12,18}`),
+		digitBoundary: true,
+		validate:      luhnValid,
+	},
+	operation_setting.ContentPolicyPIIIdNumber: {
+		// 中国居民身份证号与美国 SSN
+		re:            regexp.MustCompile(`\d{17}[\dXx]|\d{3}-\d{2}-\d{4}`),
+		digitBoundary: true,
+		validate: func(s string) bool {
+			if len(s) == 18 {
+				return chineseIdNumberValid(s)
+			}
+			return true
+		},
+	},
+}
+
+func luhnValid(s string) bool {
+	sum, count := 0, 0
+	double := false
+	for i := len(s) - 1; i >= 0; i-- {
+		ch := s[i]
+		if ch < '0' || ch > '9' {
+			continue
+		}
+		digit := int(ch - '0')
+		if double {
+			digit *= 2
+			if digit > 9 {
+				digit -= 9
+			}
+		}
+		sum += digit
+		count++
+		double = !double
+	}
+	return count >= 13 && sum%10 == 0
+}
+
+func chineseIdNumberValid(s string) bool {
+	weights := []int{7, 9, 10, 5, 8, 4, 2, 1, 6, 3, 7, 9, 10, 5, 8, 4, 2}
+	sum := 0
+	for i, weight := range weights {
+		sum += int(s[i]-'0') * weight
+	}
+	return rune("10X98765432"[sum%11]) == unicode.ToUpper(rune(s[17]))
+}
+
+var contentPolicyRegexCache sync.Map
+
+func getContentPolicyRegexp(pattern string) *regexp.Regexp {
+	if cached, ok := contentPolicyRegexCache.Load(pattern); ok {
+		return cached.(*regexp.Regexp)
+	}
+	re, err := regexp.Compile(pattern)
+	if err != nil {
+		common.SysError(fmt.Sprintf("invalid content policy regex %q: %s", pattern, err.Error()))
+		return nil
+	}
+	contentPolicyRegexCache.Store(pattern, re)
+	return re
+}
+
+func findLiteralMatches(words []string, text string) []contentPolicyMatch {
+	m := getOrBuildAC(words)
+	if m == nil {
+		return nil
+	}
+	// 按 rune 匹配，offsets 记录每个 rune 在原文中的字节位置
+	runes := make([]rune, 0, len(text))
+	offsets := make([]int, 0, len(text)+1)
+	for i, r := range text {
+		runes = append(runes, unicode.ToLower(r))
+		offsets = append(offsets, i)
+	}
+	offsets = append(offsets, len(text))
+	var matches []contentPolicyMatch
+	for _, hit := range m.MultiPatternSearch(runes, false) {
+		matches = append(matches, contentPolicyMatch{start: offsets[hit.Pos], end: offsets[hit.Pos+len(hit.Word)]})
+	}
+	return matches
+}
+
+func findPIIMatches(name string, text string) []contentPolicyMatch {
+	detector, ok := piiDetectors[name]
+	if !ok {
+		return nil
+	}
+	var matches []contentPolicyMatch
+	for _, loc := range detector.re.FindAllStringIndex(text, -1) {
+		if detector.digitBoundary {
+			if loc[0] > 0 && isASCIIDigit(text[loc[0]-1]) || loc[1] < len(text) && isASCIIDigit(text[loc[1]]) {
+				continue
+			}
+		}
+		if detector.validate != nil && !detector.validate(text[loc[0]:loc[1]]) {
+			continue
+		}
+		matches = append(matches, contentPolicyMatch{start: loc[0], end: loc[1]})
+	}
+	return matches
+}
+
+func isASCIIDigit(ch byte) bool {
+	return ch >= '0' && ch <= '9'
+}
+
+// findContentPolicyMatches 返回规则在文本中的命中位置，按位置排序且互不重叠
+func findContentPolicyMatches(rule *operation_setting.ContentPolicyRule, text string) []contentPolicyMatch {
+	var matches []contentPolicyMatch
+	switch rule.Type {
+	case operation_setting.ContentPolicyRuleLiteral:
+		matches = findLiteralMatches(rule.Patterns, text)
+	case operation_setting.ContentPolicyRuleRegex:
+		for _, pattern := range rule.Patterns {
+			re := getContentPolicyRegexp(pattern)
+			if re == nil {
+				continue
+			}
+			for _, loc := range re.FindAllStringIndex(text, -1) {
+				if loc[1] > loc[0] {
+					matches = append(matches, contentPolicyMatch{start: loc[0], end: loc[1]})
+				}
+			}
+		}
+	case operation_setting.ContentPolicyRulePII:
+		names := rule.Patterns
+		if len(names) == 0 {
+			names = piiDetectorNames
+		}
+		for _, name := range names {
+			matches = append(matches, findPIIMatches(name, text)...)
+		}
+	}
+	if len(matches) < 2 {
+		return matches
+	}
+	sort.Slice(matches, func(i, j int) bool {
+		if matches[i].start != matches[j].start {
+			return matches[i].start < matches[j].start
+		}
+		return matches[i].end > matches[j].end
+	})
+	merged := matches[:1]
+	for _, match := range matches[1:] {
+		last := &merged[len(merged)-1]
+		if match.start < last.end {
+			if match.end > last.end {
+				last.end = match.end
+			}
+			continue
+		}
+		merged = append(merged, match)
+	}
+	return merged
+}
+
+// maskSample 日志中的个人信息仅保留首尾字符
+func maskSample(s string) string {
+	runes := []rune(s)
+	if len(runes) <= 4 {
+		return strings.Repeat("*", len(runes))
+	}
+	return string(runes[:2]) + strings.Repeat("*", len(runes)-4) + string(runes[len(runes)-2:])
+}
+
+// contentPolicyChecker 对单个请求的 prompt 或 completion 应用内容策略
+type contentPolicyChecker struct {
+	target     string
+	rules      []operation_setting.ContentPolicyRule
+	violations []*ContentPolicyViolation
+	blocked    *ContentPolicyViolation
+	// 无法修改原始内容时（如表单请求），redact 规则按 block 处理
+	redactUnsupported bool
+}
+
+func newContentPolicyChecker(c *gin.Context, target string) *contentPolicyChecker {
+	var rules []operation_setting.ContentPolicyRule
+	if target == operation_setting.ContentPolicyTargetPrompt && setting.ShouldCheckPromptSensitive() && len(setting.SensitiveWords) > 0 {
+		rules = append(rules, operation_setting.ContentPolicyRule{
+			Name:     sensitiveWordsRuleName,
+			Enabled:  true,
+			Type:     operation_setting.ContentPolicyRuleLiteral,
+			Patterns: setting.SensitiveWords,
+			Action:   operation_setting.ContentPolicyActionBlock,
+		})
+	}
+	policySetting := operation_setting.GetContentPolicySetting()
+	if policySetting.Enabled {
+		group := common.GetContextKeyString(c, constant.ContextKeyUsingGroup)
+		tokenId := common.GetContextKeyInt(c, constant.ContextKeyTokenId)
+		for _, rule := range policySetting.Rules {
+			if rule.AppliesTo(target, group, tokenId) {
+				rules = append(rules, rule)
+			}
+		}
+	}
+	if len(rules) == 0 {
+		return nil
+	}
+	return &contentPolicyChecker{target: target, rules: rules}
+}
+
+func (pc *contentPolicyChecker) record(rule *operation_setting.ContentPolicyRule, action string, samples []string) *ContentPolicyViolation {
+	var violation *ContentPolicyViolation
+	for _, v := range pc.violations {
+		if v.Rule == rule.Name && v.Action == action {
+			violation = v
+			break
+		}
+	}
+	if violation == nil {
+		violation = &ContentPolicyViolation{Rule: rule.Name, Type: rule.Type, Action: action, Target: pc.target}
+		pc.violations = append(pc.violations, violation)
+	}
+	violation.Count += len(samples)
+	for _, sample := range samples {
+		if len(violation.Samples) >= maxViolationSamples {
+			break
+		}
+		if rule.Type == operation_setting.ContentPolicyRulePII {
+			sample = maskSample(sample)
+		}
+		violation.Samples = append(violation.Samples, sample)
+	}
+	return violation
+}
+
+// check 检查 text 并返回处理后的内容，prefix 为之前已输出的内容，仅用于匹配跨片段的命中
+func (pc *contentPolicyChecker) check(prefix string, text string) string {
+	if pc.blocked != nil || text == "" {
+		return text
+	}
+	offset := len(prefix)
+	for i := range pc.rules {
+		rule := &pc.rules[i]
+		full := prefix + text
+		var matches []contentPolicyMatch
+		for _, match := range findContentPolicyMatches(rule, full) {
+			// 完全位于已输出内容中的命中已在之前处理过
+			if match.end > offset {
+				matches = append(matches, match)
+			}
+		}
+		if len(matches) == 0 {
+			continue
+		}
+		samples := make([]string, 0, len(matches))
+		for _, match := range matches {
+			samples = append(samples, full[match.start:match.end])
+		}
+		action := rule.Action
+		if action == operation_setting.ContentPolicyActionRedact && pc.redactUnsupported {
+			action = operation_setting.ContentPolicyActionBlock
+		}
+		violation := pc.record(rule, action, samples)
+		switch action {
+		case operation_setting.ContentPolicyActionBlock:
+			pc.blocked = violation
+			return text
+		case operation_setting.ContentPolicyActionRedact:
+			mask := rule.Mask
+			if mask == "" {
+				mask = defaultContentPolicyMask
+			}
+			var builder strings.Builder
+			last := 0
+			for _, match := range matches {
+				start := max(match.start, offset) - offset
+				builder.WriteString(text[last:start])
+				builder.WriteString(mask)
+				last = match.end - offset
+			}
+			builder.WriteString(text[last:])
+			text = builder.String()
+		}
+	}
+	return text
+}
+
+func (pc *contentPolicyChecker) blockedError() *types.NewAPIError {
+	errorCode := types.ErrorCodeContentPolicyViolation
+	if pc.blocked.Rule == sensitiveWordsRuleName {
+		errorCode = types.ErrorCodeSensitiveWordsDetected
+	}
+	return types.NewErrorWithStatusCode(fmt.Errorf("content violates policy rule: %s", pc.blocked.Rule), errorCode,
+		http.StatusBadRequest, types.ErrOptionWithSkipRetry(), types.ErrOptionWithNoRecordErrorLog())
+}
+
+// walkContentPolicyStrings 遍历 JSON 中 keys 指定字段下的字符串，fn 返回替换后的内容
+func walkContentPolicyStrings(node any, key string, keys map[string]bool, fn func(string) string) any {
+	switch v := node.(type) {
+	case map[string]any:
+		for childKey, child := range v {
+			v[childKey] = walkContentPolicyStrings(child, childKey, keys, fn)
+		}
+	case []any:
+		for i, child := range v {
+			v[i] = walkContentPolicyStrings(child, key, keys, fn)
+		}
+	case string:
+		if keys[key] {
+			return fn(v)
+		}
+	}
+	return node
+}
+
+// collectContentPolicyImages 收集请求中的图片地址，用于内容审核
+func collectContentPolicyImages(node any, key string, images *[]string) {
+	switch v := node.(type) {
+	case map[string]any:
+		if key == "image_url" {
+			if url, ok := v["url"].(string); ok {
+				*images = append(*images, url)
+			}
+			return
+		}
+		// Claude 格式的图片
+		if key == "source" {
+			switch v["type"] {
+			case "url":
+				if url, ok := v["url"].(string); ok {
+					*images = append(*images, url)
+				}
+			case "base64":
+				mediaType, _ := v["media_type"].(string)
+				if data, ok := v["data"].(string); ok {
+					*images = append(*images, "data:"+mediaType+";base64,"+data)
+				}
+			}
+			return
+		}
+		for childKey, child := range v {
+			collectContentPolicyImages(child, childKey, images)
+		}
+	case []any:
+		for _, child := range v {
+			collectContentPolicyImages(child, key, images)
+		}
+	case string:
+		if key == "image_url" {
+			*images = append(*images, v)
+		}
+	}
+}
+
+func decodeContentPolicyJSON(data []byte) (any, error) {
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+	var node any
+	if err := decoder.Decode(&node); err != nil {
+		return nil, err
+	}
+	if decoder.More() {
+		return nil, errors.New("unexpected data after json value")
+	}
+	return node, nil
+}
+
+func encodeContentPolicyJSON(node any) ([]byte, error) {
+	var buf bytes.Buffer
+	encoder := json.NewEncoder(&buf)
+	encoder.SetEscapeHTML(false)
+	if err := encoder.Encode(node); err != nil {
+		return nil, err
+	}
+	return bytes.TrimRight(buf.Bytes(), "\n"), nil
+}
+
+func recordContentPolicyViolations(c *gin.Context, violations []*ContentPolicyViolation) {
+	if len(violations) == 0 {
+		return
+	}
+	names := make([]string, 0, len(violations))
+	for _, v := range violations {
+		names = append(names, fmt.Sprintf("%s(%s)", v.Rule, v.Action))
+	}
+	content := fmt.Sprintf("内容策略命中（%s）：%s", violations[0].Target, strings.Join(names, ", "))
+	other := map[string]interface{}{
+		"violations": violations,
+		"request_id": c.GetString(common.RequestIdKey),
+	}
+	model.RecordContentPolicyLog(c, c.GetInt("id"), c.GetString("original_model"), c.GetString("token_name"), c.GetInt("token_id"),
+		common.GetContextKeyString(c, constant.ContextKeyUsingGroup), content, other)
+}
+
+// CheckRequestContentPolicy 对请求内容应用内容策略与内容审核，combineText 用于无法解析为 JSON 的请求
+// 命中 redact 规则时会改写缓存的请求体，返回 true 表示调用方需要重新解析请求
+func CheckRequestContentPolicy(c *gin.Context, combineText string) (bool, *types.NewAPIError) {
+	checker := newContentPolicyChecker(c, operation_setting.ContentPolicyTargetPrompt)
+	moderation := operation_setting.GetContentPolicySetting().Moderation
+	moderationEnabled := operation_setting.GetContentPolicySetting().Enabled &&
+		moderation.AppliesTo(common.GetContextKeyString(c, constant.ContextKeyUsingGroup))
+	if checker == nil && !moderationEnabled {
+		return false, nil
+	}
+
+	var violations []*ContentPolicyViolation
+	defer func() {
+		recordContentPolicyViolations(c, violations)
+	}()
+
+	body, err := common.GetRequestBody(c)
+	if err != nil {
+		return false, types.NewErrorWithStatusCode(err, types.ErrorCodeReadRequestBodyFailed, http.StatusBadRequest, types.ErrOptionWithSkipRetry())
+	}
+	var texts, images []string
+	modified := false
+	tree, err := decodeContentPolicyJSON(body)
+	if err == nil {
+		tree = walkContentPolicyStrings(tree, "", contentPolicyPromptKeys, func(s string) string {
+			if checker != nil {
+				checked := checker.check("", s)
+				modified = modified || checked != s
+				s = checked
+			}
+			texts = append(texts, s)
+			return s
+		})
+		collectContentPolicyImages(tree, "", &images)
+	} else {
+		if checker != nil {
+			checker.redactUnsupported = true
+			checker.check("", combineText)
+		}
+		texts = append(texts, combineText)
+	}
+
+	if checker != nil {
+		violations = checker.violations
+		if checker.blocked != nil {
+			logger.LogWarn(c, fmt.Sprintf("request blocked by content policy rule: %s", checker.blocked.Rule))
+			return false, checker.blockedError()
+		}
+	}
+
+	if moderationEnabled {
+		categories, err := moderateContent(c, texts, images)
+		if err != nil {
+			logger.LogError(c, "content moderation failed: "+err.Error())
+			if !moderation.FailOpen {
+				return false, types.NewErrorWithStatusCode(fmt.Errorf("content moderation failed: %w", err), types.ErrorCodeContentModerationError,
+					http.StatusInternalServerError, types.ErrOptionWithSkipRetry())
+			}
+		} else if categories != nil {
+			action := moderation.Action
+			if action != operation_setting.ContentPolicyActionLog {
+				action = operation_setting.ContentPolicyActionBlock
+			}
+			violations = append(violations, &ContentPolicyViolation{
+				Rule:       moderationRuleName,
+				Type:       moderationRuleName,
+				Action:     action,
+				Target:     operation_setting.ContentPolicyTargetPrompt,
+				Count:      1,
+				Categories: categories,
+			})
+			if action == operation_setting.ContentPolicyActionBlock {
+				return false, types.NewErrorWithStatusCode(fmt.Errorf("content flagged by moderation: %s", strings.Join(categories, ", ")),
+					types.ErrorCodeContentPolicyViolation, http.StatusBadRequest, types.ErrOptionWithSkipRetry(), types.ErrOptionWithNoRecordErrorLog())
+			}
+		}
+	}
+
+	if !modified {
+		return false, nil
+	}
+	newBody, err := encodeContentPolicyJSON(tree)
+	if err != nil {
+		return false, types.NewError(err, types.ErrorCodeJsonMarshalFailed, types.ErrOptionWithSkipRetry())
+	}
+	c.Set(common.KeyRequestBody, newBody)
+	return true, nil
+}
+
+// ContentPolicyWriter 对返回给客户端的内容应用内容策略
+// 流式响应按 SSE 事件处理，跨事件的命中仍可拦截，但已输出的部分无法再替换
+type ContentPolicyWriter struct {
+	gin.ResponseWriter
+	c           *gin.Context
+	checker     *contentPolicyChecker
+	relayFormat types.RelayFormat
+	mode        int
+	pending     []byte
+	tail        string
+	finished    bool
+}
+
+const (
+	contentPolicyWriterUndecided = iota
+	contentPolicyWriterPassThrough
+	contentPolicyWriterStream
+	contentPolicyWriterJSON
+)
+
+// 跨片段匹配时保留的已输出内容长度（字节）
+const contentPolicyTailSize = 256
+
+// NewContentPolicyWriter 没有作用于输出内容的规则时返回 nil
+func NewContentPolicyWriter(c *gin.Context, relayFormat types.RelayFormat) *ContentPolicyWriter {
+	checker := newContentPolicyChecker(c, operation_setting.ContentPolicyTargetCompletion)
+	if checker == nil {
+		return nil
+	}
+	return &ContentPolicyWriter{
+		ResponseWriter: c.Writer,
+		c:              c,
+		checker:        checker,
+		relayFormat:    relayFormat,
+	}
+}
+
+func (w *ContentPolicyWriter) decideMode() {
+	if w.mode != contentPolicyWriterUndecided {
+		return
+	}
+	contentType := w.Header().Get("Content-Type")
+	switch {
+	case w.finished || w.Status() != http.StatusOK:
+		w.mode = contentPolicyWriterPassThrough
+	case strings.Contains(contentType, "text/event-stream"):
+		w.mode = contentPolicyWriterStream
+	case strings.Contains(contentType, "application/json"):
+		w.mode = contentPolicyWriterJSON
+	default:
+		w.mode = contentPolicyWriterPassThrough
+	}
+}
+
+func (w *ContentPolicyWriter) Write(data []byte) (int, error) {
+	w.decideMode()
+	if w.checker.blocked != nil && w.mode != contentPolicyWriterPassThrough {
+		// 已中止输出，丢弃后续内容，让上游处理流程正常结束并计费
+		return len(data), nil
+	}
+	switch w.mode {
+	case contentPolicyWriterStream:
+		w.pending = append(w.pending, data...)
+		for w.checker.blocked == nil {
+			idx := bytes.Index(w.pending, []byte("\n\n"))
+			if idx < 0 {
+				break
+			}
+			event := w.pending[:idx+2]
+			w.pending = w.pending[idx+2:]
+			if _, err := w.ResponseWriter.Write(w.processEvent(event)); err != nil {
+				return 0, err
+			}
+		}
+		if w.checker.blocked != nil {
+			w.pending = nil
+		}
+		return len(data), nil
+	case contentPolicyWriterJSON:
+		// 非流式响应可能分多次写入，结束时统一处理
+		w.pending = append(w.pending, data...)
+		return len(data), nil
+	default:
+		return w.ResponseWriter.Write(data)
+	}
+}
+
+func (w *ContentPolicyWriter) WriteString(s string) (int, error) {
+	return w.Write([]byte(s))
+}
+
+func (w *ContentPolicyWriter) checkText(s string) string {
+	checked := w.checker.check(w.tail, s)
+	tail := w.tail + checked
+	if len(tail) > contentPolicyTailSize {
+		cut := len(tail) - contentPolicyTailSize
+		for cut < len(tail) && !utf8.RuneStart(tail[cut]) {
+			cut++
+		}
+		tail = tail[cut:]
+	}
+	w.tail = tail
+	return checked
+}
+
+func (w *ContentPolicyWriter) processEvent(event []byte) []byte {
+	lines := strings.Split(string(event), "\n")
+	modified := false
+	for i, line := range lines {
+		if !strings.HasPrefix(line, "data:") {
+			continue
+		}
+		payload := strings.TrimSpace(strings.TrimPrefix(line, "data:"))
+		if payload == "" || payload == "[DONE]" {
+			continue
+		}
+		tree, err := decodeContentPolicyJSON([]byte(payload))
+		if err != nil {
+			continue
+		}
+		changed := false
+		tree = walkContentPolicyStrings(tree, "", contentPolicyCompletionKeys, func(s string) string {
+			checked := w.checkText(s)
+			changed = changed || checked != s
+			return checked
+		})
+		if w.checker.blocked != nil {
+			return w.blockedEvent()
+		}
+		if !changed {
+			continue
+		}
+		data, err := encodeContentPolicyJSON(tree)
+		if err != nil {
+			continue
+		}
+		lines[i] = "data: " + string(data)
+		modified = true
+	}
+	if !modified {
+		return event
+	}
+	return []byte(strings.Join(lines, "\n"))
+}
+
+func (w *ContentPolicyWriter) blockedMessage() string {
+	return fmt.Sprintf("output stopped by content policy rule: %s", w.checker.blocked.Rule)
+}
+
+func (w *ContentPolicyWriter) blockedEvent() []byte {
+	message := w.blockedMessage()
+	if w.relayFormat == types.RelayFormatClaude {
+		data, _ := common.Marshal(map[string]any{
+			"type":  "error",
+			"error": map[string]any{"type": string(types.ErrorCodeContentPolicyViolation), "message": message},
+		})
+		return []byte("event: error\ndata: " + string(data) + "\n\n")
+	}
+	data, _ := common.Marshal(map[string]any{
+		"error": types.OpenAIError{Message: message, Type: string(types.ErrorCodeContentPolicyViolation), Code: types.ErrorCodeContentPolicyViolation},
+	})
+	return []byte("data: " + string(data) + "\n\ndata: [DONE]\n\n")
+}
+
+func (w *ContentPolicyWriter) processJSON(body []byte) []byte {
+	tree, err := decodeContentPolicyJSON(body)
+	if err != nil {
+		return body
+	}
+	changed := false
+	tree = walkContentPolicyStrings(tree, "", contentPolicyCompletionKeys, func(s string) string {
+		checked := w.checker.check("", s)
+		changed = changed || checked != s
+		return checked
+	})
+	if w.checker.blocked != nil {
+		message := w.blockedMessage()
+		var data []byte
+		if w.relayFormat == types.RelayFormatClaude {
+			data, _ = common.Marshal(map[string]any{
+				"type":  "error",
+				"error": map[string]any{"type": string(types.ErrorCodeContentPolicyViolation), "message": message},
+			})
+		} else {
+			data, _ = common.Marshal(map[string]any{
+				"error": types.OpenAIError{Message: message, Type: string(types.ErrorCodeContentPolicyViolation), Code: types.ErrorCodeContentPolicyViolation},
+			})
+		}
+		w.ResponseWriter.WriteHeader(http.StatusBadRequest)
+		return data
+	}
+	if !changed {
+		return body
+	}
+	data, err := encodeContentPolicyJSON(tree)
+	if err != nil {
+		return body
+	}
+	return data
+}
+
+// Finish 输出尚未处理完的内容并记录命中情况，之后的写入不再处理
+func (w *ContentPolicyWriter) Finish() {
+	if w.finished {
+		return
+	}
+	w.finished = true
+	switch w.mode {
+	case contentPolicyWriterJSON:
+		body := w.processJSON(w.pending)
+		w.Header().Del("Content-Length")
+		_, _ = w.ResponseWriter.Write(body)
+	case contentPolicyWriterStream:
+		if len(w.pending) > 0 {
+			_, _ = w.ResponseWriter.Write(w.pending)
+		}
+	}
+	w.pending = nil
+	w.mode = contentPolicyWriterPassThrough
+	recordContentPolicyViolations(w.c, w.checker.violations)
+}
@@ -10,8 +10,19 @@ import (
 	"github.com/QuantumNous/new-api/dto"
 	"github.com/QuantumNous/new-api/relay/channel/openrouter"
 	relaycommon "github.com/QuantumNous/new-api/relay/common"
+
+	"github.com/samber/lo"
 )
 
+// ClaudeThinkingSignaturePlaceholder 上游未返回思考签名时输出的占位签名，客户端回传时不会转发给上游
+const ClaudeThinkingSignaturePlaceholder = "bmV3LWFwaS10aGlua2luZy1zaWduYXR1cmUtcGxhY2Vob2xkZXI="
+
+// ClaudeReasoningFormat reasoning_details 中 Claude 推理内容的格式标识（与 OpenRouter 一致）
+const ClaudeReasoningFormat = "anthropic-claude-v1"
+
+// claudeStopReasons Claude 原生的结束原因，上游通过 native_finish_reason 返回时直接透传
+var claudeStopReasons = []string{"end_turn", "max_tokens", "stop_sequence", "tool_use", "pause_turn", "refusal", "model_context_window_exceeded"}
+
 func ClaudeToOpenAIRequest(claudeRequest dto.ClaudeRequest, info *relaycommon.RelayInfo) (*dto.GeneralOpenAIRequest, error) {
 	openAIRequest := dto.GeneralOpenAIRequest{
 		Model:       claudeRequest.Model,
@@ -49,10 +60,13 @@ func ClaudeToOpenAIRequest(claudeRequest dto.ClaudeRequest, info *relaycommon.Re
 		openAIRequest.Stop = claudeRequest.StopSequences
 	}
 
-	// Convert tools
+	// Convert tools，服务端工具（如 web_search）没有 input_schema，OpenAI 格式中没有对应项
 	tools, _ := common.Any2Type[[]dto.Tool](claudeRequest.Tools)
 	openAITools := make([]dto.ToolCallRequest, 0)
 	for _, claudeTool := range tools {
+		if claudeTool.InputSchema == nil {
+			continue
+		}
 		openAITool := dto.ToolCallRequest{
 			Type: "function",
 			Function: dto.FunctionRequest{
@@ -64,6 +78,18 @@ func ClaudeToOpenAIRequest(claudeRequest dto.ClaudeRequest, info *relaycommon.Re
 		openAITools = append(openAITools, openAITool)
 	}
 	openAIRequest.Tools = openAITools
+	if len(openAITools) > 0 {
+		openAIRequest.ToolChoice, openAIRequest.ParallelTooCalls = toolChoiceClaude2OpenAI(claudeRequest.ToolChoice)
+	}
+
+	if len(claudeRequest.Metadata) > 0 {
+		var metadata struct {
+			UserId string `json:"user_id"`
+		}
+		if err := common.Unmarshal(claudeRequest.Metadata, &metadata); err == nil {
+			openAIRequest.User = metadata.UserId
+		}
+	}
 
 	// Convert messages
 	openAIMessages := make([]dto.Message, 0)
@@ -82,8 +108,16 @@ func ClaudeToOpenAIRequest(claudeRequest dto.ClaudeRequest, info *relaycommon.Re
 				openAIMessage := dto.Message{
 					Role: "system",
 				}
+				// 带有缓存断点时保留分段，以便支持 cache_control 的上游使用
+				hasCacheControl := false
+				for _, system := range systems {
+					if len(system.CacheControl) > 0 {
+						hasCacheControl = true
+						break
+					}
+				}
 				isOpenRouterClaude := isOpenRouter && strings.HasPrefix(info.UpstreamModelName, "anthropic/claude")
-				if isOpenRouterClaude {
+				if isOpenRouterClaude || hasCacheControl {
 					systemMediaMessages := make([]dto.MediaContent, 0, len(systems))
 					for _, system := range systems {
 						message := dto.MediaContent{
@@ -108,89 +142,211 @@ func ClaudeToOpenAIRequest(claudeRequest dto.ClaudeRequest, info *relaycommon.Re
 		}
 	}
 	for _, claudeMessage := range claudeRequest.Messages {
-		openAIMessage := dto.Message{
-			Role: claudeMessage.Role,
+		messages, err := claudeMessageToOpenAI(&claudeRequest, claudeMessage)
+		if err != nil {
+			return nil, err
 		}
+		openAIMessages = append(openAIMessages, messages...)
+	}
 
-		//log.Printf("claudeMessage.Content: %v", claudeMessage.Content)
-		if claudeMessage.IsStringContent() {
-			openAIMessage.SetStringContent(claudeMessage.GetStringContent())
-		} else {
-			content, err := claudeMessage.ParseContent()
-			if err != nil {
-				return nil, err
+	openAIRequest.Messages = openAIMessages
+
+	return &openAIRequest, nil
+}
+
+// toolChoiceClaude2OpenAI disable_parallel_tool_use 对应 parallel_tool_calls 为 false
+func toolChoiceClaude2OpenAI(toolChoice any) (any, *bool) {
+	if toolChoice == nil {
+		return nil, nil
+	}
+	claudeToolChoice, err := common.Any2Type[dto.ClaudeToolChoice](toolChoice)
+	if err != nil {
+		return nil, nil
+	}
+	var parallelToolCalls *bool
+	if claudeToolChoice.DisableParallelToolUse {
+		parallelToolCalls = common.GetPointer(false)
+	}
+	switch claudeToolChoice.Type {
+	case "auto":
+		return "auto", parallelToolCalls
+	case "any":
+		return "required", parallelToolCalls
+	case "none":
+		return "none", parallelToolCalls
+	case "tool":
+		return map[string]any{
+			"type":     "function",
+			"function": map[string]any{"name": claudeToolChoice.Name},
+		}, parallelToolCalls
+	}
+	return nil, parallelToolCalls
+}
+
+// claudeMediaToOpenAI 转换文本、图片与文档内容，无法表示的内容返回 false
+func claudeMediaToOpenAI(mediaMsg dto.ClaudeMediaMessage) (dto.MediaContent, bool) {
+	switch mediaMsg.Type {
+	case "text":
+		return dto.MediaContent{
+			Type:         "text",
+			Text:         mediaMsg.GetText(),
+			CacheControl: mediaMsg.CacheControl,
+		}, true
+	case "image":
+		if mediaMsg.Source == nil {
+			return dto.MediaContent{}, false
+		}
+		imageUrl := mediaMsg.Source.Url
+		if mediaMsg.Source.Type != "url" {
+			imageUrl = fmt.Sprintf("data:%s;base64,%s", mediaMsg.Source.MediaType, mediaMsg.Source.Data)
+		}
+		return dto.MediaContent{
+			Type:         "image_url",
+			ImageUrl:     &dto.MessageImageUrl{Url: imageUrl},
+			CacheControl: mediaMsg.CacheControl,
+		}, true
+	case "document":
+		if mediaMsg.Source == nil {
+			return dto.MediaContent{}, false
+		}
+		switch mediaMsg.Source.Type {
+		case "text":
+			return dto.MediaContent{
+				Type:         "text",
+				Text:         common.Interface2String(mediaMsg.Source.Data),
+				CacheControl: mediaMsg.CacheControl,
+			}, true
+		case "base64":
+			return dto.MediaContent{
+				Type: dto.ContentTypeFile,
+				File: &dto.MessageFile{
+					FileName: "document.pdf",
+					FileData: fmt.Sprintf("data:%s;base64,%s", mediaMsg.Source.MediaType, mediaMsg.Source.Data),
+				},
+				CacheControl: mediaMsg.CacheControl,
+			}, true
+		}
+	}
+	return dto.MediaContent{}, false
+}
+
+// claudeMessageToOpenAI 将一条 Claude 消息转换为 OpenAI 消息。tool_result 转换为 tool 消息并排在用户内容之前，
+// 工具结果中的图片无法放入 tool 消息，随后以用户消息发送
+func claudeMessageToOpenAI(claudeRequest *dto.ClaudeRequest, claudeMessage dto.ClaudeMessage) ([]dto.Message, error) {
+	openAIMessage := dto.Message{
+		Role: claudeMessage.Role,
+	}
+	if claudeMessage.IsStringContent() {
+		openAIMessage.SetStringContent(claudeMessage.GetStringContent())
+		return []dto.Message{openAIMessage}, nil
+	}
+
+	contents, err := claudeMessage.ParseContent()
+	if err != nil {
+		return nil, err
+	}
+	var openAIMessages []dto.Message
+	var toolCalls []dto.ToolCallRequest
+	var toolResultMedia []dto.MediaContent
+	var reasoningTexts []string
+	mediaMessages := make([]dto.MediaContent, 0, len(contents))
+
+	for _, mediaMsg := range contents {
+		switch mediaMsg.Type {
+		case "tool_use":
+			toolCall := dto.ToolCallRequest{
+				ID:   mediaMsg.Id,
+				Type: "function",
+				Function: dto.FunctionRequest{
+					Name:      mediaMsg.Name,
+					Arguments: toJSONString(mediaMsg.Input),
+				},
 			}
-			contents := content
-			var toolCalls []dto.ToolCallRequest
-			mediaMessages := make([]dto.MediaContent, 0, len(contents))
-
-			for _, mediaMsg := range contents {
-				switch mediaMsg.Type {
-				case "text":
-					message := dto.MediaContent{
-						Type:         "text",
-						Text:         mediaMsg.GetText(),
-						CacheControl: mediaMsg.CacheControl,
-					}
-					mediaMessages = append(mediaMessages, message)
-				case "image":
-					// Handle image conversion (base64 to URL or keep as is)
-					imageData := fmt.Sprintf("data:%s;base64,%s", mediaMsg.Source.MediaType, mediaMsg.Source.Data)
-					//textContent += fmt.Sprintf("[Image: %s]", imageData)
-					mediaMessage := dto.MediaContent{
-						Type:     "image_url",
-						ImageUrl: &dto.MessageImageUrl{Url: imageData},
-					}
-					mediaMessages = append(mediaMessages, mediaMessage)
-				case "tool_use":
-					toolCall := dto.ToolCallRequest{
-						ID:   mediaMsg.Id,
-						Type: "function",
-						Function: dto.FunctionRequest{
-							Name:      mediaMsg.Name,
-							Arguments: toJSONString(mediaMsg.Input),
-						},
-					}
-					toolCalls = append(toolCalls, toolCall)
-				case "tool_result":
-					// Add tool result as a separate message
-					toolName := mediaMsg.Name
-					if toolName == "" {
-						toolName = claudeRequest.SearchToolNameByToolCallId(mediaMsg.ToolUseId)
-					}
-					oaiToolMessage := dto.Message{
-						Role:       "tool",
-						Name:       &toolName,
-						ToolCallId: mediaMsg.ToolUseId,
+			toolCalls = append(toolCalls, toolCall)
+		case "tool_result":
+			toolName := mediaMsg.Name
+			if toolName == "" {
+				toolName = claudeRequest.SearchToolNameByToolCallId(mediaMsg.ToolUseId)
+			}
+			oaiToolMessage := dto.Message{
+				Role:       "tool",
+				Name:       &toolName,
+				ToolCallId: mediaMsg.ToolUseId,
+			}
+			if mediaMsg.IsStringContent() {
+				oaiToolMessage.SetStringContent(mediaMsg.GetStringContent())
+			} else {
+				var texts []string
+				for _, resultContent := range mediaMsg.ParseMediaContent() {
+					if resultContent.Type == "text" {
+						texts = append(texts, resultContent.GetText())
+						continue
 					}
-					//oaiToolMessage.SetStringContent(*mediaMsg.GetMediaContent().Text)
-					if mediaMsg.IsStringContent() {
-						oaiToolMessage.SetStringContent(mediaMsg.GetStringContent())
-					} else {
-						mediaContents := mediaMsg.ParseMediaContent()
-						encodeJson, _ := common.Marshal(mediaContents)
-						oaiToolMessage.SetStringContent(string(encodeJson))
+					if media, ok := claudeMediaToOpenAI(resultContent); ok {
+						toolResultMedia = append(toolResultMedia, media)
 					}
-					openAIMessages = append(openAIMessages, oaiToolMessage)
 				}
+				oaiToolMessage.SetStringContent(strings.Join(texts, "\n"))
 			}
-
-			if len(toolCalls) > 0 {
-				openAIMessage.SetToolCalls(toolCalls)
+			openAIMessages = append(openAIMessages, oaiToolMessage)
+		case "thinking":
+			// 思考内容以 reasoning_content 回传，签名放在 reasoning_details 中，网关生成的占位签名不回传
+			thinking := ""
+			if mediaMsg.Thinking != nil {
+				thinking = *mediaMsg.Thinking
 			}
-
-			if len(mediaMessages) > 0 && len(toolCalls) == 0 {
-				openAIMessage.SetMediaContent(mediaMessages)
+			reasoningTexts = append(reasoningTexts, thinking)
+			detail := dto.ReasoningDetail{
+				Type:   dto.ReasoningDetailTypeText,
+				Text:   thinking,
+				Format: ClaudeReasoningFormat,
+			}
+			if mediaMsg.Signature != ClaudeThinkingSignaturePlaceholder {
+				detail.Signature = mediaMsg.Signature
+			}
+			openAIMessage.ReasoningDetails = append(openAIMessage.ReasoningDetails, detail)
+		case "redacted_thinking":
+			openAIMessage.ReasoningDetails = append(openAIMessage.ReasoningDetails, dto.ReasoningDetail{
+				Type:   dto.ReasoningDetailTypeEncrypted,
+				Data:   mediaMsg.Data,
+				Format: ClaudeReasoningFormat,
+			})
+		default:
+			if media, ok := claudeMediaToOpenAI(mediaMsg); ok {
+				mediaMessages = append(mediaMessages, media)
 			}
-		}
-		if len(openAIMessage.ParseContent()) > 0 || len(openAIMessage.ToolCalls) > 0 {
-			openAIMessages = append(openAIMessages, openAIMessage)
 		}
 	}
 
-	openAIRequest.Messages = openAIMessages
+	if len(reasoningTexts) > 0 {
+		openAIMessage.ReasoningContent = strings.Join(reasoningTexts, "\n")
+	}
 
-	return &openAIRequest, nil
+	if len(toolResultMedia) > 0 {
+		toolResultMessage := dto.Message{Role: "user"}
+		toolResultMessage.SetMediaContent(toolResultMedia)
+		openAIMessages = append(openAIMessages, toolResultMessage)
+	}
+
+	if len(toolCalls) > 0 {
+		openAIMessage.SetToolCalls(toolCalls)
+		// 带有工具调用的助手消息只保留文本
+		var texts []string
+		for _, media := range mediaMessages {
+			if media.Type == "text" {
+				texts = append(texts, media.Text)
+			}
+		}
+		if len(texts) > 0 {
+			openAIMessage.SetStringContent(strings.Join(texts, "\n"))
+		}
+	} else if len(mediaMessages) > 0 {
+		openAIMessage.SetMediaContent(mediaMessages)
+	}
+	if len(openAIMessage.ParseContent()) > 0 || len(openAIMessage.ToolCalls) > 0 || len(openAIMessage.ReasoningDetails) > 0 {
+		openAIMessages = append(openAIMessages, openAIMessage)
+	}
+	return openAIMessages, nil
 }
 
 func generateStopBlock(index int) *dto.ClaudeResponse {
@@ -200,8 +356,63 @@ func generateStopBlock(index int) *dto.ClaudeResponse {
 	}
 }
 
+// claudeStreamStopBlock 关闭当前内容块，thinking 内容块在关闭前先输出 signature_delta
+func claudeStreamStopBlock(info *relaycommon.RelayInfo) []*dto.ClaudeResponse {
+	convertInfo := info.ClaudeConvertInfo
+	var claudeResponses []*dto.ClaudeResponse
+	if convertInfo.LastMessagesType == relaycommon.LastMessageTypeThinking {
+		signature := convertInfo.ThinkingSignature
+		if signature == "" {
+			signature = ClaudeThinkingSignaturePlaceholder
+		}
+		claudeResponses = append(claudeResponses, claudeStreamDelta(info, &dto.ClaudeMediaMessage{
+			Type:      "signature_delta",
+			Signature: signature,
+		}))
+		convertInfo.ThinkingSignature = ""
+	}
+	claudeResponses = append(claudeResponses, generateStopBlock(convertInfo.Index))
+	return claudeResponses
+}
+
+// claudeStreamStartBlock 关闭当前内容块并开始新的内容块，内容块序号从 0 开始连续递增
+func claudeStreamStartBlock(info *relaycommon.RelayInfo, messageType string, block *dto.ClaudeMediaMessage) []*dto.ClaudeResponse {
+	var claudeResponses []*dto.ClaudeResponse
+	if info.ClaudeConvertInfo.LastMessagesType != relaycommon.LastMessageTypeNone {
+		claudeResponses = append(claudeResponses, claudeStreamStopBlock(info)...)
+		info.ClaudeConvertInfo.Index++
+	}
+	info.ClaudeConvertInfo.LastMessagesType = messageType
+	claudeResponses = append(claudeResponses, &dto.ClaudeResponse{
+		Index:        common.GetPointer[int](info.ClaudeConvertInfo.Index),
+		Type:         "content_block_start",
+		ContentBlock: block,
+	})
+	return claudeResponses
+}
+
+func claudeStreamDelta(info *relaycommon.RelayInfo, delta *dto.ClaudeMediaMessage) *dto.ClaudeResponse {
+	return &dto.ClaudeResponse{
+		Index: common.GetPointer[int](info.ClaudeConvertInfo.Index),
+		Type:  "content_block_delta",
+		Delta: delta,
+	}
+}
+
+func claudeUsageFromOpenAI(usage *dto.Usage) *dto.ClaudeUsage {
+	return &dto.ClaudeUsage{
+		InputTokens:              usage.PromptTokens,
+		OutputTokens:             usage.CompletionTokens,
+		CacheCreationInputTokens: usage.PromptTokensDetails.CachedCreationTokens,
+		CacheReadInputTokens:     usage.PromptTokensDetails.CachedTokens,
+	}
+}
+
+// StreamResponseOpenAI2Claude 按 Claude 流式接口的事件顺序输出：message_start，各内容块依次 start、delta、stop，
+// 最后为 message_delta 与 message_stop。思考、文本与每个工具调用分别占用一个内容块
 func StreamResponseOpenAI2Claude(openAIResponse *dto.ChatCompletionsStreamResponse, info *relaycommon.RelayInfo) []*dto.ClaudeResponse {
 	var claudeResponses []*dto.ClaudeResponse
+	convertInfo := info.ClaudeConvertInfo
 	if info.SendResponseCount == 1 {
 		msg := &dto.ClaudeMediaMessage{
 			Id:    openAIResponse.Id,
@@ -218,188 +429,120 @@ func StreamResponseOpenAI2Claude(openAIResponse *dto.ChatCompletionsStreamRespon
 			Type:    "message_start",
 			Message: msg,
 		})
-		claudeResponses = append(claudeResponses)
-		//claudeResponses = append(claudeResponses, &dto.ClaudeResponse{
-		//	Type: "ping",
-		//})
-		if openAIResponse.IsToolCall() {
-			info.ClaudeConvertInfo.LastMessagesType = relaycommon.LastMessageTypeTools
-			resp := &dto.ClaudeResponse{
-				Type: "content_block_start",
-				ContentBlock: &dto.ClaudeMediaMessage{
-					Id:    openAIResponse.GetFirstToolCall().ID,
-					Type:  "tool_use",
-					Name:  openAIResponse.GetFirstToolCall().Function.Name,
-					Input: map[string]interface{}{},
-				},
-			}
-			resp.SetIndex(0)
-			claudeResponses = append(claudeResponses, resp)
-		} else {
+	}
 
-		}
-		// 判断首个响应是否存在内容（非标准的 OpenAI 响应）
-		if len(openAIResponse.Choices) > 0 && len(openAIResponse.Choices[0].Delta.GetContentString()) > 0 {
-			claudeResponses = append(claudeResponses, &dto.ClaudeResponse{
-				Index: &info.ClaudeConvertInfo.Index,
-				Type:  "content_block_start",
-				ContentBlock: &dto.ClaudeMediaMessage{
-					Type: "text",
-					Text: common.GetPointer[string](""),
-				},
-			})
-			claudeResponses = append(claudeResponses, &dto.ClaudeResponse{
-				Index: &info.ClaudeConvertInfo.Index,
-				Type:  "content_block_delta",
-				Delta: &dto.ClaudeMediaMessage{
-					Type: "text_delta",
-					Text: common.GetPointer[string](openAIResponse.Choices[0].Delta.GetContentString()),
-				},
-			})
-			info.ClaudeConvertInfo.LastMessagesType = relaycommon.LastMessageTypeText
-		}
-		return claudeResponses
-	}
-
-	if len(openAIResponse.Choices) == 0 {
-		// no choices
-		// 可能为非标准的 OpenAI 响应，判断是否已经完成
-		if info.Done {
-			claudeResponses = append(claudeResponses, generateStopBlock(info.ClaudeConvertInfo.Index))
-			oaiUsage := info.ClaudeConvertInfo.Usage
-			if oaiUsage != nil {
-				claudeResponses = append(claudeResponses, &dto.ClaudeResponse{
-					Type: "message_delta",
-					Usage: &dto.ClaudeUsage{
-						InputTokens:              oaiUsage.PromptTokens,
-						OutputTokens:             oaiUsage.CompletionTokens,
-						CacheCreationInputTokens: oaiUsage.PromptTokensDetails.CachedCreationTokens,
-						CacheReadInputTokens:     oaiUsage.PromptTokensDetails.CachedTokens,
-					},
-					Delta: &dto.ClaudeMediaMessage{
-						StopReason: common.GetPointer[string](stopReasonOpenAI2Claude(info.FinishReason)),
-					},
-				})
+	if len(openAIResponse.Choices) > 0 {
+		choice := openAIResponse.Choices[0]
+		if reasoning := choice.Delta.GetReasoningContent(); reasoning != "" {
+			if convertInfo.LastMessagesType != relaycommon.LastMessageTypeThinking {
+				claudeResponses = append(claudeResponses, claudeStreamStartBlock(info, relaycommon.LastMessageTypeThinking, &dto.ClaudeMediaMessage{
+					Type:     "thinking",
+					Thinking: common.GetPointer[string](""),
+				})...)
 			}
-			claudeResponses = append(claudeResponses, &dto.ClaudeResponse{
-				Type: "message_stop",
-			})
+			claudeResponses = append(claudeResponses, claudeStreamDelta(info, &dto.ClaudeMediaMessage{
+				Type:     "thinking_delta",
+				Thinking: &reasoning,
+			}))
 		}
-		return claudeResponses
-	} else {
-		chosenChoice := openAIResponse.Choices[0]
-		if chosenChoice.FinishReason != nil && *chosenChoice.FinishReason != "" {
-			// should be done
-			info.FinishReason = *chosenChoice.FinishReason
-			if !info.Done {
-				return claudeResponses
+		for _, detail := range choice.Delta.ReasoningDetails {
+			switch detail.Type {
+			case dto.ReasoningDetailTypeText:
+				// 签名随最后一段思考内容返回或紧随其后单独返回，在关闭 thinking 内容块时输出
+				if detail.Signature != "" && convertInfo.LastMessagesType == relaycommon.LastMessageTypeThinking {
+					convertInfo.ThinkingSignature = detail.Signature
+				}
+			case dto.ReasoningDetailTypeEncrypted:
+				if detail.Data == "" {
+					continue
+				}
+				claudeResponses = append(claudeResponses, claudeStreamStartBlock(info, relaycommon.LastMessageTypeRedactedThinking, &dto.ClaudeMediaMessage{
+					Type: "redacted_thinking",
+					Data: detail.Data,
+				})...)
 			}
 		}
-		if info.Done {
-			claudeResponses = append(claudeResponses, generateStopBlock(info.ClaudeConvertInfo.Index))
-			oaiUsage := info.ClaudeConvertInfo.Usage
-			if oaiUsage != nil {
-				claudeResponses = append(claudeResponses, &dto.ClaudeResponse{
-					Type: "message_delta",
-					Usage: &dto.ClaudeUsage{
-						InputTokens:              oaiUsage.PromptTokens,
-						OutputTokens:             oaiUsage.CompletionTokens,
-						CacheCreationInputTokens: oaiUsage.PromptTokensDetails.CachedCreationTokens,
-						CacheReadInputTokens:     oaiUsage.PromptTokensDetails.CachedTokens,
-					},
-					Delta: &dto.ClaudeMediaMessage{
-						StopReason: common.GetPointer[string](stopReasonOpenAI2Claude(info.FinishReason)),
-					},
-				})
+		if textContent := choice.Delta.GetContentString(); textContent != "" {
+			if convertInfo.LastMessagesType != relaycommon.LastMessageTypeText {
+				claudeResponses = append(claudeResponses, claudeStreamStartBlock(info, relaycommon.LastMessageTypeText, &dto.ClaudeMediaMessage{
+					Type: "text",
+					Text: common.GetPointer[string](""),
+				})...)
 			}
-			claudeResponses = append(claudeResponses, &dto.ClaudeResponse{
-				Type: "message_stop",
-			})
-		} else {
-			var claudeResponse dto.ClaudeResponse
-			var isEmpty bool
-			claudeResponse.Type = "content_block_delta"
-			if len(chosenChoice.Delta.ToolCalls) > 0 {
-				if info.ClaudeConvertInfo.LastMessagesType != relaycommon.LastMessageTypeTools {
-					claudeResponses = append(claudeResponses, generateStopBlock(info.ClaudeConvertInfo.Index))
-					info.ClaudeConvertInfo.Index++
-					claudeResponses = append(claudeResponses, &dto.ClaudeResponse{
-						Index: &info.ClaudeConvertInfo.Index,
-						Type:  "content_block_start",
-						ContentBlock: &dto.ClaudeMediaMessage{
-							Id:    openAIResponse.GetFirstToolCall().ID,
-							Type:  "tool_use",
-							Name:  openAIResponse.GetFirstToolCall().Function.Name,
-							Input: map[string]interface{}{},
-						},
-					})
-				}
-				info.ClaudeConvertInfo.LastMessagesType = relaycommon.LastMessageTypeTools
-				// tools delta
-				claudeResponse.Delta = &dto.ClaudeMediaMessage{
-					Type:        "input_json_delta",
-					PartialJson: &chosenChoice.Delta.ToolCalls[0].Function.Arguments,
-				}
+			claudeResponses = append(claudeResponses, claudeStreamDelta(info, &dto.ClaudeMediaMessage{
+				Type: "text_delta",
+				Text: common.GetPointer[string](textContent),
+			}))
+		}
+		for _, toolCall := range choice.Delta.ToolCalls {
+			// 部分上游不返回 index，此时以工具调用 ID 区分
+			isNewToolCall := convertInfo.LastMessagesType != relaycommon.LastMessageTypeTools
+			if toolCall.Index != nil {
+				isNewToolCall = isNewToolCall || *toolCall.Index != convertInfo.ToolCallIndex
 			} else {
-				reasoning := chosenChoice.Delta.GetReasoningContent()
-				textContent := chosenChoice.Delta.GetContentString()
-				if reasoning != "" || textContent != "" {
-					if reasoning != "" {
-						if info.ClaudeConvertInfo.LastMessagesType != relaycommon.LastMessageTypeThinking {
-							//info.ClaudeConvertInfo.Index++
-							claudeResponses = append(claudeResponses, &dto.ClaudeResponse{
-								Index: &info.ClaudeConvertInfo.Index,
-								Type:  "content_block_start",
-								ContentBlock: &dto.ClaudeMediaMessage{
-									Type:     "thinking",
-									Thinking: common.GetPointer[string](""),
-								},
-							})
-						}
-						info.ClaudeConvertInfo.LastMessagesType = relaycommon.LastMessageTypeThinking
-						// text delta
-						claudeResponse.Delta = &dto.ClaudeMediaMessage{
-							Type:     "thinking_delta",
-							Thinking: &reasoning,
-						}
-					} else {
-						if info.ClaudeConvertInfo.LastMessagesType != relaycommon.LastMessageTypeText {
-							if info.LastMessagesType == relaycommon.LastMessageTypeThinking || info.LastMessagesType == relaycommon.LastMessageTypeTools {
-								claudeResponses = append(claudeResponses, generateStopBlock(info.ClaudeConvertInfo.Index))
-								info.ClaudeConvertInfo.Index++
-							}
-							claudeResponses = append(claudeResponses, &dto.ClaudeResponse{
-								Index: &info.ClaudeConvertInfo.Index,
-								Type:  "content_block_start",
-								ContentBlock: &dto.ClaudeMediaMessage{
-									Type: "text",
-									Text: common.GetPointer[string](""),
-								},
-							})
-						}
-						info.ClaudeConvertInfo.LastMessagesType = relaycommon.LastMessageTypeText
-						// text delta
-						claudeResponse.Delta = &dto.ClaudeMediaMessage{
-							Type: "text_delta",
-							Text: common.GetPointer[string](textContent),
-						}
-					}
-				} else {
-					isEmpty = true
+				isNewToolCall = isNewToolCall || (toolCall.ID != "" && toolCall.ID != convertInfo.ToolCallId)
+			}
+			if isNewToolCall {
+				if toolCall.Index != nil {
+					convertInfo.ToolCallIndex = *toolCall.Index
 				}
+				convertInfo.ToolCallId = toolCall.ID
+				claudeResponses = append(claudeResponses, claudeStreamStartBlock(info, relaycommon.LastMessageTypeTools, &dto.ClaudeMediaMessage{
+					Id:    toolCall.ID,
+					Type:  "tool_use",
+					Name:  toolCall.Function.Name,
+					Input: map[string]interface{}{},
+				})...)
 			}
-			claudeResponse.Index = &info.ClaudeConvertInfo.Index
-			if !isEmpty {
-				claudeResponses = append(claudeResponses, &claudeResponse)
+			if toolCall.Function.Arguments != "" {
+				arguments := toolCall.Function.Arguments
+				claudeResponses = append(claudeResponses, claudeStreamDelta(info, &dto.ClaudeMediaMessage{
+					Type:        "input_json_delta",
+					PartialJson: &arguments,
+				}))
 			}
 		}
+		if choice.FinishReason != nil && *choice.FinishReason != "" {
+			info.FinishReason = *choice.FinishReason
+		}
+		if choice.NativeFinishReason != "" {
+			convertInfo.NativeFinishReason = choice.NativeFinishReason
+		}
+		if matched, ok := choice.StopReason.(string); ok && matched != "" {
+			convertInfo.MatchedStopSequence = matched
+		}
+	}
+
+	if info.Done {
+		if convertInfo.LastMessagesType != relaycommon.LastMessageTypeNone {
+			claudeResponses = append(claudeResponses, claudeStreamStopBlock(info)...)
+			convertInfo.LastMessagesType = relaycommon.LastMessageTypeNone
+		}
+		usage := &dto.ClaudeUsage{}
+		if convertInfo.Usage != nil {
+			usage = claudeUsageFromOpenAI(convertInfo.Usage)
+		}
+		stopReason, stopSequence := claudeStopReason(info, info.FinishReason, convertInfo.NativeFinishReason, convertInfo.MatchedStopSequence)
+		claudeResponses = append(claudeResponses, &dto.ClaudeResponse{
+			Type:  "message_delta",
+			Usage: usage,
+			Delta: &dto.ClaudeMediaMessage{
+				StopReason:   common.GetPointer[string](stopReason),
+				StopSequence: stopSequence,
+			},
+		})
+		claudeResponses = append(claudeResponses, &dto.ClaudeResponse{
+			Type: "message_stop",
+		})
 	}
 
 	return claudeResponses
 }
 
+// ResponseOpenAI2Claude 内容块顺序与 Claude 一致：思考、文本、工具调用
 func ResponseOpenAI2Claude(openAIResponse *dto.OpenAITextResponse, info *relaycommon.RelayInfo) *dto.ClaudeResponse {
 	var stopReason string
+	var stopSequence *string
 	contents := make([]dto.ClaudeMediaMessage, 0)
 	claudeResponse := &dto.ClaudeResponse{
 		Id:    openAIResponse.Id,
@@ -408,38 +551,95 @@ func ResponseOpenAI2Claude(openAIResponse *dto.OpenAITextResponse, info *relayco
 		Model: openAIResponse.Model,
 	}
 	for _, choice := range openAIResponse.Choices {
-		stopReason = stopReasonOpenAI2Claude(choice.FinishReason)
-		if choice.FinishReason == "tool_calls" {
-			for _, toolUse := range choice.Message.ParseToolCalls() {
-				claudeContent := dto.ClaudeMediaMessage{}
-				claudeContent.Type = "tool_use"
-				claudeContent.Id = toolUse.ID
-				claudeContent.Name = toolUse.Function.Name
-				var mapParams map[string]interface{}
-				if err := common.Unmarshal([]byte(toolUse.Function.Arguments), &mapParams); err == nil {
-					claudeContent.Input = mapParams
-				} else {
-					claudeContent.Input = toolUse.Function.Arguments
+		matched, _ := choice.StopReason.(string)
+		stopReason, stopSequence = claudeStopReason(info, choice.FinishReason, choice.NativeFinishReason, matched)
+		reasoning := choice.Message.ReasoningContent
+		if reasoning == "" {
+			reasoning = choice.Message.Reasoning
+		}
+		signature := ClaudeThinkingSignaturePlaceholder
+		var redactedContents []dto.ClaudeMediaMessage
+		for _, detail := range choice.Message.ReasoningDetails {
+			switch detail.Type {
+			case dto.ReasoningDetailTypeText:
+				if detail.Signature != "" {
+					signature = detail.Signature
+				}
+			case dto.ReasoningDetailTypeEncrypted:
+				if detail.Data != "" {
+					redactedContents = append(redactedContents, dto.ClaudeMediaMessage{
+						Type: "redacted_thinking",
+						Data: detail.Data,
+					})
 				}
-				contents = append(contents, claudeContent)
 			}
-		} else {
+		}
+		if reasoning != "" {
+			contents = append(contents, dto.ClaudeMediaMessage{
+				Type:      "thinking",
+				Thinking:  common.GetPointer[string](reasoning),
+				Signature: signature,
+			})
+		}
+		contents = append(contents, redactedContents...)
+		toolCalls := choice.Message.ParseToolCalls()
+		if text := choice.Message.StringContent(); text != "" || (len(toolCalls) == 0 && reasoning == "" && len(redactedContents) == 0) {
 			claudeContent := dto.ClaudeMediaMessage{}
 			claudeContent.Type = "text"
-			claudeContent.SetText(choice.Message.StringContent())
+			claudeContent.SetText(text)
+			contents = append(contents, claudeContent)
+		}
+		for _, toolUse := range toolCalls {
+			claudeContent := dto.ClaudeMediaMessage{}
+			claudeContent.Type = "tool_use"
+			claudeContent.Id = toolUse.ID
+			claudeContent.Name = toolUse.Function.Name
+			var mapParams map[string]interface{}
+			if err := common.Unmarshal([]byte(toolUse.Function.Arguments), &mapParams); err == nil {
+				claudeContent.Input = mapParams
+			} else {
+				claudeContent.Input = toolUse.Function.Arguments
+			}
 			contents = append(contents, claudeContent)
 		}
 	}
 	claudeResponse.Content = contents
 	claudeResponse.StopReason = stopReason
-	claudeResponse.Usage = &dto.ClaudeUsage{
-		InputTokens:  openAIResponse.PromptTokens,
-		OutputTokens: openAIResponse.CompletionTokens,
-	}
+	claudeResponse.StopSequence = stopSequence
+	claudeResponse.Usage = claudeUsageFromOpenAI(&openAIResponse.Usage)
 
 	return claudeResponse
 }
 
+// claudeStopReason 转换结束原因：优先使用上游返回的 Claude 原始结束原因（如 pause_turn），
+// finish_reason 为 stop 且命中请求中的停止序列时返回 stop_sequence 及命中的序列
+func claudeStopReason(info *relaycommon.RelayInfo, finishReason string, nativeFinishReason string, matched string) (string, *string) {
+	var stopSequences []string
+	if claudeRequest, ok := info.Request.(*dto.ClaudeRequest); ok {
+		stopSequences = claudeRequest.StopSequences
+	}
+	if !lo.Contains(stopSequences, matched) {
+		matched = ""
+	}
+	stopReason := stopReasonOpenAI2Claude(finishReason)
+	if lo.Contains(claudeStopReasons, nativeFinishReason) {
+		stopReason = nativeFinishReason
+	} else if stopReason == "end_turn" && matched != "" {
+		stopReason = "stop_sequence"
+	}
+	if stopReason != "stop_sequence" {
+		return stopReason, nil
+	}
+	// 上游只返回了 stop_sequence 而未返回命中的序列时，仅在请求只有一个停止序列时可以确定
+	if matched == "" && len(stopSequences) == 1 {
+		matched = stopSequences[0]
+	}
+	if matched == "" {
+		return stopReason, nil
+	}
+	return stopReason, &matched
+}
+
 func stopReasonOpenAI2Claude(reason string) string {
 	switch reason {
 	case "stop":
@@ -450,8 +650,14 @@ func stopReasonOpenAI2Claude(reason string) string {
 		fallthrough
 	case "max_tokens":
 		return "max_tokens"
-	case "tool_calls":
+	case "tool_calls", "function_call":
 		return "tool_use"
+	case "content_filter":
+		return "refusal"
+	case "pause_turn":
+		return "pause_turn"
+	case "":
+		return "end_turn"
 	default:
 		return reason
 	}
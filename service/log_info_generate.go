@@ -50,6 +50,10 @@ func GenerateTextOtherInfo(ctx *gin.Context, relayInfo *relaycommon.RelayInfo, m
 		other["upstream_model_name"] = relayInfo.UpstreamModelName
 	}
 
+	if fallbackFrom := common.GetContextKeyString(ctx, constant.ContextKeyModelFallbackFrom); fallbackFrom != "" {
+		other["model_fallback_from"] = fallbackFrom
+	}
+
 	isSystemPromptOverwritten := common.GetContextKeyBool(ctx, constant.ContextKeySystemPromptOverride)
 	if isSystemPromptOverwritten {
 		other["is_system_prompt_overwritten"] = true
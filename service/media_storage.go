@@ -0,0 +1,348 @@
+package service
+
+import (
+	"bufio"
+	"crypto/hmac"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/model"
+	"github.com/QuantumNous/new-api/service/storage"
+	"github.com/QuantumNous/new-api/setting/operation_setting"
+	"github.com/QuantumNous/new-api/setting/system_setting"
+
+	"github.com/gin-gonic/gin"
+)
+
+var (
+	ErrMediaQuotaExceeded = errors.New("media storage quota exceeded")
+	ErrMediaTooLarge      = errors.New("media file too large")
+)
+
+// MediaSaveParams 保存媒体文件所需的归属与来源信息，Kind 为空时按内容类型判断
+type MediaSaveParams struct {
+	UserId      int
+	Group       string
+	Source      string
+	SourceId    string
+	Seq         int
+	Kind        string
+	ModelName   string
+	ContentType string
+	// 内容大小，已知时按该大小预留存储空间，否则按可写入的上限预留
+	Size int64
+}
+
+// MediaStorageEnabled 判断是否保存指定来源的生成结果
+func MediaStorageEnabled(source string) bool {
+	setting := operation_setting.GetMediaStorageSetting()
+	if !setting.Enabled {
+		return false
+	}
+	switch source {
+	case model.MediaSourceTask:
+		return setting.TaskEnabled
+	case model.MediaSourceImage:
+		return setting.ImageEnabled
+	case model.MediaSourceAudio:
+		return setting.AudioEnabled
+	}
+	return false
+}
+
+func mediaKindFromContentType(contentType string) string {
+	switch {
+	case strings.HasPrefix(contentType, "image/"):
+		return model.MediaKindImage
+	case strings.HasPrefix(contentType, "audio/"):
+		return model.MediaKindAudio
+	}
+	return model.MediaKindVideo
+}
+
+// SaveMediaAsset 将内容写入存储后端并记录归属，同一来源已保存过时返回 nil。
+// 写入前在用户存储空间中预留大小，写入完成后修正为实际大小，超出存储空间或单文件大小上限时不保存
+func SaveMediaAsset(params MediaSaveParams, reader io.Reader) (*model.MediaAsset, error) {
+	setting := operation_setting.GetMediaStorageSetting()
+	limit := int64(setting.MaxFileSizeMB) << 20
+	limitErr := ErrMediaTooLarge
+	quota := setting.GetUserQuotaBytes(params.Group)
+	if quota > 0 {
+		usage, err := model.GetUserMediaUsage(params.UserId)
+		if err != nil {
+			return nil, err
+		}
+		if usage >= quota {
+			return nil, ErrMediaQuotaExceeded
+		}
+		if limit <= 0 || quota-usage < limit {
+			limit = quota - usage
+			limitErr = ErrMediaQuotaExceeded
+		}
+	}
+	if limit > 0 && params.Size > limit {
+		return nil, limitErr
+	}
+	reserved := limit
+	if params.Size > 0 {
+		reserved = params.Size
+		limitErr = fmt.Errorf("media size exceeds %d bytes", params.Size)
+	}
+
+	now := time.Now()
+	asset := &model.MediaAsset{
+		UserId:      params.UserId,
+		Source:      params.Source,
+		SourceId:    params.SourceId,
+		Seq:         params.Seq,
+		Kind:        params.Kind,
+		ModelName:   params.ModelName,
+		ContentType: params.ContentType,
+		StorageKey:  fmt.Sprintf("media/%d/%s/%s", params.UserId, now.Format("2006-01-02"), common.GetRandomString(32)),
+		CreatedAt:   now.Unix(),
+	}
+	if setting.RetentionDays > 0 {
+		asset.ExpiresAt = now.Unix() + int64(setting.RetentionDays)*86400
+	}
+	ok, err := model.ClaimMediaAsset(asset)
+	if err != nil || !ok {
+		return nil, err
+	}
+	ok, err = model.ReserveUserMediaUsage(params.UserId, reserved, quota)
+	if err == nil && !ok {
+		err = ErrMediaQuotaExceeded
+	}
+	if err != nil {
+		_ = model.DeleteMediaAsset(asset.Id)
+		return nil, err
+	}
+
+	store, err := storage.Get()
+	if err == nil {
+		bufReader := bufio.NewReader(reader)
+		if asset.ContentType == "" {
+			head, _ := bufReader.Peek(512)
+			asset.ContentType = http.DetectContentType(head)
+		}
+		if asset.Kind == "" {
+			asset.Kind = mediaKindFromContentType(asset.ContentType)
+		}
+		if reserved > 0 {
+			reader = io.LimitReader(bufReader, reserved+1)
+		} else {
+			reader = bufReader
+		}
+		asset.Size, err = store.Save(asset.StorageKey, reader)
+		if err == nil && reserved > 0 && asset.Size > reserved {
+			err = limitErr
+		}
+		if err != nil {
+			_ = store.Delete(asset.StorageKey)
+		}
+	}
+	if err == nil {
+		err = model.UpdateMediaAssetContent(asset, reserved)
+		if err != nil {
+			_ = store.Delete(asset.StorageKey)
+		}
+	}
+	if err != nil {
+		if releaseErr := model.ReleaseUserMediaUsage(params.UserId, reserved); releaseErr != nil {
+			common.SysError(fmt.Sprintf("failed to release media usage of user %d: %v", params.UserId, releaseErr))
+		}
+		_ = model.DeleteMediaAsset(asset.Id)
+		return nil, err
+	}
+	return asset, nil
+}
+
+// SaveMediaAssetFromUrl 下载 http(s) 地址或解码 data URL 后保存
+func SaveMediaAssetFromUrl(params MediaSaveParams, url string) (*model.MediaAsset, error) {
+	if strings.HasPrefix(url, "data:") {
+		header, data, found := strings.Cut(strings.TrimPrefix(url, "data:"), ",")
+		if !found || !strings.HasSuffix(header, ";base64") {
+			return nil, errors.New("invalid data url")
+		}
+		if params.ContentType == "" {
+			params.ContentType = strings.TrimSuffix(header, ";base64")
+		}
+		if params.Size == 0 {
+			params.Size = int64(base64.StdEncoding.DecodedLen(len(data)))
+		}
+		return SaveMediaAsset(params, base64.NewDecoder(base64.StdEncoding, strings.NewReader(data)))
+	}
+	resp, err := DoDownloadRequest(url, "media_storage")
+	if err != nil {
+		return nil, err
+	}
+	return SaveMediaAssetFromResponse(params, resp)
+}
+
+// SaveMediaAssetFromResponse 保存上游返回的文件内容，会关闭响应体
+func SaveMediaAssetFromResponse(params MediaSaveParams, resp *http.Response) (*model.MediaAsset, error) {
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("download media failed: status=%d", resp.StatusCode)
+	}
+	if params.ContentType == "" {
+		params.ContentType = resp.Header.Get("Content-Type")
+	}
+	if params.Size == 0 && resp.ContentLength > 0 {
+		params.Size = resp.ContentLength
+	}
+	return SaveMediaAsset(params, resp.Body)
+}
+
+// GetMediaDownloadClient 返回下载上游文件所用的 http 客户端
+func GetMediaDownloadClient() *http.Client {
+	return &http.Client{
+		Transport: GetHttpClient().Transport,
+		Timeout:   time.Duration(operation_setting.GetMediaStorageSetting().DownloadTimeoutSeconds) * time.Second,
+	}
+}
+
+func OpenMediaAsset(asset *model.MediaAsset) (io.ReadCloser, error) {
+	store, err := storage.Get()
+	if err != nil {
+		return nil, err
+	}
+	return store.Open(asset.StorageKey)
+}
+
+// DeleteMediaAsset 删除存储后端中的文件与记录
+func DeleteMediaAsset(asset *model.MediaAsset) error {
+	store, err := storage.Get()
+	if err != nil {
+		return err
+	}
+	if err := store.Delete(asset.StorageKey); err != nil {
+		return err
+	}
+	return model.DeleteMediaAsset(asset.Id)
+}
+
+func mediaSign(id int, expires int64) string {
+	return common.GenerateHMAC(fmt.Sprintf("media_asset:%d:%d", id, expires))[:32]
+}
+
+// SignMediaUrl 返回带签名的网关地址，无需令牌即可在有效期内访问
+func SignMediaUrl(asset *model.MediaAsset) string {
+	ttl := int64(operation_setting.GetMediaStorageSetting().SignedUrlTTLSeconds)
+	if ttl <= 0 {
+		ttl = 86400
+	}
+	expires := common.GetTimestamp() + ttl
+	if asset.ExpiresAt > 0 && asset.ExpiresAt < expires {
+		expires = asset.ExpiresAt
+	}
+	return fmt.Sprintf("%s/v1/media/%d?expires=%d&sign=%s", strings.TrimSuffix(system_setting.ServerAddress, "/"), asset.Id, expires, mediaSign(asset.Id, expires))
+}
+
+func VerifyMediaSign(id int, expires string, sign string) bool {
+	expiresAt, err := strconv.ParseInt(expires, 10, 64)
+	if err != nil || expiresAt < common.GetTimestamp() {
+		return false
+	}
+	return hmac.Equal([]byte(sign), []byte(mediaSign(id, expiresAt)))
+}
+
+// GetMediaAssets 获取同一来源已保存的文件，未开启时返回空
+func GetMediaAssets(userId int, source string, sourceId string) []*model.MediaAsset {
+	if !operation_setting.GetMediaStorageSetting().Enabled {
+		return nil
+	}
+	assets, err := model.GetMediaAssetsBySource(userId, source, sourceId)
+	if err != nil {
+		common.SysError(fmt.Sprintf("failed to get media assets: source=%s, source_id=%s, error=%v", source, sourceId, err))
+		return nil
+	}
+	return assets
+}
+
+// GetMediaUrls 返回同一来源已保存文件的签名地址
+func GetMediaUrls(userId int, source string, sourceId string) []string {
+	assets := GetMediaAssets(userId, source, sourceId)
+	if len(assets) == 0 {
+		return nil
+	}
+	urls := make([]string, 0, len(assets))
+	for _, asset := range assets {
+		urls = append(urls, SignMediaUrl(asset))
+	}
+	return urls
+}
+
+// ServeMediaAsset 将保存的文件返回给客户端
+func ServeMediaAsset(c *gin.Context, asset *model.MediaAsset) {
+	reader, err := OpenMediaAsset(asset)
+	if err != nil {
+		common.SysError(fmt.Sprintf("failed to open media asset %d: %v", asset.Id, err))
+		c.JSON(http.StatusNotFound, gin.H{
+			"error": gin.H{
+				"message": "Media not found",
+				"type":    "invalid_request_error",
+			},
+		})
+		return
+	}
+	defer reader.Close()
+	contentType := asset.ContentType
+	if contentType == "" {
+		contentType = "application/octet-stream"
+	}
+	c.Header("Cache-Control", "private, max-age=86400")
+	c.DataFromReader(http.StatusOK, asset.Size, contentType, reader, nil)
+}
+
+// StartMediaAssetCleaner 定期删除过期的媒体文件
+func StartMediaAssetCleaner() {
+	for {
+		time.Sleep(time.Hour)
+		cleanExpiredMediaAssets(common.GetTimestamp())
+	}
+}
+
+func cleanExpiredMediaAssets(now int64) {
+	var store storage.Storage
+	for {
+		assets, err := model.GetExpiredMediaAssets(now, 100)
+		if err != nil {
+			common.SysError("failed to get expired media assets: " + err.Error())
+			return
+		}
+		if len(assets) == 0 {
+			return
+		}
+		if store == nil {
+			if store, err = storage.Get(); err != nil {
+				common.SysError("failed to get file storage: " + err.Error())
+				return
+			}
+		}
+		ids := make([]int, 0, len(assets))
+		for _, asset := range assets {
+			if err := store.Delete(asset.StorageKey); err != nil {
+				common.SysError(fmt.Sprintf("failed to delete media asset %s: %s", asset.StorageKey, err.Error()))
+				continue
+			}
+			ids = append(ids, asset.Id)
+		}
+		if len(ids) == 0 {
+			return
+		}
+		if err := model.DeleteMediaAssetsByIds(ids); err != nil {
+			common.SysError("failed to delete expired media assets: " + err.Error())
+			return
+		}
+		if len(assets) < 100 {
+			return
+		}
+	}
+}
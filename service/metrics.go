@@ -0,0 +1,60 @@
+package service
+
+import (
+	"strconv"
+	"time"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/common/metrics"
+	"github.com/QuantumNous/new-api/constant"
+	relaycommon "github.com/QuantumNous/new-api/relay/common"
+	"github.com/QuantumNous/new-api/types"
+
+	"github.com/gin-gonic/gin"
+)
+
+var (
+	relayRequestsTotal = metrics.NewCounterVec("new_api_relay_requests_total",
+		"Relayed requests by final status code.", "model", "channel", "group", "status")
+	relayRequestDuration = metrics.NewHistogramVec("new_api_relay_request_duration_seconds",
+		"Total time spent relaying a request, including retries.", metrics.DefaultBuckets, "model", "channel", "group")
+	relayFirstTokenDuration = metrics.NewHistogramVec("new_api_relay_first_token_seconds",
+		"Time to first token of streaming requests.", []float64{0.25, 0.5, 1, 2, 3, 5, 10, 20, 30, 60}, "model", "channel", "group")
+	relayRetries = metrics.NewHistogramVec("new_api_relay_retries",
+		"Number of channel retries per request.", []float64{0, 1, 2, 3, 5, 10}, "model", "group")
+	relayUpstreamErrorsTotal = metrics.NewCounterVec("new_api_relay_upstream_errors_total",
+		"Channel errors by error code and status code.", "channel", "error_code", "status")
+	quotaPreConsumedTotal = metrics.NewCounterVec("new_api_quota_pre_consumed_total",
+		"Quota pre-consumed before relaying.", "model", "group")
+)
+
+// RecordRelayMetrics 在请求结束后记录请求数、耗时、首字时间、重试次数与预扣费额度，relayInfo 可能为 nil
+func RecordRelayMetrics(c *gin.Context, relayInfo *relaycommon.RelayInfo, startTime time.Time) {
+	modelName := common.GetContextKeyString(c, constant.ContextKeyOriginalModel)
+	group := common.GetContextKeyString(c, constant.ContextKeyUsingGroup)
+	channel := ""
+	if channelId := common.GetContextKeyInt(c, constant.ContextKeyChannelId); channelId != 0 {
+		channel = strconv.Itoa(channelId)
+	}
+	status := strconv.Itoa(c.Writer.Status())
+
+	relayRequestsTotal.Inc(modelName, channel, group, status)
+	relayRequestDuration.Observe(time.Since(startTime).Seconds(), modelName, channel, group)
+	if useChannel := c.GetStringSlice("use_channel"); len(useChannel) > 0 {
+		relayRetries.Observe(float64(len(useChannel)-1), modelName, group)
+	}
+	if relayInfo == nil {
+		return
+	}
+	if relayInfo.IsStream && relayInfo.HasSendResponse() {
+		relayFirstTokenDuration.Observe(relayInfo.FirstResponseTime.Sub(relayInfo.StartTime).Seconds(), modelName, channel, group)
+	}
+	if relayInfo.FinalPreConsumedQuota > 0 {
+		quotaPreConsumedTotal.Add(float64(relayInfo.FinalPreConsumedQuota), modelName, group)
+	}
+}
+
+// RecordUpstreamErrorMetric 记录渠道返回的错误
+func RecordUpstreamErrorMetric(channelId int, err *types.NewAPIError) {
+	relayUpstreamErrorsTotal.Inc(strconv.Itoa(channelId), string(err.GetErrorCode()), strconv.Itoa(err.StatusCode))
+}
@@ -0,0 +1,59 @@
+package service
+
+import (
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/constant"
+	"github.com/QuantumNous/new-api/model"
+	"github.com/QuantumNous/new-api/setting/operation_setting"
+	"github.com/QuantumNous/new-api/setting/ratio_setting"
+
+	"github.com/gin-gonic/gin"
+)
+
+// GetModelFallbackChain 返回模型的回退链（不含模型本身）。令牌配置优先于分组配置，
+// 令牌模型限制不允许的模型会被跳过
+func GetModelFallbackChain(c *gin.Context, group, modelName string) []string {
+	var chain []string
+	if tokenChains, ok := common.GetContextKeyType[map[string][]string](c, constant.ContextKeyTokenModelFallback); ok {
+		chain = tokenChains[modelName]
+	}
+	if len(chain) == 0 {
+		chain = operation_setting.GetGroupModelFallbackChain(group, modelName)
+	}
+	if len(chain) == 0 {
+		return nil
+	}
+
+	var tokenModelLimit map[string]bool
+	if common.GetContextKeyBool(c, constant.ContextKeyTokenModelLimitEnabled) {
+		tokenModelLimit, _ = common.GetContextKeyType[map[string]bool](c, constant.ContextKeyTokenModelLimit)
+		if tokenModelLimit == nil {
+			tokenModelLimit = map[string]bool{}
+		}
+	}
+
+	seen := map[string]bool{modelName: true}
+	fallbackModels := make([]string, 0, len(chain))
+	for _, fallbackModel := range chain {
+		if fallbackModel == "" || seen[fallbackModel] {
+			continue
+		}
+		seen[fallbackModel] = true
+		if tokenModelLimit != nil && !tokenModelLimit[ratio_setting.FormatMatchingModelName(fallbackModel)] {
+			continue
+		}
+		fallbackModels = append(fallbackModels, fallbackModel)
+	}
+	return fallbackModels
+}
+
+// CacheGetFallbackChannel 按回退链依次为后续模型选择渠道，返回第一个有可用渠道的模型
+func CacheGetFallbackChannel(c *gin.Context, group string, fallbackModels []string) (*model.Channel, string) {
+	for _, fallbackModel := range fallbackModels {
+		channel, _, err := CacheGetRandomSatisfiedChannel(c, group, fallbackModel, 0)
+		if err == nil && channel != nil {
+			return channel, fallbackModel
+		}
+	}
+	return nil, ""
+}
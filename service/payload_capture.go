@@ -0,0 +1,497 @@
+package service
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/constant"
+	"github.com/QuantumNous/new-api/model"
+	"github.com/QuantumNous/new-api/service/storage"
+	"github.com/QuantumNous/new-api/setting/operation_setting"
+
+	"github.com/bytedance/gopkg/util/gopool"
+	"github.com/gin-gonic/gin"
+)
+
+// cappedBuffer 只保留前 max 个字节，写入始终返回成功
+type cappedBuffer struct {
+	mu        sync.Mutex
+	buf       bytes.Buffer
+	max       int
+	truncated bool
+}
+
+func (b *cappedBuffer) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	remain := b.max - b.buf.Len()
+	if remain < len(p) {
+		b.truncated = true
+		if remain > 0 {
+			b.buf.Write(p[:remain])
+		}
+		return len(p), nil
+	}
+	b.buf.Write(p)
+	return len(p), nil
+}
+
+func (b *cappedBuffer) String() (string, bool) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.String(), b.truncated
+}
+
+type teeReadCloser struct {
+	io.Reader
+	io.Closer
+}
+
+// PayloadUpstreamAttempt 一次发往上游的请求，重试与对冲时会有多次
+type PayloadUpstreamAttempt struct {
+	channelId int
+	url       string
+	body      *cappedBuffer
+	status    int
+	headers   http.Header
+}
+
+// SetResponse 记录上游返回的状态码与响应头
+func (attempt *PayloadUpstreamAttempt) SetResponse(resp *http.Response) {
+	if attempt == nil || resp == nil {
+		return
+	}
+	headers := resp.Header.Clone()
+	headers.Del("Set-Cookie")
+	attempt.status = resp.StatusCode
+	attempt.headers = headers
+}
+
+// PayloadCapture 记录单次请求发往上游的请求体、上游响应状态与返回给客户端的响应
+type PayloadCapture struct {
+	mu       sync.Mutex
+	maxBytes int
+	attempts []*PayloadUpstreamAttempt
+	writer   *payloadCaptureWriter
+	record   *model.PayloadCapture
+}
+
+// StartPayloadCapture 当前请求需要记录内容时包装 c.Writer 并返回记录器，否则返回 nil
+func StartPayloadCapture(c *gin.Context) *PayloadCapture {
+	captureSetting := operation_setting.GetPayloadCaptureSetting()
+	userId := common.GetContextKeyInt(c, constant.ContextKeyUserId)
+	tokenId := common.GetContextKeyInt(c, constant.ContextKeyTokenId)
+	group := common.GetContextKeyString(c, constant.ContextKeyUsingGroup)
+	if !captureSetting.ShouldCapture(userId, tokenId, group) {
+		return nil
+	}
+	maxBytes := captureSetting.MaxBodyBytes
+	if maxBytes <= 0 {
+		maxBytes = 64 * 1024
+	}
+	capture := &PayloadCapture{
+		maxBytes: maxBytes,
+		record: &model.PayloadCapture{
+			RequestId: c.GetString(common.RequestIdKey),
+			UserId:    userId,
+			TokenId:   tokenId,
+			Group:     group,
+			ModelName: common.GetContextKeyString(c, constant.ContextKeyOriginalModel),
+		},
+	}
+	capture.writer = &payloadCaptureWriter{
+		ResponseWriter: c.Writer,
+		body:           &cappedBuffer{max: maxBytes},
+		merger:         &streamMerger{maxBytes: maxBytes},
+	}
+	c.Writer = capture.writer
+	common.SetContextKey(c, constant.ContextKeyPayloadCapture, capture)
+	common.SetContextKey(c, constant.ContextKeyPayloadCaptured, true)
+	return capture
+}
+
+// CapturePayloadUpstreamRequest 记录发往上游的请求，当前请求不需要记录时返回 nil
+func CapturePayloadUpstreamRequest(c *gin.Context, req *http.Request, channelId int) *PayloadUpstreamAttempt {
+	capture, ok := common.GetContextKeyType[*PayloadCapture](c, constant.ContextKeyPayloadCapture)
+	if !ok || capture == nil {
+		return nil
+	}
+	// 不记录 URL 中的查询参数，部分渠道的密钥位于查询参数中
+	upstreamUrl := *req.URL
+	upstreamUrl.RawQuery = ""
+	upstreamUrl.User = nil
+	attempt := &PayloadUpstreamAttempt{
+		channelId: channelId,
+		url:       req.Method + " " + upstreamUrl.String(),
+		body:      &cappedBuffer{max: capture.maxBytes},
+	}
+	if req.GetBody != nil {
+		if body, err := req.GetBody(); err == nil {
+			_, _ = io.Copy(attempt.body, body)
+			_ = body.Close()
+		}
+	} else if req.Body != nil {
+		req.Body = teeReadCloser{Reader: io.TeeReader(req.Body, attempt.body), Closer: req.Body}
+	}
+	capture.mu.Lock()
+	capture.attempts = append(capture.attempts, attempt)
+	capture.mu.Unlock()
+	return attempt
+}
+
+// Finish 在请求结束后异步保存记录
+func (capture *PayloadCapture) Finish() {
+	if capture == nil {
+		return
+	}
+	record := capture.record
+	record.CreatedAt = common.GetTimestamp()
+	record.StatusCode = capture.writer.Status()
+	record.IsStream = capture.writer.stream
+
+	capture.mu.Lock()
+	// 优先使用成功的那次上游请求
+	var attempt *PayloadUpstreamAttempt
+	for _, a := range capture.attempts {
+		if attempt == nil || a.status == http.StatusOK || attempt.status != http.StatusOK {
+			attempt = a
+		}
+	}
+	capture.mu.Unlock()
+	truncated := false
+	if attempt != nil {
+		record.ChannelId = attempt.channelId
+		record.UpstreamUrl = attempt.url
+		record.UpstreamStatus = attempt.status
+		record.RequestBody, truncated = attempt.body.String()
+		if attempt.headers != nil {
+			record.UpstreamHeaders = common.GetJsonString(attempt.headers)
+		}
+	}
+	var responseTruncated bool
+	if record.IsStream {
+		record.ResponseBody, responseTruncated = capture.writer.merger.result()
+	} else {
+		record.ResponseBody, responseTruncated = capture.writer.body.String()
+	}
+	record.Truncated = truncated || responseTruncated
+
+	gopool.Go(func() {
+		if err := savePayloadCapture(record); err != nil {
+			common.SysError(fmt.Sprintf("failed to save payload capture %s: %s", record.RequestId, err.Error()))
+		}
+	})
+}
+
+// payloadCaptureBlob 使用文件存储时保存到存储后端的内容
+type payloadCaptureBlob struct {
+	RequestBody     string `json:"request_body"`
+	UpstreamHeaders string `json:"upstream_headers"`
+	ResponseBody    string `json:"response_body"`
+}
+
+func savePayloadCapture(record *model.PayloadCapture) error {
+	if operation_setting.GetPayloadCaptureSetting().Storage == operation_setting.PayloadCaptureStorageFile {
+		store, err := storage.Get()
+		if err != nil {
+			return err
+		}
+		data, err := common.Marshal(payloadCaptureBlob{
+			RequestBody:     record.RequestBody,
+			UpstreamHeaders: record.UpstreamHeaders,
+			ResponseBody:    record.ResponseBody,
+		})
+		if err != nil {
+			return err
+		}
+		key := fmt.Sprintf("payload_captures/%s/%s.json", time.Unix(record.CreatedAt, 0).Format("2006-01-02"), record.RequestId)
+		if _, err := store.Save(key, bytes.NewReader(data)); err != nil {
+			return err
+		}
+		record.StorageKey = key
+		record.RequestBody = ""
+		record.UpstreamHeaders = ""
+		record.ResponseBody = ""
+	}
+	return record.Insert()
+}
+
+// GetPayloadCapture 按 request_id 获取记录，内容保存在存储后端时一并读取
+func GetPayloadCapture(requestId string) (*model.PayloadCapture, error) {
+	record, err := model.GetPayloadCaptureByRequestId(requestId)
+	if err != nil {
+		return nil, err
+	}
+	if record.StorageKey == "" {
+		return record, nil
+	}
+	store, err := storage.Get()
+	if err != nil {
+		return nil, err
+	}
+	reader, err := store.Open(record.StorageKey)
+	if err != nil {
+		return nil, err
+	}
+	defer reader.Close()
+	data, err := io.ReadAll(reader)
+	if err != nil {
+		return nil, err
+	}
+	var blob payloadCaptureBlob
+	if err := common.Unmarshal(data, &blob); err != nil {
+		return nil, err
+	}
+	record.RequestBody = blob.RequestBody
+	record.UpstreamHeaders = blob.UpstreamHeaders
+	record.ResponseBody = blob.ResponseBody
+	return record, nil
+}
+
+// StartPayloadCaptureCleaner 定期清理超过保留天数的记录
+func StartPayloadCaptureCleaner() {
+	for {
+		time.Sleep(time.Hour)
+		retentionDays := operation_setting.GetPayloadCaptureSetting().RetentionDays
+		if retentionDays <= 0 {
+			continue
+		}
+		cleanPayloadCaptures(common.GetTimestamp() - int64(retentionDays)*86400)
+	}
+}
+
+func cleanPayloadCaptures(targetTimestamp int64) {
+	var store storage.Storage
+	for {
+		captures, err := model.GetExpiredPayloadCaptures(targetTimestamp, 100)
+		if err != nil {
+			common.SysError("failed to get expired payload captures: " + err.Error())
+			return
+		}
+		ids := make([]int, 0, len(captures))
+		for _, capture := range captures {
+			ids = append(ids, capture.Id)
+			if capture.StorageKey == "" {
+				continue
+			}
+			if store == nil {
+				if store, err = storage.Get(); err != nil {
+					common.SysError("failed to get file storage: " + err.Error())
+					return
+				}
+			}
+			if err := store.Delete(capture.StorageKey); err != nil {
+				common.SysError(fmt.Sprintf("failed to delete payload capture %s: %s", capture.StorageKey, err.Error()))
+			}
+		}
+		if err := model.DeletePayloadCapturesByIds(ids); err != nil {
+			common.SysError("failed to delete expired payload captures: " + err.Error())
+			return
+		}
+		if len(captures) < 100 {
+			return
+		}
+	}
+}
+
+// payloadCaptureWriter 记录返回给客户端的响应，流式响应按事件合并为完整内容
+type payloadCaptureWriter struct {
+	gin.ResponseWriter
+	decided bool
+	stream  bool
+	pending []byte
+	body    *cappedBuffer
+	merger  *streamMerger
+}
+
+func (w *payloadCaptureWriter) Write(data []byte) (int, error) {
+	if !w.decided {
+		w.decided = true
+		w.stream = strings.Contains(w.Header().Get("Content-Type"), "text/event-stream")
+	}
+	n, err := w.ResponseWriter.Write(data)
+	if n <= 0 {
+		return n, err
+	}
+	if !w.stream {
+		_, _ = w.body.Write(data[:n])
+		return n, err
+	}
+	w.pending = append(w.pending, data[:n]...)
+	for {
+		idx := bytes.Index(w.pending, []byte("\n\n"))
+		if idx < 0 {
+			break
+		}
+		w.merger.processEvent(string(w.pending[:idx]))
+		w.pending = w.pending[idx+2:]
+	}
+	return n, err
+}
+
+func (w *payloadCaptureWriter) WriteString(s string) (int, error) {
+	return w.Write([]byte(s))
+}
+
+// streamMerger 将 OpenAI、Claude、Gemini 与 Responses 格式的流式事件合并为完整内容
+type streamMerger struct {
+	maxBytes     int
+	events       int
+	id           string
+	model        string
+	content      strings.Builder
+	reasoning    strings.Builder
+	finishReason string
+	usage        any
+	final        any
+	errorEvent   any
+	truncated    bool
+}
+
+func (m *streamMerger) appendText(builder *strings.Builder, text string) {
+	if text == "" {
+		return
+	}
+	if m.content.Len()+m.reasoning.Len()+len(text) > m.maxBytes {
+		m.truncated = true
+		return
+	}
+	builder.WriteString(text)
+}
+
+func (m *streamMerger) processEvent(event string) {
+	for _, line := range strings.Split(event, "\n") {
+		if !strings.HasPrefix(line, "data:") {
+			continue
+		}
+		payload := strings.TrimSpace(strings.TrimPrefix(line, "data:"))
+		if payload == "" || payload == "[DONE]" {
+			continue
+		}
+		var data map[string]any
+		if err := common.UnmarshalJsonStr(payload, &data); err != nil {
+			continue
+		}
+		m.events++
+		m.processData(data)
+	}
+}
+
+func (m *streamMerger) processData(data map[string]any) {
+	if id, ok := data["id"].(string); ok && m.id == "" {
+		m.id = id
+	}
+	if modelName, ok := data["model"].(string); ok && m.model == "" {
+		m.model = modelName
+	}
+	if usage, ok := data["usage"]; ok && usage != nil {
+		m.usage = usage
+	}
+	if errorEvent, ok := data["error"]; ok && errorEvent != nil {
+		m.errorEvent = errorEvent
+	}
+	// OpenAI Chat Completions 与 Completions
+	if choices, ok := data["choices"].([]any); ok {
+		for _, item := range choices {
+			choice, _ := item.(map[string]any)
+			if delta, ok := choice["delta"].(map[string]any); ok {
+				m.appendText(&m.content, stringField(delta, "content"))
+				m.appendText(&m.reasoning, stringField(delta, "reasoning_content"))
+				m.appendText(&m.reasoning, stringField(delta, "reasoning"))
+			}
+			m.appendText(&m.content, stringField(choice, "text"))
+			if reason := stringField(choice, "finish_reason"); reason != "" {
+				m.finishReason = reason
+			}
+		}
+	}
+	// Gemini
+	if candidates, ok := data["candidates"].([]any); ok {
+		for _, item := range candidates {
+			candidate, _ := item.(map[string]any)
+			if content, ok := candidate["content"].(map[string]any); ok {
+				parts, _ := content["parts"].([]any)
+				for _, p := range parts {
+					part, _ := p.(map[string]any)
+					if thought, _ := part["thought"].(bool); thought {
+						m.appendText(&m.reasoning, stringField(part, "text"))
+					} else {
+						m.appendText(&m.content, stringField(part, "text"))
+					}
+				}
+			}
+			if reason := stringField(candidate, "finishReason"); reason != "" {
+				m.finishReason = reason
+			}
+		}
+		if usage, ok := data["usageMetadata"]; ok {
+			m.usage = usage
+		}
+	}
+	// Claude 与 Responses
+	switch stringField(data, "type") {
+	case "message_start":
+		if message, ok := data["message"].(map[string]any); ok {
+			m.id = stringField(message, "id")
+			m.model = stringField(message, "model")
+			if usage, ok := message["usage"]; ok {
+				m.usage = usage
+			}
+		}
+	case "content_block_delta":
+		if delta, ok := data["delta"].(map[string]any); ok {
+			m.appendText(&m.content, stringField(delta, "text"))
+			m.appendText(&m.reasoning, stringField(delta, "thinking"))
+		}
+	case "message_delta":
+		if delta, ok := data["delta"].(map[string]any); ok {
+			if reason := stringField(delta, "stop_reason"); reason != "" {
+				m.finishReason = reason
+			}
+		}
+	case "response.output_text.delta":
+		m.appendText(&m.content, stringField(data, "delta"))
+	case "response.completed", "response.incomplete", "response.failed":
+		// 完成事件中已包含完整的响应
+		m.final = data["response"]
+	}
+}
+
+func stringField(data map[string]any, key string) string {
+	if data == nil {
+		return ""
+	}
+	value, _ := data[key].(string)
+	return value
+}
+
+func (m *streamMerger) result() (string, bool) {
+	if m.final != nil {
+		return common.GetJsonString(m.final), m.truncated
+	}
+	merged := map[string]any{
+		"id":      m.id,
+		"model":   m.model,
+		"content": m.content.String(),
+		"events":  m.events,
+	}
+	if m.reasoning.Len() > 0 {
+		merged["reasoning_content"] = m.reasoning.String()
+	}
+	if m.finishReason != "" {
+		merged["finish_reason"] = m.finishReason
+	}
+	if m.usage != nil {
+		merged["usage"] = m.usage
+	}
+	if m.errorEvent != nil {
+		merged["error"] = m.errorEvent
+	}
+	return common.GetJsonString(merged), m.truncated
+}
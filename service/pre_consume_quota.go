@@ -3,8 +3,11 @@ package service
 import (
 	"fmt"
 	"net/http"
+	"sync"
+	"time"
 
 	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/common/event"
 	"github.com/QuantumNous/new-api/logger"
 	"github.com/QuantumNous/new-api/model"
 	relaycommon "github.com/QuantumNous/new-api/relay/common"
@@ -42,6 +45,10 @@ func PreConsumeQuota(c *gin.Context, preConsumedQuota int, relayInfo *relaycommo
 		return types.NewErrorWithStatusCode(fmt.Errorf("预扣费额度失败, 用户剩余额度: %s, 需要预扣费额度: %s", logger.FormatQuota(userQuota), logger.FormatQuota(preConsumedQuota)), types.ErrorCodeInsufficientUserQuota, http.StatusForbidden, types.ErrOptionWithSkipRetry(), types.ErrOptionWithNoRecordErrorLog())
 	}
 
+	if newAPIError := CheckQuotaBudget(relayInfo, preConsumedQuota); newAPIError != nil {
+		return newAPIError
+	}
+
 	trustQuota := common.GetTrustQuota()
 
 	relayInfo.UserQuota = userQuota
@@ -73,7 +80,58 @@ func PreConsumeQuota(c *gin.Context, preConsumedQuota int, relayInfo *relaycommo
 			return types.NewError(err, types.ErrorCodeUpdateDataError, types.ErrOptionWithSkipRetry())
 		}
 		logger.LogInfo(c, fmt.Sprintf("用户 %d 预扣费 %s, 预扣费后剩余额度: %s", relayInfo.UserId, logger.FormatQuota(preConsumedQuota), logger.FormatQuota(userQuota-preConsumedQuota)))
+		recordQuotaBudgetUsage(relayInfo, preConsumedQuota)
 	}
 	relayInfo.FinalPreConsumedQuota = preConsumedQuota
 	return nil
 }
+
+// CheckQuotaBudget 检查用户与令牌的周期预算，预算用尽时拒绝请求直到周期重置
+func CheckQuotaBudget(relayInfo *relaycommon.RelayInfo, preConsumedQuota int) *types.NewAPIError {
+	tokenId := relayInfo.TokenId
+	if relayInfo.IsPlayground {
+		tokenId = 0
+	}
+	budget, err := model.GetExceededQuotaBudget(relayInfo.UserId, tokenId, preConsumedQuota)
+	if err != nil {
+		return types.NewError(err, types.ErrorCodeQueryDataError, types.ErrOptionWithSkipRetry())
+	}
+	if budget == nil {
+		return nil
+	}
+	publishBudgetReached(relayInfo.UserId, budget)
+	return types.NewErrorWithStatusCode(fmt.Errorf("%s%s预算不足, 预算: %s, 已使用: %s, 需要预扣费额度: %s, 将于 %s 重置",
+		budget.GetSubjectName(), budget.GetPeriodName(), logger.FormatQuota(budget.Quota), logger.FormatQuota(budget.UsedQuota),
+		logger.FormatQuota(preConsumedQuota), time.Unix(budget.ResetTime, 0).Format("2006-01-02 15:04:05")),
+		types.ErrorCodeQuotaBudgetExceeded, http.StatusForbidden, types.ErrOptionWithSkipRetry(), types.ErrOptionWithNoRecordErrorLog())
+}
+
+// 每个预算周期内只发布一次预算耗尽事件，budget id -> 已发布的周期开始时间
+var budgetReachedWindows sync.Map
+
+func publishBudgetReached(userId int, budget *model.QuotaBudget) {
+	if window, ok := budgetReachedWindows.Load(budget.Id); ok && window.(int64) == budget.WindowStart {
+		return
+	}
+	budgetReachedWindows.Store(budget.Id, budget.WindowStart)
+	event.Publish(event.BudgetReached, userId, event.BudgetData{
+		BudgetId:    budget.Id,
+		SubjectType: budget.SubjectType,
+		SubjectId:   budget.SubjectId,
+		Period:      budget.Period,
+		Quota:       budget.Quota,
+		UsedQuota:   budget.UsedQuota,
+		ResetTime:   budget.ResetTime,
+	})
+}
+
+// recordQuotaBudgetUsage 将额度变化计入周期预算，quota 为负数表示退还
+func recordQuotaBudgetUsage(relayInfo *relaycommon.RelayInfo, quota int) {
+	tokenId := relayInfo.TokenId
+	if relayInfo.IsPlayground {
+		tokenId = 0
+	}
+	if err := model.RecordQuotaBudgetUsage(relayInfo.UserId, tokenId, quota); err != nil {
+		common.SysLog(fmt.Sprintf("failed to record quota budget usage: user_id=%d, token_id=%d, error=%v", relayInfo.UserId, tokenId, err))
+	}
+}
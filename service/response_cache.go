@@ -0,0 +1,146 @@
+package service
+
+import (
+	"container/list"
+	"sync"
+	"time"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/dto"
+	"github.com/QuantumNous/new-api/setting/operation_setting"
+)
+
+const responseCacheKeyPrefix = "response_cache:"
+
+// ResponseCacheEntry 缓存的上游响应，Body 为返回给客户端的原始内容（流式请求为完整的 SSE 数据）
+type ResponseCacheEntry struct {
+	ContentType string    `json:"content_type"`
+	Body        []byte    `json:"body"`
+	IsStream    bool      `json:"is_stream"`
+	Usage       dto.Usage `json:"usage"`
+	CreatedAt   int64     `json:"created_at"`
+}
+
+type responseCacheBackend interface {
+	get(key string) (*ResponseCacheEntry, bool)
+	set(key string, entry *ResponseCacheEntry, ttl time.Duration)
+}
+
+type redisResponseCache struct{}
+
+func (redisResponseCache) get(key string) (*ResponseCacheEntry, bool) {
+	data, err := common.RedisGet(responseCacheKeyPrefix + key)
+	if err != nil {
+		return nil, false
+	}
+	var entry ResponseCacheEntry
+	if err := common.UnmarshalJsonStr(data, &entry); err != nil {
+		return nil, false
+	}
+	return &entry, true
+}
+
+func (redisResponseCache) set(key string, entry *ResponseCacheEntry, ttl time.Duration) {
+	data, err := common.Marshal(entry)
+	if err != nil {
+		common.SysError("failed to marshal response cache entry: " + err.Error())
+		return
+	}
+	if err := common.RedisSet(responseCacheKeyPrefix+key, string(data), ttl); err != nil {
+		common.SysError("failed to save response cache entry: " + err.Error())
+	}
+}
+
+type memoryResponseCacheItem struct {
+	key      string
+	entry    *ResponseCacheEntry
+	expireAt time.Time
+}
+
+// memoryResponseCache 按最近使用淘汰的内存缓存，仅在当前节点内生效
+type memoryResponseCache struct {
+	mu    sync.Mutex
+	ll    *list.List
+	items map[string]*list.Element
+}
+
+var defaultMemoryResponseCache = &memoryResponseCache{
+	ll:    list.New(),
+	items: make(map[string]*list.Element),
+}
+
+func (m *memoryResponseCache) get(key string) (*ResponseCacheEntry, bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	elem, ok := m.items[key]
+	if !ok {
+		return nil, false
+	}
+	item := elem.Value.(*memoryResponseCacheItem)
+	if time.Now().After(item.expireAt) {
+		m.ll.Remove(elem)
+		delete(m.items, key)
+		return nil, false
+	}
+	m.ll.MoveToFront(elem)
+	return item.entry, true
+}
+
+func (m *memoryResponseCache) set(key string, entry *ResponseCacheEntry, ttl time.Duration) {
+	maxEntries := operation_setting.GetResponseCacheSetting().MaxEntries
+	if maxEntries <= 0 {
+		return
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	item := &memoryResponseCacheItem{key: key, entry: entry, expireAt: time.Now().Add(ttl)}
+	if elem, ok := m.items[key]; ok {
+		elem.Value = item
+		m.ll.MoveToFront(elem)
+	} else {
+		m.items[key] = m.ll.PushFront(item)
+	}
+	for m.ll.Len() > maxEntries {
+		oldest := m.ll.Back()
+		m.ll.Remove(oldest)
+		delete(m.items, oldest.Value.(*memoryResponseCacheItem).key)
+	}
+}
+
+func getResponseCacheBackend() responseCacheBackend {
+	switch operation_setting.GetResponseCacheSetting().Backend {
+	case operation_setting.ResponseCacheBackendRedis:
+		if common.RedisEnabled {
+			return redisResponseCache{}
+		}
+	case operation_setting.ResponseCacheBackendMemory:
+		return defaultMemoryResponseCache
+	default:
+		if common.RedisEnabled {
+			return redisResponseCache{}
+		}
+	}
+	return defaultMemoryResponseCache
+}
+
+// GetResponseCache 查询缓存的响应
+func GetResponseCache(key string) (*ResponseCacheEntry, bool) {
+	return getResponseCacheBackend().get(key)
+}
+
+// SetResponseCache 写入缓存，ttl 不大于 0 时不缓存
+func SetResponseCache(key string, entry *ResponseCacheEntry, ttl time.Duration) {
+	if ttl <= 0 {
+		return
+	}
+	getResponseCacheBackend().set(key, entry, ttl)
+}
+
+// GetResponseCacheHitQuota 按配置的计费方式计算命中缓存时的实际扣费
+func GetResponseCacheHitQuota(quota int) int {
+	setting := operation_setting.GetResponseCacheSetting()
+	if setting.BillingMode != operation_setting.ResponseCacheBillingRatio || setting.BillingRatio <= 0 {
+		return 0
+	}
+	return int(float64(quota) * setting.BillingRatio)
+}
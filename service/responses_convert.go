@@ -0,0 +1,692 @@
+package service
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/dto"
+)
+
+// ResponsesRequestToChatCompletionsRequest 将 Responses API 请求转换为 Chat Completions 请求，
+// 用于不支持 Responses API 的渠道，内置工具等无法转换的内容返回错误
+func ResponsesRequestToChatCompletionsRequest(req *dto.OpenAIResponsesRequest) (*dto.GeneralOpenAIRequest, error) {
+	chatReq := &dto.GeneralOpenAIRequest{
+		Model:          req.Model,
+		Stream:         req.Stream,
+		MaxTokens:      req.MaxOutputTokens,
+		TopP:           req.TopP,
+		User:           req.User,
+		ToolChoice:     convertResponsesToolChoice(req.ToolChoice),
+		ResponseFormat: convertResponsesTextFormat(req.Text),
+	}
+	if req.Temperature != 0 {
+		temperature := req.Temperature
+		chatReq.Temperature = &temperature
+	}
+	if req.Reasoning != nil && req.Reasoning.Effort != "" {
+		chatReq.ReasoningEffort = req.Reasoning.Effort
+	}
+	if len(req.ParallelToolCalls) > 0 {
+		var parallel bool
+		if err := common.Unmarshal(req.ParallelToolCalls, &parallel); err == nil {
+			chatReq.ParallelTooCalls = &parallel
+		}
+	}
+
+	tools, err := convertResponsesTools(req.Tools)
+	if err != nil {
+		return nil, err
+	}
+	chatReq.Tools = tools
+	if len(tools) == 0 {
+		chatReq.ToolChoice = nil
+		chatReq.ParallelTooCalls = nil
+	}
+
+	messages, err := convertResponsesInput(req.Instructions, req.Input)
+	if err != nil {
+		return nil, err
+	}
+	chatReq.Messages = messages
+	return chatReq, nil
+}
+
+type responsesChatMessage struct {
+	message   dto.Message
+	toolCalls []dto.ToolCallRequest
+}
+
+func convertResponsesInput(instructions json.RawMessage, input json.RawMessage) ([]dto.Message, error) {
+	var builders []*responsesChatMessage
+	if len(instructions) > 0 && common.GetJsonType(instructions) == "string" {
+		var text string
+		if err := common.Unmarshal(instructions, &text); err == nil && text != "" {
+			msg := dto.Message{Role: "system"}
+			msg.SetStringContent(text)
+			builders = append(builders, &responsesChatMessage{message: msg})
+		}
+	}
+
+	switch common.GetJsonType(input) {
+	case "string":
+		var text string
+		if err := common.Unmarshal(input, &text); err != nil {
+			return nil, fmt.Errorf("invalid input: %w", err)
+		}
+		msg := dto.Message{Role: "user"}
+		msg.SetStringContent(text)
+		builders = append(builders, &responsesChatMessage{message: msg})
+	case "array":
+		var items []map[string]any
+		if err := common.Unmarshal(input, &items); err != nil {
+			return nil, fmt.Errorf("invalid input: %w", err)
+		}
+		// 推理内容挂到其后的 assistant 消息上
+		pendingReasoning := ""
+		lastAssistant := func() *responsesChatMessage {
+			if len(builders) > 0 && builders[len(builders)-1].message.Role == "assistant" {
+				return builders[len(builders)-1]
+			}
+			b := &responsesChatMessage{message: dto.Message{Role: "assistant"}}
+			builders = append(builders, b)
+			return b
+		}
+		for _, item := range items {
+			itemType := common.Interface2String(item["type"])
+			if itemType == "" && item["role"] != nil {
+				itemType = dto.ResponsesItemTypeMessage
+			}
+			switch itemType {
+			case dto.ResponsesItemTypeMessage:
+				role := common.Interface2String(item["role"])
+				if role == "developer" {
+					role = "system"
+				}
+				msg := dto.Message{Role: role}
+				setResponsesMessageContent(&msg, item["content"])
+				if role == "assistant" && pendingReasoning != "" {
+					msg.ReasoningContent = pendingReasoning
+					pendingReasoning = ""
+				}
+				builders = append(builders, &responsesChatMessage{message: msg})
+			case dto.ResponsesItemTypeFunctionCall:
+				b := lastAssistant()
+				if pendingReasoning != "" {
+					b.message.ReasoningContent += pendingReasoning
+					pendingReasoning = ""
+				}
+				b.toolCalls = append(b.toolCalls, dto.ToolCallRequest{
+					ID:   common.Interface2String(item["call_id"]),
+					Type: "function",
+					Function: dto.FunctionRequest{
+						Name:      common.Interface2String(item["name"]),
+						Arguments: common.Interface2String(item["arguments"]),
+					},
+				})
+			case "function_call_output":
+				msg := dto.Message{Role: "tool", ToolCallId: common.Interface2String(item["call_id"])}
+				msg.SetStringContent(responsesOutputText(item["output"]))
+				builders = append(builders, &responsesChatMessage{message: msg})
+			case dto.ResponsesItemTypeReasoning:
+				summaryText := ""
+				summaries, _ := item["summary"].([]any)
+				for _, summary := range summaries {
+					if part, ok := summary.(map[string]any); ok {
+						summaryText += common.Interface2String(part["text"])
+					}
+				}
+				// encrypted_content 只有 OpenAI 能解密，没有摘要时推理内容无法转换
+				if summaryText == "" && common.Interface2String(item["encrypted_content"]) != "" {
+					return nil, fmt.Errorf("reasoning item with only encrypted_content is not supported by this channel")
+				}
+				pendingReasoning += summaryText
+			}
+		}
+	case "":
+	default:
+		return nil, fmt.Errorf("invalid input type: %s", common.GetJsonType(input))
+	}
+
+	messages := make([]dto.Message, 0, len(builders))
+	for _, b := range builders {
+		if len(b.toolCalls) > 0 {
+			b.message.SetToolCalls(b.toolCalls)
+			if b.message.Content == nil {
+				b.message.SetStringContent("")
+			}
+		}
+		messages = append(messages, b.message)
+	}
+	return messages, nil
+}
+
+func setResponsesMessageContent(msg *dto.Message, content any) {
+	if text, ok := content.(string); ok {
+		msg.SetStringContent(text)
+		return
+	}
+	parts, _ := content.([]any)
+	mediaContents := make([]dto.MediaContent, 0, len(parts))
+	allText := true
+	for _, p := range parts {
+		part, ok := p.(map[string]any)
+		if !ok {
+			continue
+		}
+		switch common.Interface2String(part["type"]) {
+		case "input_text", "output_text", "text", "refusal":
+			text := common.Interface2String(part["text"])
+			if text == "" {
+				text = common.Interface2String(part["refusal"])
+			}
+			mediaContents = append(mediaContents, dto.MediaContent{Type: dto.ContentTypeText, Text: text})
+		case "input_image":
+			imageUrl := &dto.MessageImageUrl{Detail: common.Interface2String(part["detail"])}
+			switch v := part["image_url"].(type) {
+			case string:
+				imageUrl.Url = v
+			case map[string]any:
+				imageUrl.Url = common.Interface2String(v["url"])
+			}
+			if imageUrl.Url == "" {
+				continue
+			}
+			if imageUrl.Detail == "" {
+				imageUrl.Detail = "auto"
+			}
+			allText = false
+			mediaContents = append(mediaContents, dto.MediaContent{Type: dto.ContentTypeImageURL, ImageUrl: imageUrl})
+		case "input_file":
+			file := &dto.MessageFile{
+				FileName: common.Interface2String(part["filename"]),
+				FileData: common.Interface2String(part["file_data"]),
+				FileId:   common.Interface2String(part["file_id"]),
+			}
+			if file.FileData == "" && file.FileId == "" {
+				continue
+			}
+			allText = false
+			mediaContents = append(mediaContents, dto.MediaContent{Type: dto.ContentTypeFile, File: file})
+		}
+	}
+	if allText {
+		texts := make([]string, 0, len(mediaContents))
+		for _, mc := range mediaContents {
+			texts = append(texts, mc.Text)
+		}
+		msg.SetStringContent(strings.Join(texts, "\n"))
+		return
+	}
+	msg.SetMediaContent(mediaContents)
+}
+
+// responsesOutputText function_call_output 的 output 可以是字符串或内容数组
+func responsesOutputText(output any) string {
+	switch v := output.(type) {
+	case string:
+		return v
+	case []any:
+		var sb strings.Builder
+		for _, p := range v {
+			if part, ok := p.(map[string]any); ok {
+				sb.WriteString(common.Interface2String(part["text"]))
+			}
+		}
+		return sb.String()
+	case nil:
+		return ""
+	default:
+		data, _ := common.Marshal(v)
+		return string(data)
+	}
+}
+
+func convertResponsesTools(raw json.RawMessage) ([]dto.ToolCallRequest, error) {
+	if len(raw) == 0 || common.GetJsonType(raw) != "array" {
+		return nil, nil
+	}
+	var tools []map[string]any
+	if err := common.Unmarshal(raw, &tools); err != nil {
+		return nil, fmt.Errorf("invalid tools: %w", err)
+	}
+	result := make([]dto.ToolCallRequest, 0, len(tools))
+	for _, tool := range tools {
+		// 内置工具（web_search_preview、file_search 等）由 OpenAI 执行，其他渠道无法提供
+		if toolType := common.Interface2String(tool["type"]); toolType != "function" {
+			return nil, fmt.Errorf("tool type %s is not supported by this channel", toolType)
+		}
+		result = append(result, dto.ToolCallRequest{
+			Type: "function",
+			Function: dto.FunctionRequest{
+				Name:        common.Interface2String(tool["name"]),
+				Description: common.Interface2String(tool["description"]),
+				Parameters:  tool["parameters"],
+			},
+		})
+	}
+	return result, nil
+}
+
+func convertResponsesToolChoice(raw json.RawMessage) any {
+	if len(raw) == 0 {
+		return nil
+	}
+	switch common.GetJsonType(raw) {
+	case "string":
+		var choice string
+		_ = common.Unmarshal(raw, &choice)
+		return choice
+	case "object":
+		var choice map[string]any
+		if err := common.Unmarshal(raw, &choice); err != nil {
+			return nil
+		}
+		if common.Interface2String(choice["type"]) == "function" {
+			return map[string]any{
+				"type":     "function",
+				"function": map[string]any{"name": common.Interface2String(choice["name"])},
+			}
+		}
+	}
+	return nil
+}
+
+func convertResponsesTextFormat(raw json.RawMessage) *dto.ResponseFormat {
+	if len(raw) == 0 {
+		return nil
+	}
+	var text struct {
+		Format map[string]any `json:"format"`
+	}
+	if err := common.Unmarshal(raw, &text); err != nil || text.Format == nil {
+		return nil
+	}
+	switch common.Interface2String(text.Format["type"]) {
+	case "json_object":
+		return &dto.ResponseFormat{Type: "json_object"}
+	case "json_schema":
+		schema := make(map[string]any)
+		for _, key := range []string{"name", "description", "schema", "strict"} {
+			if v, ok := text.Format[key]; ok {
+				schema[key] = v
+			}
+		}
+		data, err := common.Marshal(schema)
+		if err != nil {
+			return nil
+		}
+		return &dto.ResponseFormat{Type: "json_schema", JsonSchema: data}
+	}
+	return nil
+}
+
+// ChatUsageToResponsesUsage 将 Chat Completions 的用量转换为 Responses API 的格式
+func ChatUsageToResponsesUsage(usage *dto.Usage) *dto.Usage {
+	if usage == nil {
+		return nil
+	}
+	cachedTokens := usage.PromptTokensDetails.CachedTokens
+	if usage.PromptCacheHitTokens > 0 && cachedTokens == 0 {
+		cachedTokens = usage.PromptCacheHitTokens
+	}
+	return &dto.Usage{
+		InputTokens:  usage.PromptTokens,
+		OutputTokens: usage.CompletionTokens,
+		TotalTokens:  usage.PromptTokens + usage.CompletionTokens,
+		InputTokensDetails: &dto.InputTokenDetails{
+			CachedTokens: cachedTokens,
+		},
+		OutputTokensDetails: &dto.OutputTokenDetails{
+			ReasoningTokens: usage.CompletionTokenDetails.ReasoningTokens,
+		},
+	}
+}
+
+// NewResponsesFromRequest 根据请求构造 Responses 响应对象的公共字段
+func NewResponsesFromRequest(req *dto.OpenAIResponsesRequest, responseId string, createdAt int) *dto.OpenAIResponsesResponse {
+	resp := &dto.OpenAIResponsesResponse{
+		ID:                 responseId,
+		Object:             "response",
+		CreatedAt:          createdAt,
+		Status:             "in_progress",
+		MaxOutputTokens:    int(req.MaxOutputTokens),
+		Model:              req.Model,
+		Output:             []dto.ResponsesOutput{},
+		ParallelToolCalls:  true,
+		PreviousResponseID: req.PreviousResponseID,
+		Reasoning:          req.Reasoning,
+		Temperature:        req.Temperature,
+		ToolChoice:         "auto",
+		Tools:              []map[string]any{},
+		TopP:               req.TopP,
+		Truncation:         "disabled",
+		Metadata:           req.Metadata,
+	}
+	if len(req.Instructions) > 0 && common.GetJsonType(req.Instructions) == "string" {
+		_ = common.Unmarshal(req.Instructions, &resp.Instructions)
+	}
+	if len(req.ToolChoice) > 0 && common.GetJsonType(req.ToolChoice) == "string" {
+		_ = common.Unmarshal(req.ToolChoice, &resp.ToolChoice)
+	}
+	if len(req.Tools) > 0 {
+		_ = common.Unmarshal(req.Tools, &resp.Tools)
+	}
+	if len(req.ParallelToolCalls) > 0 {
+		_ = common.Unmarshal(req.ParallelToolCalls, &resp.ParallelToolCalls)
+	}
+	if req.User != "" {
+		resp.User, _ = common.Marshal(req.User)
+	}
+	return resp
+}
+
+// finishResponses 根据 finish_reason 设置最终状态与用量
+func finishResponses(resp *dto.OpenAIResponsesResponse, finishReason string, usage *dto.Usage) {
+	resp.Status = "completed"
+	if finishReason == "length" {
+		resp.Status = "incomplete"
+		resp.IncompleteDetails = &dto.IncompleteDetails{Reason: "max_output_tokens"}
+	} else if finishReason == "content_filter" {
+		resp.Status = "incomplete"
+		resp.IncompleteDetails = &dto.IncompleteDetails{Reason: "content_filter"}
+	}
+	resp.Usage = ChatUsageToResponsesUsage(usage)
+}
+
+func newResponsesItemId(prefix string) string {
+	return prefix + "_" + common.GetRandomString(24)
+}
+
+// ChatCompletionsResponseToResponses 将非流式 Chat Completions 响应转换为 Responses 响应
+func ChatCompletionsResponseToResponses(req *dto.OpenAIResponsesRequest, chatResp *dto.OpenAITextResponse, responseId string, createdAt int) *dto.OpenAIResponsesResponse {
+	resp := NewResponsesFromRequest(req, responseId, createdAt)
+	if chatResp.Model != "" {
+		resp.Model = chatResp.Model
+	}
+	finishReason := ""
+	if len(chatResp.Choices) > 0 {
+		choice := chatResp.Choices[0]
+		finishReason = choice.FinishReason
+		reasoning := choice.Message.ReasoningContent
+		if reasoning == "" {
+			reasoning = choice.Message.Reasoning
+		}
+		if reasoning != "" {
+			resp.Output = append(resp.Output, dto.ResponsesOutput{
+				Type:    dto.ResponsesItemTypeReasoning,
+				ID:      newResponsesItemId("rs"),
+				Summary: []dto.ResponsesOutputContent{{Type: "summary_text", Text: reasoning}},
+			})
+		}
+		if text := choice.Message.StringContent(); text != "" {
+			resp.Output = append(resp.Output, dto.ResponsesOutput{
+				Type:    dto.ResponsesItemTypeMessage,
+				ID:      newResponsesItemId("msg"),
+				Status:  "completed",
+				Role:    "assistant",
+				Content: []dto.ResponsesOutputContent{{Type: "output_text", Text: text, Annotations: []interface{}{}}},
+			})
+		}
+		for _, toolCall := range choice.Message.ParseToolCalls() {
+			resp.Output = append(resp.Output, dto.ResponsesOutput{
+				Type:      dto.ResponsesItemTypeFunctionCall,
+				ID:        newResponsesItemId("fc"),
+				Status:    "completed",
+				CallId:    toolCall.ID,
+				Name:      toolCall.Function.Name,
+				Arguments: toolCall.Function.Arguments,
+			})
+		}
+	}
+	finishResponses(resp, finishReason, &chatResp.Usage)
+	return resp
+}
+
+// ChatToResponsesStreamConverter 将 Chat Completions 流式块转换为 Responses API 流式事件
+type ChatToResponsesStreamConverter struct {
+	response       *dto.OpenAIResponsesResponse
+	sequenceNumber int
+	started        bool
+
+	reasoningIndex int
+	reasoningText  strings.Builder
+	messageIndex   int
+	messageText    strings.Builder
+	// chat 中的 tool_call index 到 output 下标
+	toolCallIndexes map[int]int
+	toolCallOrder   []int
+	toolCallArgs    map[int]*strings.Builder
+
+	finishReason string
+	usage        *dto.Usage
+}
+
+func NewChatToResponsesStreamConverter(req *dto.OpenAIResponsesRequest, responseId string, createdAt int) *ChatToResponsesStreamConverter {
+	return &ChatToResponsesStreamConverter{
+		response:        NewResponsesFromRequest(req, responseId, createdAt),
+		reasoningIndex:  -1,
+		messageIndex:    -1,
+		toolCallIndexes: make(map[int]int),
+		toolCallArgs:    make(map[int]*strings.Builder),
+	}
+}
+
+func (s *ChatToResponsesStreamConverter) event(eventType string) dto.ResponsesStreamResponse {
+	event := dto.ResponsesStreamResponse{Type: eventType, SequenceNumber: s.sequenceNumber}
+	s.sequenceNumber++
+	return event
+}
+
+func (s *ChatToResponsesStreamConverter) itemEvent(eventType string, outputIndex int) dto.ResponsesStreamResponse {
+	event := s.event(eventType)
+	event.OutputIndex = common.GetPointer(outputIndex)
+	item := s.response.Output[outputIndex]
+	if eventType == dto.ResponsesOutputTypeItemAdded || eventType == dto.ResponsesOutputTypeItemDone {
+		event.Item = &item
+	} else {
+		event.ItemId = item.ID
+	}
+	return event
+}
+
+func (s *ChatToResponsesStreamConverter) snapshot() *dto.OpenAIResponsesResponse {
+	resp := *s.response
+	resp.Output = append([]dto.ResponsesOutput{}, s.response.Output...)
+	return &resp
+}
+
+func (s *ChatToResponsesStreamConverter) start(events []dto.ResponsesStreamResponse) []dto.ResponsesStreamResponse {
+	if s.started {
+		return events
+	}
+	s.started = true
+	created := s.event(dto.ResponsesEventCreated)
+	created.Response = s.snapshot()
+	inProgress := s.event(dto.ResponsesEventInProgress)
+	inProgress.Response = s.snapshot()
+	return append(events, created, inProgress)
+}
+
+func (s *ChatToResponsesStreamConverter) closeReasoning(events []dto.ResponsesStreamResponse) []dto.ResponsesStreamResponse {
+	if s.reasoningIndex < 0 {
+		return events
+	}
+	index := s.reasoningIndex
+	s.reasoningIndex = -1
+	text := s.reasoningText.String()
+	part := dto.ResponsesOutputContent{Type: "summary_text", Text: text}
+	s.response.Output[index].Summary = []dto.ResponsesOutputContent{part}
+
+	textDone := s.itemEvent(dto.ResponsesEventReasoningSummaryTextDone, index)
+	textDone.SummaryIndex = common.GetPointer(0)
+	textDone.Text = &text
+	partDone := s.itemEvent(dto.ResponsesEventReasoningSummaryPartDone, index)
+	partDone.SummaryIndex = common.GetPointer(0)
+	partDone.Part = &part
+	return append(events, textDone, partDone, s.itemEvent(dto.ResponsesOutputTypeItemDone, index))
+}
+
+func (s *ChatToResponsesStreamConverter) closeMessage(events []dto.ResponsesStreamResponse) []dto.ResponsesStreamResponse {
+	if s.messageIndex < 0 {
+		return events
+	}
+	index := s.messageIndex
+	s.messageIndex = -1
+	text := s.messageText.String()
+	part := dto.ResponsesOutputContent{Type: "output_text", Text: text, Annotations: []interface{}{}}
+	s.response.Output[index].Content = []dto.ResponsesOutputContent{part}
+	s.response.Output[index].Status = "completed"
+
+	textDone := s.itemEvent(dto.ResponsesEventOutputTextDone, index)
+	textDone.ContentIndex = common.GetPointer(0)
+	textDone.Text = &text
+	partDone := s.itemEvent(dto.ResponsesEventContentPartDone, index)
+	partDone.ContentIndex = common.GetPointer(0)
+	partDone.Part = &part
+	return append(events, textDone, partDone, s.itemEvent(dto.ResponsesOutputTypeItemDone, index))
+}
+
+func (s *ChatToResponsesStreamConverter) closeToolCalls(events []dto.ResponsesStreamResponse) []dto.ResponsesStreamResponse {
+	for _, chatIndex := range s.toolCallOrder {
+		index := s.toolCallIndexes[chatIndex]
+		arguments := s.toolCallArgs[chatIndex].String()
+		if arguments == "" {
+			arguments = "{}"
+		}
+		s.response.Output[index].Arguments = arguments
+		s.response.Output[index].Status = "completed"
+		argsDone := s.itemEvent(dto.ResponsesEventFunctionCallArgumentsDone, index)
+		argsDone.Arguments = &arguments
+		events = append(events, argsDone, s.itemEvent(dto.ResponsesOutputTypeItemDone, index))
+	}
+	s.toolCallOrder = nil
+	s.toolCallIndexes = make(map[int]int)
+	s.toolCallArgs = make(map[int]*strings.Builder)
+	return events
+}
+
+// ProcessChunk 处理一个 Chat Completions 流式块，返回需要发送的事件
+func (s *ChatToResponsesStreamConverter) ProcessChunk(chunk *dto.ChatCompletionsStreamResponse) []dto.ResponsesStreamResponse {
+	events := s.start(nil)
+	if chunk.Model != "" {
+		s.response.Model = chunk.Model
+	}
+	if chunk.Usage != nil && (chunk.Usage.PromptTokens > 0 || chunk.Usage.CompletionTokens > 0) {
+		s.usage = chunk.Usage
+	}
+	for _, choice := range chunk.Choices {
+		if choice.Index != 0 {
+			continue
+		}
+		delta := choice.Delta
+		reasoning := delta.GetReasoningContent()
+		if reasoning != "" {
+			events = s.closeMessage(events)
+			if s.reasoningIndex < 0 {
+				s.reasoningIndex = len(s.response.Output)
+				s.reasoningText.Reset()
+				s.response.Output = append(s.response.Output, dto.ResponsesOutput{
+					Type:    dto.ResponsesItemTypeReasoning,
+					ID:      newResponsesItemId("rs"),
+					Summary: []dto.ResponsesOutputContent{},
+				})
+				itemAdded := s.itemEvent(dto.ResponsesOutputTypeItemAdded, s.reasoningIndex)
+				partAdded := s.itemEvent(dto.ResponsesEventReasoningSummaryPartAdded, s.reasoningIndex)
+				partAdded.SummaryIndex = common.GetPointer(0)
+				partAdded.Part = &dto.ResponsesOutputContent{Type: "summary_text"}
+				events = append(events, itemAdded, partAdded)
+			}
+			s.reasoningText.WriteString(reasoning)
+			textDelta := s.itemEvent(dto.ResponsesEventReasoningSummaryTextDelta, s.reasoningIndex)
+			textDelta.SummaryIndex = common.GetPointer(0)
+			textDelta.Delta = reasoning
+			events = append(events, textDelta)
+		}
+		if content := delta.GetContentString(); content != "" {
+			events = s.closeReasoning(events)
+			if s.messageIndex < 0 {
+				s.messageIndex = len(s.response.Output)
+				s.messageText.Reset()
+				s.response.Output = append(s.response.Output, dto.ResponsesOutput{
+					Type:    dto.ResponsesItemTypeMessage,
+					ID:      newResponsesItemId("msg"),
+					Status:  "in_progress",
+					Role:    "assistant",
+					Content: []dto.ResponsesOutputContent{},
+				})
+				itemAdded := s.itemEvent(dto.ResponsesOutputTypeItemAdded, s.messageIndex)
+				partAdded := s.itemEvent(dto.ResponsesEventContentPartAdded, s.messageIndex)
+				partAdded.ContentIndex = common.GetPointer(0)
+				partAdded.Part = &dto.ResponsesOutputContent{Type: "output_text", Annotations: []interface{}{}}
+				events = append(events, itemAdded, partAdded)
+			}
+			s.messageText.WriteString(content)
+			textDelta := s.itemEvent(dto.ResponsesEventOutputTextDelta, s.messageIndex)
+			textDelta.ContentIndex = common.GetPointer(0)
+			textDelta.Delta = content
+			events = append(events, textDelta)
+		}
+		for i, toolCall := range delta.ToolCalls {
+			chatIndex := i
+			if toolCall.Index != nil {
+				chatIndex = *toolCall.Index
+			}
+			index, ok := s.toolCallIndexes[chatIndex]
+			if !ok {
+				events = s.closeReasoning(events)
+				events = s.closeMessage(events)
+				index = len(s.response.Output)
+				s.toolCallIndexes[chatIndex] = index
+				s.toolCallOrder = append(s.toolCallOrder, chatIndex)
+				s.toolCallArgs[chatIndex] = &strings.Builder{}
+				callId := toolCall.ID
+				if callId == "" {
+					callId = newResponsesItemId("call")
+				}
+				s.response.Output = append(s.response.Output, dto.ResponsesOutput{
+					Type:   dto.ResponsesItemTypeFunctionCall,
+					ID:     newResponsesItemId("fc"),
+					Status: "in_progress",
+					CallId: callId,
+					Name:   toolCall.Function.Name,
+				})
+				events = append(events, s.itemEvent(dto.ResponsesOutputTypeItemAdded, index))
+			}
+			if toolCall.Function.Arguments != "" {
+				s.toolCallArgs[chatIndex].WriteString(toolCall.Function.Arguments)
+				argsDelta := s.itemEvent(dto.ResponsesEventFunctionCallArgumentsDelta, index)
+				argsDelta.Delta = toolCall.Function.Arguments
+				events = append(events, argsDelta)
+			}
+		}
+		if choice.FinishReason != nil && *choice.FinishReason != "" {
+			s.finishReason = *choice.FinishReason
+		}
+	}
+	return events
+}
+
+// Finish 结束所有输出项并生成最终的 response.completed 或 response.incomplete 事件，
+// usage 为空时使用流中收到的用量
+func (s *ChatToResponsesStreamConverter) Finish(usage *dto.Usage) []dto.ResponsesStreamResponse {
+	events := s.start(nil)
+	events = s.closeReasoning(events)
+	events = s.closeMessage(events)
+	events = s.closeToolCalls(events)
+	if usage == nil {
+		usage = s.usage
+	}
+	if usage == nil {
+		usage = &dto.Usage{}
+	}
+	finishResponses(s.response, s.finishReason, usage)
+	eventType := dto.ResponsesEventCompleted
+	if s.response.Status == "incomplete" {
+		eventType = dto.ResponsesEventIncomplete
+	}
+	done := s.event(eventType)
+	done.Response = s.snapshot()
+	return append(events, done)
+}
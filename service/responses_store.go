@@ -0,0 +1,393 @@
+package service
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/constant"
+	"github.com/QuantumNous/new-api/dto"
+	"github.com/QuantumNous/new-api/model"
+	"github.com/QuantumNous/new-api/service/storage"
+	"github.com/QuantumNous/new-api/setting/operation_setting"
+
+	"github.com/bytedance/gopkg/util/gopool"
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// storedResponseBlob 保存到存储后端的内容，Input 为本轮请求的输入项，Response 为完整的响应对象
+type storedResponseBlob struct {
+	Input    json.RawMessage `json:"input"`
+	Response json.RawMessage `json:"response"`
+}
+
+// responsesInputItems 将字符串形式的 input 转换为输入项数组
+func responsesInputItems(input json.RawMessage) ([]json.RawMessage, error) {
+	switch common.GetJsonType(input) {
+	case "string":
+		var text string
+		if err := common.Unmarshal(input, &text); err != nil {
+			return nil, err
+		}
+		item, err := common.Marshal(map[string]any{"type": "message", "role": "user", "content": text})
+		if err != nil {
+			return nil, err
+		}
+		return []json.RawMessage{item}, nil
+	case "array":
+		var items []json.RawMessage
+		if err := common.Unmarshal(input, &items); err != nil {
+			return nil, err
+		}
+		return items, nil
+	case "":
+		return nil, nil
+	default:
+		return nil, fmt.Errorf("invalid input type: %s", common.GetJsonType(input))
+	}
+}
+
+// responsesOutputAsInput 将响应的输出项转换为下一轮的输入项。输出项 ID 在其他渠道或上游不保存时无法引用，需要去掉；
+// 没有 encrypted_content 的推理项只有在转换为 Chat Completions 时才有意义
+func responsesOutputAsInput(response json.RawMessage, keepReasoningSummary bool) []json.RawMessage {
+	var resp struct {
+		Output []map[string]any `json:"output"`
+	}
+	if err := common.Unmarshal(response, &resp); err != nil {
+		return nil
+	}
+	items := make([]json.RawMessage, 0, len(resp.Output))
+	for _, item := range resp.Output {
+		switch common.Interface2String(item["type"]) {
+		case dto.ResponsesItemTypeReasoning:
+			if common.Interface2String(item["encrypted_content"]) == "" && !keepReasoningSummary {
+				continue
+			}
+		case dto.ResponsesItemTypeMessage, dto.ResponsesItemTypeFunctionCall, "custom_tool_call":
+		default:
+			// 内置工具的调用记录无法作为输入发送
+			continue
+		}
+		delete(item, "id")
+		data, err := common.Marshal(item)
+		if err != nil {
+			continue
+		}
+		items = append(items, data)
+	}
+	return items
+}
+
+func loadStoredResponseBlob(record *model.StoredResponse) (*storedResponseBlob, error) {
+	store, err := storage.Get()
+	if err != nil {
+		return nil, err
+	}
+	reader, err := store.Open(record.StorageKey)
+	if err != nil {
+		return nil, err
+	}
+	defer reader.Close()
+	data, err := io.ReadAll(reader)
+	if err != nil {
+		return nil, err
+	}
+	var blob storedResponseBlob
+	if err := common.Unmarshal(data, &blob); err != nil {
+		return nil, err
+	}
+	return &blob, nil
+}
+
+// ExpandPreviousResponse 将 previous_response_id 展开为完整的输入，网关中没有该响应时返回 false 且不修改请求。
+// 链路中途缺失或超过最大深度时保留未展开的 ID，由上游继续处理
+func ExpandPreviousResponse(userId int, request *dto.OpenAIResponsesRequest, keepReasoningSummary bool) (bool, error) {
+	setting := operation_setting.GetResponsesStoreSetting()
+	if !setting.Enabled || request.PreviousResponseID == "" {
+		return false, nil
+	}
+	var turns []*storedResponseBlob
+	id := request.PreviousResponseID
+	for id != "" && (setting.MaxChainDepth <= 0 || len(turns) < setting.MaxChainDepth) {
+		record, err := model.GetStoredResponseById(id, userId)
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			break
+		}
+		if err != nil {
+			return false, err
+		}
+		blob, err := loadStoredResponseBlob(record)
+		if err != nil {
+			return false, err
+		}
+		turns = append(turns, blob)
+		id = record.PreviousResponseId
+	}
+	if len(turns) == 0 {
+		return false, nil
+	}
+
+	var items []json.RawMessage
+	for i := len(turns) - 1; i >= 0; i-- {
+		inputItems, err := responsesInputItems(turns[i].Input)
+		if err != nil {
+			return false, err
+		}
+		items = append(items, inputItems...)
+		items = append(items, responsesOutputAsInput(turns[i].Response, keepReasoningSummary)...)
+	}
+	inputItems, err := responsesInputItems(request.Input)
+	if err != nil {
+		return false, err
+	}
+	items = append(items, inputItems...)
+	input, err := common.Marshal(items)
+	if err != nil {
+		return false, err
+	}
+	request.Input = input
+	request.PreviousResponseID = id
+	return true, nil
+}
+
+// ResponsesStoreRecorder 记录返回给客户端的 Responses 响应，请求结束后保存到网关
+type ResponsesStoreRecorder struct {
+	gin.ResponseWriter
+	c                  *gin.Context
+	userId             int
+	modelName          string
+	previousResponseId string
+	input              json.RawMessage
+	decided            bool
+	stream             bool
+	ignore             bool
+	pending            []byte
+	body               bytes.Buffer
+	response           json.RawMessage
+}
+
+// NewResponsesStoreRecorder 未开启网关存储或请求中 store 为 false 时返回 nil
+func NewResponsesStoreRecorder(c *gin.Context, request *dto.OpenAIResponsesRequest) *ResponsesStoreRecorder {
+	if !operation_setting.GetResponsesStoreSetting().Enabled {
+		return nil
+	}
+	if len(request.Store) > 0 {
+		var store bool
+		if err := common.Unmarshal(request.Store, &store); err == nil && !store {
+			return nil
+		}
+	}
+	items, err := responsesInputItems(request.Input)
+	if err != nil {
+		return nil
+	}
+	input, err := common.Marshal(items)
+	if err != nil {
+		return nil
+	}
+	recorder := &ResponsesStoreRecorder{
+		ResponseWriter:     c.Writer,
+		c:                  c,
+		userId:             common.GetContextKeyInt(c, constant.ContextKeyUserId),
+		modelName:          request.Model,
+		previousResponseId: request.PreviousResponseID,
+		input:              input,
+	}
+	c.Writer = recorder
+	return recorder
+}
+
+func (w *ResponsesStoreRecorder) observe(data []byte) {
+	if !w.decided {
+		w.decided = true
+		w.ignore = w.Status() != http.StatusOK
+		w.stream = strings.Contains(w.Header().Get("Content-Type"), "text/event-stream")
+	}
+	if w.ignore {
+		return
+	}
+	if !w.stream {
+		w.body.Write(data)
+		return
+	}
+	w.pending = append(w.pending, data...)
+	for {
+		idx := bytes.IndexByte(w.pending, '\n')
+		if idx < 0 {
+			return
+		}
+		line := strings.TrimSpace(string(w.pending[:idx]))
+		w.pending = w.pending[idx+1:]
+		if !strings.HasPrefix(line, "data:") {
+			continue
+		}
+		payload := strings.TrimSpace(strings.TrimPrefix(line, "data:"))
+		if !strings.Contains(payload, dto.ResponsesEventCompleted) && !strings.Contains(payload, dto.ResponsesEventIncomplete) {
+			continue
+		}
+		var event struct {
+			Type     string          `json:"type"`
+			Response json.RawMessage `json:"response"`
+		}
+		if err := common.UnmarshalJsonStr(payload, &event); err != nil {
+			continue
+		}
+		if event.Type == dto.ResponsesEventCompleted || event.Type == dto.ResponsesEventIncomplete {
+			w.response = event.Response
+		}
+	}
+}
+
+func (w *ResponsesStoreRecorder) Write(data []byte) (int, error) {
+	w.observe(data)
+	return w.ResponseWriter.Write(data)
+}
+
+func (w *ResponsesStoreRecorder) WriteString(s string) (int, error) {
+	w.observe([]byte(s))
+	return w.ResponseWriter.WriteString(s)
+}
+
+// Finish 恢复原始的 ResponseWriter，响应完成时异步保存
+func (w *ResponsesStoreRecorder) Finish() {
+	if w == nil {
+		return
+	}
+	w.c.Writer = w.ResponseWriter
+	response := w.response
+	if !w.stream && w.body.Len() > 0 {
+		response = w.body.Bytes()
+	}
+	if len(response) == 0 || w.c.Request.Context().Err() != nil {
+		return
+	}
+	var resp struct {
+		Id     string `json:"id"`
+		Object string `json:"object"`
+		Status string `json:"status"`
+	}
+	if err := common.Unmarshal(response, &resp); err != nil || resp.Id == "" || resp.Object != "response" {
+		return
+	}
+	if resp.Status != "completed" && resp.Status != "incomplete" {
+		return
+	}
+	record := &model.StoredResponse{
+		Id:                 resp.Id,
+		UserId:             w.userId,
+		PreviousResponseId: w.previousResponseId,
+		ModelName:          w.modelName,
+		ChannelId:          common.GetContextKeyInt(w.c, constant.ContextKeyChannelId),
+		CreatedAt:          common.GetTimestamp(),
+	}
+	blob := storedResponseBlob{Input: w.input, Response: append(json.RawMessage(nil), response...)}
+	gopool.Go(func() {
+		if err := saveStoredResponse(record, &blob); err != nil {
+			common.SysError(fmt.Sprintf("failed to save response %s: %s", record.Id, err.Error()))
+		}
+	})
+}
+
+func saveStoredResponse(record *model.StoredResponse, blob *storedResponseBlob) error {
+	store, err := storage.Get()
+	if err != nil {
+		return err
+	}
+	data, err := common.Marshal(blob)
+	if err != nil {
+		return err
+	}
+	key := fmt.Sprintf("responses/%s/%s.json", time.Unix(record.CreatedAt, 0).Format("2006-01-02"), record.Id)
+	if _, err := store.Save(key, bytes.NewReader(data)); err != nil {
+		return err
+	}
+	record.StorageKey = key
+	if err := record.Insert(); err != nil {
+		_ = store.Delete(key)
+		return err
+	}
+	return nil
+}
+
+// GetStoredResponse 返回网关保存的完整响应对象
+func GetStoredResponse(id string, userId int) (json.RawMessage, error) {
+	record, err := model.GetStoredResponseById(id, userId)
+	if err != nil {
+		return nil, err
+	}
+	blob, err := loadStoredResponseBlob(record)
+	if err != nil {
+		return nil, err
+	}
+	return blob.Response, nil
+}
+
+// DeleteStoredResponse 删除网关保存的响应，不影响上游保存的内容
+func DeleteStoredResponse(id string, userId int) error {
+	record, err := model.GetStoredResponseById(id, userId)
+	if err != nil {
+		return err
+	}
+	if err := model.DeleteStoredResponseById(id, userId); err != nil {
+		return err
+	}
+	if store, err := storage.Get(); err == nil {
+		if err := store.Delete(record.StorageKey); err != nil {
+			common.SysError(fmt.Sprintf("failed to delete response %s from storage: %s", id, err.Error()))
+		}
+	}
+	return nil
+}
+
+// StartResponsesStoreCleaner 定期清理超过保留天数的响应
+func StartResponsesStoreCleaner() {
+	for {
+		time.Sleep(time.Hour)
+		retentionDays := operation_setting.GetResponsesStoreSetting().RetentionDays
+		if retentionDays <= 0 {
+			continue
+		}
+		cleanStoredResponses(common.GetTimestamp() - int64(retentionDays)*86400)
+	}
+}
+
+func cleanStoredResponses(targetTimestamp int64) {
+	var store storage.Storage
+	for {
+		responses, err := model.GetExpiredStoredResponses(targetTimestamp, 100)
+		if err != nil {
+			common.SysError("failed to get expired responses: " + err.Error())
+			return
+		}
+		ids := make([]string, 0, len(responses))
+		for _, response := range responses {
+			ids = append(ids, response.Id)
+			if response.StorageKey == "" {
+				continue
+			}
+			if store == nil {
+				if store, err = storage.Get(); err != nil {
+					common.SysError("failed to get file storage: " + err.Error())
+					return
+				}
+			}
+			if err := store.Delete(response.StorageKey); err != nil {
+				common.SysError(fmt.Sprintf("failed to delete response %s: %s", response.StorageKey, err.Error()))
+			}
+		}
+		if err := model.DeleteStoredResponsesByIds(ids); err != nil {
+			common.SysError("failed to delete expired responses: " + err.Error())
+			return
+		}
+		if len(responses) < 100 {
+			return
+		}
+	}
+}
@@ -0,0 +1,67 @@
+package storage
+
+import (
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+
+	"github.com/QuantumNous/new-api/setting/system_setting"
+)
+
+const BackendLocal = "local"
+
+func init() {
+	Register(BackendLocal, func(settings *system_setting.FileStorageSettings) (Storage, error) {
+		return &LocalStorage{Root: settings.LocalPath}, nil
+	})
+}
+
+// LocalStorage 将文件保存在本地磁盘，多节点部署时需要挂载共享目录
+type LocalStorage struct {
+	Root string
+}
+
+// path 将 key 限制在 Root 目录内
+func (s *LocalStorage) path(key string) string {
+	return filepath.Join(s.Root, filepath.Clean("/"+key))
+}
+
+func (s *LocalStorage) Save(key string, reader io.Reader) (int64, error) {
+	path := s.path(key)
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return 0, err
+	}
+	// 先写临时文件再重命名，避免读到写了一半的文件
+	tmp := path + ".tmp"
+	file, err := os.Create(tmp)
+	if err != nil {
+		return 0, err
+	}
+	n, err := io.Copy(file, reader)
+	closeErr := file.Close()
+	if err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		_ = os.Remove(tmp)
+		return 0, err
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		_ = os.Remove(tmp)
+		return 0, err
+	}
+	return n, nil
+}
+
+func (s *LocalStorage) Open(key string) (io.ReadCloser, error) {
+	return os.Open(s.path(key))
+}
+
+func (s *LocalStorage) Delete(key string) error {
+	err := os.Remove(s.path(key))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	return err
+}
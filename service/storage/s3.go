@@ -0,0 +1,161 @@
+package storage
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/QuantumNous/new-api/setting/system_setting"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	v4 "github.com/aws/aws-sdk-go-v2/aws/signer/v4"
+)
+
+const BackendS3 = "s3"
+
+func init() {
+	Register(BackendS3, func(settings *system_setting.FileStorageSettings) (Storage, error) {
+		if settings.S3Endpoint == "" || settings.S3Bucket == "" {
+			return nil, errors.New("s3 endpoint and bucket are required")
+		}
+		region := settings.S3Region
+		if region == "" {
+			region = "us-east-1"
+		}
+		return &S3Storage{
+			Endpoint:  strings.TrimSuffix(settings.S3Endpoint, "/"),
+			Region:    region,
+			Bucket:    settings.S3Bucket,
+			PathStyle: settings.S3PathStyle,
+			credentials: aws.Credentials{
+				AccessKeyID:     settings.S3AccessKeyId,
+				SecretAccessKey: settings.S3SecretAccessKey,
+			},
+		}, nil
+	})
+}
+
+var s3HttpClient = &http.Client{}
+
+// S3Storage 将文件保存在 S3 兼容的对象存储中，直接使用 SigV4 签名的 HTTP 请求访问
+type S3Storage struct {
+	Endpoint    string
+	Region      string
+	Bucket      string
+	PathStyle   bool
+	credentials aws.Credentials
+}
+
+// objectURL 返回对象地址，key 的每一段单独转义
+func (s *S3Storage) objectURL(key string) (string, error) {
+	segments := strings.Split(strings.TrimPrefix(path.Clean("/"+key), "/"), "/")
+	for i, segment := range segments {
+		segments[i] = url.PathEscape(segment)
+	}
+	escapedKey := strings.Join(segments, "/")
+	if s.PathStyle {
+		return fmt.Sprintf("%s/%s/%s", s.Endpoint, s.Bucket, escapedKey), nil
+	}
+	u, err := url.Parse(s.Endpoint)
+	if err != nil {
+		return "", err
+	}
+	u.Host = s.Bucket + "." + u.Host
+	return fmt.Sprintf("%s/%s", strings.TrimSuffix(u.String(), "/"), escapedKey), nil
+}
+
+func (s *S3Storage) do(method string, key string, body io.Reader, size int64, payloadHash string) (*http.Response, error) {
+	uri, err := s.objectURL(key)
+	if err != nil {
+		return nil, err
+	}
+	req, err := http.NewRequest(method, uri, body)
+	if err != nil {
+		return nil, err
+	}
+	if body != nil {
+		req.ContentLength = size
+	}
+	req.Header.Set("X-Amz-Content-Sha256", payloadHash)
+	signer := v4.NewSigner(func(options *v4.SignerOptions) {
+		options.DisableURIPathEscaping = true
+	})
+	if err := signer.SignHTTP(context.Background(), s.credentials, req, payloadHash, "s3", s.Region, time.Now()); err != nil {
+		return nil, err
+	}
+	return s3HttpClient.Do(req)
+}
+
+func s3ResponseError(resp *http.Response) error {
+	body, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+	return fmt.Errorf("s3 request failed: status=%d, body=%s", resp.StatusCode, body)
+}
+
+// emptyPayloadHash 空请求体的 SHA256
+const emptyPayloadHash = "e3b0c44298fc1c149afbf4c8996fb92427ae41e4649b934ca495991b7852b855"
+
+func (s *S3Storage) Save(key string, reader io.Reader) (int64, error) {
+	// PutObject 需要预先知道内容长度与摘要，先写入临时文件
+	tmp, err := os.CreateTemp("", "s3-upload-*")
+	if err != nil {
+		return 0, err
+	}
+	defer func() {
+		_ = tmp.Close()
+		_ = os.Remove(tmp.Name())
+	}()
+	hash := sha256.New()
+	n, err := io.Copy(io.MultiWriter(tmp, hash), reader)
+	if err != nil {
+		return 0, err
+	}
+	if _, err := tmp.Seek(0, io.SeekStart); err != nil {
+		return 0, err
+	}
+	resp, err := s.do(http.MethodPut, key, tmp, n, hex.EncodeToString(hash.Sum(nil)))
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return 0, s3ResponseError(resp)
+	}
+	return n, nil
+}
+
+func (s *S3Storage) Open(key string) (io.ReadCloser, error) {
+	resp, err := s.do(http.MethodGet, key, nil, 0, emptyPayloadHash)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode == http.StatusNotFound {
+		resp.Body.Close()
+		return nil, os.ErrNotExist
+	}
+	if resp.StatusCode != http.StatusOK {
+		defer resp.Body.Close()
+		return nil, s3ResponseError(resp)
+	}
+	return resp.Body, nil
+}
+
+func (s *S3Storage) Delete(key string) error {
+	resp, err := s.do(http.MethodDelete, key, nil, 0, emptyPayloadHash)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusNoContent && resp.StatusCode != http.StatusOK && resp.StatusCode != http.StatusNotFound {
+		return s3ResponseError(resp)
+	}
+	return nil
+}
@@ -0,0 +1,47 @@
+package storage
+
+import (
+	"fmt"
+	"io"
+	"sync"
+
+	"github.com/QuantumNous/new-api/setting/system_setting"
+)
+
+// Storage 文件存储后端，key 由调用方生成，后端只负责按 key 读写
+type Storage interface {
+	Save(key string, reader io.Reader) (int64, error)
+	Open(key string) (io.ReadCloser, error)
+	Delete(key string) error
+}
+
+// Factory 根据当前配置创建存储后端
+type Factory func(settings *system_setting.FileStorageSettings) (Storage, error)
+
+var (
+	factories     = map[string]Factory{}
+	factoriesLock sync.RWMutex
+)
+
+// Register 注册存储后端，供其他后端实现（如对象存储）在 init 中调用
+func Register(name string, factory Factory) {
+	factoriesLock.Lock()
+	defer factoriesLock.Unlock()
+	factories[name] = factory
+}
+
+// Get 按配置获取存储后端
+func Get() (Storage, error) {
+	settings := system_setting.GetFileStorageSettings()
+	backend := settings.Backend
+	if backend == "" {
+		backend = BackendLocal
+	}
+	factoriesLock.RLock()
+	factory, ok := factories[backend]
+	factoriesLock.RUnlock()
+	if !ok {
+		return nil, fmt.Errorf("unknown file storage backend: %s", backend)
+	}
+	return factory(settings)
+}
@@ -0,0 +1,76 @@
+package service
+
+import (
+	"crypto/hmac"
+	"errors"
+	"fmt"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/model"
+	"github.com/QuantumNous/new-api/setting/operation_setting"
+	"github.com/QuantumNous/new-api/setting/system_setting"
+)
+
+// ValidateTaskCallbackUrl 校验客户端提供的任务回调地址，投递时还会经过 SSRF 检查
+func ValidateTaskCallbackUrl(callbackUrl string) error {
+	if callbackUrl == "" {
+		return nil
+	}
+	if len(callbackUrl) > 512 {
+		return errors.New("回调地址长度不能超过 512")
+	}
+	u, err := url.Parse(callbackUrl)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return errors.New("回调地址必须是有效的 http 或 https 地址")
+	}
+	return nil
+}
+
+// EnqueueTaskCallback 任务状态变化时写入一条回调投递记录，复用 webhook 投递队列的重试与日志
+func EnqueueTaskCallback(task *model.Task, preStatus model.TaskStatus, payload []byte) {
+	if task.Properties.CallbackUrl == "" || preStatus == task.Status {
+		return
+	}
+	if !operation_setting.GetTaskCallbackSetting().Enabled {
+		return
+	}
+	now := common.GetTimestamp()
+	delivery := &model.WebhookDelivery{
+		TaskId:        task.ID,
+		UserId:        task.UserId,
+		EventId:       task.TaskID,
+		EventType:     "task." + task.Status.ToVideoStatus(),
+		Payload:       string(payload),
+		Status:        model.WebhookDeliveryStatusPending,
+		NextAttemptAt: now,
+		CreatedTime:   now,
+	}
+	if err := model.CreateWebhookDeliveries([]*model.WebhookDelivery{delivery}); err != nil {
+		common.SysError(fmt.Sprintf("failed to enqueue task callback: task_id=%s, error=%v", task.TaskID, err))
+		return
+	}
+	TriggerWebhookDelivery()
+}
+
+func taskUpstreamCallbackSign(channelId int) string {
+	return common.GenerateHMAC("task_upstream_callback:" + strconv.Itoa(channelId))[:32]
+}
+
+// GetTaskUpstreamCallbackUrl 返回提交给上游的回调地址，未开启或未配置服务器地址时返回空
+func GetTaskUpstreamCallbackUrl(channelId int) string {
+	if !operation_setting.GetTaskCallbackSetting().UpstreamCallbackEnabled {
+		return ""
+	}
+	serverAddress := strings.TrimSuffix(system_setting.ServerAddress, "/")
+	if serverAddress == "" || strings.Contains(serverAddress, "localhost") {
+		return ""
+	}
+	return fmt.Sprintf("%s/api/task/callback/%d/%s", serverAddress, channelId, taskUpstreamCallbackSign(channelId))
+}
+
+func VerifyTaskUpstreamCallbackSign(channelId int, sign string) bool {
+	return hmac.Equal([]byte(sign), []byte(taskUpstreamCallbackSign(channelId)))
+}
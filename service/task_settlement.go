@@ -0,0 +1,254 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/dto"
+	"github.com/QuantumNous/new-api/logger"
+	"github.com/QuantumNous/new-api/model"
+	relaycommon "github.com/QuantumNous/new-api/relay/common"
+	"github.com/QuantumNous/new-api/setting/operation_setting"
+	"github.com/QuantumNous/new-api/setting/ratio_setting"
+)
+
+func isTaskFinished(status model.TaskStatus) bool {
+	return status == model.TaskStatusSuccess || status == model.TaskStatusFailure
+}
+
+// SettleTask 任务从未结束变为成功或失败后结算额度：失败时退还全部额度，
+// 成功时按上游返回的实际用量重新计费。result 为空时成功任务按原额度结算。
+// 结算通过条件更新领取，每个任务只会结算一次
+func SettleTask(ctx context.Context, task *model.Task, preStatus model.TaskStatus, result *relaycommon.TaskInfo) {
+	if !isTaskFinished(task.Status) || isTaskFinished(preStatus) || task.SettledAt != 0 {
+		return
+	}
+	preQuota := task.Quota
+	actualQuota := preQuota
+	detail := ""
+	if task.Status == model.TaskStatusFailure {
+		actualQuota = 0
+		detail = "任务失败"
+		if task.FailReason != "" {
+			detail = fmt.Sprintf("任务失败：%s", task.FailReason)
+		}
+	} else if result != nil && operation_setting.GetTaskSettlementSetting().RepriceEnabled {
+		actualQuota, detail = repriceTask(task, result)
+	}
+
+	now := common.GetTimestamp()
+	ok, err := model.SettleTaskQuota(task.ID, actualQuota, now)
+	if err != nil {
+		logger.LogError(ctx, fmt.Sprintf("failed to settle task %s: %s", task.TaskID, err.Error()))
+		return
+	}
+	if !ok {
+		return
+	}
+	task.SettledAt = now
+	task.Quota = actualQuota
+	if actualQuota != preQuota {
+		applyTaskQuotaDelta(ctx, task, preQuota, actualQuota, detail)
+	}
+}
+
+// repriceTask 按上游返回的实际用量计算任务额度，无法计算时返回原额度
+func repriceTask(task *model.Task, result *relaycommon.TaskInfo) (int, string) {
+	if quota, detail, ok := repriceTaskByTokens(task, result); ok {
+		return quota, detail
+	}
+
+	// 按实际计费参数与预估参数的比例调整额度
+	estimated := task.PrivateData.BillingRatios
+	if len(estimated) == 0 || len(result.BillingRatios) == 0 {
+		return task.Quota, ""
+	}
+	keys := make([]string, 0, len(result.BillingRatios))
+	for key := range result.BillingRatios {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	scale := 1.0
+	var changes []string
+	for _, key := range keys {
+		actual := result.BillingRatios[key]
+		expected, ok := estimated[key]
+		if !ok || expected <= 0 || actual <= 0 || actual == expected {
+			continue
+		}
+		scale *= actual / expected
+		changes = append(changes, fmt.Sprintf("%s: %.2f -> %.2f", key, expected, actual))
+	}
+	if len(changes) == 0 {
+		return task.Quota, ""
+	}
+	return int(float64(task.Quota) * scale), "计算参数：" + strings.Join(changes, ", ")
+}
+
+// repriceTaskByTokens 上游返回了 total_tokens 且模型按倍率计费（非固定价格）时，
+// 与文本请求使用相同的计价方式按输入、输出 tokens 计算额度
+func repriceTaskByTokens(task *model.Task, result *relaycommon.TaskInfo) (int, string, bool) {
+	if result.TotalTokens <= 0 {
+		return 0, "", false
+	}
+	var taskData map[string]interface{}
+	if err := common.Unmarshal(task.Data, &taskData); err != nil {
+		return 0, "", false
+	}
+	modelName, _ := taskData["model"].(string)
+	if modelName == "" {
+		return 0, "", false
+	}
+	if _, usePrice := ratio_setting.GetModelPrice(modelName, false); usePrice {
+		return 0, "", false
+	}
+	modelRatio, hasRatioSetting, _ := ratio_setting.GetModelRatio(modelName)
+	if !hasRatioSetting || modelRatio <= 0 {
+		return 0, "", false
+	}
+	groupRatio, ok := getTaskGroupRatio(task)
+	if !ok {
+		return 0, "", false
+	}
+	completionTokens := min(max(result.CompletionTokens, 0), result.TotalTokens)
+	promptTokens := result.TotalTokens - completionTokens
+	quota := calculateAudioQuota(QuotaInfo{
+		InputDetails:  TokenDetails{TextTokens: promptTokens},
+		OutputDetails: TokenDetails{TextTokens: completionTokens},
+		ModelName:     modelName,
+		ModelRatio:    modelRatio,
+		GroupRatio:    groupRatio,
+	})
+	return quota, fmt.Sprintf("模型倍率 %.2f，补全倍率 %.2f，分组倍率 %.2f，输入 tokens %d，输出 tokens %d",
+		modelRatio, ratio_setting.GetCompletionRatio(modelName), groupRatio, promptTokens, completionTokens), true
+}
+
+// getTaskGroupRatio 获取任务提交时所用分组的倍率，用户分组对该分组有特殊倍率时使用特殊倍率
+func getTaskGroupRatio(task *model.Task) (float64, bool) {
+	user, err := model.GetUserById(task.UserId, false)
+	group := task.Group
+	if group == "" {
+		if err != nil {
+			return 0, false
+		}
+		group = user.Group
+	}
+	groupRatio := ratio_setting.GetGroupRatio(group)
+	if err == nil {
+		if userGroupRatio, ok := ratio_setting.GetGroupGroupRatio(user.Group, group); ok {
+			groupRatio = userGroupRatio
+		}
+	}
+	return groupRatio, true
+}
+
+// applyTaskQuotaDelta 按结算结果向用户和令牌退还或补扣额度，并记录日志
+func applyTaskQuotaDelta(ctx context.Context, task *model.Task, preQuota int, actualQuota int, detail string) {
+	var token *model.Token
+	if task.TokenId > 0 {
+		t, err := model.GetTokenById(task.TokenId)
+		if err != nil {
+			logger.LogWarn(ctx, fmt.Sprintf("task %s token %d not found: %s", task.TaskID, task.TokenId, err.Error()))
+		} else {
+			token = t
+		}
+	}
+	params := model.RecordConsumeLogParams{
+		ModelName: task.Properties.OriginModelName,
+		Other: map[string]interface{}{
+			"task_id":      task.TaskID,
+			"pre_quota":    preQuota,
+			"actual_quota": actualQuota,
+		},
+	}
+	if params.ModelName == "" {
+		params.ModelName = CoverTaskActionToModelName(task.Platform, task.Action)
+	}
+	if token != nil {
+		params.TokenName = token.Name
+	}
+
+	logType := model.LogTypeRefund
+	if delta := actualQuota - preQuota; delta < 0 {
+		refund := -delta
+		if err := model.IncreaseUserQuota(task.UserId, refund, false); err != nil {
+			logger.LogError(ctx, fmt.Sprintf("failed to refund task %s: %s", task.TaskID, err.Error()))
+		}
+		if token != nil {
+			if err := model.IncreaseTokenQuota(token.Id, token.Key, refund); err != nil {
+				logger.LogError(ctx, fmt.Sprintf("failed to refund task %s token quota: %s", task.TaskID, err.Error()))
+			}
+		}
+		params.Quota = refund
+		params.Content = fmt.Sprintf("异步任务 %s 退还 %s（预扣费 %s，实际扣费 %s）",
+			task.TaskID, logger.LogQuota(refund), logger.LogQuota(preQuota), logger.LogQuota(actualQuota))
+	} else {
+		if err := model.DecreaseUserQuota(task.UserId, delta); err != nil {
+			logger.LogError(ctx, fmt.Sprintf("failed to charge task %s: %s", task.TaskID, err.Error()))
+		}
+		if token != nil {
+			if err := model.DecreaseTokenQuota(token.Id, token.Key, delta); err != nil {
+				logger.LogError(ctx, fmt.Sprintf("failed to charge task %s token quota: %s", task.TaskID, err.Error()))
+			}
+		}
+		model.UpdateUserUsedQuotaAndRequestCount(task.UserId, delta)
+		model.UpdateChannelUsedQuota(task.ChannelId, delta)
+		logType = model.LogTypeConsume
+		params.Quota = delta
+		params.Content = fmt.Sprintf("异步任务 %s 补扣费 %s（预扣费 %s，实际扣费 %s）",
+			task.TaskID, logger.LogQuota(delta), logger.LogQuota(preQuota), logger.LogQuota(actualQuota))
+	}
+	// 退还与补扣同样计入周期预算
+	if err := model.RecordQuotaBudgetUsage(task.UserId, task.TokenId, actualQuota-preQuota); err != nil {
+		logger.LogError(ctx, fmt.Sprintf("failed to record task %s quota budget usage: %s", task.TaskID, err.Error()))
+	}
+	if detail != "" {
+		params.Content = fmt.Sprintf("%s，%s", params.Content, detail)
+	}
+	logger.LogInfo(ctx, params.Content)
+	model.RecordTaskLog(task, logType, params)
+}
+
+// StartTaskReconcileScheduler 每日对账，向管理员报告长时间未结束的任务，仅在主节点运行
+func StartTaskReconcileScheduler() {
+	lastDay := ""
+	for {
+		time.Sleep(10 * time.Minute)
+		setting := operation_setting.GetTaskSettlementSetting()
+		now := time.Now()
+		day := now.Format("2006-01-02")
+		if !setting.ReconcileEnabled || now.Hour() < setting.ReconcileHour || day == lastDay {
+			continue
+		}
+		lastDay = day
+		ReconcileTasks(now.Unix())
+	}
+}
+
+// ReconcileTasks 统计提交后超过卡住阈值仍未结束的任务并通知管理员
+func ReconcileTasks(now int64) {
+	deadline := now - int64(operation_setting.GetTaskSettlementSetting().StuckSeconds)
+	stats, err := model.GetStuckTaskStats(deadline)
+	if err != nil {
+		common.SysError("failed to get stuck task stats: " + err.Error())
+		return
+	}
+	if len(stats) == 0 {
+		return
+	}
+
+	var total int64
+	var sb strings.Builder
+	for _, stat := range stats {
+		total += stat.Count
+		sb.WriteString(fmt.Sprintf("- %s 渠道 #%d：%d 个，最早提交于 %s\n", stat.Platform, stat.ChannelId, stat.Count,
+			time.Unix(stat.OldestSubmitTime, 0).Format("2006-01-02 15:04:05")))
+	}
+	common.SysLog(fmt.Sprintf("task reconcile: %d stuck tasks", total))
+	subject := fmt.Sprintf("%s 异步任务对账：%d 个任务长时间未结束", common.SystemName, total)
+	NotifyRootUser(dto.NotifyTypeTaskReconcile, subject, strings.TrimSuffix(sb.String(), "\n"))
+}
@@ -0,0 +1,164 @@
+package service
+
+import (
+	"context"
+	"testing"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/model"
+	relaycommon "github.com/QuantumNous/new-api/relay/common"
+	"github.com/QuantumNous/new-api/setting/operation_setting"
+	"github.com/QuantumNous/new-api/setting/ratio_setting"
+
+	"github.com/glebarez/sqlite"
+	"gorm.io/gorm"
+)
+
+func setupTaskSettlementTestDB(t *testing.T) {
+	t.Helper()
+	db, err := gorm.Open(sqlite.Open("file:"+t.Name()+"?mode=memory&cache=shared"), &gorm.Config{})
+	if err != nil {
+		t.Fatalf("open db: %v", err)
+	}
+	if err = db.AutoMigrate(&model.User{}, &model.Task{}, &model.Log{}, &model.Channel{}, &model.QuotaBudget{}); err != nil {
+		t.Fatalf("migrate: %v", err)
+	}
+	model.DB = db
+	model.LOG_DB = db
+	common.UsingSQLite = true
+	common.RedisEnabled = false
+	common.BatchUpdateEnabled = false
+}
+
+func TestSettleTaskIdempotent(t *testing.T) {
+	setting := operation_setting.GetTaskSettlementSetting()
+	savedReprice := setting.RepriceEnabled
+	setting.RepriceEnabled = true
+	defer func() { setting.RepriceEnabled = savedReprice }()
+
+	tests := []struct {
+		name        string
+		status      model.TaskStatus
+		preStatus   model.TaskStatus
+		result      *relaycommon.TaskInfo
+		billing     map[string]float64
+		wantQuota   int
+		wantRefund  int
+		wantSettled bool
+	}{
+		{name: "failure refunds all", status: model.TaskStatusFailure, preStatus: model.TaskStatusInProgress, wantQuota: 0, wantRefund: 1000, wantSettled: true},
+		{name: "success keeps quota", status: model.TaskStatusSuccess, preStatus: model.TaskStatusInProgress, wantQuota: 1000, wantSettled: true},
+		{
+			name:        "success reprices by billing ratios",
+			status:      model.TaskStatusSuccess,
+			preStatus:   model.TaskStatusInProgress,
+			billing:     map[string]float64{"seconds": 10},
+			result:      &relaycommon.TaskInfo{BillingRatios: map[string]float64{"seconds": 5}},
+			wantQuota:   500,
+			wantRefund:  500,
+			wantSettled: true,
+		},
+		{name: "unfinished task is not settled", status: model.TaskStatusInProgress, preStatus: model.TaskStatusSubmitted, wantQuota: 1000},
+		{name: "already finished task is not settled", status: model.TaskStatusFailure, preStatus: model.TaskStatusFailure, wantQuota: 1000},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			setupTaskSettlementTestDB(t)
+			user := &model.User{Username: "settle", Quota: 0, Status: common.UserStatusEnabled}
+			if err := model.DB.Create(user).Error; err != nil {
+				t.Fatalf("create user: %v", err)
+			}
+			task := &model.Task{
+				TaskID:     "task_settle",
+				UserId:     user.Id,
+				Platform:   "test",
+				Status:     tt.status,
+				Quota:      1000,
+				Data:       []byte(`{}`),
+				SubmitTime: common.GetTimestamp(),
+			}
+			task.PrivateData.BillingRatios = tt.billing
+			if err := model.DB.Create(task).Error; err != nil {
+				t.Fatalf("create task: %v", err)
+			}
+
+			// 轮询与超时处理可能同时结算同一个任务，只有一次生效
+			for i := 0; i < 2; i++ {
+				loaded, err := model.GetTaskById(task.ID)
+				if err != nil {
+					t.Fatalf("load task: %v", err)
+				}
+				SettleTask(context.Background(), loaded, tt.preStatus, tt.result)
+			}
+
+			loaded, err := model.GetTaskById(task.ID)
+			if err != nil {
+				t.Fatalf("load task: %v", err)
+			}
+			if loaded.Quota != tt.wantQuota {
+				t.Errorf("task quota = %d, want %d", loaded.Quota, tt.wantQuota)
+			}
+			if settled := loaded.SettledAt != 0; settled != tt.wantSettled {
+				t.Errorf("settled = %v, want %v", settled, tt.wantSettled)
+			}
+			var quota int
+			model.DB.Model(&model.User{}).Where("id = ?", user.Id).Select("quota").Scan(&quota)
+			if quota != tt.wantRefund {
+				t.Errorf("user quota = %d, want %d", quota, tt.wantRefund)
+			}
+		})
+	}
+}
+
+func TestRepriceTaskByTokens(t *testing.T) {
+	setupTaskSettlementTestDB(t)
+	ratio_setting.InitRatioSettings()
+	if err := ratio_setting.UpdateModelRatioByJSONString(`{"test-video-model":2}`); err != nil {
+		t.Fatalf("update model ratio: %v", err)
+	}
+	if err := ratio_setting.UpdateCompletionRatioByJSONString(`{"test-video-model":4}`); err != nil {
+		t.Fatalf("update completion ratio: %v", err)
+	}
+	user := &model.User{Username: "reprice", Group: "default", Status: common.UserStatusEnabled}
+	if err := model.DB.Create(user).Error; err != nil {
+		t.Fatalf("create user: %v", err)
+	}
+
+	tests := []struct {
+		name      string
+		data      string
+		result    *relaycommon.TaskInfo
+		wantQuota int
+		wantOk    bool
+	}{
+		{
+			name:      "prompt and completion tokens",
+			data:      `{"model":"test-video-model"}`,
+			result:    &relaycommon.TaskInfo{TotalTokens: 150, CompletionTokens: 50},
+			wantQuota: (100 + 50*4) * 2,
+			wantOk:    true,
+		},
+		{
+			name:      "completion tokens only",
+			data:      `{"model":"test-video-model"}`,
+			result:    &relaycommon.TaskInfo{TotalTokens: 100, CompletionTokens: 100},
+			wantQuota: 100 * 4 * 2,
+			wantOk:    true,
+		},
+		{name: "no tokens", data: `{"model":"test-video-model"}`, result: &relaycommon.TaskInfo{}},
+		{name: "unknown model", data: `{"model":"unknown-video-model"}`, result: &relaycommon.TaskInfo{TotalTokens: 100}},
+		{name: "no model", data: `{}`, result: &relaycommon.TaskInfo{TotalTokens: 100}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			task := &model.Task{UserId: user.Id, Group: "default", Quota: 1000, Data: []byte(tt.data)}
+			quota, _, ok := repriceTaskByTokens(task, tt.result)
+			if ok != tt.wantOk {
+				t.Fatalf("ok = %v, want %v", ok, tt.wantOk)
+			}
+			if ok && quota != tt.wantQuota {
+				t.Errorf("quota = %d, want %d", quota, tt.wantQuota)
+			}
+		})
+	}
+}
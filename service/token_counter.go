@@ -437,9 +437,12 @@ func CountTokenClaudeRequest(request dto.ClaudeRequest, model string) (int, erro
 	tkm += msgTokens
 
 	// Count tokens in system message
-	if request.System != "" {
-		systemTokens := CountTokenInput(request.System, model)
-		tkm += systemTokens
+	if request.IsStringSystem() {
+		tkm += CountTokenInput(request.GetStringSystem(), model)
+	} else if request.System != nil {
+		for _, system := range request.ParseSystem() {
+			tkm += CountTokenInput(system.GetText(), model)
+		}
 	}
 
 	if request.Tools != nil {
@@ -464,6 +467,33 @@ func CountTokenClaudeRequest(request dto.ClaudeRequest, model string) (int, erro
 	return tkm, nil
 }
 
+// CountTokenGeminiRequest 本地估算 Gemini 请求的输入 token，媒体按固定值计算
+func CountTokenGeminiRequest(request *dto.GeminiChatRequest, model string) int {
+	meta := request.GetTokenCountMeta()
+	tkm := CountTextToken(meta.CombineText, model)
+	if request.SystemInstructions != nil {
+		for _, part := range request.SystemInstructions.Parts {
+			tkm += CountTextToken(part.Text, model)
+		}
+	}
+	if len(request.Tools) > 0 {
+		tkm += CountTextToken(string(request.Tools), model)
+	}
+	for _, file := range meta.Files {
+		switch file.FileType {
+		case types.FileTypeImage:
+			tkm += 520 // gemini per input image tokens
+		case types.FileTypeAudio:
+			tkm += 256
+		case types.FileTypeVideo:
+			tkm += 4096 * 2
+		default:
+			tkm += 4096
+		}
+	}
+	return tkm
+}
+
 func CountTokenClaudeMessages(messages []dto.ClaudeMessage, model string, stream bool) (int, error) {
 	tokenEncoder := getTokenEncoder(model)
 	tokenNum := 0
@@ -0,0 +1,200 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/common/limiter"
+	"github.com/QuantumNous/new-api/constant"
+	"github.com/QuantumNous/new-api/dto"
+	relaycommon "github.com/QuantumNous/new-api/relay/common"
+	"github.com/QuantumNous/new-api/setting/operation_setting"
+	"github.com/QuantumNous/new-api/types"
+
+	"github.com/gin-gonic/gin"
+)
+
+type tokenRateLimitScope struct {
+	name  string // 用于错误提示
+	key   string
+	limit operation_setting.TokenRateLimit
+}
+
+// tokenRateLimitLease 单个请求占用的 TPM 与并发名额，请求结束后按实际用量校正并释放
+type tokenRateLimitLease struct {
+	mu              sync.Mutex
+	member          string
+	tpmScopes       []tokenRateLimitScope
+	concurrencyKeys []string
+	chargedTokens   int // 已计入令牌桶的 token 数
+	actualTokens    int // 实际用量累计
+}
+
+func getTokenLimiter() limiter.TokenLimiter {
+	if common.RedisEnabled {
+		return limiter.New(context.Background(), common.RDB)
+	}
+	return limiter.NewMemory()
+}
+
+func getTokenRateLimitScopes(c *gin.Context, relayInfo *relaycommon.RelayInfo) []tokenRateLimitScope {
+	setting := operation_setting.GetTokenRateLimitSetting()
+	var scopes []tokenRateLimitScope
+	if relayInfo.TokenId != 0 && !relayInfo.IsPlayground {
+		limit := operation_setting.TokenRateLimit{
+			TPM:         common.GetContextKeyInt(c, constant.ContextKeyTokenTpmLimit),
+			Concurrency: common.GetContextKeyInt(c, constant.ContextKeyTokenConcurrencyLimit),
+		}
+		scopes = append(scopes, tokenRateLimitScope{
+			name:  "令牌",
+			key:   fmt.Sprintf("tokenRateLimit:token:%d", relayInfo.TokenId),
+			limit: limit,
+		})
+	}
+	if limit, ok := setting.Groups[relayInfo.UsingGroup]; ok {
+		scopes = append(scopes, tokenRateLimitScope{
+			name:  "分组 " + relayInfo.UsingGroup,
+			key:   fmt.Sprintf("tokenRateLimit:group:%s:%d", relayInfo.UsingGroup, relayInfo.UserId),
+			limit: limit,
+		})
+	}
+	if limit, ok := setting.Models[relayInfo.OriginModelName]; ok {
+		scopes = append(scopes, tokenRateLimitScope{
+			name:  "模型 " + relayInfo.OriginModelName,
+			key:   fmt.Sprintf("tokenRateLimit:model:%s", relayInfo.OriginModelName),
+			limit: limit,
+		})
+	}
+	return scopes
+}
+
+// AcquireTokenRateLimit 按预估的 prompt token 数检查 TPM 限制并占用并发名额，
+// 成功后需在请求结束时调用 ReleaseTokenRateLimit
+func AcquireTokenRateLimit(c *gin.Context, relayInfo *relaycommon.RelayInfo, promptTokens int) *types.NewAPIError {
+	setting := operation_setting.GetTokenRateLimitSetting()
+	if !setting.Enabled {
+		return nil
+	}
+	scopes := getTokenRateLimitScopes(c, relayInfo)
+	if len(scopes) == 0 {
+		return nil
+	}
+
+	ctx := context.Background()
+	tl := getTokenLimiter()
+	lease := &tokenRateLimitLease{
+		member:        fmt.Sprintf("%s:%d", c.GetString(common.RequestIdKey), time.Now().UnixNano()),
+		chargedTokens: promptTokens,
+	}
+	leaseDuration := time.Duration(setting.ConcurrencyLeaseSeconds) * time.Second
+	if leaseDuration <= 0 {
+		leaseDuration = 15 * time.Minute
+	}
+
+	for _, scope := range scopes {
+		if scope.limit.Concurrency <= 0 {
+			continue
+		}
+		key := scope.key + ":concurrency"
+		allowed, err := tl.AcquireConcurrency(ctx, key, lease.member, int64(scope.limit.Concurrency), leaseDuration)
+		if err != nil {
+			// 限流存储异常时放行，避免影响正常请求
+			common.SysError("failed to acquire concurrency limit: " + err.Error())
+			continue
+		}
+		if !allowed {
+			lease.release(tl)
+			return types.NewErrorWithStatusCode(fmt.Errorf("%s并发请求数已达上限：最多同时处理 %d 个请求", scope.name, scope.limit.Concurrency),
+				types.ErrorCodeConcurrencyLimitExceeded, http.StatusTooManyRequests, types.ErrOptionWithSkipRetry(), types.ErrOptionWithNoRecordErrorLog())
+		}
+		lease.concurrencyKeys = append(lease.concurrencyKeys, key)
+	}
+
+	for _, scope := range scopes {
+		if scope.limit.TPM <= 0 {
+			continue
+		}
+		allowed, err := tl.ConsumeTokens(ctx, scope.key+":tpm", int64(promptTokens), int64(scope.limit.TPM), false)
+		if err != nil {
+			common.SysError("failed to check tpm limit: " + err.Error())
+			continue
+		}
+		if !allowed {
+			lease.refund(tl)
+			lease.release(tl)
+			return types.NewErrorWithStatusCode(fmt.Errorf("%s已达到 TPM 限制：每分钟最多 %d tokens", scope.name, scope.limit.TPM),
+				types.ErrorCodeTPMLimitExceeded, http.StatusTooManyRequests, types.ErrOptionWithSkipRetry(), types.ErrOptionWithNoRecordErrorLog())
+		}
+		lease.tpmScopes = append(lease.tpmScopes, scope)
+	}
+
+	common.SetContextKey(c, constant.ContextKeyTokenRateLimitLease, lease)
+	return nil
+}
+
+// ReconcileTokenRateLimit 按实际用量校正 TPM 令牌桶，可多次调用（如 Realtime 会话），用量累加
+func ReconcileTokenRateLimit(c *gin.Context, usage *dto.Usage) {
+	if usage == nil {
+		return
+	}
+	totalTokens := usage.TotalTokens
+	if totalTokens == 0 {
+		totalTokens = usage.PromptTokens + usage.CompletionTokens
+	}
+	reconcileTokenRateLimit(c, totalTokens)
+}
+
+func reconcileTokenRateLimit(c *gin.Context, totalTokens int) {
+	lease, ok := common.GetContextKeyType[*tokenRateLimitLease](c, constant.ContextKeyTokenRateLimitLease)
+	if !ok || lease == nil {
+		return
+	}
+	lease.mu.Lock()
+	lease.actualTokens += totalTokens
+	delta := lease.actualTokens - lease.chargedTokens
+	lease.chargedTokens = lease.actualTokens
+	lease.mu.Unlock()
+	if delta == 0 {
+		return
+	}
+	tl := getTokenLimiter()
+	for _, scope := range lease.tpmScopes {
+		_, err := tl.ConsumeTokens(context.Background(), scope.key+":tpm", int64(delta), int64(scope.limit.TPM), true)
+		if err != nil {
+			common.SysError("failed to reconcile tpm limit: " + err.Error())
+		}
+	}
+}
+
+// ReleaseTokenRateLimit 释放请求占用的并发名额
+func ReleaseTokenRateLimit(c *gin.Context) {
+	lease, ok := common.GetContextKeyType[*tokenRateLimitLease](c, constant.ContextKeyTokenRateLimitLease)
+	if !ok || lease == nil {
+		return
+	}
+	lease.release(getTokenLimiter())
+}
+
+func (lease *tokenRateLimitLease) release(tl limiter.TokenLimiter) {
+	lease.mu.Lock()
+	keys := lease.concurrencyKeys
+	lease.concurrencyKeys = nil
+	lease.mu.Unlock()
+	for _, key := range keys {
+		if err := tl.ReleaseConcurrency(context.Background(), key, lease.member); err != nil {
+			common.SysError("failed to release concurrency limit: " + err.Error())
+		}
+	}
+}
+
+// refund 请求被拒绝时退还已扣减的 token
+func (lease *tokenRateLimitLease) refund(tl limiter.TokenLimiter) {
+	for _, scope := range lease.tpmScopes {
+		_, _ = tl.ConsumeTokens(context.Background(), scope.key+":tpm", -int64(lease.chargedTokens), int64(scope.limit.TPM), true)
+	}
+	lease.tpmScopes = nil
+}
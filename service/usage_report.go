@@ -0,0 +1,303 @@
+package service
+
+import (
+	"fmt"
+	"html"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/dto"
+	"github.com/QuantumNous/new-api/logger"
+	"github.com/QuantumNous/new-api/model"
+	"github.com/QuantumNous/new-api/setting/operation_setting"
+)
+
+var usageReportPeriods = []string{model.UsageReportPeriodDaily, model.UsageReportPeriodWeekly, model.UsageReportPeriodMonthly}
+
+// 本节点已处理过的周期，period -> 周期开始时间，避免每次检查都重复尝试领取
+var (
+	usageReportDone     = map[string]int64{}
+	usageReportDoneLock sync.Mutex
+)
+
+// StartUsageReportScheduler 定期生成并发送上一周期的用量报告，仅在主节点运行
+func StartUsageReportScheduler() {
+	for {
+		time.Sleep(10 * time.Minute)
+		runUsageReports(time.Now())
+	}
+}
+
+func runUsageReports(now time.Time) {
+	setting := operation_setting.GetUsageReportSetting()
+	if now.Hour() < setting.SendHour {
+		return
+	}
+	for _, period := range usageReportPeriods {
+		start, end, previousStart := model.UsageReportWindow(period, now)
+		usageReportDoneLock.Lock()
+		done := usageReportDone[period] == start.Unix()
+		usageReportDoneLock.Unlock()
+		if done {
+			continue
+		}
+		for _, adminPeriod := range setting.AdminReportPeriods {
+			if adminPeriod == period {
+				sendAdminUsageReport(period, start, end, previousStart)
+				break
+			}
+		}
+		if setting.Enabled {
+			sendUserUsageReports(period, start, end, previousStart)
+		}
+		usageReportDoneLock.Lock()
+		usageReportDone[period] = start.Unix()
+		usageReportDoneLock.Unlock()
+	}
+}
+
+func sendUserUsageReports(period string, start time.Time, end time.Time, previousStart time.Time) {
+	users, err := model.GetUsageReportUsers(period)
+	if err != nil {
+		common.SysError("failed to get usage report users: " + err.Error())
+		return
+	}
+	for _, user := range users {
+		userSetting := user.GetSetting()
+		if userSetting.UsageReportPeriod != period {
+			continue
+		}
+		report, ok := generateUsageReport(user.Id, period, start, end, previousStart)
+		if !ok {
+			continue
+		}
+		report.Username = user.Username
+		if !hasUsageReportActivity(report) {
+			continue
+		}
+		err := NotifyUser(user.Id, user.Email, userSetting, newUsageReportNotify(report, userSetting.NotifyType))
+		if err != nil {
+			common.SysLog(fmt.Sprintf("failed to send usage report to user %d: %s", user.Id, err.Error()))
+		}
+	}
+}
+
+// sendAdminUsageReport 全站报告发送给 root 用户及管理员告警目标
+func sendAdminUsageReport(period string, start time.Time, end time.Time, previousStart time.Time) {
+	report, ok := generateUsageReport(0, period, start, end, previousStart)
+	if !ok {
+		return
+	}
+	root := model.GetRootUser()
+	if root == nil {
+		return
+	}
+	rootSetting := root.GetSetting()
+	err := NotifyUser(root.Id, root.Email, rootSetting, newUsageReportNotify(report, rootSetting.NotifyType))
+	if err != nil {
+		common.SysLog(fmt.Sprintf("failed to send usage report to root user: %s", err.Error()))
+	}
+	notifyAdminTargets(root.Id, func(notifyType string) dto.Notify {
+		return newUsageReportNotify(report, notifyType)
+	})
+}
+
+// generateUsageReport 领取并生成报告，其他节点或之前已生成时返回 false
+func generateUsageReport(userId int, period string, start time.Time, end time.Time, previousStart time.Time) (*dto.UsageReport, bool) {
+	record := &model.UsageReport{
+		UserId:      userId,
+		Period:      period,
+		PeriodStart: start.Unix(),
+		PeriodEnd:   end.Unix(),
+	}
+	ok, err := model.ClaimUsageReport(record)
+	if err != nil {
+		common.SysError(fmt.Sprintf("failed to claim usage report: user_id=%d, period=%s, error=%v", userId, period, err))
+		return nil, false
+	}
+	if !ok {
+		return nil, false
+	}
+	report, err := BuildUsageReport(userId, period, start.Unix(), end.Unix(), previousStart.Unix())
+	if err != nil {
+		common.SysError(fmt.Sprintf("failed to build usage report: user_id=%d, period=%s, error=%v", userId, period, err))
+		_ = model.DeleteUsageReport(record.Id)
+		return nil, false
+	}
+	content, err := common.Marshal(report)
+	if err == nil {
+		err = model.UpdateUsageReportContent(record.Id, string(content))
+	}
+	if err != nil {
+		common.SysError(fmt.Sprintf("failed to save usage report %d: %v", record.Id, err))
+	}
+	return report, true
+}
+
+// BuildUsageReport 统计 [startTime, endTime) 的用量并与 [previousStartTime, startTime) 对比，userId 为 0 时统计全站
+func BuildUsageReport(userId int, period string, startTime int64, endTime int64, previousStartTime int64) (*dto.UsageReport, error) {
+	setting := operation_setting.GetUsageReportSetting()
+	report := &dto.UsageReport{
+		Period:    period,
+		StartTime: startTime,
+		EndTime:   endTime,
+		UserId:    userId,
+		Models:    []dto.UsageReportModel{},
+		TopTokens: []dto.UsageReportToken{},
+	}
+
+	models, err := model.GetUsageModelStats(userId, startTime, endTime)
+	if err != nil {
+		return nil, err
+	}
+	for i, stat := range models {
+		report.Quota += stat.Quota
+		report.Tokens += stat.Tokens
+		report.RequestCount += stat.Count
+		if i < setting.TopModels {
+			report.Models = append(report.Models, dto.UsageReportModel{
+				ModelName:    stat.ModelName,
+				Quota:        stat.Quota,
+				Tokens:       stat.Tokens,
+				RequestCount: stat.Count,
+			})
+		}
+	}
+
+	previousModels, err := model.GetUsageModelStats(userId, previousStartTime, startTime)
+	if err != nil {
+		return nil, err
+	}
+	for _, stat := range previousModels {
+		report.PreviousQuota += stat.Quota
+		report.PreviousRequestCount += stat.Count
+	}
+	if report.PreviousQuota > 0 {
+		change := float64(report.Quota-report.PreviousQuota) / float64(report.PreviousQuota)
+		report.QuotaChange = &change
+	}
+
+	tokens, err := model.GetUsageTopTokens(userId, startTime, endTime, setting.TopTokens)
+	if err != nil {
+		return nil, err
+	}
+	for _, stat := range tokens {
+		token := dto.UsageReportToken{
+			TokenName:    stat.TokenName,
+			Quota:        stat.Quota,
+			RequestCount: stat.Count,
+		}
+		// 用户报告中的令牌都属于该用户
+		if userId == 0 {
+			token.Username = stat.Username
+		}
+		report.TopTokens = append(report.TopTokens, token)
+	}
+
+	errorCount, err := model.CountUsageErrors(userId, startTime, endTime)
+	if err != nil {
+		return nil, err
+	}
+	report.ErrorCount = int(errorCount)
+	if total := report.RequestCount + report.ErrorCount; total > 0 {
+		report.ErrorRate = float64(report.ErrorCount) / float64(total)
+	}
+	return report, nil
+}
+
+// hasUsageReportActivity 本周期与上一周期都没有任何请求时不发送报告
+func hasUsageReportActivity(report *dto.UsageReport) bool {
+	return report.RequestCount > 0 || report.ErrorCount > 0 || report.PreviousRequestCount > 0
+}
+
+func usageReportPeriodName(period string) string {
+	switch period {
+	case model.UsageReportPeriodWeekly:
+		return "周报"
+	case model.UsageReportPeriodMonthly:
+		return "月报"
+	}
+	return "日报"
+}
+
+func usageReportChangeText(report *dto.UsageReport) string {
+	if report.QuotaChange == nil {
+		return "上期无消费"
+	}
+	return fmt.Sprintf("较上期 %+.1f%%", *report.QuotaChange*100)
+}
+
+// newUsageReportNotify 按通知方式生成报告内容，邮件与 webhook 使用 HTML，其余使用纯文本
+func newUsageReportNotify(report *dto.UsageReport, notifyType string) dto.Notify {
+	title := fmt.Sprintf("%s 用量%s（%s ~ %s）", common.SystemName, usageReportPeriodName(report.Period),
+		time.Unix(report.StartTime, 0).Format("2006-01-02"), time.Unix(report.EndTime-1, 0).Format("2006-01-02"))
+	if report.UserId == 0 {
+		title = fmt.Sprintf("%s 全站用量%s（%s ~ %s）", common.SystemName, usageReportPeriodName(report.Period),
+			time.Unix(report.StartTime, 0).Format("2006-01-02"), time.Unix(report.EndTime-1, 0).Format("2006-01-02"))
+	}
+
+	var content string
+	if notifyType == "" || notifyType == dto.NotifyTypeEmail || notifyType == dto.NotifyTypeWebhook {
+		content = renderUsageReportHTML(report)
+	} else {
+		content = renderUsageReportText(report)
+	}
+	notify := dto.NewNotify(dto.NotifyTypeUsageReport+"_"+report.Period, title, content, nil)
+	notify.Data = report
+	return notify
+}
+
+func renderUsageReportHTML(report *dto.UsageReport) string {
+	var sb strings.Builder
+	sb.WriteString(fmt.Sprintf("<p>消费：<b>%s</b>（%s）<br/>请求数：%d，Tokens：%d<br/>错误数：%d，错误率：%.2f%%</p>",
+		logger.FormatQuota(report.Quota), usageReportChangeText(report), report.RequestCount, report.Tokens, report.ErrorCount, report.ErrorRate*100))
+	if len(report.Models) > 0 {
+		sb.WriteString("<h4>模型用量</h4><table border='1' cellpadding='4' style='border-collapse:collapse'><tr><th>模型</th><th>消费</th><th>Tokens</th><th>请求数</th></tr>")
+		for _, m := range report.Models {
+			sb.WriteString(fmt.Sprintf("<tr><td>%s</td><td>%s</td><td>%d</td><td>%d</td></tr>",
+				html.EscapeString(m.ModelName), logger.FormatQuota(m.Quota), m.Tokens, m.RequestCount))
+		}
+		sb.WriteString("</table>")
+	}
+	if len(report.TopTokens) > 0 {
+		sb.WriteString("<h4>消费最多的令牌</h4><table border='1' cellpadding='4' style='border-collapse:collapse'><tr><th>令牌</th>")
+		if report.UserId == 0 {
+			sb.WriteString("<th>用户</th>")
+		}
+		sb.WriteString("<th>消费</th><th>请求数</th></tr>")
+		for _, t := range report.TopTokens {
+			sb.WriteString("<tr><td>" + html.EscapeString(t.TokenName) + "</td>")
+			if report.UserId == 0 {
+				sb.WriteString("<td>" + html.EscapeString(t.Username) + "</td>")
+			}
+			sb.WriteString(fmt.Sprintf("<td>%s</td><td>%d</td></tr>", logger.FormatQuota(t.Quota), t.RequestCount))
+		}
+		sb.WriteString("</table>")
+	}
+	return sb.String()
+}
+
+func renderUsageReportText(report *dto.UsageReport) string {
+	var sb strings.Builder
+	sb.WriteString(fmt.Sprintf("消费：%s（%s）\n请求数：%d，Tokens：%d\n错误数：%d，错误率：%.2f%%\n",
+		logger.FormatQuota(report.Quota), usageReportChangeText(report), report.RequestCount, report.Tokens, report.ErrorCount, report.ErrorRate*100))
+	if len(report.Models) > 0 {
+		sb.WriteString("\n模型用量：\n")
+		for _, m := range report.Models {
+			sb.WriteString(fmt.Sprintf("- %s：%s，%d tokens，%d 次\n", m.ModelName, logger.FormatQuota(m.Quota), m.Tokens, m.RequestCount))
+		}
+	}
+	if len(report.TopTokens) > 0 {
+		sb.WriteString("\n消费最多的令牌：\n")
+		for _, t := range report.TopTokens {
+			name := t.TokenName
+			if t.Username != "" {
+				name = fmt.Sprintf("%s（%s）", t.TokenName, t.Username)
+			}
+			sb.WriteString(fmt.Sprintf("- %s：%s，%d 次\n", name, logger.FormatQuota(t.Quota), t.RequestCount))
+		}
+	}
+	return strings.TrimSuffix(sb.String(), "\n")
+}
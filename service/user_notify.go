@@ -11,15 +11,53 @@ import (
 	"github.com/QuantumNous/new-api/common"
 	"github.com/QuantumNous/new-api/dto"
 	"github.com/QuantumNous/new-api/model"
+	"github.com/QuantumNous/new-api/setting/operation_setting"
 	"github.com/QuantumNous/new-api/setting/system_setting"
 )
 
 func NotifyRootUser(t string, subject string, content string) {
 	user := model.GetRootUser().ToBaseUser()
-	err := NotifyUser(user.Id, user.Email, user.GetSetting(), dto.NewNotify(t, subject, content, nil))
+	data := dto.NewNotify(t, subject, content, nil)
+	err := NotifyUser(user.Id, user.Email, user.GetSetting(), data)
 	if err != nil {
 		common.SysLog(fmt.Sprintf("failed to notify root user: %s", err.Error()))
 	}
+	notifyAdminTargets(user.Id, func(string) dto.Notify { return data })
+}
+
+// notifyAdminTargets 将管理员告警发送到额外配置的通知目标，每个目标单独计算通知频率限制。
+// buildNotify 按通知方式生成通知内容
+func notifyAdminTargets(rootUserId int, buildNotify func(notifyType string) dto.Notify) {
+	setting := operation_setting.GetAdminNotifySetting()
+	if !setting.Enabled {
+		return
+	}
+	for i, target := range setting.Targets {
+		data := buildNotify(target.Type)
+		canSend, err := CheckNotificationLimit(rootUserId, fmt.Sprintf("%s:admin_%d", data.Type, i))
+		if err != nil {
+			common.SysLog(fmt.Sprintf("failed to check notification limit: %s", err.Error()))
+			continue
+		}
+		if !canSend {
+			continue
+		}
+		userSetting := dto.UserSetting{
+			NotifyType:         target.Type,
+			WebhookUrl:         target.Url,
+			WebhookSecret:      target.Secret,
+			SlackWebhookUrl:    target.Url,
+			TelegramChatId:     target.ChatId,
+			DingtalkWebhookUrl: target.Url,
+			DingtalkSecret:     target.Secret,
+			FeishuWebhookUrl:   target.Url,
+			FeishuSecret:       target.Secret,
+			WecomWebhookUrl:    target.Url,
+		}
+		if err := sendNotify(rootUserId, "", userSetting, data); err != nil {
+			common.SysLog(fmt.Sprintf("failed to notify admin target %s: %s", target.Name, err.Error()))
+		}
+	}
 }
 
 func NotifyUser(userId int, userEmail string, userSetting dto.UserSetting, data dto.Notify) error {
@@ -38,6 +76,16 @@ func NotifyUser(userId int, userEmail string, userSetting dto.UserSetting, data
 		return fmt.Errorf("notification limit exceeded for user %d with type %s", userId, notifyType)
 	}
 
+	return sendNotify(userId, userEmail, userSetting, data)
+}
+
+// sendNotify 按通知方式发送，不做频率限制
+func sendNotify(userId int, userEmail string, userSetting dto.UserSetting, data dto.Notify) error {
+	notifyType := userSetting.NotifyType
+	if notifyType == "" {
+		notifyType = dto.NotifyTypeEmail
+	}
+
 	switch notifyType {
 	case dto.NotifyTypeEmail:
 		// 优先使用设置中的通知邮箱，如果为空则使用用户的默认邮箱
@@ -75,6 +123,43 @@ func NotifyUser(userId int, userEmail string, userSetting dto.UserSetting, data
 			return nil
 		}
 		return sendGotifyNotify(gotifyUrl, gotifyToken, userSetting.GotifyPriority, data)
+	case dto.NotifyTypeSlack:
+		if userSetting.SlackWebhookUrl == "" {
+			common.SysLog(fmt.Sprintf("user %d has no slack webhook url, skip sending slack", userId))
+			return nil
+		}
+		return sendSlackNotify(userSetting.SlackWebhookUrl, data)
+	case dto.NotifyTypeTelegram:
+		chatId := userSetting.TelegramChatId
+		if chatId == "" {
+			// 未指定会话时发送给用户绑定的 Telegram 账号
+			if user, err := model.GetUserById(userId, false); err == nil {
+				chatId = user.TelegramId
+			}
+		}
+		if chatId == "" {
+			common.SysLog(fmt.Sprintf("user %d has no telegram chat id, skip sending telegram", userId))
+			return nil
+		}
+		return sendTelegramNotify(chatId, data)
+	case dto.NotifyTypeDingtalk:
+		if userSetting.DingtalkWebhookUrl == "" {
+			common.SysLog(fmt.Sprintf("user %d has no dingtalk webhook url, skip sending dingtalk", userId))
+			return nil
+		}
+		return sendDingtalkNotify(userSetting.DingtalkWebhookUrl, userSetting.DingtalkSecret, data)
+	case dto.NotifyTypeFeishu:
+		if userSetting.FeishuWebhookUrl == "" {
+			common.SysLog(fmt.Sprintf("user %d has no feishu webhook url, skip sending feishu", userId))
+			return nil
+		}
+		return sendFeishuNotify(userSetting.FeishuWebhookUrl, userSetting.FeishuSecret, data)
+	case dto.NotifyTypeWecom:
+		if userSetting.WecomWebhookUrl == "" {
+			common.SysLog(fmt.Sprintf("user %d has no wecom webhook url, skip sending wecom", userId))
+			return nil
+		}
+		return sendWecomNotify(userSetting.WecomWebhookUrl, data)
 	}
 	return nil
 }
@@ -2,6 +2,7 @@ package service
 
 import (
 	"bytes"
+	"context"
 	"crypto/hmac"
 	"crypto/sha256"
 	"encoding/hex"
@@ -21,6 +22,7 @@ type WebhookPayload struct {
 	Title     string        `json:"title"`
 	Content   string        `json:"content"`
 	Values    []interface{} `json:"values,omitempty"`
+	Data      any           `json:"data,omitempty"`
 	Timestamp int64         `json:"timestamp"`
 }
 
@@ -45,6 +47,7 @@ func SendWebhookNotify(webhookURL string, secret string, data dto.Notify) error
 		Title:     data.Title,
 		Content:   content,
 		Values:    data.Values,
+		Data:      data.Data,
 		Timestamp: time.Now().Unix(),
 	}
 
@@ -54,9 +57,15 @@ func SendWebhookNotify(webhookURL string, secret string, data dto.Notify) error
 		return fmt.Errorf("failed to marshal webhook payload: %v", err)
 	}
 
-	// 创建 HTTP 请求
+	_, err = postWebhook(context.Background(), webhookURL, secret, payloadBytes, nil)
+	return err
+}
+
+// postWebhook 发送已序列化的 webhook 负载，返回响应状态码。配置了 secret 时附带签名
+func postWebhook(ctx context.Context, webhookURL string, secret string, payloadBytes []byte, headers map[string]string) (int, error) {
 	var req *http.Request
 	var resp *http.Response
+	var err error
 
 	if system_setting.EnableWorker() {
 		// 构建worker请求数据
@@ -69,6 +78,9 @@ func SendWebhookNotify(webhookURL string, secret string, data dto.Notify) error
 			},
 			Body: payloadBytes,
 		}
+		for k, v := range headers {
+			workerReq.Headers[k] = v
+		}
 
 		// 如果有secret，添加签名到headers
 		if secret != "" {
@@ -79,28 +91,26 @@ func SendWebhookNotify(webhookURL string, secret string, data dto.Notify) error
 
 		resp, err = DoWorkerRequest(workerReq)
 		if err != nil {
-			return fmt.Errorf("failed to send webhook request through worker: %v", err)
+			return 0, fmt.Errorf("failed to send webhook request through worker: %v", err)
 		}
 		defer resp.Body.Close()
-
-		// 检查响应状态
-		if resp.StatusCode < 200 || resp.StatusCode >= 300 {
-			return fmt.Errorf("webhook request failed with status code: %d", resp.StatusCode)
-		}
 	} else {
 		// SSRF防护：验证Webhook URL（非Worker模式）
 		fetchSetting := system_setting.GetFetchSetting()
 		if err := common.ValidateURLWithFetchSetting(webhookURL, fetchSetting.EnableSSRFProtection, fetchSetting.AllowPrivateIp, fetchSetting.DomainFilterMode, fetchSetting.IpFilterMode, fetchSetting.DomainList, fetchSetting.IpList, fetchSetting.AllowedPorts, fetchSetting.ApplyIPFilterForDomain); err != nil {
-			return fmt.Errorf("request reject: %v", err)
+			return 0, fmt.Errorf("request reject: %v", err)
 		}
 
-		req, err = http.NewRequest(http.MethodPost, webhookURL, bytes.NewBuffer(payloadBytes))
+		req, err = http.NewRequestWithContext(ctx, http.MethodPost, webhookURL, bytes.NewBuffer(payloadBytes))
 		if err != nil {
-			return fmt.Errorf("failed to create webhook request: %v", err)
+			return 0, fmt.Errorf("failed to create webhook request: %v", err)
 		}
 
 		// 设置请求头
 		req.Header.Set("Content-Type", "application/json")
+		for k, v := range headers {
+			req.Header.Set(k, v)
+		}
 
 		// 如果有 secret，生成签名
 		if secret != "" {
@@ -112,15 +122,14 @@ func SendWebhookNotify(webhookURL string, secret string, data dto.Notify) error
 		client := GetHttpClient()
 		resp, err = client.Do(req)
 		if err != nil {
-			return fmt.Errorf("failed to send webhook request: %v", err)
+			return 0, fmt.Errorf("failed to send webhook request: %v", err)
 		}
 		defer resp.Body.Close()
-
-		// 检查响应状态
-		if resp.StatusCode < 200 || resp.StatusCode >= 300 {
-			return fmt.Errorf("webhook request failed with status code: %d", resp.StatusCode)
-		}
 	}
 
-	return nil
+	// 检查响应状态
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return resp.StatusCode, fmt.Errorf("webhook request failed with status code: %d", resp.StatusCode)
+	}
+	return resp.StatusCode, nil
 }
@@ -0,0 +1,252 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/QuantumNous/new-api/common"
+	"github.com/QuantumNous/new-api/common/event"
+	"github.com/QuantumNous/new-api/model"
+	"github.com/QuantumNous/new-api/setting/operation_setting"
+
+	"github.com/bytedance/gopkg/util/gopool"
+)
+
+// 每轮最多领取的投递记录数
+const webhookDeliveryBatchSize = 50
+
+var webhookDeliveryKick = make(chan struct{}, 1)
+
+// TriggerWebhookDelivery 唤醒投递协程立即处理队列
+func TriggerWebhookDelivery() {
+	select {
+	case webhookDeliveryKick <- struct{}{}:
+	default:
+	}
+}
+
+// SubscribeWebhookDeliveries 同步订阅事件总线，事件在发布方的调用链中落库，需在服务启动前调用。
+// 发布方只写入一条事件记录，按订阅展开投递记录由投递协程完成
+func SubscribeWebhookDeliveries() {
+	event.SubscribeSync(enqueueWebhookEvent)
+}
+
+// StartWebhookDeliveryWorker 定期投递队列中到期的 webhook
+func StartWebhookDeliveryWorker() {
+	ticker := time.NewTicker(10 * time.Second)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+		case <-webhookDeliveryKick:
+		}
+		dispatchWebhookDeliveries()
+	}
+}
+
+// enqueueWebhookEvent 写入一条待分发的事件记录
+func enqueueWebhookEvent(e *event.Event) {
+	if !operation_setting.GetWebhookSetting().Enabled {
+		return
+	}
+	payload, err := common.Marshal(e)
+	if err != nil {
+		common.SysError(fmt.Sprintf("failed to marshal event %s: %v", e.Id, err))
+		return
+	}
+	err = model.CreateWebhookEvent(&model.WebhookEvent{
+		EventId:     e.Id,
+		EventType:   string(e.Type),
+		UserId:      e.UserId,
+		UserScoped:  event.IsUserScoped(e.Type),
+		Payload:     string(payload),
+		CreatedTime: e.CreatedAt,
+	})
+	if err != nil {
+		common.SysError(fmt.Sprintf("failed to enqueue webhook event: event=%s, error=%v", e.Id, err))
+		return
+	}
+	TriggerWebhookDelivery()
+}
+
+// fanOutWebhookEvents 为订阅了事件的每个端点写入一条待投递记录
+func fanOutWebhookEvents() {
+	events, err := model.GetPendingWebhookEvents(webhookDeliveryBatchSize)
+	if err != nil {
+		common.SysError("failed to get pending webhook events: " + err.Error())
+		return
+	}
+	for _, e := range events {
+		err := model.FanOutWebhookEvent(e, func(subscriptions []*model.WebhookSubscription) []*model.WebhookDelivery {
+			deliveries := make([]*model.WebhookDelivery, 0, len(subscriptions))
+			for _, subscription := range subscriptions {
+				deliveries = append(deliveries, &model.WebhookDelivery{
+					SubscriptionId: subscription.Id,
+					UserId:         subscription.UserId,
+					EventId:        e.EventId,
+					EventType:      e.EventType,
+					Payload:        e.Payload,
+					Status:         model.WebhookDeliveryStatusPending,
+					NextAttemptAt:  common.GetTimestamp(),
+					CreatedTime:    e.CreatedTime,
+				})
+			}
+			return deliveries
+		})
+		if err != nil {
+			common.SysError(fmt.Sprintf("failed to fan out webhook event: event=%s, error=%v", e.EventId, err))
+		}
+	}
+	if len(events) == webhookDeliveryBatchSize {
+		TriggerWebhookDelivery()
+	}
+}
+
+func dispatchWebhookDeliveries() {
+	setting := operation_setting.GetWebhookSetting()
+	if !setting.Enabled && !operation_setting.GetTaskCallbackSetting().Enabled {
+		return
+	}
+	if setting.Enabled {
+		fanOutWebhookEvents()
+	}
+	now := common.GetTimestamp()
+	deliveries, err := model.GetDueWebhookDeliveries(now, webhookDeliveryBatchSize)
+	if err != nil {
+		common.SysError("failed to get due webhook deliveries: " + err.Error())
+		return
+	}
+	// 租约需覆盖一次投递的超时时间，执行节点中途退出时记录会在租约到期后被重新投递
+	leaseUntil := now + int64(setting.TimeoutSeconds) + 60
+	var wg sync.WaitGroup
+	for _, delivery := range deliveries {
+		ok, err := model.ClaimWebhookDelivery(delivery.Id, delivery.NextAttemptAt, leaseUntil)
+		if err != nil || !ok {
+			continue
+		}
+		wg.Add(1)
+		gopool.Go(func() {
+			defer wg.Done()
+			deliverWebhook(delivery)
+		})
+	}
+	wg.Wait()
+}
+
+// getWebhookDeliveryTarget 获取投递地址与签名密钥，任务回调使用任务上记录的回调地址。
+// 任务回调始终签名，任务上没有记录密钥时使用令牌的密钥，无法获取密钥时不投递
+func getWebhookDeliveryTarget(delivery *model.WebhookDelivery) (string, string, error) {
+	if delivery.TaskId != 0 {
+		task, err := model.GetTaskById(delivery.TaskId)
+		if err != nil || task.Properties.CallbackUrl == "" {
+			return "", "", errors.New("task not found or callback url is empty")
+		}
+		secret := task.PrivateData.CallbackSecret
+		if secret == "" && task.TokenId != 0 {
+			secret, _ = model.EnsureTokenCallbackSecret(task.TokenId)
+		}
+		if secret == "" {
+			return "", "", errors.New("task callback secret is unavailable")
+		}
+		return task.Properties.CallbackUrl, secret, nil
+	}
+	subscription, err := model.GetWebhookSubscriptionById(delivery.SubscriptionId, delivery.UserId)
+	if err != nil || subscription.Status != model.WebhookStatusEnabled {
+		return "", "", errors.New("subscription not found or disabled")
+	}
+	return subscription.Url, subscription.Secret, nil
+}
+
+func deliverWebhook(delivery *model.WebhookDelivery) {
+	setting := operation_setting.GetWebhookSetting()
+	targetUrl, secret, err := getWebhookDeliveryTarget(delivery)
+	if err != nil {
+		finishWebhookDelivery(delivery.Id, map[string]interface{}{
+			"status":     model.WebhookDeliveryStatusFailed,
+			"last_error": err.Error(),
+		})
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Duration(setting.TimeoutSeconds)*time.Second)
+	defer cancel()
+	headers := map[string]string{
+		"X-Webhook-Event":    delivery.EventType,
+		"X-Webhook-Event-Id": delivery.EventId,
+		"X-Webhook-Delivery": strconv.Itoa(delivery.Id),
+	}
+	statusCode, err := postWebhook(ctx, targetUrl, secret, []byte(delivery.Payload), headers)
+
+	attempts := delivery.Attempts + 1
+	fields := map[string]interface{}{
+		"attempts":        attempts,
+		"response_status": statusCode,
+	}
+	if err == nil {
+		fields["status"] = model.WebhookDeliveryStatusSuccess
+		fields["last_error"] = ""
+		fields["delivered_at"] = common.GetTimestamp()
+	} else {
+		fields["last_error"] = err.Error()
+		if attempts >= setting.MaxAttempts {
+			fields["status"] = model.WebhookDeliveryStatusFailed
+		} else {
+			fields["next_attempt_at"] = common.GetTimestamp() + webhookBackoffSeconds(attempts)
+		}
+	}
+	finishWebhookDelivery(delivery.Id, fields)
+}
+
+func finishWebhookDelivery(id int, fields map[string]interface{}) {
+	if err := model.UpdateWebhookDeliveryFields(id, fields); err != nil {
+		common.SysError(fmt.Sprintf("failed to update webhook delivery %d: %v", id, err))
+	}
+}
+
+// webhookBackoffSeconds 第 attempts 次投递失败后的重试间隔，按指数退避
+func webhookBackoffSeconds(attempts int) int64 {
+	setting := operation_setting.GetWebhookSetting()
+	backoff := int64(setting.BaseBackoffSeconds)
+	if backoff <= 0 {
+		backoff = 1
+	}
+	for i := 1; i < attempts; i++ {
+		backoff *= 2
+		if backoff >= int64(setting.MaxBackoffSeconds) {
+			break
+		}
+	}
+	if setting.MaxBackoffSeconds > 0 && backoff > int64(setting.MaxBackoffSeconds) {
+		backoff = int64(setting.MaxBackoffSeconds)
+	}
+	return backoff
+}
+
+// StartWebhookDeliveryCleaner 定期清理超过保留期的投递记录
+func StartWebhookDeliveryCleaner() {
+	for {
+		time.Sleep(time.Hour)
+		retentionDays := operation_setting.GetWebhookSetting().RetentionDays
+		if retentionDays <= 0 {
+			continue
+		}
+		targetTimestamp := common.GetTimestamp() - int64(retentionDays)*86400
+		if err := model.DeleteOldWebhookEvents(targetTimestamp); err != nil {
+			common.SysError("failed to clean webhook events: " + err.Error())
+		}
+		for {
+			deleted, err := model.DeleteOldWebhookDeliveries(targetTimestamp, 1000)
+			if err != nil {
+				common.SysError("failed to clean webhook deliveries: " + err.Error())
+				break
+			}
+			if deleted == 0 {
+				break
+			}
+		}
+	}
+}
@@ -0,0 +1,37 @@
+package operation_setting
+
+import "github.com/QuantumNous/new-api/setting/config"
+
+// AdminNotifyTarget 管理员告警的通知目标
+type AdminNotifyTarget struct {
+	Name string `json:"name"`
+	// slack / telegram / dingtalk / feishu / wecom / webhook
+	Type string `json:"type"`
+	// 机器人或 webhook 地址，Telegram 不需要
+	Url string `json:"url"`
+	// 钉钉加签密钥、飞书签名校验密钥或 webhook 签名密钥
+	Secret string `json:"secret"`
+	// Telegram 会话 ID（用户、群组或频道），使用 Telegram 登录所配置的机器人发送
+	ChatId string `json:"chat_id"`
+}
+
+type AdminNotifySetting struct {
+	// 启用后渠道禁用/启用、渠道测试等管理员告警除发送给 root 用户外，还会发送到以下目标
+	Enabled bool                `json:"enabled"`
+	Targets []AdminNotifyTarget `json:"targets"`
+}
+
+// 默认配置
+var adminNotifySetting = AdminNotifySetting{
+	Enabled: false,
+	Targets: []AdminNotifyTarget{},
+}
+
+func init() {
+	// 注册到全局配置管理器
+	config.GlobalConfig.Register("admin_notify_setting", &adminNotifySetting)
+}
+
+func GetAdminNotifySetting() *AdminNotifySetting {
+	return &adminNotifySetting
+}
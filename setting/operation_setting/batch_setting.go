@@ -0,0 +1,31 @@
+package operation_setting
+
+import "github.com/QuantumNous/new-api/setting/config"
+
+type BatchSetting struct {
+	// 单个批处理任务内同时执行的请求数
+	Concurrency int `json:"concurrency"`
+	// 单个节点同时执行的批处理任务数
+	MaxRunningBatches int `json:"max_running_batches"`
+	// 单个批处理任务的最大请求数
+	MaxRequests int `json:"max_requests"`
+	// 执行节点心跳超时时间（秒），超时的任务视为已中断
+	HeartbeatTimeoutSeconds int `json:"heartbeat_timeout_seconds"`
+}
+
+// 默认配置
+var batchSetting = BatchSetting{
+	Concurrency:             4,
+	MaxRunningBatches:       2,
+	MaxRequests:             50000,
+	HeartbeatTimeoutSeconds: 300,
+}
+
+func init() {
+	// 注册到全局配置管理器
+	config.GlobalConfig.Register("batch_setting", &batchSetting)
+}
+
+func GetBatchSetting() *BatchSetting {
+	return &batchSetting
+}
@@ -0,0 +1,33 @@
+package operation_setting
+
+import "github.com/QuantumNous/new-api/setting/config"
+
+type ChannelBreakerSetting struct {
+	Enabled bool `json:"enabled"`
+	// 连续可重试失败次数达到该值后熔断
+	FailureThreshold int `json:"failure_threshold"`
+	// 熔断冷却时间（秒），冷却结束后进入半开状态
+	CooldownSeconds int `json:"cooldown_seconds"`
+	// 半开状态下放行真实请求的最小间隔（秒）
+	HalfOpenProbeIntervalSeconds int `json:"half_open_probe_interval_seconds"`
+	// 多节点部署时从 Redis 同步熔断状态的间隔（秒）
+	SyncIntervalSeconds int `json:"sync_interval_seconds"`
+}
+
+// 默认配置
+var channelBreakerSetting = ChannelBreakerSetting{
+	Enabled:                      false,
+	FailureThreshold:             5,
+	CooldownSeconds:              60,
+	HalfOpenProbeIntervalSeconds: 5,
+	SyncIntervalSeconds:          5,
+}
+
+func init() {
+	// 注册到全局配置管理器
+	config.GlobalConfig.Register("channel_breaker_setting", &channelBreakerSetting)
+}
+
+func GetChannelBreakerSetting() *ChannelBreakerSetting {
+	return &channelBreakerSetting
+}
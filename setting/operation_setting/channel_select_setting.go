@@ -0,0 +1,61 @@
+package operation_setting
+
+import "github.com/QuantumNous/new-api/setting/config"
+
+// 渠道选择策略
+const (
+	ChannelSelectStrategyWeighted     = "weighted"      // 静态权重（默认）
+	ChannelSelectStrategyLeastLatency = "least_latency" // 同优先级下首字延迟最低的渠道优先
+	ChannelSelectStrategyEWMA         = "ewma"          // 按成功率、延迟与 429 的 EWMA 评分调整权重
+)
+
+type ChannelSelectSetting struct {
+	// 默认策略，未在 GroupStrategies 中配置的分组使用该策略
+	DefaultStrategy string `json:"default_strategy"`
+	// 分组 -> 策略
+	GroupStrategies map[string]string `json:"group_strategies"`
+	// 健康统计的滑动窗口（秒）
+	WindowSeconds int `json:"window_seconds"`
+	// 样本数不足时视为健康，避免冷启动时渠道被饿死
+	MinSamples int `json:"min_samples"`
+	// EWMA 平滑系数 (0, 1]，越大越敏感
+	EWMAAlpha float64 `json:"ewma_alpha"`
+	// 延迟评分的参考值（毫秒），首字延迟等于该值时延迟得分为 0.5
+	LatencyReferenceMs int `json:"latency_reference_ms"`
+	// 评分最低保留比例，保证不健康的渠道仍有少量探测流量
+	MinScoreRatio float64 `json:"min_score_ratio"`
+	// 多 Key 随机模式下按 Key 的健康评分加权选择
+	KeyHealthAware bool `json:"key_health_aware"`
+}
+
+// 默认配置
+var channelSelectSetting = ChannelSelectSetting{
+	DefaultStrategy:    ChannelSelectStrategyWeighted,
+	GroupStrategies:    map[string]string{},
+	WindowSeconds:      300,
+	MinSamples:         5,
+	EWMAAlpha:          0.2,
+	LatencyReferenceMs: 3000,
+	MinScoreRatio:      0.05,
+	KeyHealthAware:     false,
+}
+
+func init() {
+	// 注册到全局配置管理器
+	config.GlobalConfig.Register("channel_select_setting", &channelSelectSetting)
+}
+
+func GetChannelSelectSetting() *ChannelSelectSetting {
+	return &channelSelectSetting
+}
+
+// GetChannelSelectStrategy 返回分组使用的渠道选择策略
+func GetChannelSelectStrategy(group string) string {
+	if strategy, ok := channelSelectSetting.GroupStrategies[group]; ok && strategy != "" {
+		return strategy
+	}
+	if channelSelectSetting.DefaultStrategy == "" {
+		return ChannelSelectStrategyWeighted
+	}
+	return channelSelectSetting.DefaultStrategy
+}
@@ -0,0 +1,114 @@
+package operation_setting
+
+import (
+	"slices"
+
+	"github.com/QuantumNous/new-api/setting/config"
+)
+
+// 内容策略规则类型
+const (
+	ContentPolicyRuleLiteral = "literal" // 关键词，不区分大小写
+	ContentPolicyRuleRegex   = "regex"   // 正则表达式
+	ContentPolicyRulePII     = "pii"     // 内置的个人信息检测器
+)
+
+// 内置的个人信息检测器
+const (
+	ContentPolicyPIIEmail      = "email"
+	ContentPolicyPIIPhone      = "phone"
+	ContentPolicyPIICreditCard = "credit_card"
+	ContentPolicyPIIIdNumber   = "id_number"
+)
+
+// 命中规则后的处理方式
+const (
+	ContentPolicyActionBlock  = "block"  // 拒绝请求或中止输出
+	ContentPolicyActionRedact = "redact" // 将命中的内容替换为掩码
+	ContentPolicyActionLog    = "log"    // 仅记录日志
+)
+
+// 规则作用的内容
+const (
+	ContentPolicyTargetPrompt     = "prompt"
+	ContentPolicyTargetCompletion = "completion"
+)
+
+type ContentPolicyRule struct {
+	Name    string `json:"name"`
+	Enabled bool   `json:"enabled"`
+	Type    string `json:"type"`
+	// literal 为关键词列表，regex 为正则表达式列表，pii 为检测器列表（为空时启用全部检测器）
+	Patterns []string `json:"patterns"`
+	Action   string   `json:"action"`
+	// redact 时的替换内容，默认为 ***
+	Mask string `json:"mask"`
+	// 作用的内容，为空时同时作用于 prompt 与 completion
+	Targets []string `json:"targets"`
+	// 生效的分组与令牌，均为空时对所有请求生效
+	Groups   []string `json:"groups"`
+	TokenIds []int    `json:"token_ids"`
+}
+
+type ContentModerationSetting struct {
+	Enabled bool `json:"enabled"`
+	// 用于调用 /v1/moderations 的渠道，需兼容 OpenAI moderations 接口
+	ChannelId int    `json:"channel_id"`
+	Model     string `json:"model"`
+	// 生效的分组，为空时对所有分组生效
+	Groups []string `json:"groups"`
+	// 命中时的处理方式，仅支持 block 与 log
+	Action         string `json:"action"`
+	TimeoutSeconds int    `json:"timeout_seconds"`
+	// 调用审核接口失败时是否放行请求
+	FailOpen bool `json:"fail_open"`
+}
+
+type ContentPolicySetting struct {
+	Enabled    bool                     `json:"enabled"`
+	Rules      []ContentPolicyRule      `json:"rules"`
+	Moderation ContentModerationSetting `json:"moderation"`
+}
+
+// 默认配置
+var contentPolicySetting = ContentPolicySetting{
+	Enabled: false,
+	Rules:   []ContentPolicyRule{},
+	Moderation: ContentModerationSetting{
+		Model:          "omni-moderation-latest",
+		Action:         ContentPolicyActionBlock,
+		TimeoutSeconds: 10,
+		FailOpen:       true,
+	},
+}
+
+func init() {
+	// 注册到全局配置管理器
+	config.GlobalConfig.Register("content_policy_setting", &contentPolicySetting)
+}
+
+func GetContentPolicySetting() *ContentPolicySetting {
+	return &contentPolicySetting
+}
+
+// AppliesTo 判断规则是否作用于指定内容、分组与令牌
+func (rule *ContentPolicyRule) AppliesTo(target string, group string, tokenId int) bool {
+	if !rule.Enabled {
+		return false
+	}
+	if len(rule.Targets) > 0 && !slices.Contains(rule.Targets, target) {
+		return false
+	}
+	if len(rule.Groups) > 0 && !slices.Contains(rule.Groups, group) {
+		return false
+	}
+	return len(rule.TokenIds) == 0 || slices.Contains(rule.TokenIds, tokenId)
+}
+
+// AppliesTo 判断内容审核是否作用于指定分组
+func (s *ContentModerationSetting) AppliesTo(group string) bool {
+	if !s.Enabled || s.ChannelId == 0 {
+		return false
+	}
+	return len(s.Groups) == 0 || slices.Contains(s.Groups, group)
+}
@@ -0,0 +1,58 @@
+package operation_setting
+
+import "github.com/QuantumNous/new-api/setting/config"
+
+type MediaStorageSetting struct {
+	// 启用后将生成的图片、视频与音频保存到文件存储后端，返回的地址改为带签名的网关地址
+	Enabled bool `json:"enabled"`
+	// 保存异步任务（视频、Suno、Midjourney）的结果
+	TaskEnabled bool `json:"task_enabled"`
+	// 保存图片生成接口的结果，在请求完成后异步保存，返回给客户端的地址保持不变
+	ImageEnabled bool `json:"image_enabled"`
+	// 保存语音合成接口的结果
+	AudioEnabled bool `json:"audio_enabled"`
+	// 单个文件的最大大小（MB）
+	MaxFileSizeMB int `json:"max_file_size_mb"`
+	// 每个用户的默认存储空间（MB），0 表示不限制
+	UserQuotaMB int `json:"user_quota_mb"`
+	// 按分组覆盖用户的存储空间（MB）
+	GroupQuotaMB map[string]int `json:"group_quota_mb"`
+	// 保留天数，0 表示永久保留
+	RetentionDays int `json:"retention_days"`
+	// 签名地址的有效期（秒）
+	SignedUrlTTLSeconds int `json:"signed_url_ttl_seconds"`
+	// 下载上游文件的超时时间（秒）
+	DownloadTimeoutSeconds int `json:"download_timeout_seconds"`
+}
+
+// 默认配置
+var mediaStorageSetting = MediaStorageSetting{
+	Enabled:                false,
+	TaskEnabled:            true,
+	ImageEnabled:           true,
+	AudioEnabled:           true,
+	MaxFileSizeMB:          200,
+	UserQuotaMB:            1024,
+	GroupQuotaMB:           map[string]int{},
+	RetentionDays:          30,
+	SignedUrlTTLSeconds:    86400,
+	DownloadTimeoutSeconds: 300,
+}
+
+func init() {
+	// 注册到全局配置管理器
+	config.GlobalConfig.Register("media_storage_setting", &mediaStorageSetting)
+}
+
+func GetMediaStorageSetting() *MediaStorageSetting {
+	return &mediaStorageSetting
+}
+
+// GetUserQuotaBytes 返回分组的存储空间上限（字节），0 表示不限制
+func (s *MediaStorageSetting) GetUserQuotaBytes(group string) int64 {
+	quotaMB := s.UserQuotaMB
+	if groupQuota, ok := s.GroupQuotaMB[group]; ok {
+		quotaMB = groupQuota
+	}
+	return int64(quotaMB) << 20
+}
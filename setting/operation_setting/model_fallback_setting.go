@@ -0,0 +1,35 @@
+package operation_setting
+
+import (
+	"github.com/QuantumNous/new-api/setting/config"
+)
+
+type ModelFallbackSetting struct {
+	Enabled bool `json:"enabled"`
+	// 分组 -> 模型 -> 回退模型列表，主模型的所有渠道均失败或限流时按顺序切换到下一个模型
+	// 令牌上配置的回退链优先于分组配置
+	GroupChains map[string]map[string][]string `json:"group_chains"`
+}
+
+// 默认配置
+var modelFallbackSetting = ModelFallbackSetting{
+	Enabled:     false,
+	GroupChains: map[string]map[string][]string{},
+}
+
+func init() {
+	// 注册到全局配置管理器
+	config.GlobalConfig.Register("model_fallback_setting", &modelFallbackSetting)
+}
+
+func GetModelFallbackSetting() *ModelFallbackSetting {
+	return &modelFallbackSetting
+}
+
+// GetGroupModelFallbackChain 返回分组下模型的回退链，未启用或未配置时返回 nil
+func GetGroupModelFallbackChain(group, modelName string) []string {
+	if !modelFallbackSetting.Enabled {
+		return nil
+	}
+	return modelFallbackSetting.GroupChains[group][modelName]
+}
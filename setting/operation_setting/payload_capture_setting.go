@@ -0,0 +1,54 @@
+package operation_setting
+
+import (
+	"slices"
+
+	"github.com/QuantumNous/new-api/setting/config"
+)
+
+// 请求内容的存储位置
+const (
+	PayloadCaptureStorageDatabase = "database" // 保存在日志数据库
+	PayloadCaptureStorageFile     = "file"     // 保存在文件存储后端，数据库仅保存索引
+)
+
+type PayloadCaptureSetting struct {
+	Enabled bool `json:"enabled"`
+	// 需要记录的用户、令牌与分组，满足任意一项即记录；均为空时不记录任何请求
+	UserIds  []int    `json:"user_ids"`
+	TokenIds []int    `json:"token_ids"`
+	Groups   []string `json:"groups"`
+	Storage  string   `json:"storage"`
+	// 请求体与响应体各自的最大记录长度（字节），超出部分截断
+	MaxBodyBytes int `json:"max_body_bytes"`
+	// 保留天数，0 表示永久保留
+	RetentionDays int `json:"retention_days"`
+}
+
+// 默认配置
+var payloadCaptureSetting = PayloadCaptureSetting{
+	Enabled:       false,
+	UserIds:       []int{},
+	TokenIds:      []int{},
+	Groups:        []string{},
+	Storage:       PayloadCaptureStorageDatabase,
+	MaxBodyBytes:  64 * 1024,
+	RetentionDays: 7,
+}
+
+func init() {
+	// 注册到全局配置管理器
+	config.GlobalConfig.Register("payload_capture_setting", &payloadCaptureSetting)
+}
+
+func GetPayloadCaptureSetting() *PayloadCaptureSetting {
+	return &payloadCaptureSetting
+}
+
+// ShouldCapture 判断是否记录指定用户、令牌与分组的请求内容
+func (s *PayloadCaptureSetting) ShouldCapture(userId int, tokenId int, group string) bool {
+	if !s.Enabled {
+		return false
+	}
+	return slices.Contains(s.UserIds, userId) || slices.Contains(s.TokenIds, tokenId) || slices.Contains(s.Groups, group)
+}
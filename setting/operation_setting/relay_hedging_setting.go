@@ -0,0 +1,41 @@
+package operation_setting
+
+import (
+	"time"
+
+	"github.com/QuantumNous/new-api/setting/config"
+)
+
+type RelayHedgingSetting struct {
+	Enabled bool `json:"enabled"`
+	// 分组 -> 对冲等待时间（毫秒），超过该时间仍未向客户端返回首字时向另一个渠道发起相同请求
+	// 未配置的分组不启用对冲；启用对冲的请求不发送自定义 Ping，避免 Ping 被当作首字
+	GroupDelayMs map[string]int `json:"group_delay_ms"`
+}
+
+// 默认配置
+var relayHedgingSetting = RelayHedgingSetting{
+	Enabled:      false,
+	GroupDelayMs: map[string]int{},
+}
+
+func init() {
+	// 注册到全局配置管理器
+	config.GlobalConfig.Register("relay_hedging_setting", &relayHedgingSetting)
+}
+
+func GetRelayHedgingSetting() *RelayHedgingSetting {
+	return &relayHedgingSetting
+}
+
+// GetRelayHedgingDelay 返回分组的对冲等待时间，返回 0 表示不启用
+func GetRelayHedgingDelay(group string) time.Duration {
+	if !relayHedgingSetting.Enabled {
+		return 0
+	}
+	delayMs := relayHedgingSetting.GroupDelayMs[group]
+	if delayMs <= 0 {
+		return 0
+	}
+	return time.Duration(delayMs) * time.Millisecond
+}
@@ -0,0 +1,62 @@
+package operation_setting
+
+import "github.com/QuantumNous/new-api/setting/config"
+
+const (
+	ResponseCacheBackendRedis  = "redis"
+	ResponseCacheBackendMemory = "memory"
+)
+
+const (
+	// 命中缓存不计费
+	ResponseCacheBillingFree = "free"
+	// 命中缓存按原价乘以 BillingRatio 计费
+	ResponseCacheBillingRatio = "ratio"
+)
+
+type ResponseCacheSetting struct {
+	Enabled bool `json:"enabled"`
+	// 缓存后端，留空时启用 Redis 则使用 Redis，否则使用内存
+	Backend string `json:"backend"`
+	// 未单独配置的模型使用的缓存时间（秒），0 表示不缓存
+	DefaultTTLSeconds int `json:"default_ttl_seconds"`
+	// 按模型名配置的缓存时间（秒），0 表示不缓存该模型
+	ModelTTLSeconds map[string]int `json:"model_ttl_seconds"`
+	// 内存后端最多缓存的条目数
+	MaxEntries int `json:"max_entries"`
+	// 单条响应超过该大小（字节）时不缓存
+	MaxEntryBytes int    `json:"max_entry_bytes"`
+	BillingMode   string `json:"billing_mode"`
+	// BillingMode 为 ratio 时的计费倍率
+	BillingRatio float64 `json:"billing_ratio"`
+	// 是否在不同用户之间共享缓存，默认每个用户的缓存相互隔离
+	ShareAcrossUsers bool `json:"share_across_users"`
+}
+
+// 默认配置
+var responseCacheSetting = ResponseCacheSetting{
+	Enabled:           false,
+	DefaultTTLSeconds: 0,
+	ModelTTLSeconds:   map[string]int{},
+	MaxEntries:        10000,
+	MaxEntryBytes:     1 << 20,
+	BillingMode:       ResponseCacheBillingFree,
+	BillingRatio:      0.1,
+}
+
+func init() {
+	// 注册到全局配置管理器
+	config.GlobalConfig.Register("response_cache_setting", &responseCacheSetting)
+}
+
+func GetResponseCacheSetting() *ResponseCacheSetting {
+	return &responseCacheSetting
+}
+
+// GetTTLSeconds 获取上游模型的缓存时间，返回 0 表示该模型不缓存
+func (s *ResponseCacheSetting) GetTTLSeconds(modelName string) int {
+	if ttl, ok := s.ModelTTLSeconds[modelName]; ok {
+		return ttl
+	}
+	return s.DefaultTTLSeconds
+}
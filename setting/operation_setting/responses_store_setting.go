@@ -0,0 +1,28 @@
+package operation_setting
+
+import "github.com/QuantumNous/new-api/setting/config"
+
+// ResponsesStoreSetting 在网关保存 Responses API 的输入与输出，使 previous_response_id 不依赖上游渠道
+type ResponsesStoreSetting struct {
+	Enabled bool `json:"enabled"`
+	// 保留天数，0 表示永久保留
+	RetentionDays int `json:"retention_days"`
+	// 展开 previous_response_id 时最多向前追溯的响应数
+	MaxChainDepth int `json:"max_chain_depth"`
+}
+
+// 默认配置
+var responsesStoreSetting = ResponsesStoreSetting{
+	Enabled:       false,
+	RetentionDays: 30,
+	MaxChainDepth: 100,
+}
+
+func init() {
+	// 注册到全局配置管理器
+	config.GlobalConfig.Register("responses_store_setting", &responsesStoreSetting)
+}
+
+func GetResponsesStoreSetting() *ResponsesStoreSetting {
+	return &responsesStoreSetting
+}
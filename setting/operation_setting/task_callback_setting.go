@@ -0,0 +1,28 @@
+package operation_setting
+
+import "github.com/QuantumNous/new-api/setting/config"
+
+type TaskCallbackSetting struct {
+	// 是否允许客户端提交异步任务时指定 callback_url，任务状态变化时回调
+	Enabled bool `json:"enabled"`
+	// 是否在支持的上游（可灵、Vidu、海螺）提交任务时附带回调地址，需正确配置服务器地址
+	UpstreamCallbackEnabled bool `json:"upstream_callback_enabled"`
+	// 等待上游回调的任务超过该时间（秒）未更新时仍会轮询，防止回调丢失
+	UpstreamFallbackPollSeconds int `json:"upstream_fallback_poll_seconds"`
+}
+
+// 默认配置
+var taskCallbackSetting = TaskCallbackSetting{
+	Enabled:                     true,
+	UpstreamCallbackEnabled:     false,
+	UpstreamFallbackPollSeconds: 300,
+}
+
+func init() {
+	// 注册到全局配置管理器
+	config.GlobalConfig.Register("task_callback_setting", &taskCallbackSetting)
+}
+
+func GetTaskCallbackSetting() *TaskCallbackSetting {
+	return &taskCallbackSetting
+}
@@ -0,0 +1,42 @@
+package operation_setting
+
+import "github.com/QuantumNous/new-api/setting/config"
+
+type TaskPollSetting struct {
+	// 任务的首次轮询间隔（秒），任务存在时间每翻一倍间隔也翻倍
+	BaseIntervalSeconds int `json:"base_interval_seconds"`
+	// 最大轮询间隔（秒）
+	MaxIntervalSeconds int `json:"max_interval_seconds"`
+	// 任务提交后超过该时间（秒）仍未完成则标记失败并退还额度，0 表示不超时
+	MaxAgeSeconds int `json:"max_age_seconds"`
+	// 领取任务后的租约时间（秒），节点中途退出时任务会在租约到期后被其他节点重新领取
+	LeaseSeconds int `json:"lease_seconds"`
+	// 每轮最多领取的任务数
+	BatchSize int `json:"batch_size"`
+	// 每个工作协程一次处理的任务数
+	TasksPerWorker int `json:"tasks_per_worker"`
+	// 每个平台、每个渠道在单个节点上同时运行的工作协程数
+	PlatformConcurrency int `json:"platform_concurrency"`
+	ChannelConcurrency  int `json:"channel_concurrency"`
+}
+
+// 默认配置
+var taskPollSetting = TaskPollSetting{
+	BaseIntervalSeconds: 15,
+	MaxIntervalSeconds:  300,
+	MaxAgeSeconds:       86400,
+	LeaseSeconds:        120,
+	BatchSize:           500,
+	TasksPerWorker:      20,
+	PlatformConcurrency: 4,
+	ChannelConcurrency:  2,
+}
+
+func init() {
+	// 注册到全局配置管理器
+	config.GlobalConfig.Register("task_poll_setting", &taskPollSetting)
+}
+
+func GetTaskPollSetting() *TaskPollSetting {
+	return &taskPollSetting
+}
@@ -0,0 +1,31 @@
+package operation_setting
+
+import "github.com/QuantumNous/new-api/setting/config"
+
+type TaskSettlementSetting struct {
+	// 任务成功后按上游返回的实际时长、分辨率或 tokens 重新计费，多退少补
+	RepriceEnabled bool `json:"reprice_enabled"`
+	// 每日对账，向管理员报告长时间未结束的任务
+	ReconcileEnabled bool `json:"reconcile_enabled"`
+	// 对账时间（0-23 点）
+	ReconcileHour int `json:"reconcile_hour"`
+	// 提交后超过该时间（秒）仍未结束的任务视为卡住
+	StuckSeconds int `json:"stuck_seconds"`
+}
+
+// 默认配置
+var taskSettlementSetting = TaskSettlementSetting{
+	RepriceEnabled:   true,
+	ReconcileEnabled: true,
+	ReconcileHour:    9,
+	StuckSeconds:     3600,
+}
+
+func init() {
+	// 注册到全局配置管理器
+	config.GlobalConfig.Register("task_settlement_setting", &taskSettlementSetting)
+}
+
+func GetTaskSettlementSetting() *TaskSettlementSetting {
+	return &taskSettlementSetting
+}
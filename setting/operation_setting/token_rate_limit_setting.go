@@ -0,0 +1,36 @@
+package operation_setting
+
+import "github.com/QuantumNous/new-api/setting/config"
+
+// TokenRateLimit 按 token 数与在途请求数的限流配置，0 表示不限制
+type TokenRateLimit struct {
+	TPM         int `json:"tpm"`
+	Concurrency int `json:"concurrency"`
+}
+
+type TokenRateLimitSetting struct {
+	Enabled bool `json:"enabled"`
+	// 按用户分组限流，对该分组内的每个用户分别计数
+	Groups map[string]TokenRateLimit `json:"groups"`
+	// 按模型限流，所有用户共享同一计数，用于对齐上游的 TPM/并发配额
+	Models map[string]TokenRateLimit `json:"models"`
+	// 并发名额的最长持有时间（秒），超时未释放的请求不再占用名额
+	ConcurrencyLeaseSeconds int `json:"concurrency_lease_seconds"`
+}
+
+// 默认配置
+var tokenRateLimitSetting = TokenRateLimitSetting{
+	Enabled:                 false,
+	Groups:                  map[string]TokenRateLimit{},
+	Models:                  map[string]TokenRateLimit{},
+	ConcurrencyLeaseSeconds: 900,
+}
+
+func init() {
+	// 注册到全局配置管理器
+	config.GlobalConfig.Register("token_rate_limit_setting", &tokenRateLimitSetting)
+}
+
+func GetTokenRateLimitSetting() *TokenRateLimitSetting {
+	return &tokenRateLimitSetting
+}
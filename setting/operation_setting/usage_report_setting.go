@@ -0,0 +1,33 @@
+package operation_setting
+
+import "github.com/QuantumNous/new-api/setting/config"
+
+type UsageReportSetting struct {
+	// 是否允许用户订阅用量报告
+	Enabled bool `json:"enabled"`
+	// 每天几点（服务器时区）之后发送上一周期的报告
+	SendHour int `json:"send_hour"`
+	// 发送给管理员的全站报告周期，可选 daily / weekly / monthly
+	AdminReportPeriods []string `json:"admin_report_periods"`
+	// 报告中列出的模型数与令牌数
+	TopModels int `json:"top_models"`
+	TopTokens int `json:"top_tokens"`
+}
+
+// 默认配置
+var usageReportSetting = UsageReportSetting{
+	Enabled:            false,
+	SendHour:           8,
+	AdminReportPeriods: []string{},
+	TopModels:          10,
+	TopTokens:          5,
+}
+
+func init() {
+	// 注册到全局配置管理器
+	config.GlobalConfig.Register("usage_report_setting", &usageReportSetting)
+}
+
+func GetUsageReportSetting() *UsageReportSetting {
+	return &usageReportSetting
+}
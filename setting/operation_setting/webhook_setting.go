@@ -0,0 +1,41 @@
+package operation_setting
+
+import "github.com/QuantumNous/new-api/setting/config"
+
+type WebhookSetting struct {
+	Enabled bool `json:"enabled"`
+	// 是否允许普通用户订阅自己的事件
+	UserSubscriptionEnabled bool `json:"user_subscription_enabled"`
+	// 每个用户最多可创建的订阅数
+	MaxSubscriptionsPerUser int `json:"max_subscriptions_per_user"`
+	// 最大投递次数，超过后标记为失败，可通过接口手动重新投递
+	MaxAttempts int `json:"max_attempts"`
+	// 重试间隔为 BaseBackoffSeconds * 2^(次数-1)，不超过 MaxBackoffSeconds
+	BaseBackoffSeconds int `json:"base_backoff_seconds"`
+	MaxBackoffSeconds  int `json:"max_backoff_seconds"`
+	// 单次投递超时时间（秒）
+	TimeoutSeconds int `json:"timeout_seconds"`
+	// 投递记录保留天数，0 表示不清理
+	RetentionDays int `json:"retention_days"`
+}
+
+// 默认配置
+var webhookSetting = WebhookSetting{
+	Enabled:                 true,
+	UserSubscriptionEnabled: true,
+	MaxSubscriptionsPerUser: 10,
+	MaxAttempts:             8,
+	BaseBackoffSeconds:      30,
+	MaxBackoffSeconds:       6 * 3600,
+	TimeoutSeconds:          10,
+	RetentionDays:           30,
+}
+
+func init() {
+	// 注册到全局配置管理器
+	config.GlobalConfig.Register("webhook_setting", &webhookSetting)
+}
+
+func GetWebhookSetting() *WebhookSetting {
+	return &webhookSetting
+}
@@ -0,0 +1,38 @@
+package system_setting
+
+import "github.com/QuantumNous/new-api/setting/config"
+
+type FileStorageSettings struct {
+	// 存储后端，local 或 s3，默认为本地磁盘
+	Backend string `json:"backend"`
+	// 本地存储目录
+	LocalPath string `json:"local_path"`
+	// S3 兼容对象存储（AWS S3、MinIO、R2 等）的接口地址，如 https://s3.us-east-1.amazonaws.com
+	S3Endpoint        string `json:"s3_endpoint"`
+	S3Region          string `json:"s3_region"`
+	S3Bucket          string `json:"s3_bucket"`
+	S3AccessKeyId     string `json:"s3_access_key_id"`
+	S3SecretAccessKey string `json:"s3_secret_access_key"`
+	// 使用路径方式访问存储桶（endpoint/bucket/key），MinIO 通常需要开启
+	S3PathStyle bool `json:"s3_path_style"`
+	// 单个上传文件的最大大小（MB）
+	MaxFileSizeMB int `json:"max_file_size_mb"`
+}
+
+// 默认配置
+var defaultFileStorageSettings = FileStorageSettings{
+	Backend:       "local",
+	LocalPath:     "data/files",
+	S3Region:      "us-east-1",
+	S3PathStyle:   true,
+	MaxFileSizeMB: 200,
+}
+
+func init() {
+	// 注册到全局配置管理器
+	config.GlobalConfig.Register("file_storage", &defaultFileStorageSettings)
+}
+
+func GetFileStorageSettings() *FileStorageSettings {
+	return &defaultFileStorageSettings
+}
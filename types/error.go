@@ -38,6 +38,8 @@ type ErrorCode string
 const (
 	ErrorCodeInvalidRequest         ErrorCode = "invalid_request"
 	ErrorCodeSensitiveWordsDetected ErrorCode = "sensitive_words_detected"
+	ErrorCodeContentPolicyViolation ErrorCode = "content_policy_violation"
+	ErrorCodeContentModerationError ErrorCode = "content_moderation_error"
 
 	// new api error
 	ErrorCodeCountTokenFailed   ErrorCode = "count_token_failed"
@@ -47,6 +49,7 @@ const (
 	ErrorCodeDoRequestFailed    ErrorCode = "do_request_failed"
 	ErrorCodeGetChannelFailed   ErrorCode = "get_channel_failed"
 	ErrorCodeGenRelayInfoFailed ErrorCode = "gen_relay_info_failed"
+	ErrorCodeChannelCircuitOpen ErrorCode = "channel_circuit_open" // 熔断不属于渠道错误，不会触发自动禁用
 
 	// channel error
 	ErrorCodeChannelNoAvailableKey        ErrorCode = "channel:no_available_key"
@@ -82,6 +85,11 @@ const (
 	// quota error
 	ErrorCodeInsufficientUserQuota      ErrorCode = "insufficient_user_quota"
 	ErrorCodePreConsumeTokenQuotaFailed ErrorCode = "pre_consume_token_quota_failed"
+	ErrorCodeQuotaBudgetExceeded        ErrorCode = "quota_budget_exceeded"
+
+	// rate limit error
+	ErrorCodeTPMLimitExceeded         ErrorCode = "tpm_limit_exceeded"
+	ErrorCodeConcurrencyLimitExceeded ErrorCode = "concurrency_limit_exceeded"
 )
 
 type NewAPIError struct {